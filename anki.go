@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// flashcard is a question and answer written in a note, either as
+//
+//	Q: question
+//	A: answer, possibly continuing on the following lines
+//
+// or on one line as "question :: answer".
+type flashcard struct {
+	GUID     string
+	Deck     string
+	Question string
+	Answer   string
+	Tags     []string
+	Source   string
+}
+
+// noteCards extracts the flashcards from a note. A card's GUID is derived
+// from the note's path and the question, so re-exporting doesn't duplicate
+// it in Anki.
+func noteCards(config *CONFIG, note *Note) []flashcard {
+	deck := note.Meta["deck"]
+	if deck == "" {
+		deck = config.AnkiDeck
+	}
+	var tags []string
+	for _, tag := range noteTags(note) {
+		tags = append(tags, strings.ReplaceAll(tag, "/", "::"))
+	}
+	key := visitKey(config, note.Path)
+
+	var cards []flashcard
+	add := func(q, a string) {
+		q, a = strings.TrimSpace(q), strings.TrimSpace(a)
+		if q == "" || a == "" {
+			return
+		}
+		sum := sha1.Sum([]byte(key + "\x00" + q))
+		cards = append(cards, flashcard{
+			GUID:     base64.RawURLEncoding.EncodeToString(sum[:9]),
+			Deck:     deck,
+			Question: q,
+			Answer:   a,
+			Tags:     tags,
+			Source:   key,
+		})
+	}
+
+	question, answer, inAnswer := "", []string(nil), false
+	finish := func() {
+		if inAnswer {
+			add(question, strings.Join(answer, "\n"))
+		}
+		question, answer, inAnswer = "", nil, false
+	}
+	for _, line := range strings.Split(stripCodeBlocks(withoutComments(note.Body)), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "Q:"):
+			finish()
+			question = strings.TrimPrefix(trimmed, "Q:")
+		case strings.HasPrefix(trimmed, "A:") && question != "":
+			inAnswer = true
+			answer = []string{strings.TrimPrefix(trimmed, "A:")}
+		case inAnswer && trimmed != "":
+			answer = append(answer, trimmed)
+		case trimmed == "":
+			finish()
+		case strings.Contains(trimmed, " :: "):
+			finish()
+			q, a, _ := strings.Cut(trimmed, " :: ")
+			add(strings.TrimLeft(q, "-* "), a)
+		}
+	}
+	finish()
+	return cards
+}
+
+func runAnki(config *CONFIG, args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: syt anki export [--format tsv|connect] [--send] [-o file] [--tag tag] [--where cond] [note...]")
+	}
+	fs := flag.NewFlagSet("anki export", flag.ContinueOnError)
+	format := fs.String("format", "tsv", "tsv for File > Import, or connect for an AnkiConnect payload")
+	send := fs.Bool("send", false, "post the cards to AnkiConnect instead of printing them")
+	out := fs.String("o", "", "output file (default stdout)")
+	filter := addNoteFilter(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var notes []*Note
+	if fs.NArg() == 0 {
+		all, err := vaultNotes(config, true)
+		if err != nil {
+			return err
+		}
+		notes = all
+	}
+	for _, arg := range fs.Args() {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			return err
+		}
+		note, err := readNote(path)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+	notes = filter.filter(notes)
+	var cards []flashcard
+	for _, note := range notes {
+		cards = append(cards, noteCards(config, note)...)
+	}
+	if len(cards) == 0 {
+		return fmt.Errorf("no flashcards found")
+	}
+
+	if *send {
+		return sendToAnki(config, cards)
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "tsv":
+		return writeAnkiTSV(w, cards)
+	case "connect":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ankiConnectRequest(cards))
+	}
+	return fmt.Errorf("unknown anki format %q", *format)
+}
+
+// writeAnkiTSV writes cards in Anki's text import format. The header lines
+// tell Anki which columns hold the GUID, deck and tags, so importing the
+// file again updates cards instead of duplicating them. (An .apkg would
+// need a SQLite database, which syt doesn't link.)
+func writeAnkiTSV(w io.Writer, cards []flashcard) error {
+	field := func(s string) string {
+		return strings.ReplaceAll(ankiHTML(s), "\t", " ")
+	}
+	var b strings.Builder
+	b.WriteString("#separator:tab\n#html:true\n#notetype:Basic\n#guid column:1\n#deck column:2\n#tags column:5\n")
+	for _, c := range cards {
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%s\n", c.GUID, strings.ReplaceAll(c.Deck, "\t", " "), field(c.Question), field(c.Answer), strings.Join(c.Tags, " "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ankiHTML renders card text as the HTML Anki fields hold.
+func ankiHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+type ankiNote struct {
+	DeckName  string            `json:"deckName"`
+	ModelName string            `json:"modelName"`
+	Fields    map[string]string `json:"fields"`
+	Tags      []string          `json:"tags"`
+	Options   map[string]any    `json:"options"`
+}
+
+type ankiRequest struct {
+	Action  string         `json:"action"`
+	Version int            `json:"version"`
+	Params  map[string]any `json:"params"`
+}
+
+// ankiConnectRequest builds an addNotes call. AnkiConnect has no GUID
+// parameter, so the GUID goes in as a tag and duplicates are refused.
+func ankiConnectRequest(cards []flashcard) ankiRequest {
+	notes := make([]ankiNote, len(cards))
+	for i, c := range cards {
+		notes[i] = ankiNote{
+			DeckName:  c.Deck,
+			ModelName: "Basic",
+			Fields:    map[string]string{"Front": ankiHTML(c.Question), "Back": ankiHTML(c.Answer)},
+			Tags:      append(append([]string{}, c.Tags...), "syt", "syt::"+c.GUID),
+			Options:   map[string]any{"allowDuplicate": false, "duplicateScope": "deck"},
+		}
+	}
+	return ankiRequest{Action: "addNotes", Version: 6, Params: map[string]any{"notes": notes}}
+}
+
+// sendToAnki posts the cards to a running AnkiConnect. Cards already in
+// Anki come back as errors from addNotes and are counted as skipped.
+func sendToAnki(config *CONFIG, cards []flashcard) error {
+	decks := map[string]bool{}
+	for _, c := range cards {
+		decks[c.Deck] = true
+	}
+	for deck := range decks {
+		if _, err := callAnkiConnect(config, ankiRequest{Action: "createDeck", Version: 6, Params: map[string]any{"deck": deck}}); err != nil {
+			return err
+		}
+	}
+	result, err := callAnkiConnect(config, ankiConnectRequest(cards))
+	if err != nil && !strings.Contains(err.Error(), "duplicate") {
+		return err
+	}
+	var ids []*int64
+	json.Unmarshal(result, &ids)
+	added := 0
+	for _, id := range ids {
+		if id != nil {
+			added++
+		}
+	}
+	fmt.Printf("Added %d card(s) to Anki, %d already there.\n", added, len(cards)-added)
+	return nil
+}
+
+func callAnkiConnect(config *CONFIG, req ankiRequest) (json.RawMessage, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(config.AnkiConnectURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("contacting AnkiConnect (is Anki running?): %w", err)
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *string         `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("reading AnkiConnect reply: %w", err)
+	}
+	if reply.Error != nil {
+		return reply.Result, fmt.Errorf("AnkiConnect %s: %s", req.Action, *reply.Error)
+	}
+	return reply.Result, nil
+}
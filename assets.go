@@ -0,0 +1,102 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// bundledAssets holds the templates, themes and shell completions shipped
+// inside the binary. `syt assets install` copies them out for editing.
+//
+//go:embed all:assets
+var bundledAssets embed.FS
+
+// assetsDir is where installed (and possibly customized) assets live.
+func assetsDir(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "assets")
+}
+
+// readAsset returns an installed asset if there is one, otherwise the copy
+// embedded in the binary.
+func readAsset(config *CONFIG, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(assetsDir(config), filepath.FromSlash(name)))
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return data, err
+	}
+	return bundledAssets.ReadFile("assets/" + name)
+}
+
+func runAssets(config *CONFIG, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listAssets(config)
+	}
+	if args[0] != "install" {
+		return fmt.Errorf("usage: syt assets [list | install [--dir dir] [--force]]")
+	}
+	flags := flag.NewFlagSet("assets install", flag.ContinueOnError)
+	dir := flags.String("dir", assetsDir(config), "directory to extract the assets into")
+	force := flags.Bool("force", false, "overwrite assets that were already installed")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	return installAssets(*dir, *force)
+}
+
+// listAssets prints every bundled asset and whether a customized copy is
+// installed.
+func listAssets(config *CONFIG) error {
+	return fs.WalkDir(bundledAssets, "assets", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := path[len("assets/"):]
+		status := "embedded"
+		if fileExists(filepath.Join(assetsDir(config), filepath.FromSlash(name))) {
+			status = "installed"
+		}
+		fmt.Printf("%-28s %s\n", name, status)
+		return nil
+	})
+}
+
+// installAssets extracts the bundled assets into dir. Existing files are
+// kept unless force is set, so reinstalling never clobbers customizations.
+func installAssets(dir string, force bool) error {
+	written, skipped := 0, 0
+	err := fs.WalkDir(bundledAssets, "assets", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(path[len("assets/"):]))
+		if fileExists(dest) && !force {
+			skipped++
+			return nil
+		}
+		data, err := bundledAssets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("installing assets: %w", err)
+	}
+	fmt.Printf("Installed %d asset(s) into %s", written, dir)
+	if skipped > 0 {
+		fmt.Printf(" (%d already present; use --force to overwrite)", skipped)
+	}
+	fmt.Println()
+	return nil
+}
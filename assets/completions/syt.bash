@@ -0,0 +1,33 @@
+# bash completion for syt; source this file from ~/.bashrc
+_syt() {
+  local cur=${COMP_WORDS[COMP_CWORD]}
+  if [ "$COMP_CWORD" -eq 1 ]; then
+    COMPREPLY=($(compgen -W "new list open last config help people map spell prose unfurl tags types lang today add daemon mount search recent unread subscribe rm undo assets due stress gc stats heatmap check sync publish export backup attach encrypt keys anki serve share tasks cal timeline history restore blame vault init clone sparse migrate" -- "$cur"))
+    return
+  fi
+  case ${COMP_WORDS[1]} in
+    tags) COMPREPLY=($(compgen -W "tree rename notes suggest" -- "$cur")) ;;
+    types) COMPREPLY=($(compgen -W "lint" -- "$cur")) ;;
+    map) COMPREPLY=($(compgen -W "export --format -o --tag --where" -- "$cur")) ;;
+    search) COMPREPLY=($(compgen -W "reindex --json --color --literal --tag -i -w -A -B -C" -- "$cur")) ;;
+    assets) COMPREPLY=($(compgen -W "list install" -- "$cur")) ;;
+    publish) COMPREPLY=($(compgen -W "confluence site queue" -- "$cur")) ;;
+    undo) COMPREPLY=($(compgen -W "--list" -- "$cur")) ;;
+    attach) COMPREPLY=($(compgen -W "list --preview" -- "$cur")) ;;
+    unread) COMPREPLY=($(compgen -W "--mark" -- "$cur")) ;;
+    history) COMPREPLY=($(compgen -W "-n --patch" -- "$cur")) ;;
+    restore) COMPREPLY=($(compgen -W "--at" -- "$cur")) ;;
+    backup) COMPREPLY=($(compgen -W "disk verify restore --delete --to --dry-run" -- "$cur")) ;;
+    vault) COMPREPLY=($(compgen -W "diff merge init unlock lock status -p --prefer --dry-run" -- "$cur")) ;;
+    keys) COMPREPLY=($(compgen -W "rotate --identity --dry-run" -- "$cur")) ;;
+    subscribe) COMPREPLY=($(compgen -W "--tag --remove" -- "$cur")) ;;
+    list) COMPREPLY=($(compgen -W "--sort --tag -r -n" -- "$cur")) ;;
+    sparse) COMPREPLY=($(compgen -W "list set add disable" -- "$cur")) ;;
+    clone) COMPREPLY=($(compgen -W "--sparse --depth --filter" -- "$cur")) ;;
+    export) COMPREPLY=($(compgen -W "--format -o --redact-profile --tag --where" -- "$cur")) ;;
+    sync) COMPREPLY=($(compgen -W "merge --force --pending --retry-failed --push --all --batch" -- "$cur")) ;;
+    config) COMPREPLY=($(compgen -W "show path edit get set" -- "$cur")) ;;
+    new) COMPREPLY=($(compgen -W "--type --template --tags -m --stdin --location --auto-tag --force" -- "$cur")) ;;
+  esac
+}
+complete -F _syt syt
@@ -0,0 +1,29 @@
+# fish completion for syt; copy to ~/.config/fish/completions/
+set -l commands new list open last config help people map spell prose unfurl tags types lang today add daemon mount search recent unread subscribe rm undo assets due stress gc stats heatmap check sync publish export backup attach encrypt keys anki serve share tasks cal timeline history restore blame vault init clone sparse migrate
+complete -c syt -f -n "not __fish_seen_subcommand_from $commands" -a "$commands"
+complete -c syt -f -n "__fish_seen_subcommand_from tags" -a "tree rename notes suggest"
+complete -c syt -f -n "__fish_seen_subcommand_from types" -a "lint"
+complete -c syt -f -n "__fish_seen_subcommand_from assets" -a "list install"
+complete -c syt -f -n "__fish_seen_subcommand_from search" -a "reindex"
+complete -c syt -n "__fish_seen_subcommand_from new" -l type -l template -l tags -s m -l stdin -l location -l auto-tag -l force
+complete -c syt -f -n "__fish_seen_subcommand_from sparse" -a "list set add disable"
+complete -c syt -f -n "__fish_seen_subcommand_from config" -a "show path edit get set"
+complete -c syt -f -n "__fish_seen_subcommand_from publish" -a "confluence site queue"
+complete -c syt -n "__fish_seen_subcommand_from list" -l sort -a "date name"
+complete -c syt -n "__fish_seen_subcommand_from list search" -l tag
+complete -c syt -n "__fish_seen_subcommand_from clone" -l sparse -l depth -l filter
+complete -c syt -n "__fish_seen_subcommand_from sync" -l force -l pending -l retry-failed -l push -l all -l batch
+complete -c syt -f -n "__fish_seen_subcommand_from sync" -a merge
+complete -c syt -n "__fish_seen_subcommand_from export anki map tasks" -l tag -l where
+complete -c syt -n "__fish_seen_subcommand_from export" -l format -a "zip html" -l redact-profile
+complete -c syt -n "__fish_seen_subcommand_from unread" -l mark
+complete -c syt -n "__fish_seen_subcommand_from subscribe" -l tag -l remove
+complete -c syt -n "__fish_seen_subcommand_from attach" -a list
+complete -c syt -n "__fish_seen_subcommand_from attach" -l preview -xa "auto always never"
+complete -c syt -n "__fish_seen_subcommand_from history" -s n -l patch
+complete -c syt -n "__fish_seen_subcommand_from restore" -l at
+complete -c syt -n "__fish_seen_subcommand_from backup" -a "disk verify restore"
+complete -c syt -n "__fish_seen_subcommand_from backup" -l delete -l to -l dry-run
+complete -c syt -n "__fish_seen_subcommand_from vault" -a "diff merge init unlock lock status"
+complete -c syt -n "__fish_seen_subcommand_from keys" -a rotate
+complete -c syt -n "__fish_seen_subcommand_from keys" -l identity -l dry-run
@@ -0,0 +1,144 @@
+// Service worker for the syt web UI. It keeps the app shell and recently
+// read notes available offline and queues captures made without a
+// connection, replaying them once the server can be reached again.
+
+const SHELL = "syt-shell-v1";
+const NOTES = "syt-notes-v1";
+const MAX_NOTES = 50;
+const shellFiles = ["./", "manifest.webmanifest", "icon.svg"];
+
+self.addEventListener("install", e => {
+  e.waitUntil(caches.open(SHELL).then(c => c.addAll(shellFiles)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener("activate", e => {
+  e.waitUntil(caches.keys()
+    .then(keys => Promise.all(keys.filter(k => k !== SHELL && k !== NOTES).map(k => caches.delete(k))))
+    .then(() => self.clients.claim()));
+});
+
+self.addEventListener("fetch", e => {
+  const url = new URL(e.request.url);
+  if (url.origin !== location.origin) return;
+  const path = url.pathname.slice(new URL(self.registration.scope).pathname.length);
+
+  if (path === "api/capture" && e.request.method === "POST") {
+    e.respondWith(capture(e.request));
+  } else if (e.request.method !== "GET" || path === "api/events") {
+    return;
+  } else if (path.startsWith("api/notes")) {
+    e.respondWith(networkFirst(e.request, NOTES));
+  } else if (!path.startsWith("api/")) {
+    e.respondWith(networkFirst(e.request, SHELL));
+  }
+});
+
+// networkFirst answers from the server when it can, caching what it gets,
+// and from the cache when it can't.
+async function networkFirst(request, cacheName) {
+  const cache = await caches.open(cacheName);
+  try {
+    const resp = await fetch(request);
+    if (resp.ok) {
+      await cache.put(request, resp.clone());
+      if (cacheName === NOTES) await trimNotes(cache);
+    }
+    return resp;
+  } catch (err) {
+    const cached = await cache.match(request);
+    if (cached) return cached;
+    throw err;
+  }
+}
+
+// trimNotes keeps only the most recently read notes (plus the list).
+async function trimNotes(cache) {
+  const keys = (await cache.keys()).filter(r => new URL(r.url).pathname.includes("/api/notes/"));
+  for (const old of keys.slice(0, Math.max(0, keys.length - MAX_NOTES))) await cache.delete(old);
+}
+
+// capture posts an entry, or queues it if the server is out of reach. The
+// entry is stamped with the time it was written, not the time it syncs.
+async function capture(request) {
+  const text = await request.clone().text();
+  let body = text;
+  if (!(request.headers.get("Content-Type") || "").startsWith("application/json")) {
+    body = JSON.stringify({ text, time: new Date().toISOString() });
+  }
+  const entry = { url: request.url, auth: request.headers.get("Authorization"), body };
+  try {
+    return await send(entry);
+  } catch (err) {
+    await queue("add", entry);
+    if (self.registration.sync) self.registration.sync.register("syt-capture").catch(() => {});
+    notify({ queued: await pending() });
+    return new Response(JSON.stringify({ queued: true }), { status: 202, headers: { "Content-Type": "application/json" } });
+  }
+}
+
+function send(entry) {
+  return fetch(entry.url, {
+    method: "POST",
+    headers: { Authorization: entry.auth, "Content-Type": "application/json" },
+    body: entry.body,
+  });
+}
+
+// flush replays queued captures in order, stopping at the first one the
+// server can't take yet. Entries the server rejects for good are dropped so
+// they can't block the queue.
+async function flush() {
+  for (const [key, entry] of await queue("list")) {
+    let resp;
+    try {
+      resp = await send(entry);
+    } catch (err) {
+      break;
+    }
+    if (resp.status === 429 || resp.status >= 500) break;
+    await queue("delete", key);
+  }
+  notify({ queued: await pending() });
+}
+
+self.addEventListener("sync", e => {
+  if (e.tag === "syt-capture") e.waitUntil(flush());
+});
+
+self.addEventListener("message", e => {
+  if (e.data === "flush") e.waitUntil(flush());
+});
+
+async function notify(msg) {
+  for (const client of await self.clients.matchAll()) client.postMessage(msg);
+}
+
+async function pending() {
+  return (await queue("list")).length;
+}
+
+// queue is a tiny IndexedDB store of captures waiting to be sent.
+function queue(op, arg) {
+  return new Promise((resolve, reject) => {
+    const open = indexedDB.open("syt", 1);
+    open.onupgradeneeded = () => open.result.createObjectStore("captures", { autoIncrement: true });
+    open.onerror = () => reject(open.error);
+    open.onsuccess = () => {
+      const tx = open.result.transaction("captures", op === "list" ? "readonly" : "readwrite");
+      const store = tx.objectStore("captures");
+      if (op === "add") store.add(arg);
+      if (op === "delete") store.delete(arg);
+      if (op === "list") {
+        const items = [];
+        store.openCursor().onsuccess = ev => {
+          const cur = ev.target.result;
+          if (cur) { items.push([cur.key, cur.value]); cur.continue(); }
+        };
+        tx.oncomplete = () => resolve(items);
+      } else {
+        tx.oncomplete = () => resolve();
+      }
+      tx.onerror = () => reject(tx.error);
+    };
+  });
+}
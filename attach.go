@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Attachment is what syt knows about a file a note links to, kept in the
+// state database by its path in the vault.
+type Attachment struct {
+	Mime    string    `json:"mime"`
+	Size    int64     `json:"size"`
+	Width   int       `json:"width,omitempty"`
+	Height  int       `json:"height,omitempty"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// attachmentLink matches markdown links and images.
+var attachmentLink = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// previewColumns is how wide image previews are drawn, in terminal cells.
+const previewColumns = 40
+
+// runAttach copies files into ATTACHMENTS_DIR and links them from a note,
+// or with list shows the files a note links to.
+func runAttach(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		return listAttachments(config, args[1:])
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: syt attach <note> <file>... | syt attach list [--preview auto|always|never] <note>")
+	}
+	path, err := resolveNote(config, args[0])
+	if err != nil {
+		if path, err = findNote(config, args[0]); err != nil {
+			return err
+		}
+	}
+
+	var links strings.Builder
+	for _, file := range args[1:] {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		dst, a, err := storeAttachment(config, filepath.Base(file), data)
+		if err != nil {
+			return err
+		}
+		link, err := attachmentMarkdown(path, dst, a)
+		if err != nil {
+			return err
+		}
+		links.WriteString(link + "\n")
+		fmt.Printf("Attached %s (%s, %s)\n", relNotePath(config.NotesDir, dst), a.Mime, formatSize(a.Size))
+	}
+	return appendNote(config, path, "\n"+links.String())
+}
+
+// storeAttachment saves data as name in ATTACHMENTS_DIR, under another name
+// if a different file has that one, and records its metadata.
+func storeAttachment(config *CONFIG, name string, data []byte) (string, *Attachment, error) {
+	dir := filepath.Join(config.NotesDir, config.AttachmentsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	dst := filepath.Join(dir, filepath.Base(name))
+	if existing, err := os.ReadFile(dst); err == nil && !bytes.Equal(existing, data) {
+		ext := filepath.Ext(dst)
+		dst = strings.TrimSuffix(dst, ext) + "_" + newID() + ext
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return "", nil, err
+	}
+	a, err := recordAttachment(config, dst)
+	return dst, a, err
+}
+
+// attachmentMarkdown links the attachment at dst from the note at path, as
+// an image when it is one.
+func attachmentMarkdown(path, dst string, a *Attachment) (string, error) {
+	rel, err := filepath.Rel(filepath.Dir(path), dst)
+	if err != nil {
+		return "", err
+	}
+	bang := ""
+	if a.Width > 0 {
+		bang = "!"
+	}
+	return fmt.Sprintf("%s[%s](%s)", bang, filepath.Base(dst), filepath.ToSlash(rel)), nil
+}
+
+func listAttachments(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("attach list", flag.ContinueOnError)
+	preview := fs.String("preview", "auto", "draw images in kitty or iTerm2: auto, always or never")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt attach list [--preview auto|always|never] <note>")
+	}
+	path, err := resolveNote(config, fs.Arg(0))
+	if err != nil {
+		if path, err = findNote(config, fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+	note, err := readNote(path)
+	if err != nil {
+		return err
+	}
+	protocol := ""
+	if *preview == "always" || (*preview == "auto" && isTerminal(os.Stdout)) {
+		protocol = graphicsProtocol()
+	}
+
+	files := noteAttachments(note)
+	if len(files) == 0 {
+		fmt.Println("No attachments.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, file := range files {
+		a, err := recordAttachment(config, file)
+		if err != nil {
+			fmt.Fprintf(w, "%s\tmissing\n", relNotePath(config.NotesDir, file))
+			continue
+		}
+		dims := "-"
+		if a.Width > 0 {
+			dims = fmt.Sprintf("%dx%d", a.Width, a.Height)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", relNotePath(config.NotesDir, file), a.Mime, formatSize(a.Size), dims, a.SHA256[:12])
+		if protocol != "" && a.Width > 0 {
+			w.Flush()
+			if err := drawImage(protocol, file); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not preview %s: %v\n", filepath.Base(file), err)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// noteAttachments returns the local files a note links to, other than notes,
+// in the order they appear.
+func noteAttachments(note *Note) []string {
+	seen := map[string]bool{}
+	var files []string
+	for _, m := range attachmentLink.FindAllStringSubmatch(withoutComments(note.Body), -1) {
+		target, _, _ := strings.Cut(m[2], "#")
+		if target == "" || strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:") || strings.HasSuffix(target, ".md") {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(note.Path), filepath.FromSlash(target))
+		}
+		if !seen[target] {
+			seen[target] = true
+			files = append(files, target)
+		}
+	}
+	return files
+}
+
+// recordAttachment returns the metadata of the file at path, working it out
+// and storing it in the state database when the file is new or changed
+// since it was last looked at.
+func recordAttachment(config *CONFIG, path string) (*Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	key := visitKey(config, path)
+	state, err := loadState(config)
+	if err != nil {
+		return nil, err
+	}
+	if a := state.Attachments[key]; a != nil && a.Size == info.Size() && a.ModTime.Equal(info.ModTime()) {
+		return a, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	a := &Attachment{Size: info.Size(), ModTime: info.ModTime(), SHA256: hex.EncodeToString(sum[:])}
+	if a.Mime = mime.TypeByExtension(filepath.Ext(path)); a.Mime == "" {
+		a.Mime = http.DetectContentType(data)
+	}
+	a.Mime, _, _ = strings.Cut(a.Mime, ";")
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		a.Width, a.Height = cfg.Width, cfg.Height
+	}
+	err = updateState(config, func(s *State) error {
+		if s.Attachments == nil {
+			s.Attachments = map[string]*Attachment{}
+		}
+		s.Attachments[key] = a
+		return nil
+	})
+	return a, err
+}
+
+// graphicsProtocol names the inline image protocol the terminal speaks,
+// kitty or iterm, or "" when it has none syt knows.
+func graphicsProtocol() string {
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty" || os.Getenv("TERM_PROGRAM") == "ghostty":
+		return "kitty"
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return "iterm"
+	}
+	return ""
+}
+
+// drawImage writes the image at path to the terminal, previewColumns wide.
+// Kitty is sent PNG, so other formats are converted first; iTerm2 takes the
+// file as it is.
+func drawImage(protocol, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if protocol == "iterm" {
+		fmt.Printf("\x1b]1337;File=inline=1;size=%d;width=%d;name=%s:%s\a\n", len(data), previewColumns,
+			base64.StdEncoding.EncodeToString([]byte(filepath.Base(path))), base64.StdEncoding.EncodeToString(data))
+		return nil
+	}
+
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "png" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	// Kitty takes the data in chunks of at most 4096 bytes, m=1 on all but
+	// the last
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for first := true; encoded != ""; first = false {
+		chunk := encoded[:min(4096, len(encoded))]
+		encoded = encoded[len(chunk):]
+		more := 0
+		if encoded != "" {
+			more = 1
+		}
+		if first {
+			fmt.Printf("\x1b_Ga=T,f=100,c=%d,m=%d;%s\x1b\\", previewColumns, more, chunk)
+		} else {
+			fmt.Printf("\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	fmt.Println()
+	return nil
+}
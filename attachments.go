@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// imageLine matches a markdown image on a line of its own, which becomes an
+// image block on Notion.
+var imageLine = regexp.MustCompile(`^!\[([^\]]*)\]\(([^)\s]+)(?:\s+"[^"]*")?\)$`)
+
+// remoteImage reports whether src already points somewhere Notion can reach.
+func remoteImage(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "file_upload:")
+}
+
+// resolveImages uploads the local images a note's blocks refer to and points
+// the blocks at the uploaded copies. Uploads are remembered by content, so
+// an unchanged image is only uploaded once. Images that can't be found keep
+// their markdown as a paragraph.
+func resolveImages(config *CONFIG, api notionAPI, note *Note, blocks []notionBlock) ([]notionBlock, error) {
+	state, err := loadState(config)
+	if err != nil {
+		return nil, err
+	}
+	upload := imageUploader(config, api)
+	for i, b := range blocks {
+		if b.Type != "image" || remoteImage(b.Text) {
+			continue
+		}
+		path, err := notesImage(config, note, b.Text)
+		var content []byte
+		if err == nil {
+			content, err = os.ReadFile(path)
+		}
+		if err != nil {
+			log.Printf("Could not attach image %s: %v", b.Text, err)
+			blocks[i] = notionBlock{Type: "paragraph", Text: fmt.Sprintf("![%s](%s)", b.Caption, b.Text)}
+			continue
+		}
+		sum := sha1.Sum(content)
+		key := hex.EncodeToString(sum[:])
+		url := state.Uploads[key]
+		if url == "" {
+			if url, err = upload(path); err != nil {
+				return nil, fmt.Errorf("uploading %s: %w", b.Text, err)
+			}
+			err = updateState(config, func(s *State) error {
+				if s.Uploads == nil {
+					s.Uploads = map[string]string{}
+				}
+				s.Uploads[key] = url
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		blocks[i].Text = url
+	}
+	return blocks, nil
+}
+
+// notesImage resolves an image link in note to the file it names, symlinks
+// followed. Only files inside the notes directory are uploaded; a link to
+// anywhere else is left as text.
+func notesImage(config *CONFIG, note *Note, link string) (string, error) {
+	path := filepath.FromSlash(link)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(note.Path), path)
+	}
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(config.NotesDir)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside the notes directory", path)
+	}
+	return path, nil
+}
+
+// imageUploader picks where images go: an IMAGE_UPLOAD_COMMAND that prints
+// the URL it stored the file at, an IMAGE_UPLOAD_URL accepting multipart
+// POSTs, or otherwise Notion's own file uploads.
+func imageUploader(config *CONFIG, api notionAPI) func(path string) (string, error) {
+	switch {
+	case config.ImageUploadCommand != "":
+		return func(path string) (string, error) {
+			fields := strings.Fields(config.ImageUploadCommand)
+			out, err := exec.Command(fields[0], append(fields[1:], path)...).Output()
+			if err != nil {
+				return "", fmt.Errorf("image upload command: %w", err)
+			}
+			return uploadedURL(out)
+		}
+	case config.ImageUploadURL != "":
+		return func(path string) (string, error) {
+			return postImage(config.ImageUploadURL, path)
+		}
+	}
+	return func(path string) (string, error) {
+		id, err := api.uploadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return "file_upload:" + id, nil
+	}
+}
+
+// postImage sends path as the "file" field of a multipart form.
+func postImage(endpoint, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Post(endpoint, form.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("image host returned %s", resp.Status)
+	}
+	return uploadedURL(out)
+}
+
+// uploadedURL reads the URL an image host replied with, either as plain
+// text or as a JSON object with a "url" field.
+func uploadedURL(out []byte) (string, error) {
+	var reply struct {
+		URL string `json:"url"`
+	}
+	url := strings.TrimSpace(string(out))
+	if json.Unmarshal(out, &reply) == nil && reply.URL != "" {
+		url = reply.URL
+	}
+	if !remoteImage(url) {
+		return "", fmt.Errorf("image host did not return a URL: %q", abbreviate(url))
+	}
+	return url, nil
+}
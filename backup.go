@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupDirName is the directory a disk backup goes into on the drive.
+const backupDirName = "syt-backup"
+
+// backupManifestName is the file in a backup listing what it holds.
+const backupManifestName = ".syt-backup.json"
+
+// backupManifest records every file in a disk backup with the size and
+// modification time it had in the vault and its checksum, so the next run
+// copies only what changed and verify can tell a damaged copy.
+type backupManifest struct {
+	Updated time.Time              `json:"updated"`
+	Files   map[string]*backupFile `json:"files"`
+}
+
+type backupFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// runBackup copies the vault, its git history included, to a drive, or
+// checks or restores such a copy:
+//
+//	syt backup disk [--delete] /mnt/usb
+//	syt backup verify /mnt/usb
+//	syt backup restore [--to dir] [--dry-run] /mnt/usb
+//
+// The copy goes into syt-backup on the drive. Only files that changed since
+// the last backup are copied, each read back and checked against its
+// checksum afterwards; files deleted from the vault stay in the backup
+// unless --delete is given. With VAULT_CONTAINER it is the sealed container
+// that is backed up, never the decrypted working copy.
+func runBackup(config *CONFIG, args []string) error {
+	usage := fmt.Errorf("usage: syt backup disk [--delete] <dir> | syt backup verify <dir> | syt backup restore [--to dir] [--dry-run] <dir>")
+	if len(args) == 0 {
+		return usage
+	}
+	fs := flag.NewFlagSet("backup "+args[0], flag.ContinueOnError)
+	del := fs.Bool("delete", false, "remove files from the backup that are gone from the vault")
+	source := backupSource(config)
+	to := fs.String("to", source, "restore into this directory")
+	dryRun := fs.Bool("dry-run", false, "show what restoring would change")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usage
+	}
+	if info, err := os.Stat(fs.Arg(0)); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", fs.Arg(0))
+	}
+	dir, err := filepath.Abs(filepath.Join(fs.Arg(0), backupDirName))
+	if err != nil {
+		return err
+	}
+	for _, notes := range []string{config.NotesDir, source} {
+		if notes, err := filepath.Abs(notes); err == nil && strings.HasPrefix(dir, notes+string(filepath.Separator)) {
+			return fmt.Errorf("the backup can't go inside the vault")
+		}
+	}
+	switch args[0] {
+	case "disk":
+		return backupToDisk(config, source, dir, *del)
+	case "verify":
+		return verifyBackup(dir)
+	case "restore":
+		// Sealing the working copy afterwards would undo the restore
+		if config.VaultContainer != "" && *to == source && !*dryRun && vaultUnlocked(config) {
+			return codeErrorf(ErrUsage, "lock the vault before restoring the container")
+		}
+		return restoreBackup(config, dir, *to, *dryRun)
+	}
+	return usage
+}
+
+// backupSource is the directory backed up: the vault, or the container an
+// encrypted vault is sealed in.
+func backupSource(config *CONFIG) string {
+	if config.VaultContainer != "" {
+		return config.VaultContainer
+	}
+	return config.NotesDir
+}
+
+func backupToDisk(config *CONFIG, source, dir string, del bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	m, err := loadBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	copied, unchanged, removed := 0, 0, 0
+	var bytes int64
+	seen := map[string]bool{}
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Locks and half-written temporary files aren't worth keeping, and
+		// an unlocked vault's session holds its key
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), ".lock") || (strings.HasPrefix(d.Name(), ".") && strings.Contains(d.Name(), ".tmp")) || strings.HasPrefix(d.Name(), vaultSessionName) {
+			return nil
+		}
+		rel := relNotePath(source, path)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if f := m.Files[rel]; f != nil && f.Size == info.Size() && f.ModTime.Equal(info.ModTime()) {
+			if copy, err := os.Stat(dst); err == nil && copy.Size() == f.Size && copy.ModTime().Equal(f.ModTime) {
+				unchanged++
+				return nil
+			}
+		}
+		sum, err := copyVerified(path, dst, info.ModTime())
+		if err != nil {
+			return fmt.Errorf("backing up %s: %w", rel, err)
+		}
+		m.Files[rel] = &backupFile{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum}
+		copied++
+		bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		// Keep the record of what did get copied
+		saveBackupManifest(dir, m)
+		return err
+	}
+	if del {
+		for rel := range m.Files {
+			if seen[rel] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(m.Files, rel)
+			removed++
+		}
+	}
+	m.Updated = currentTime()
+	if err := saveBackupManifest(dir, m); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up to %s: %d file(s) copied and verified (%s), %d unchanged", dir, copied, formatSize(bytes), unchanged)
+	if del {
+		fmt.Printf(", %d removed", removed)
+	}
+	fmt.Println(".")
+	return nil
+}
+
+// copyVerified copies src to dst through a temporary file, reads the copy
+// back to check it matches and returns its checksum.
+func copyVerified(src, dst string, mtime time.Time) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), in); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	// The drive may be pulled right after; don't trust its cache
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	want := hex.EncodeToString(h.Sum(nil))
+	if got, err := fileSHA256(tmp.Name()); err != nil {
+		return "", err
+	} else if got != want {
+		return "", fmt.Errorf("the copy doesn't match (checksum %s, want %s)", got[:12], want[:12])
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+		return "", err
+	}
+	return want, os.Rename(tmp.Name(), dst)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyBackup checks every file in the backup against its checksum. Bad
+// copies are dropped from the manifest, so the next backup makes them again.
+func verifyBackup(dir string) error {
+	m, err := loadBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	if len(m.Files) == 0 {
+		return fmt.Errorf("no backup in %s", dir)
+	}
+	var bad []string
+	for _, rel := range sortedKeys(m.Files) {
+		sum, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(rel)))
+		switch {
+		case err != nil:
+			fmt.Printf("missing  %s\n", rel)
+			bad = append(bad, rel)
+		case sum != m.Files[rel].SHA256:
+			fmt.Printf("damaged  %s\n", rel)
+			bad = append(bad, rel)
+		}
+	}
+	if len(bad) > 0 {
+		total := len(m.Files)
+		for _, rel := range bad {
+			delete(m.Files, rel)
+		}
+		if err := saveBackupManifest(dir, m); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d of %d file(s) in the backup failed verification; run syt backup disk to copy them again", len(bad), total)
+	}
+	fmt.Printf("All %d file(s) verified (backup of %s).\n", len(m.Files), m.Updated.Format("2006-01-02 15:04"))
+	return nil
+}
+
+// restoreBackup copies the files in the backup that differ from what is in
+// to back there, each verified against its checksum first. Files only in
+// to are left alone.
+func restoreBackup(config *CONFIG, dir, to string, dryRun bool) error {
+	m, err := loadBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	if len(m.Files) == 0 {
+		return fmt.Errorf("no backup in %s", dir)
+	}
+	var restore, overwrite []string
+	for _, rel := range sortedKeys(m.Files) {
+		dst := filepath.Join(to, filepath.FromSlash(rel))
+		if !fileExists(dst) {
+			restore = append(restore, rel)
+		} else if sum, err := fileSHA256(dst); err != nil || sum != m.Files[rel].SHA256 {
+			restore = append(restore, rel)
+			overwrite = append(overwrite, rel)
+		}
+	}
+	if len(restore) == 0 {
+		fmt.Printf("%s already matches the backup.\n", to)
+		return nil
+	}
+	for _, rel := range restore {
+		mark := "+"
+		if containsString(overwrite, rel) {
+			mark = "M"
+		}
+		fmt.Printf("%s %s\n", mark, rel)
+	}
+	if dryRun {
+		fmt.Printf("%d file(s) would be restored, %d of them overwritten.\n", len(restore), len(overwrite))
+		return nil
+	}
+	// A damaged backup restores nothing rather than part of the vault
+	for _, rel := range restore {
+		if sum, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(rel))); err != nil || sum != m.Files[rel].SHA256 {
+			return fmt.Errorf("%s is damaged in the backup; nothing restored", rel)
+		}
+	}
+	if err := confirm(config, "Overwrite with the backup", len(overwrite)); err != nil {
+		return err
+	}
+	for _, rel := range restore {
+		f := m.Files[rel]
+		src := filepath.Join(dir, filepath.FromSlash(rel))
+		if _, err := copyVerified(src, filepath.Join(to, filepath.FromSlash(rel)), f.ModTime); err != nil {
+			return fmt.Errorf("restoring %s: %w", rel, err)
+		}
+	}
+	fmt.Printf("Restored %d file(s) into %s.\n", len(restore), to)
+	return nil
+}
+
+func loadBackupManifest(dir string) (*backupManifest, error) {
+	m := &backupManifest{Files: map[string]*backupFile{}}
+	data, err := os.ReadFile(filepath.Join(dir, backupManifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("corrupt backup manifest in %s: %w", dir, err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]*backupFile{}
+	}
+	return m, nil
+}
+
+func saveBackupManifest(dir string, m *backupManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, backupManifestName), data)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
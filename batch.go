@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// changedNotes lists the notes git sees as changed in the notes directory:
+// modified or new ones, and deleted ones apart.
+func changedNotes(config *CONFIG) (changed, deleted []string, err error) {
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		return nil, nil, withCode(ErrGitFailed, err)
+	}
+	dir, err := filepath.Abs(config.NotesDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := gitOutput(root, "status", "--porcelain", "-z", "--untracked-files=all", "--no-renames", "--", dir)
+	if err != nil {
+		return nil, nil, withCode(ErrGitFailed, err)
+	}
+	for _, entry := range strings.Split(out, "\x00") {
+		if len(entry) < 4 {
+			continue
+		}
+		status, file := entry[:2], entry[3:]
+		path := filepath.Join(root, filepath.FromSlash(file))
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		// Only notes, leaving out hidden directories such as .syt
+		if _, err := noteRelPath(filepath.ToSlash(rel)); err != nil || isCommentsSidecar(path) {
+			continue
+		}
+		if strings.Contains(status, "D") {
+			deleted = append(deleted, path)
+		} else {
+			changed = append(changed, path)
+		}
+	}
+	return changed, deleted, nil
+}
+
+// commitBatch commits the notes, including deletions, in one commit whose
+// message lists them, and pushes it like a single note's commit.
+func commitBatch(config *CONFIG, paths []string) error {
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		if root, err = setUpGitRepo(config); err != nil {
+			return err
+		}
+	}
+	var files, lines []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if out, err := gitOutput(root, "status", "--porcelain", "--", abs); err == nil && strings.TrimSpace(out) == "" {
+			continue
+		}
+		files = append(files, abs)
+		line := "- " + relNotePath(config.NotesDir, path)
+		if note, err := readNote(path); err != nil {
+			line += " (deleted)"
+		} else if title := note.Meta["title"]; title != "" {
+			line += " (" + title + ")"
+		}
+		lines = append(lines, line)
+	}
+	if len(files) == 0 {
+		fmt.Println("Nothing to commit.")
+		return nil
+	}
+
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLockWait(filepath.Join(stateDir(config), "sync.lock"), syncLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := runCmd("git", append([]string{"-C", root, "add", "-A", "--"}, files...)...); err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	subject := fmt.Sprintf("Update %d notes", len(files))
+	if len(files) == 1 {
+		subject = "Update 1 note"
+	}
+	args := []string{"-C", root, "commit", "-q", "-m", subject, "-m", strings.Join(lines, "\n"), "--"}
+	if err := runCmd("git", append(args, files...)...); err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	fmt.Printf("Committed %d note(s) together.\n", len(files))
+	if config.GitSquashWindow == "" {
+		if err := gitPush(config, root); err != nil {
+			return err
+		}
+	}
+	countPushed(files...)
+	return saveUploaded(config)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runBlame prints a note with a gutter giving the date each paragraph was
+// last changed, taken from git blame, to show which parts of a long-lived
+// note have gone stale. Paragraphs older than --stale are marked.
+func runBlame(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("blame", flag.ContinueOnError)
+	stale := fs.String("stale", "180d", "mark paragraphs unchanged for this long (0 to mark none)")
+	color := fs.String("color", "auto", "color stale paragraphs: auto, always or never")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt blame [--stale 180d] [--color auto|always|never] <note>")
+	}
+	staleAfter, err := parseRetention(*stale)
+	if err != nil {
+		return withCode(ErrUsage, err)
+	}
+	path, err := resolveNote(config, fs.Arg(0))
+	if err != nil {
+		if path, err = findNote(config, fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+	lines, changed, err := blameLines(path)
+	if err != nil {
+		return err
+	}
+
+	paint := useColor(*color, config.Accessible)
+	bar := "│"
+	if config.Accessible {
+		bar = "|"
+	}
+	now := currentTime()
+	for _, p := range paragraphs(lines) {
+		var last time.Time
+		edited := false
+		for _, t := range changed[p.start:p.end] {
+			edited = edited || t.IsZero()
+			if t.After(last) {
+				last = t
+			}
+		}
+		label := last.Format("2006-01-02")
+		if edited {
+			label = "uncommitted"
+		}
+		old := staleAfter > 0 && !edited && now.Sub(last) > staleAfter
+		mark := " "
+		if old {
+			mark = "!"
+		}
+		for i, line := range lines[p.start:p.end] {
+			gutter := fmt.Sprintf("%-11s %s", label, mark)
+			if i > 0 {
+				gutter = strings.Repeat(" ", len(gutter))
+			}
+			if old && paint {
+				gutter = "\x1b[33m" + gutter + "\x1b[0m"
+			}
+			fmt.Printf("%s %s %s\n", gutter, bar, line)
+		}
+	}
+	return nil
+}
+
+// blameLines returns the note's lines and when git last saw each change.
+// Lines not committed yet have a zero time.
+func blameLines(path string) ([]string, []time.Time, error) {
+	root, err := gitRepoRoot(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, withCode(ErrGitFailed, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := gitOutput(root, "blame", "--line-porcelain", "--", abs)
+	if err != nil {
+		return nil, nil, withCode(ErrGitFailed, err)
+	}
+
+	var lines []string
+	var changed []time.Time
+	var when time.Time
+	uncommitted := false
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			lines = append(lines, line[1:])
+			if uncommitted {
+				changed = append(changed, time.Time{})
+			} else {
+				changed = append(changed, when)
+			}
+		case strings.HasPrefix(line, "author-time "):
+			sec, _ := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+			when = time.Unix(sec, 0)
+		default:
+			// Each entry starts with the commit hash, all zeros for lines only
+			// in the work tree
+			if hash, _, ok := strings.Cut(line, " "); ok && len(hash) == 40 {
+				uncommitted = strings.Trim(hash, "0") == ""
+			}
+		}
+	}
+	return lines, changed, nil
+}
+
+// paragraph is a run of lines, lines[start:end].
+type paragraph struct{ start, end int }
+
+// paragraphs splits lines into paragraphs at blank lines; a blank line
+// belongs to the paragraph before it, and the frontmatter counts as one.
+func paragraphs(lines []string) []paragraph {
+	var out []paragraph
+	start, inFence := 0, false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if i == 0 && trimmed == "---" {
+			for j := 1; j < len(lines); j++ {
+				if strings.TrimSpace(lines[j]) == "---" {
+					out = append(out, paragraph{0, j + 1})
+					start = j + 1
+					break
+				}
+			}
+		}
+		if i < start {
+			continue
+		}
+		if trimmed == "" && !inFence {
+			out = append(out, paragraph{start, i + 1})
+			start = i + 1
+		}
+	}
+	if start < len(lines) {
+		out = append(out, paragraph{start, len(lines)})
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Budgets keep syncing within what a metered connection or a rate-limited
+// workspace can take: UPLOAD_BUDGET_MB bounds what the backends send in a
+// day and NOTION_CALL_BUDGET the Notion requests one run makes, a run
+// being a command or, in the daemon, one round of watching or publishing. A
+// push that would go over is deferred: it is recorded as failed with
+// BudgetExceeded, and `syt sync --retry-failed` (or the resume offered at
+// the next start) sends it once there is budget again.
+
+// UploadBudget is what today's syncs have sent, in bytes.
+type UploadBudget struct {
+	Day   string `json:"day"`
+	Bytes int64  `json:"bytes"`
+}
+
+var (
+	// notionCalls counts the Notion requests made by this run.
+	notionCalls atomic.Int64
+	// uploadedBytes counts what the backends sent since the total in the
+	// state database was last brought up to date.
+	uploadedBytes atomic.Int64
+)
+
+// checkBudget returns an ErrBudgetExceeded error when pushing the note to
+// the backend would go over a budget.
+func checkBudget(config *CONFIG, backend, notePath string) error {
+	if backend == "notion" && config.NotionCallBudget > 0 && notionCalls.Load() >= int64(config.NotionCallBudget) {
+		return codeErrorf(ErrBudgetExceeded, "deferred: the budget of %d Notion calls per run is used up", config.NotionCallBudget)
+	}
+	if config.UploadBudgetMB <= 0 || backend == "format" || backend == "lint" {
+		return nil
+	}
+	info, err := os.Stat(notePath)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	used := uploadedBytes.Load()
+	if b := state.Upload; b != nil && b.Day == currentTime().Format("2006-01-02") {
+		used += b.Bytes
+	}
+	if used+info.Size() > int64(config.UploadBudgetMB)<<20 {
+		return codeErrorf(ErrBudgetExceeded, "deferred: %s of today's %d MB upload budget is used", formatSize(used), config.UploadBudgetMB)
+	}
+	return nil
+}
+
+// startRun begins a run, with the whole NOTION_CALL_BUDGET to spend.
+func startRun() {
+	notionCalls.Store(0)
+}
+
+// reserveNotionCalls defers a note whose n Notion requests won't fit in what
+// is left of NOTION_CALL_BUDGET, so notes are synced whole rather than
+// stopping part way.
+func reserveNotionCalls(config *CONFIG, n int) error {
+	if used := notionCalls.Load(); config.NotionCallBudget > 0 && used+int64(n) > int64(config.NotionCallBudget) {
+		return codeErrorf(ErrBudgetExceeded, "deferred: the note needs %d Notion calls and %d of the %d per run are left", n, max(int64(config.NotionCallBudget)-used, 0), config.NotionCallBudget)
+	}
+	return nil
+}
+
+// notionCallAllowed counts a Notion request against NOTION_CALL_BUDGET, so
+// a note whose upload takes the last of it stops part way rather than
+// sending more.
+func notionCallAllowed(config *CONFIG) error {
+	if n := notionCalls.Add(1); config.NotionCallBudget > 0 && n > int64(config.NotionCallBudget) {
+		return codeErrorf(ErrBudgetExceeded, "the budget of %d Notion calls per run is used up", config.NotionCallBudget)
+	}
+	return nil
+}
+
+// saveUploaded adds what was sent since the last call to today's total.
+func saveUploaded(config *CONFIG) error {
+	n := uploadedBytes.Swap(0)
+	if n == 0 {
+		return nil
+	}
+	today := currentTime().Format("2006-01-02")
+	return updateState(config, func(s *State) error {
+		if s.Upload == nil || s.Upload.Day != today {
+			s.Upload = &UploadBudget{Day: today}
+		}
+		s.Upload.Bytes += n
+		return nil
+	})
+}
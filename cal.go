@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCal prints a month calendar with the days that have notes marked. With
+// -i it then asks for a day and opens that day's notes.
+func runCal(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("cal", flag.ContinueOnError)
+	interactive := fs.Bool("i", false, "pick a day afterwards and open its notes")
+	color := fs.String("color", "auto", "highlight days: auto, always or never")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	month, err := parseMonth(strings.Join(fs.Args(), " "), currentTime())
+	if err != nil {
+		return err
+	}
+
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return err
+	}
+	byDay := map[int][]*Note{}
+	for _, note := range notes {
+		d := noteDate(note)
+		if d.Year() == month.Year() && d.Month() == month.Month() {
+			byDay[d.Day()] = append(byDay[d.Day()], note)
+		}
+	}
+	for _, list := range byDay {
+		sort.Slice(list, func(i, j int) bool { return noteDate(list[i]).Before(noteDate(list[j])) })
+	}
+
+	if config.Accessible {
+		printCalSummary(month, byDay)
+	} else {
+		printCal(month, byDay, useColor(*color, config.Accessible))
+	}
+	if !*interactive {
+		return nil
+	}
+	return pickCalDay(config, month, byDay)
+}
+
+// parseMonth reads "2024-05", "5", "may" or "May 2024"; empty means the
+// month of now.
+func parseMonth(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	first := func(y int, m time.Month) time.Time { return time.Date(y, m, 1, 0, 0, 0, 0, now.Location()) }
+	if s == "" {
+		return first(now.Year(), now.Month()), nil
+	}
+	for _, layout := range []string{"2006-01", "January 2006", "Jan 2006", "2006/01"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= 12 {
+		return first(now.Year(), time.Month(n)), nil
+	}
+	for m := time.January; m <= time.December; m++ {
+		if strings.EqualFold(s, m.String()) || strings.EqualFold(s, m.String()[:3]) {
+			return first(now.Year(), m), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown month %q (want e.g. 2024-05 or may)", s)
+}
+
+// printCal lays the month out in weeks starting on Monday. Days with notes
+// are bold or, without color, starred; today is shown in reverse video or
+// brackets.
+func printCal(month time.Time, byDay map[int][]*Note, color bool) {
+	now := currentTime()
+	title := month.Format("January 2006")
+	fmt.Printf("%*s\n", (28+len(title))/2, title)
+	fmt.Println(" Mo  Tu  We  Th  Fr  Sa  Su")
+	offset := (int(month.Weekday()) + 6) % 7
+	fmt.Print(strings.Repeat("    ", offset))
+	last := month.AddDate(0, 1, -1).Day()
+	for day := 1; day <= last; day++ {
+		today := now.Year() == month.Year() && now.Month() == month.Month() && now.Day() == day
+		has := len(byDay[day]) > 0
+		cell := fmt.Sprintf("%2d", day)
+		switch {
+		case color && today:
+			cell = " \x1b[7m" + cell + colorReset + " "
+		case color && has:
+			cell = " \x1b[1;32m" + cell + colorReset + " "
+		case today:
+			cell = "[" + cell + "]"
+		case has:
+			cell = " " + cell + "*"
+		default:
+			cell = " " + cell + " "
+		}
+		fmt.Print(cell)
+		if (offset+day)%7 == 0 || day == last {
+			fmt.Println()
+		}
+	}
+	total := 0
+	for _, list := range byDay {
+		total += len(list)
+	}
+	fmt.Printf("\n%d note(s) this month\n", total)
+}
+
+// printCalSummary lists the days with notes, for screen readers.
+func printCalSummary(month time.Time, byDay map[int][]*Note) {
+	var days []int
+	for day := range byDay {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	if len(days) == 0 {
+		fmt.Printf("%s: no notes\n", month.Format("January 2006"))
+		return
+	}
+	for _, day := range days {
+		fmt.Printf("%s: %d note(s)\n", month.AddDate(0, 0, day-1).Format("Monday 2 January"), len(byDay[day]))
+	}
+}
+
+// pickCalDay asks for a day of the month and opens its notes, one after the
+// other, choosing between them when there are several.
+func pickCalDay(config *CONFIG, month time.Time, byDay map[int][]*Note) error {
+	reader := bufio.NewReader(os.Stdin)
+	last := month.AddDate(0, 1, -1).Day()
+	for {
+		fmt.Printf("Open day (1-%d, Enter to quit): ", last)
+		answer, err := reader.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" || err != nil {
+			return nil
+		}
+		day, convErr := strconv.Atoi(answer)
+		if convErr != nil || day < 1 || day > last {
+			fmt.Println("Not a day of this month.")
+			continue
+		}
+		notes := byDay[day]
+		switch len(notes) {
+		case 0:
+			fmt.Printf("No notes on %s.\n", month.AddDate(0, 0, day-1).Format("2 January"))
+			continue
+		case 1:
+			return openEditor(config.Editor, notes[0].Path)
+		}
+		for i, note := range notes {
+			fmt.Printf("  %d. %s\n", i+1, note.Title)
+		}
+		fmt.Print("Which one? ")
+		answer, _ = reader.ReadString('\n')
+		n, convErr := strconv.Atoi(strings.TrimSpace(answer))
+		if convErr != nil || n < 1 || n > len(notes) {
+			continue
+		}
+		return openEditor(config.Editor, notes[n-1].Path)
+	}
+}
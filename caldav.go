@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// A small CalDAV server for tasks, enough for DAVx5/Tasks.org and Apple
+// Reminders: the home at /dav/ holds a single calendar, /dav/tasks/, with one
+// VTODO per open checkbox. Clients log in with any user name and an API
+// token as the password. Completing a task in the client ticks its box in
+// the note; tasks are created and edited in notes only.
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// davResource is something a PROPFIND or REPORT can describe.
+type davResource struct {
+	href  string
+	props map[xml.Name]string // inner XML of each property
+}
+
+// davRequest is what we read from a PROPFIND or REPORT body.
+type davRequest struct {
+	report string     // root element of a REPORT
+	props  []xml.Name // requested properties; nil for allprop
+	hrefs  []string   // calendar-multiget targets
+}
+
+func parseDAVRequest(r io.Reader) (davRequest, error) {
+	var req davRequest
+	dec := xml.NewDecoder(r)
+	var stack []xml.Name
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return req, nil
+		}
+		if err != nil {
+			return req, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				req.report = tok.Name.Local
+			}
+			if len(stack) > 0 && stack[len(stack)-1] == (xml.Name{Space: nsDAV, Local: "prop"}) {
+				req.props = append(req.props, tok.Name)
+			}
+			stack = append(stack, tok.Name)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1] == (xml.Name{Space: nsDAV, Local: "href"}) {
+				req.hrefs = append(req.hrefs, strings.TrimSpace(string(tok)))
+			}
+		}
+	}
+}
+
+func (s *server) davHref(p string) string {
+	return s.basePath + "/dav/" + p
+}
+
+func (s *server) davHome() davResource {
+	home := "<D:href>" + s.davHref("") + "</D:href>"
+	return davResource{href: s.davHref(""), props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                 "<D:collection/>",
+		{Space: nsDAV, Local: "displayname"}:                  "syt",
+		{Space: nsDAV, Local: "current-user-principal"}:       home,
+		{Space: nsDAV, Local: "principal-URL"}:                home,
+		{Space: nsCalDAV, Local: "calendar-home-set"}:         home,
+		{Space: nsCalDAV, Local: "calendar-user-address-set"}: "",
+	}}
+}
+
+func (s *server) davCollection(tasks []Task) davResource {
+	ctag := sha1.New()
+	for _, t := range tasks {
+		fmt.Fprintln(ctag, davETag(s.config, t))
+	}
+	return davResource{href: s.davHref("tasks/"), props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        "<D:collection/><C:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:                         "syt tasks",
+		{Space: nsDAV, Local: "current-user-principal"}:              "<D:href>" + s.davHref("") + "</D:href>",
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          "<D:privilege><D:read/></D:privilege><D:privilege><D:write-content/></D:privilege>",
+		{Space: nsDAV, Local: "supported-report-set"}:                "<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report><D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>",
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<C:comp name="VTODO"/>`,
+		{Space: nsCS, Local: "getctag"}:                              hex.EncodeToString(ctag.Sum(nil)),
+	}}
+}
+
+func (s *server) davTask(t Task, withData bool) davResource {
+	res := davResource{href: s.davHref("tasks/" + t.UID + ".ics"), props: map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:   "",
+		{Space: nsDAV, Local: "getetag"}:        html.EscapeString(davETag(s.config, t)),
+		{Space: nsDAV, Local: "getcontenttype"}: "text/calendar; charset=utf-8; component=vtodo",
+	}}
+	if withData {
+		res.props[xml.Name{Space: nsCalDAV, Local: "calendar-data"}] = html.EscapeString(icalendar(s.config, t))
+	}
+	return res
+}
+
+func davETag(config *CONFIG, t Task) string {
+	sum := sha1.Sum([]byte(vtodo(config, t)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// writeMultistatus answers with the requested properties of each resource,
+// listing those it doesn't have as not found.
+func writeMultistatus(w http.ResponseWriter, resources []davResource, want []xml.Name) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">` + "\n")
+	for _, res := range resources {
+		names := want
+		if names == nil {
+			for name := range res.props {
+				names = append(names, name)
+			}
+		}
+		var found, missing strings.Builder
+		for _, name := range names {
+			tag := davTag(name)
+			if value, ok := res.props[name]; ok {
+				fmt.Fprintf(&found, "<%s>%s</%s>", tag, value, tag)
+			} else {
+				fmt.Fprintf(&missing, `<x:%s xmlns:x="%s"/>`, name.Local, html.EscapeString(name.Space))
+			}
+		}
+		b.WriteString("<D:response><D:href>" + html.EscapeString(res.href) + "</D:href>")
+		if found.Len() > 0 {
+			b.WriteString("<D:propstat><D:prop>" + found.String() + "</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>")
+		}
+		if missing.Len() > 0 {
+			b.WriteString("<D:propstat><D:prop>" + missing.String() + "</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+		}
+		b.WriteString("</D:response>\n")
+	}
+	b.WriteString("</D:multistatus>\n")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+func davTag(name xml.Name) string {
+	prefix := map[string]string{nsDAV: "D", nsCalDAV: "C", nsCS: "CS"}[name.Space]
+	return prefix + ":" + name.Local
+}
+
+// davTaskUID extracts the task UID from /dav/tasks/<uid>.ics.
+func davTaskUID(path string) (string, bool) {
+	name, ok := strings.CutPrefix(path, "/dav/tasks/")
+	if !ok || strings.Contains(name, "/") {
+		return "", false
+	}
+	return strings.CutSuffix(name, ".ics")
+}
+
+func (s *server) handleDAVOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, PROPFIND, REPORT")
+}
+
+// handleDAVWellKnown sends clients that probe /.well-known/caldav to the home.
+func (s *server) handleDAVWellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, s.davHref(""), http.StatusMovedPermanently)
+}
+
+func (s *server) handlePropfind(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDAVRequest(r.Body)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tasks, err := vaultTasks(s.config, true)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	depth1 := r.Header.Get("Depth") == "1"
+	var resources []davResource
+	switch path := r.URL.Path; {
+	case path == "/dav/" || path == "/dav":
+		resources = append(resources, s.davHome())
+		if depth1 {
+			resources = append(resources, s.davCollection(tasks))
+		}
+	case path == "/dav/tasks/" || path == "/dav/tasks":
+		resources = append(resources, s.davCollection(tasks))
+		if depth1 {
+			for _, t := range tasks {
+				resources = append(resources, s.davTask(t, false))
+			}
+		}
+	default:
+		uid, ok := davTaskUID(path)
+		t := findTask(tasks, uid)
+		if !ok || t == nil {
+			httpError(w, http.StatusNotFound, "no such task")
+			return
+		}
+		resources = append(resources, s.davTask(*t, false))
+	}
+	writeMultistatus(w, resources, req.props)
+}
+
+// handleReport answers calendar-query (every task) and calendar-multiget
+// (the tasks asked for by href).
+func (s *server) handleReport(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDAVRequest(r.Body)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tasks, err := vaultTasks(s.config, true)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	withData := req.props == nil
+	for _, p := range req.props {
+		withData = withData || p.Local == "calendar-data"
+	}
+	var resources []davResource
+	switch req.report {
+	case "calendar-query":
+		for _, t := range tasks {
+			resources = append(resources, s.davTask(t, withData))
+		}
+	case "calendar-multiget":
+		for _, href := range req.hrefs {
+			uid, _ := davTaskUID(strings.TrimPrefix(href, s.basePath))
+			if t := findTask(tasks, uid); t != nil {
+				resources = append(resources, s.davTask(*t, withData))
+			} else {
+				resources = append(resources, davResource{href: href})
+			}
+		}
+	default:
+		httpError(w, http.StatusNotImplemented, "unsupported report "+req.report)
+		return
+	}
+	writeMultistatus(w, resources, req.props)
+}
+
+func (s *server) handleDAVGet(w http.ResponseWriter, r *http.Request) {
+	tasks, err := vaultTasks(s.config, true)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	uid, _ := davTaskUID(r.URL.Path)
+	t := findTask(tasks, uid)
+	if t == nil {
+		httpError(w, http.StatusNotFound, "no such task")
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", davETag(s.config, *t))
+	io.WriteString(w, icalendar(s.config, *t))
+}
+
+// handleDAVPut takes a client's copy of a task and applies its completion
+// status to the checkbox. Other edits are ignored.
+func (s *server) handleDAVPut(w http.ResponseWriter, r *http.Request) {
+	uid, ok := davTaskUID(r.URL.Path)
+	if !ok {
+		httpError(w, http.StatusForbidden, "tasks are created in notes")
+		return
+	}
+	tasks, err := vaultTasks(s.config, false)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t := findTask(tasks, uid)
+	if t == nil {
+		httpError(w, http.StatusForbidden, "tasks are created in notes")
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != davETag(s.config, *t) {
+		httpError(w, http.StatusPreconditionFailed, "task changed in the note")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	status := icsProperty(string(body), "STATUS")
+	if _, err := setTaskDone(s.config, uid, status == "COMPLETED"); err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.watcher.poll()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func findTask(tasks []Task, uid string) *Task {
+	for i := range tasks {
+		if tasks[i].UID == uid {
+			return &tasks[i]
+		}
+	}
+	return nil
+}
+
+// icsProperty returns the value of the first property called name in an
+// iCalendar document, after unfolding its lines.
+func icsProperty(doc, name string) string {
+	doc = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(doc)
+	for _, line := range strings.Split(doc, "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		if k, _, _ := strings.Cut(key, ";"); strings.EqualFold(k, name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// Clock tells syt what time it is. Everything that records or compares
+// dates in notes (filenames, visits, reminders, recurrences, expiry) asks
+// the clock rather than calling time.Now, so it can be pinned with --now or
+// stepped through a window by `syt simulate`.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// fixedClock always reports the same instant.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// fakeClock is moved forward explicitly with Advance.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// clock is the process-wide clock; --now replaces it with a fixedClock so
+// scripts and golden tests get stable filenames, dates and commit messages.
+var clock Clock = systemClock{}
+
+// ids generates note and operation IDs. --seed makes the sequence
+// reproducible; otherwise it is randomly seeded.
+var ids = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+
+var nowLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// setDeterminism applies --now and --seed (or SYT_NOW and SYT_SEED).
+func setDeterminism(config *CONFIG) error {
+	if config.Now != "" {
+		t, err := parseTimestamp(config.Now)
+		if err != nil {
+			return fmt.Errorf("invalid --now: %w", err)
+		}
+		clock = fixedClock(t)
+	}
+	if config.Seed != "" {
+		seed, err := strconv.ParseUint(config.Seed, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid --seed %q: want a non-negative integer", config.Seed)
+		}
+		ids = rand.New(rand.NewPCG(seed, 0))
+	}
+	return nil
+}
+
+// parseTimestamp accepts RFC 3339 or a local date with an optional time.
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range nowLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a timestamp (try 2006-01-02T15:04:05)", s)
+}
+
+// currentTime is the time syt records in notes.
+func currentTime() time.Time {
+	return clock.Now()
+}
+
+// newID returns a short random hex ID from the (possibly seeded) generator.
+func newID() string {
+	return fmt.Sprintf("%08x", ids.Uint32())
+}
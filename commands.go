@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// command is a syt subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(*CONFIG, []string) error
+}
+
+// commands lists every subcommand in the order `syt help` shows them; those
+// without a summary are left out of the help. It is filled in by init
+// because some commands (the daemon) dispatch back through runCommand.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"new", "create a note", runNew},
+		{"list", "list notes", runList},
+		{"open", "open a note in the editor", runOpen},
+		{"last", "reopen the most recently edited note", runLast},
+		{"sync", "push notes to the enabled backends", runSync},
+		{"config", "show or change settings", runConfig},
+		{"init", "set syt up interactively", runInit},
+		{"clone", "clone a shared vault, optionally only some notebooks", runClone},
+		{"sparse", "choose which notebooks of a vault are checked out", runSparse},
+		{"today", "open the daily note at a new timestamped section", runToday},
+		{"add", "append to the daily note", runAdd},
+		{"search", "full-text search", runSearch},
+		{"recent", "recently visited notes", runRecent},
+		{"unread", "notes others changed since you last read them", runUnread},
+		{"subscribe", "follow notes and tags others change", runSubscribe},
+		{"rm", "move notes to the trash", runRm},
+		{"undo", "undo the last destructive operation", runUndo},
+		{"gc", "purge expired notes from the trash", runGC},
+		{"tags", "work with tags", runTags},
+		{"types", "list note types", runTypes},
+		{"people", "list people notes", runPeople},
+		{"lang", "detect or set a note language", runLang},
+		{"spell", "spell-check a note", runSpell},
+		{"prose", "report prose readability", runProse},
+		{"check", "run publish quality gates", runCheck},
+		{"unfurl", "fetch link titles", runUnfurl},
+		{"map", "export note locations", runMap},
+		{"due", "reminders, recurrences and expiries firing today", runDue},
+		{"simulate", "", runSimulate},
+		{"tasks", "list or export checkbox tasks", runTasks},
+		{"cal", "show a month calendar of notes", runCal},
+		{"timeline", "show the history of a tag", runTimeline},
+		{"history", "show the commits that changed a note", runHistory},
+		{"restore", "restore a note to an earlier version", runRestore},
+		{"blame", "show when each paragraph of a note last changed", runBlame},
+		{"stats", "vault statistics, --history for trends", runStats},
+		{"heatmap", "calendar of writing activity", runHeatmap},
+		{"publish", "publish notes to Confluence or a Hugo/Jekyll site", runPublish},
+		{"export", "export notes as a zip archive or HTML", runExport},
+		{"backup", "back the vault up to a drive, verify or restore it", runBackup},
+		{"attach", "attach files to a note or list its attachments", runAttach},
+		{"encrypt", "encrypt notes at rest", runEncrypt},
+		{"keys", "list encryption recipients, or re-encrypt notes to new ones", runKeys},
+		{"anki", "export flashcards to Anki", runAnki},
+		{"share", "share a note through a signed, expiring link", runShare},
+		{"serve", "serve the vault over HTTP", runServe},
+		{"daemon", "run the background daemon", runDaemon},
+		{"mount", "build tag and date views", runMount},
+		{"vault", "compare or merge another notes directory, or unlock an encrypted one", runVault},
+		{"migrate", "upgrade notes from an older layout", runMigrate},
+		{"assets", "list or install bundled assets", runAssets},
+		{"stress", "check concurrency guarantees on this filesystem", runStress},
+		{"help", "list the commands", runHelp},
+	}
+}
+
+// runCommand dispatches a subcommand.
+func runCommand(config *CONFIG, name string, args []string) error {
+	startRun()
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(config, args)
+		}
+	}
+	return fmt.Errorf(tr("unknown command: %s"), name)
+}
+
+// runHelp prints the commands with a line about each.
+func runHelp(config *CONFIG, args []string) error {
+	fmt.Println("usage: syt [--yes] [--direct] [--remote host] [--now time] [--seed n] <command> [arguments]")
+	fmt.Println("\nWithout a command syt creates a new note. Commands:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		if c.summary == "" {
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.summary)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Println("\nRun `syt <command> -h` for a command's flags.")
+	return nil
+}
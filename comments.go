@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// notionComment is a comment left on a synced page.
+type notionComment struct {
+	ID      string
+	Author  string
+	Created time.Time
+	Text    string
+}
+
+// commentsHeading starts the section imported comments are kept in. The
+// section is local only: it is left out of what syncs to Notion.
+const commentsHeading = "## Comments"
+
+// commentsSidecar is where comments go in sidecar mode.
+func commentsSidecar(notePath string) string {
+	return strings.TrimSuffix(notePath, ".md") + ".comments.md"
+}
+
+// isCommentsSidecar reports whether path holds imported comments rather
+// than a note of its own.
+func isCommentsSidecar(path string) bool {
+	return strings.HasSuffix(path, ".comments.md")
+}
+
+// withoutComments drops the imported comments section from a note body.
+func withoutComments(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != commentsHeading {
+			continue
+		}
+		end := len(lines)
+		for j := i + 1; j < len(lines); j++ {
+			if strings.HasPrefix(lines[j], "# ") || strings.HasPrefix(lines[j], "## ") {
+				end = j
+				break
+			}
+		}
+		return strings.Join(append(lines[:i:i], lines[end:]...), "\n")
+	}
+	return body
+}
+
+// importComments pulls comments that appeared on the note's Notion page
+// since the last sync into the note, or into its sidecar file, according to
+// NOTION_COMMENTS (section, sidecar or off). It returns how many were new.
+func importComments(config *CONFIG, api notionAPI, note *Note, page *NotionPage) (int, error) {
+	mode := strings.ToLower(config.NotionComments)
+	if mode == "off" {
+		return 0, nil
+	}
+	comments, err := api.comments(page.PageID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching Notion comments: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, id := range page.Comments {
+		seen[id] = true
+	}
+	var b strings.Builder
+	var fresh []string
+	for _, c := range comments {
+		if seen[c.ID] {
+			continue
+		}
+		fmt.Fprintf(&b, "- **%s** (%s): %s\n", c.Author, c.Created.Local().Format("2006-01-02 15:04"),
+			strings.ReplaceAll(strings.TrimSpace(c.Text), "\n", "\n  "))
+		fresh = append(fresh, c.ID)
+	}
+	if len(fresh) == 0 {
+		return 0, nil
+	}
+
+	switch mode {
+	case "sidecar":
+		target, text := commentsSidecar(note.Path), b.String()
+		if !fileExists(target) {
+			text = "# Comments on " + noteTitle(note) + "\n\n" + text
+		}
+		if err := createIfMissing(target); err != nil {
+			return 0, err
+		}
+		if err := lockedAppend(target, text); err != nil {
+			return 0, err
+		}
+	case "", "section":
+		unlock, err := acquireLock(note.Path + ".lock")
+		if err != nil {
+			return 0, err
+		}
+		defer unlock()
+		content, err := os.ReadFile(note.Path)
+		if err != nil {
+			return 0, err
+		}
+		if err := writeFileAtomic(note.Path, []byte(addComments(string(content), b.String()))); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unknown NOTION_COMMENTS mode %q (want section, sidecar or off)", config.NotionComments)
+	}
+	page.Comments = append(page.Comments, fresh...)
+	return len(fresh), nil
+}
+
+// addComments puts entries after the last line of the note's comments
+// section, wherever in the note that is, or starts the section at the end.
+func addComments(content, entries string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != commentsHeading {
+			continue
+		}
+		end := len(lines)
+		for j := i + 1; j < len(lines); j++ {
+			if strings.HasPrefix(lines[j], "# ") || strings.HasPrefix(lines[j], "## ") {
+				end = j
+				break
+			}
+		}
+		// The blank lines ahead of the next heading stay after the new entries
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		added := strings.Split(strings.TrimSuffix(entries, "\n"), "\n")
+		if end == i+1 {
+			added = append([]string{""}, added...)
+		}
+		if end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			added = append(added, "")
+		}
+		return strings.Join(append(append(lines[:end:end], added...), lines[end:]...), "\n")
+	}
+	prefix := "\n"
+	if !strings.HasSuffix(content, "\n") {
+		prefix = "\n\n"
+	}
+	return content + prefix + commentsHeading + "\n\n" + entries
+}
+
+func createIfMissing(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
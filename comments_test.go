@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestAddComments(t *testing.T) {
+	tests := []struct{ name, content, want string }{
+		{"no section", "# T\n\nbody\n", "# T\n\nbody\n\n## Comments\n\n- b\n"},
+		{"no final newline", "body", "body\n\n## Comments\n\n- b\n"},
+		{"section last", "# T\n\n## Comments\n\n- a\n", "# T\n\n## Comments\n\n- a\n- b\n"},
+		{"section first", "# T\n\n## Comments\n\n- a\n\n## Next\n\nx\n", "# T\n\n## Comments\n\n- a\n- b\n\n## Next\n\nx\n"},
+		{"empty section", "# T\n## Comments\n## Next\n", "# T\n## Comments\n\n- b\n\n## Next\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addComments(tt.content, "- b\n"); got != tt.want {
+				t.Errorf("addComments = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Concurrency guarantees. Any number of syt processes, plus the daemon, may
+// run against one vault at once:
+//
+//   - New notes never overwrite each other; two created in the same second
+//     get distinct names (O_EXCL with an ID suffix).
+//   - Updates to the state database (.syt/state.json) are serialized by its
+//     lock file and written by rename, so none are lost and readers never see
+//     a partial file.
+//   - Appends to a note (`syt add`) are serialized per file, by the daemon's
+//     single writer or the note's lock file, so lines never interleave.
+//   - Undo journal entries from concurrent operations are all recorded.
+//   - Git pushes take turns behind .syt/sync.lock instead of failing on git's
+//     index lock.
+//
+// Locks held by live processes are never broken; a lock left by a crashed
+// process is, by exactly one of the processes waiting on it. `syt stress`
+// checks these on the user's filesystem.
+
+func runStress(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("stress", flag.ContinueOnError)
+	workers := fs.Int("n", 8, "concurrent processes per check")
+	keep := fs.Bool("keep", false, "keep the scratch vault for inspection")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *workers < 2 {
+		return fmt.Errorf("-n must be at least 2")
+	}
+	if *workers > maxUndoOperations {
+		return fmt.Errorf("-n must be at most %d", maxUndoOperations)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// The scratch vault lives next to the real one so the same filesystem
+	// (and its locking semantics) is exercised
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	vault, err := os.MkdirTemp(stateDir(config), "stress-")
+	if err != nil {
+		return err
+	}
+	if !*keep {
+		defer os.RemoveAll(vault)
+	}
+	scratch := *config
+	scratch.NotesDir = vault
+	env := append(os.Environ(),
+		"NOTES_DIR="+vault,
+		"NOTE_EDITOR=true",
+		"SYT_REMOTE=",
+		"SYT_NOW="+config.Now,
+		"GIT_ENABLED=false",
+		"NOTION_ENABLED=false",
+		"WEATHER_ENABLED=false",
+	)
+	fmt.Printf("Stressing %s with %d concurrent processes\n", vault, *workers)
+
+	failures := 0
+	check := func(name string, run func(i int) []string, verify func() error) {
+		start := time.Now()
+		errs := spawnConcurrently(exe, env, *workers, run)
+		if len(errs) == 0 {
+			errs = append(errs, verify())
+		}
+		status := "ok"
+		for _, err := range errs {
+			if err != nil {
+				status = "FAIL: " + err.Error()
+				failures++
+				break
+			}
+		}
+		fmt.Printf("  %-28s %-8s %s\n", name, time.Since(start).Round(time.Millisecond), status)
+	}
+
+	// A crashed process left the state lock behind
+	if err := plantStaleLock(exe, env, filepath.Join(stateDir(&scratch), "state.lock")); err != nil {
+		return err
+	}
+	check("concurrent new (stale lock)",
+		func(i int) []string { return []string{"new"} },
+		func() error {
+			notes, err := scanNotes(vault)
+			if err != nil {
+				return err
+			}
+			if len(notes) != *workers {
+				return fmt.Errorf("%d notes created, want %d", len(notes), *workers)
+			}
+			return nil
+		})
+	check("state database updates",
+		nil,
+		func() error {
+			state, err := loadState(&scratch)
+			if err != nil {
+				return err
+			}
+			total := 0
+			for _, v := range state.Visits {
+				total += v.Count
+			}
+			if total != *workers {
+				return fmt.Errorf("%d visits recorded, want %d", total, *workers)
+			}
+			return nil
+		})
+	check("concurrent add",
+		func(i int) []string { return []string{"add", fmt.Sprintf("stress line %d", i)} },
+		func() error {
+			path, err := dailyNotePath(&scratch, currentTime())
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < *workers; i++ {
+				if n := strings.Count(string(data), fmt.Sprintf("stress line %d\n", i)); n != 1 {
+					return fmt.Errorf("line %d appears %d times", i, n)
+				}
+			}
+			return nil
+		})
+
+	notes, err := scanNotes(vault)
+	if err != nil {
+		return err
+	}
+	remote := filepath.Join(stateDir(&scratch), "remote.git")
+	if err := startStressRepo(vault, remote); err != nil {
+		return err
+	}
+	env = append(env, "GIT_ENABLED=true", "GIT_REPO_PATH="+vault, "GIT_REMOTE_URL="+remote,
+		"GIT_AUTHOR_NAME=syt stress", "GIT_AUTHOR_EMAIL=stress@localhost",
+		"GIT_COMMITTER_NAME=syt stress", "GIT_COMMITTER_EMAIL=stress@localhost")
+	check("concurrent sync (git)",
+		func(i int) []string {
+			if i >= len(notes) {
+				return nil
+			}
+			return []string{"sync", notes[i].Path}
+		},
+		func() error {
+			out, err := gitOutput(remote, "ls-tree", "-r", "--name-only", "HEAD")
+			if err != nil {
+				return err
+			}
+			pushed := map[string]bool{}
+			for _, name := range strings.Fields(out) {
+				pushed[name] = true
+			}
+			for i := 0; i < min(len(notes), *workers); i++ {
+				if name := relNotePath(vault, notes[i].Path); !pushed[name] {
+					return fmt.Errorf("%s didn't reach the remote", name)
+				}
+			}
+			return nil
+		})
+
+	daemon, err := startStressDaemon(exe, env, &scratch)
+	if err != nil {
+		return err
+	}
+	check("daemon add and list",
+		func(i int) []string {
+			if i%2 == 1 {
+				return []string{"list"}
+			}
+			return []string{"add", fmt.Sprintf("daemon line %d", i)}
+		},
+		func() error {
+			path, err := dailyNotePath(&scratch, currentTime())
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < *workers; i += 2 {
+				if n := strings.Count(string(data), fmt.Sprintf("daemon line %d\n", i)); n != 1 {
+					return fmt.Errorf("line %d appears %d times", i, n)
+				}
+			}
+			return nil
+		})
+	daemon.Process.Signal(os.Interrupt)
+	daemon.Wait()
+
+	check("concurrent rm (undo journal)",
+		func(i int) []string {
+			if i >= len(notes) {
+				return nil
+			}
+			return []string{"rm", notes[i].Path}
+		},
+		func() error {
+			ops, err := loadUndoJournal(&scratch)
+			if err != nil {
+				return err
+			}
+			want := min(len(notes), *workers)
+			if len(ops) != want {
+				return fmt.Errorf("%d operations journaled, want %d", len(ops), want)
+			}
+			return nil
+		})
+
+	if failures > 0 {
+		return fmt.Errorf("%d check(s) failed", failures)
+	}
+	fmt.Println("All concurrency checks passed.")
+	return nil
+}
+
+// spawnConcurrently starts n syt processes at once, each with the arguments
+// run(i) returns, and collects their failures. A nil run means
+// the check only inspects what earlier ones left behind. Read-only commands
+// go to the daemon when one is running.
+func spawnConcurrently(exe string, env []string, n int, run func(i int) []string) []error {
+	if run == nil {
+		return nil
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i := 0; i < n; i++ {
+		args := run(i)
+		if args == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(exe, append([]string{"--yes"}, args...)...)
+			cmd.Env = env
+			var out bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &out, &out
+			if err := cmd.Run(); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(out.String())))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// plantStaleLock leaves lockPath as a crashed process would: held by a PID
+// that has exited.
+func plantStaleLock(exe string, env []string, lockPath string) error {
+	cmd := exec.Command(exe, "--direct", "help")
+	cmd.Env = env
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(lockPath, []byte(fmt.Sprintf("%d\n", cmd.ProcessState.Pid())), 0644)
+}
+
+// startStressRepo makes vault a git repository pushing to a new bare one at
+// remote, as syt init would.
+func startStressRepo(vault, remote string) error {
+	if err := gitIn(vault, "init", "-q", "--bare", remote); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", remote},
+		{"config", "push.autoSetupRemote", "true"},
+	} {
+		if err := gitIn(vault, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startStressDaemon starts a daemon on the scratch vault and waits for its
+// socket to answer.
+func startStressDaemon(exe string, env []string, scratch *CONFIG) (*exec.Cmd, error) {
+	cmd := exec.Command(exe, "daemon")
+	cmd.Env = env
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if _, err := callDaemon(scratch, daemonRequest{Op: "ping"}); err == nil {
+			return cmd, nil
+		}
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil, fmt.Errorf("the daemon didn't start on %s", socketPath(scratch))
+}
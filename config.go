@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fileSettings holds the values from the config file, by environment
+// variable name. Environment variables win over them, so a setting can
+// still be changed for a single run.
+var fileSettings = map[string]string{}
+
+// configPath is SYT_CONFIG, else $XDG_CONFIG_HOME/syt/config.toml, else
+// ~/.config/syt/config.toml.
+func configPath() string {
+	if path := os.Getenv("SYT_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "syt", "config.toml")
+}
+
+// configValue looks a setting up in the environment and then in the config
+// file. A variable that is set but empty still overrides the file.
+func configValue(key string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return val
+	}
+	return fileSettings[key]
+}
+
+// loadConfigFile reads the config file, if there is one, into fileSettings.
+func loadConfigFile() error {
+	path := configPath()
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	settings, err := parseTOML(bufio.NewScanner(f))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fileSettings = settings
+	return nil
+}
+
+// runConfig shows and changes settings. Keys can be given in either form,
+// notion.token or NOTION_TOKEN.
+func runConfig(config *CONFIG, args []string) error {
+	sub := "show"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	path := configPath()
+	if path == "" && sub != "get" {
+		return fmt.Errorf("can't find a home directory for the config file; set SYT_CONFIG")
+	}
+	switch {
+	case sub == "path" && len(args) == 0:
+		fmt.Println(path)
+	case sub == "show" && len(args) == 0:
+		printSettings()
+	case sub == "get" && len(args) == 1:
+		fmt.Println(configValue(tomlKey(args[0])))
+	case sub == "set" && len(args) == 2:
+		key := tomlKey(args[0])
+		if err := setConfigValue(path, key, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s in %s.\n", key, path)
+		if _, ok := os.LookupEnv(key); ok {
+			fmt.Printf("Note that %s is also set in the environment, which takes precedence.\n", key)
+		}
+	case sub == "edit" && len(args) == 0:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return openEditor(config.Editor, path)
+	default:
+		return fmt.Errorf("usage: syt config [show | path | edit | get <key> | set <key> <value>]")
+	}
+	return nil
+}
+
+// printSettings lists the config file's settings, hiding secrets and
+// flagging those the environment overrides.
+func printSettings() {
+	keys := make([]string, 0, len(fileSettings))
+	for key := range fileSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := strconv.Quote(fileSettings[key])
+		if secretSetting(key) {
+			val = "(hidden)"
+		}
+		note := ""
+		if env, ok := os.LookupEnv(key); ok && env != fileSettings[key] {
+			note = "  # overridden by the environment"
+		}
+		fmt.Printf("%s = %s%s\n", key, val, note)
+	}
+}
+
+func secretSetting(key string) bool {
+	for _, word := range []string{"TOKEN", "SECRET", "PASSWORD"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// setConfigValue sets key in the config file at path. An existing line for
+// the key is replaced where it stands, keeping comments and layout;
+// otherwise the setting is added before the first table.
+func setConfigValue(path, key, val string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := parseTOML(bufio.NewScanner(strings.NewReader(string(data)))); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	table, found, firstTable := "", false, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			name, _ := strings.CutSuffix(strings.TrimSpace(stripTOMLComment(trimmed)), "]")
+			table = tomlKey(strings.TrimPrefix(name, "[")) + "_"
+			firstTable = min(firstTable, i)
+			continue
+		}
+		if k, raw, ok := strings.Cut(line, "="); ok && trimmed[0] != '#' && table+tomlKey(k) == key {
+			lines[i] = strings.TrimRight(k, " \t") + " = " + strconv.Quote(val)
+			if comment := raw[len(stripTOMLComment(raw)):]; comment != "" {
+				lines[i] += " " + comment
+			}
+			found = true
+		}
+	}
+	if !found {
+		at := firstTable
+		for at > 0 && strings.TrimSpace(lines[at-1]) == "" {
+			at--
+		}
+		lines = append(lines[:at], append([]string{strings.ToLower(key) + " = " + strconv.Quote(val)}, lines[at:]...)...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return os.Chmod(path, 0600) // it may hold tokens
+	}
+	return nil
+}
+
+// parseTOML reads the subset of TOML a settings file needs: tables, bare
+// or quoted keys, strings, numbers, booleans and single-line arrays. Keys
+// are flattened into the environment variable each one stands for, so
+//
+//	notes_dir = "~/notes"
+//	[notion]
+//	token = "secret"
+//
+// sets NOTES_DIR and NOTION_TOKEN. Arrays become comma separated lists and a
+// leading ~/ in a string is expanded to the home directory.
+func parseTOML(scanner *bufio.Scanner) (map[string]string, error) {
+	settings := map[string]string{}
+	table := ""
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name, ok := strings.CutSuffix(strings.TrimSpace(stripTOMLComment(line)), "]")
+			if !ok || strings.HasPrefix(name, "[[") {
+				return nil, fmt.Errorf("line %d: unsupported table header %q", n, line)
+			}
+			table = tomlKey(strings.TrimPrefix(name, "[")) + "_"
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		val, err := tomlValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		settings[table+tomlKey(key)] = val
+	}
+	return settings, scanner.Err()
+}
+
+// tomlKey turns a key or table name into its environment variable form:
+// notion.database-id becomes NOTION_DATABASE_ID.
+func tomlKey(key string) string {
+	var parts []string
+	for _, part := range strings.Split(key, ".") {
+		parts = append(parts, strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return strings.ToUpper(strings.ReplaceAll(strings.Join(parts, "_"), "-", "_"))
+}
+
+func tomlValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := closingQuote(raw)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		s, err := strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw[:end+1])
+		}
+		return expandHome(s), nil
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return expandHome(raw[1 : end+1]), nil
+	case strings.HasPrefix(raw, "["):
+		inner, ok := strings.CutSuffix(strings.TrimSpace(stripTOMLComment(raw)), "]")
+		if !ok {
+			return "", fmt.Errorf("arrays must be on one line")
+		}
+		var items []string
+		for _, item := range splitTOMLArray(inner[1:]) {
+			v, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	}
+	val := strings.TrimSpace(stripTOMLComment(raw))
+	if val == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return strings.ReplaceAll(val, "_", ""), nil // 1_000 is 1000
+}
+
+// closingQuote finds the quote ending the basic string at the start of s.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func stripTOMLComment(s string) string {
+	inString := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString == 0 && (c == '"' || c == '\''):
+			inString = c
+		case inString == '"' && c == '\\':
+			i++
+		case c == inString:
+			inString = 0
+		case inString == 0 && c == '#':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitTOMLArray splits the inside of an array at commas outside strings.
+func splitTOMLArray(s string) []string {
+	var items []string
+	inString, start := byte(0), 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch c := s[i]; {
+			case inString == 0 && (c == '"' || c == '\''):
+				inString = c
+				continue
+			case inString == '"' && c == '\\':
+				i++
+				continue
+			case c == inString:
+				inString = 0
+				continue
+			case inString != 0 || c != ',':
+				continue
+			}
+		}
+		if item := strings.TrimSpace(s[start:i]); item != "" {
+			items = append(items, item)
+		}
+		start = i + 1
+	}
+	return items
+}
+
+func expandHome(s string) string {
+	if rest, ok := strings.CutPrefix(s, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// confirm asks before a destructive or batch action touching files notes.
+// CONFIRM_POLICY decides when to ask: "always" (the default), "never", or
+// "over-N" to ask only when more than N files are affected. --yes skips the
+// question. Without a terminal to ask on, the action is refused rather than
+// silently performed.
+func confirm(config *CONFIG, action string, files int) error {
+	if config.Yes || files == 0 {
+		return nil
+	}
+	policy := strings.ToLower(config.ConfirmPolicy)
+	switch {
+	case policy == "never":
+		return nil
+	case strings.HasPrefix(policy, "over-"):
+		limit, err := strconv.Atoi(strings.TrimPrefix(policy, "over-"))
+		if err != nil {
+			return codeErrorf(ErrConfigInvalid, "invalid CONFIRM_POLICY %q", config.ConfirmPolicy)
+		}
+		if files <= limit {
+			return nil
+		}
+	case policy != "always":
+		return codeErrorf(ErrConfigInvalid, "invalid CONFIRM_POLICY %q (want always, never or over-N)", config.ConfirmPolicy)
+	}
+
+	if !isTerminal(os.Stdin) {
+		return codeErrorf(ErrAborted, tr("%s needs confirmation; rerun with --yes"), action)
+	}
+	fmt.Printf(tr("%s (%d file(s))? [y/N] "), action, files)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if isYes(answer) {
+		return nil
+	}
+	return withCode(ErrAborted, errors.New(tr("aborted")))
+}
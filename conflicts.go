@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRebaseSteps bounds the commits resolveRebase works through, in case git
+// keeps stopping for a reason it can't fix.
+const maxRebaseSteps = 1000
+
+// resolveRebase deals with a pull --rebase stopped on conflicts, the way
+// GIT_PULL_CONFLICT says:
+//
+//   - abort (the default) undoes the rebase and reports the files
+//   - notify does the same and raises a desktop notification, for the daemon
+//   - local (or ours) and remote (or theirs) keep one side of each
+//     conflicting change; git has already applied them
+//   - keep-both keeps the upstream note and writes this machine's version
+//     next to it as a conflict copy
+//   - union keeps the lines of both sides, which suits notes that are only
+//     ever appended to
+//
+// Nothing is pushed when the rebase is undone; the local commits are kept.
+func resolveRebase(config *CONFIG, root string) error {
+	strategy := config.GitPullConflict
+	for step := 0; step < maxRebaseSteps && rebaseInProgress(root); step++ {
+		files := conflictedFiles(root)
+		if len(files) == 0 || (strategy != "keep-both" && strategy != "union") {
+			break
+		}
+		for _, file := range files {
+			var err error
+			if strategy == "keep-both" {
+				err = keepBoth(config, root, file)
+			} else {
+				err = unionResolve(root, file)
+			}
+			if err != nil {
+				gitOutput(root, "rebase", "--abort")
+				return codeErrorf(ErrGitFailed, "resolving %s: %v; the rebase was undone and nothing pushed", file, err)
+			}
+		}
+		if _, err := gitOutput(root, "-c", "core.editor=true", "rebase", "--continue"); err != nil && len(conflictedFiles(root)) == 0 {
+			// The commit ended up changing nothing
+			gitOutput(root, "rebase", "--skip")
+		}
+	}
+	if !rebaseInProgress(root) {
+		fmt.Printf("Resolved conflicts with the upstream (%s).\n", strategy)
+		return nil
+	}
+
+	files := conflictedFiles(root)
+	gitOutput(root, "rebase", "--abort")
+	if strategy == "notify" {
+		notifyDesktop("sync conflict", "Not pushed: conflicts in "+strings.Join(files, ", "))
+	}
+	return codeErrorf(ErrGitFailed, "git pull --rebase: conflicts in %s; the rebase was undone and nothing pushed. Run git pull --rebase to resolve them by hand, or set GIT_PULL_CONFLICT to local, remote, keep-both or union",
+		strings.Join(files, ", "))
+}
+
+// conflictedFiles lists the unmerged files, relative to root.
+func conflictedFiles(root string) []string {
+	out, _ := gitOutput(root, "diff", "--name-only", "--diff-filter=U")
+	return strings.Fields(out)
+}
+
+func rebaseInProgress(root string) bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		if out, err := gitOutput(root, "rev-parse", "--git-path", dir); err == nil {
+			path := strings.TrimSpace(out)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(root, path)
+			}
+			if fileExists(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conflictStage returns one side of a conflicted file. While rebasing, stage
+// 1 is the common ancestor, 2 the upstream and what was replayed onto it, and
+// 3 the local commit being replayed.
+func conflictStage(root string, stage int, file string) (string, bool) {
+	out, err := gitOutput(root, "show", fmt.Sprintf(":%d:%s", stage, file))
+	return out, err == nil
+}
+
+// keepBoth resolves file to the upstream version and saves the local one as
+// a conflict copy named after the device, e.g.
+// plan_conflict_laptop_2024-05-01_101500.md.
+func keepBoth(config *CONFIG, root, file string) error {
+	path := filepath.Join(root, filepath.FromSlash(file))
+	remote, hasRemote := conflictStage(root, 2, file)
+	local, hasLocal := conflictStage(root, 3, file)
+	if hasLocal {
+		ext := filepath.Ext(path)
+		copyPath := fmt.Sprintf("%s_conflict_%s_%s%s", strings.TrimSuffix(path, ext), slugify(config.DeviceName), currentTime().Format("2006-01-02_150405"), ext)
+		if err := os.WriteFile(copyPath, []byte(local), 0644); err != nil {
+			return err
+		}
+		if err := gitIn(root, "add", "--", copyPath); err != nil {
+			return err
+		}
+		fmt.Printf("Kept this machine's %s as %s.\n", file, relNotePath(root, copyPath))
+	}
+	if !hasRemote {
+		// Deleted upstream; the copy is all that's left of it
+		_, err := gitOutput(root, "rm", "-q", "--cached", "--", file)
+		os.Remove(path)
+		return err
+	}
+	if err := os.WriteFile(path, []byte(remote), 0644); err != nil {
+		return err
+	}
+	return gitIn(root, "add", "--", path)
+}
+
+// unionResolve merges file keeping the lines of both sides where they
+// conflict, upstream first.
+func unionResolve(root, file string) error {
+	path := filepath.Join(root, filepath.FromSlash(file))
+	remote, hasRemote := conflictStage(root, 2, file)
+	local, hasLocal := conflictStage(root, 3, file)
+	base, _ := conflictStage(root, 1, file)
+	merged := remote + local
+	if hasRemote && hasLocal {
+		dir, err := os.MkdirTemp("", "syt-merge")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		sides := []string{filepath.Join(dir, "remote"), filepath.Join(dir, "base"), filepath.Join(dir, "local")}
+		for i, text := range []string{remote, base, local} {
+			if err := os.WriteFile(sides[i], []byte(text), 0644); err != nil {
+				return err
+			}
+		}
+		// merge-file exits with the number of conflicts, which union leaves none of
+		if merged, err = gitOutput(root, append([]string{"merge-file", "-p", "--union"}, sides...)...); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, []byte(merged), 0644); err != nil {
+		return err
+	}
+	return gitIn(root, "add", "--", path)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// publishConfluence creates or updates a Confluence page per note under the
+// configured space and parent. Page IDs are kept in the state database, so
+// publishing again updates the same page.
+func publishConfluence(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("publish confluence", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the storage format instead of publishing")
+	fs.BoolVar(&config.Force, "force", false, "publish even if a note tagged publish fails its checks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: syt publish confluence [--dry-run] [--force] <note>...")
+	}
+	if !*dryRun && (config.ConfluenceURL == "" || config.ConfluenceSpace == "") {
+		return fmt.Errorf("set CONFLUENCE_URL and CONFLUENCE_SPACE to publish to Confluence")
+	}
+
+	for _, arg := range fs.Args() {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			return err
+		}
+		note, err := readNote(path)
+		if err != nil {
+			return err
+		}
+		if ok, err := passesGates(config, note); err != nil {
+			return err
+		} else if !ok {
+			return codeErrorf(ErrPublishChecks, "%s failed its publish checks", path)
+		}
+		storage := markdownToStorage(withoutComments(note.Body))
+		if *dryRun {
+			fmt.Println(storage)
+			continue
+		}
+
+		state, err := loadState(config)
+		if err != nil {
+			return err
+		}
+		key := visitKey(config, path)
+		c := confluenceClient{config: config}
+		id := state.Confluence[key]
+		if id == "" {
+			if id, err = c.create(noteTitle(note), storage); err != nil {
+				return err
+			}
+			fmt.Printf("Created Confluence page %s for %s\n", id, path)
+		} else {
+			if err := c.update(id, noteTitle(note), storage); err != nil {
+				return err
+			}
+			fmt.Printf("Updated Confluence page %s for %s\n", id, path)
+		}
+		err = updateState(config, func(s *State) error {
+			if s.Confluence == nil {
+				s.Confluence = map[string]string{}
+			}
+			s.Confluence[key] = id
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confluenceClient talks to the Confluence REST API with basic auth (the
+// user's email and an API token on Confluence Cloud).
+type confluenceClient struct {
+	config *CONFIG
+}
+
+type confluenceContent struct {
+	ID        string             `json:"id,omitempty"`
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Space     *confluenceSpace   `json:"space,omitempty"`
+	Ancestors []confluenceID     `json:"ancestors,omitempty"`
+	Version   *confluenceVersion `json:"version,omitempty"`
+	Body      *confluenceBody    `json:"body,omitempty"`
+}
+
+type confluenceSpace struct {
+	Key string `json:"key"`
+}
+
+type confluenceID struct {
+	ID string `json:"id"`
+}
+
+type confluenceVersion struct {
+	Number int `json:"number"`
+}
+
+type confluenceBody struct {
+	Storage confluenceStorage `json:"storage"`
+}
+
+type confluenceStorage struct {
+	Value          string `json:"value"`
+	Representation string `json:"representation"`
+}
+
+func (c confluenceClient) create(title, storage string) (string, error) {
+	page := confluenceContent{
+		Type:  "page",
+		Title: title,
+		Space: &confluenceSpace{Key: c.config.ConfluenceSpace},
+		Body:  &confluenceBody{Storage: confluenceStorage{Value: storage, Representation: "storage"}},
+	}
+	if c.config.ConfluenceParent != "" {
+		page.Ancestors = []confluenceID{{ID: c.config.ConfluenceParent}}
+	}
+	var created confluenceContent
+	if err := c.do("POST", "/rest/api/content", page, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// update replaces the page's content, which Confluence requires to carry
+// the next version number.
+func (c confluenceClient) update(id, title, storage string) error {
+	var current confluenceContent
+	if err := c.do("GET", "/rest/api/content/"+id+"?expand=version", nil, &current); err != nil {
+		return err
+	}
+	if current.Version == nil {
+		return fmt.Errorf("confluence page %s has no version", id)
+	}
+	page := confluenceContent{
+		ID:      id,
+		Type:    "page",
+		Title:   title,
+		Version: &confluenceVersion{Number: current.Version.Number + 1},
+		Body:    &confluenceBody{Storage: confluenceStorage{Value: storage, Representation: "storage"}},
+	}
+	return c.do("PUT", "/rest/api/content/"+id, page, nil)
+}
+
+func (c confluenceClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.config.ConfluenceURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.config.ConfluenceUser, c.config.ConfluenceToken)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("confluence %s %s: %s: %s", method, path, resp.Status, abbreviate(string(data)))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdNumbered = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	mdImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdCode     = regexp.MustCompile("`([^`]+)`")
+	mdBold     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic   = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+)
+
+// markdownToStorage converts markdown into Confluence storage format, the
+// XHTML dialect pages are saved in. It covers headings, paragraphs, lists,
+// quotes, fenced code (as the code macro), images and inline formatting.
+func markdownToStorage(body string) string {
+	return renderMarkdown(body, storageFormat)
+}
+
+// markdownToHTML converts markdown into plain HTML, as used for share pages.
+func markdownToHTML(body string) string {
+	return renderMarkdown(body, plainHTML)
+}
+
+// markupFlavor holds the constructs storage format writes differently from
+// plain HTML.
+type markupFlavor struct {
+	code  func(lang, code string) string
+	image string // replacement for mdImage matches
+}
+
+var storageFormat = markupFlavor{
+	code: func(lang, code string) string {
+		s := `<ac:structured-macro ac:name="code">`
+		if lang != "" {
+			s += `<ac:parameter ac:name="language">` + html.EscapeString(lang) + `</ac:parameter>`
+		}
+		return s + "<ac:plain-text-body><![CDATA[" + strings.ReplaceAll(code, "]]>", "]]]]><![CDATA[>") +
+			"]]></ac:plain-text-body></ac:structured-macro>"
+	},
+	image: `<ac:image ac:alt="$1"><ri:url ri:value="$2" /></ac:image>`,
+}
+
+var plainHTML = markupFlavor{
+	code: func(lang, code string) string {
+		class := ""
+		if lang != "" {
+			class = ` class="language-` + html.EscapeString(lang) + `"`
+		}
+		return "<pre><code" + class + ">" + html.EscapeString(code) + "</code></pre>"
+	},
+	image: `<img alt="$1" src="$2">`,
+}
+
+func renderMarkdown(body string, flavor markupFlavor) string {
+	var out strings.Builder
+	var para []string
+	list := "" // "ul" or "ol" while inside a list
+	inFence, fenceLang := false, ""
+	var code []string
+
+	flush := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + flavor.inline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(kind string) {
+		if list != kind {
+			closeList()
+			out.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inFence {
+				out.WriteString(flavor.code(fenceLang, strings.Join(code, "\n")) + "\n")
+				code, inFence = nil, false
+			} else {
+				flush()
+				closeList()
+				inFence, fenceLang = true, strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			}
+			continue
+		}
+		if inFence {
+			code = append(code, line)
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flush()
+			closeList()
+		case mdHeading.MatchString(trimmed):
+			flush()
+			closeList()
+			m := mdHeading.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			fmt.Fprintf(&out, "<h%d>%s</h%d>\n", level, flavor.inline(m[2]), level)
+		case mdBullet.MatchString(line):
+			flush()
+			openList("ul")
+			out.WriteString("<li>" + flavor.inline(mdBullet.FindStringSubmatch(line)[1]) + "</li>\n")
+		case mdNumbered.MatchString(line):
+			flush()
+			openList("ol")
+			out.WriteString("<li>" + flavor.inline(mdNumbered.FindStringSubmatch(line)[1]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			closeList()
+			out.WriteString("<blockquote><p>" + flavor.inline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</p></blockquote>\n")
+		default:
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	// A fence left open runs to the end of the note
+	if inFence {
+		out.WriteString(flavor.code(fenceLang, strings.Join(code, "\n")) + "\n")
+	}
+	flush()
+	closeList()
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// inline escapes text and converts inline markdown. Code spans are swapped
+// out first so their content isn't formatted.
+func (flavor markupFlavor) inline(text string) string {
+	var spans []string
+	text = mdCode.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	text = html.EscapeString(text)
+	text = mdImage.ReplaceAllString(text, flavor.image)
+	text = mdLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = mdBold.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = mdItalic.ReplaceAllString(text, "<em>$1$2</em>")
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return text
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestRenderMarkdownCode(t *testing.T) {
+	tests := []struct{ name, body, want string }{
+		{"closed fence", "Intro\n\n```go\nx := 1\n```\nAfter", "<p>Intro</p>\n<pre><code class=\"language-go\">x := 1</code></pre>\n<p>After</p>"},
+		{"fence left open", "Intro\n\n```go\nx := 1\ny := 2", "<p>Intro</p>\n<pre><code class=\"language-go\">x := 1\ny := 2</code></pre>"},
+		{"open fence after a list", "- item\n```\n<b>", "<ul>\n<li>item</li>\n</ul>\n<pre><code>&lt;b&gt;</code></pre>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToHTML(tt.body); got != tt.want {
+				t.Errorf("markdownToHTML = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownOpenFenceStorageFormat(t *testing.T) {
+	want := `<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">sh</ac:parameter>` +
+		`<ac:plain-text-body><![CDATA[echo hi]]></ac:plain-text-body></ac:structured-macro>`
+	if got := renderMarkdown("```sh\necho hi", storageFormat); got != want {
+		t.Errorf("renderMarkdown = %q, want %q", got, want)
+	}
+}
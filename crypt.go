@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Notes can be kept encrypted at rest. With ENCRYPTION=age new notes are
+// written as <name>.md.age, encrypted to AGE_RECIPIENT (age or SSH public
+// keys, or files of them) by the age command; with ENCRYPTION=gpg they are
+// <name>.md.gpg, encrypted to GPG_RECIPIENT by gpg, which leaves keys on a
+// smartcard such as a YubiKey to gpg-agent. Both take a comma-separated
+// list, so a recovery key can open every note as well as the everyday one,
+// and `syt keys rotate` re-encrypts the notes after the list changes (see
+// keys.go). Daily notes, captures, scans and the inbox are sealed as they
+// are created too, and appending to a sealed note decrypts it and seals it
+// again; only attachments are kept as they are. `syt encrypt` seals existing
+// notes. Opening a sealed note decrypts it (with the AGE_IDENTITY files for
+// age) into a private temporary file for the editor and seals the result
+// again, so the plain text never lands in the vault or the repository. Each
+// note is opened by the tool its suffix names, whatever ENCRYPTION is now.
+// Sealed notes are left out of listings and search, and only sync to git:
+// the other stages would need the plain text.
+
+// noteCipher seals and opens note files.
+type noteCipher interface {
+	// ext is the suffix sealed files get after .md
+	ext() string
+	seal(plain []byte) ([]byte, error)
+	open(sealed []byte) ([]byte, error)
+}
+
+// noteCiphers are the ciphers by the suffix they give files.
+var noteCiphers = map[string]func(*CONFIG) noteCipher{
+	".age": func(config *CONFIG) noteCipher { return ageCipher{config} },
+	".gpg": func(config *CONFIG) noteCipher { return gpgCipher{config} },
+}
+
+// configuredCipher returns the cipher ENCRYPTION picks for new notes, or nil
+// when notes are kept in the clear.
+func configuredCipher(config *CONFIG) (noteCipher, error) {
+	switch config.Encryption {
+	case "", "off":
+		return nil, nil
+	case "age":
+		return ageCipher{config}, nil
+	case "gpg":
+		return gpgCipher{config}, nil
+	}
+	return nil, codeErrorf(ErrConfigInvalid, "ENCRYPTION: %q is not age, gpg or off", config.Encryption)
+}
+
+// isSealed reports whether path is an encrypted note.
+func isSealed(path string) bool {
+	return sealedCipher(nil, path) != nil
+}
+
+// sealedCipher returns the cipher that opens the note at path, or nil for a
+// note in the clear.
+func sealedCipher(config *CONFIG, path string) noteCipher {
+	ext := filepath.Ext(path)
+	if newCipher, ok := noteCiphers[ext]; ok && strings.HasSuffix(strings.TrimSuffix(path, ext), ".md") {
+		return newCipher(config)
+	}
+	return nil
+}
+
+// sealedPath is where syt creates the note it would otherwise create at
+// plain: there when notes are kept in the clear or a plain note is already
+// there, and under plain plus the cipher's suffix otherwise.
+func sealedPath(config *CONFIG, plain string) (string, error) {
+	c, err := configuredCipher(config)
+	if err != nil || c == nil || fileExists(plain) {
+		return plain, err
+	}
+	return plain + c.ext(), nil
+}
+
+// createNote writes a new note at path, sealed when path is an encrypted
+// note's. Like os.OpenFile with O_EXCL it fails with an os.ErrExist error
+// when something is there already.
+func createNote(config *CONFIG, path string, content []byte) error {
+	if c := sealedCipher(config, path); c != nil {
+		sealed, err := c.seal(content)
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
+		}
+		content = sealed
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// appendNote is lockedAppend for any note: a sealed one is decrypted, added
+// to and sealed again under the same lock.
+func appendNote(config *CONFIG, path, text string) error {
+	c := sealedCipher(config, path)
+	if c == nil {
+		return lockedAppend(path, text)
+	}
+	unlock, err := acquireLock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plain, err := c.open(sealed)
+	if err != nil {
+		return err
+	}
+	sealed, err = c.seal(append(plain, text...))
+	if err != nil {
+		return fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
+	}
+	return writeFileAtomic(path, sealed)
+}
+
+// createSealedNote is createNewNoteFile for notes written without an
+// editor: with ENCRYPTION set the note is sealed into dir straight away.
+func createSealedNote(config *CONFIG, dir, title, header string) (string, error) {
+	c, err := configuredCipher(config)
+	if err != nil {
+		return "", err
+	}
+	if c == nil {
+		return createNewNoteFile(dir, config.FilenamePrefix, title, header)
+	}
+	tmp, err := os.MkdirTemp("", "syt-sealed")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	plainPath, err := createNewNoteFile(tmp, config.FilenamePrefix, title, header)
+	if err != nil {
+		return "", err
+	}
+	return sealInto(c, plainPath, dir)
+}
+
+// ageCipher runs the age command.
+type ageCipher struct{ config *CONFIG }
+
+func (ageCipher) ext() string { return ".age" }
+
+func (c ageCipher) seal(plain []byte) ([]byte, error) {
+	recipients := splitList(c.config.AgeRecipient)
+	if len(recipients) == 0 {
+		return nil, codeErrorf(ErrConfigInvalid, "ENCRYPTION=age needs AGE_RECIPIENT, public keys or files of them")
+	}
+	// Armored, sealed notes diff and merge as text
+	args := []string{"--encrypt", "--armor"}
+	for _, recipient := range recipients {
+		if strings.HasPrefix(recipient, "age1") || strings.HasPrefix(recipient, "ssh-") {
+			args = append(args, "-r", recipient)
+		} else {
+			args = append(args, "-R", expandHome(recipient))
+		}
+	}
+	return runFilter("age", plain, args...)
+}
+
+func (c ageCipher) open(sealed []byte) ([]byte, error) {
+	args := []string{"--decrypt"}
+	for _, identity := range splitList(c.config.AgeIdentity) {
+		if identity = expandHome(identity); fileExists(identity) {
+			args = append(args, "--identity", identity)
+		}
+	}
+	if len(args) == 1 {
+		return nil, codeErrorf(ErrConfigInvalid, "no age identity at %s; set AGE_IDENTITY", c.config.AgeIdentity)
+	}
+	return runFilter("age", sealed, args...)
+}
+
+// gpgCipher runs gpg.
+type gpgCipher struct{ config *CONFIG }
+
+func (gpgCipher) ext() string { return ".gpg" }
+
+func (c gpgCipher) seal(plain []byte) ([]byte, error) {
+	recipients := splitList(c.config.GPGRecipient)
+	if len(recipients) == 0 {
+		return nil, codeErrorf(ErrConfigInvalid, "ENCRYPTION=gpg needs GPG_RECIPIENT, key IDs, fingerprints or emails")
+	}
+	args := []string{"--batch", "--yes", "--quiet", "--armor", "--encrypt"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	return runFilter("gpg", plain, args...)
+}
+
+func (gpgCipher) open(sealed []byte) ([]byte, error) {
+	// Not --batch, so gpg-agent can ask for a passphrase or a card PIN
+	return runFilter("gpg", sealed, "--quiet", "--decrypt")
+}
+
+// runFilter pipes input through a command and returns what it printed.
+func runFilter(name string, input []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, codeErrorf(ErrConfigInvalid, "%s is not installed", name)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stderr = bytes.NewReader(input), &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// sealInto encrypts the note at plainPath into dir under the same name plus
+// the cipher's suffix, or another name when that one is taken.
+func sealInto(c noteCipher, plainPath, dir string) (string, error) {
+	plain, err := os.ReadFile(plainPath)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := c.seal(plain)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(filepath.Base(plainPath), ".md")
+	path := filepath.Join(dir, base+".md"+c.ext())
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	for os.IsExist(err) {
+		path = filepath.Join(dir, base+"_"+newID()+".md"+c.ext())
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(sealed); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// openSealed decrypts the note at path into a private temporary directory
+// and returns the plain file; cleanup removes it.
+func openSealed(config *CONFIG, path string) (plainPath string, cleanup func(), err error) {
+	c := sealedCipher(config, path)
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	plain, err := c.open(sealed)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "syt-sealed")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	// The editor sees a .md file, so it highlights markdown
+	plainPath = filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), c.ext()))
+	if err := os.WriteFile(plainPath, plain, 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return plainPath, cleanup, nil
+}
+
+// editSealedNote is editNote for an encrypted note: it is edited as a
+// decrypted copy, sealed again when it changed, and synced.
+func editSealedNote(config *CONFIG, path string) error {
+	plainPath, cleanup, err := openSealed(config, path)
+	if err != nil {
+		return err
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			cleanup()
+		}
+	}()
+	before, err := os.ReadFile(plainPath)
+	if err != nil {
+		return err
+	}
+	if err := markPending(config, path); err != nil {
+		log.Printf("Could not record pending sync: %v", err)
+	}
+	if err := openEditor(config.Editor, plainPath); err != nil {
+		return fmt.Errorf("opening editor: %w", err)
+	}
+	if err := recordVisit(config, path); err != nil {
+		log.Printf("Could not record visit: %v", err)
+	}
+	after, err := os.ReadFile(plainPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(before, after) {
+		sealed, err := sealedCipher(config, path).seal(after)
+		if err != nil {
+			keep = true
+			return fmt.Errorf("encrypting %s: %w; the edited text is left in %s", filepath.Base(path), err, plainPath)
+		}
+		if err := writeFileAtomic(path, sealed); err != nil {
+			return err
+		}
+	}
+	_ = syncTracked(config, syncBackends(config), sealedNoteType(plainPath), path)
+	return nil
+}
+
+// newSealedNote is the end of runNew when notes are encrypted: the note is
+// written and edited in a private temporary directory, then sealed into dir.
+func newSealedNote(config *CONFIG, c noteCipher, dir, title, header string, capture bool) (string, error) {
+	tmp, err := os.MkdirTemp("", "syt-sealed")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	// Find out the cipher can't seal before anything is written
+	if _, err := c.seal([]byte(header)); err != nil {
+		return "", fmt.Errorf("encrypting the note: %w", err)
+	}
+	plainPath, err := createNewNoteFile(tmp, config.FilenamePrefix, title, header)
+	if err != nil {
+		return "", fmt.Errorf("creating new note file: %w", err)
+	}
+	if !capture {
+		if err := openEditor(config.Editor, plainPath); err != nil {
+			return "", fmt.Errorf("opening editor: %w", err)
+		}
+	}
+	path, err := sealInto(c, plainPath, dir)
+	if err != nil {
+		return "", fmt.Errorf("encrypting the note: %w", err)
+	}
+	if err := recordVisit(config, path); err != nil {
+		log.Printf("Could not record visit: %v", err)
+	}
+	if err := markPending(config, path); err != nil {
+		log.Printf("Could not record pending sync: %v", err)
+	}
+	_ = syncTracked(config, syncBackends(config), sealedNoteType(plainPath), path)
+	return path, nil
+}
+
+// sealedNoteType reads the type of a decrypted note.
+func sealedNoteType(plainPath string) NoteType {
+	var t NoteType
+	if note, err := readNote(plainPath); err == nil && note.Meta["type"] != "" {
+		t, _ = lookupType(note.Meta["type"])
+	}
+	return t
+}
+
+// runEncrypt seals notes kept in the clear with the ENCRYPTION cipher and
+// removes the plain files. With git the change is committed in one go; the
+// plain text stays in the history that was already pushed.
+func runEncrypt(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: syt encrypt <note>...")
+	}
+	c, err := configuredCipher(config)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return codeErrorf(ErrConfigInvalid, "set ENCRYPTION to encrypt notes")
+	}
+	var changed []string
+	for _, arg := range args {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			if path, err = findNote(config, arg); err != nil {
+				return err
+			}
+		}
+		if isSealed(path) {
+			fmt.Printf("%s is already encrypted.\n", relNotePath(config.NotesDir, path))
+			continue
+		}
+		sealed, err := sealInto(c, path, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted %s\n", relNotePath(config.NotesDir, sealed))
+		changed = append(changed, sealed, path)
+	}
+	if len(changed) == 0 || !config.GitEnabled {
+		return nil
+	}
+	if err := commitBatch(config, changed); err != nil {
+		return err
+	}
+	fmt.Println("Earlier commits still hold the plain text; rewrite the history to remove it.")
+	return nil
+}
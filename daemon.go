@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// daemonRequest is one line of the daemon's JSON protocol. Clients send a
+// request per line and get one response line back:
+//
+//	{"op":"ping"}
+//	{"op":"append","path":"journal/2024-05-01.md","text":"- 10:00 idea\n"}
+//	{"op":"run","args":["tags","--tree"],"accessible":false,"config":"9f2c…"}
+//	{"op":"notes","with_body":true}
+type daemonRequest struct {
+	Op       string   `json:"op"`
+	Path     string   `json:"path,omitempty"`
+	Text     string   `json:"text,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	WithBody bool     `json:"with_body,omitempty"`
+
+	// Presentation settings of the client for "run"
+	Accessible bool `json:"accessible,omitempty"`
+	// Config is the client's configFingerprint for "run"
+	Config string `json:"config,omitempty"`
+}
+
+type daemonResponse struct {
+	OK     bool      `json:"ok"`
+	Error  string    `json:"error,omitempty"`
+	Code   ErrorCode `json:"code,omitempty"`
+	Output string    `json:"output,omitempty"`
+	Notes  []*Note   `json:"notes,omitempty"`
+}
+
+// routedCommands can be answered by the daemon: they don't open an editor or
+// prompt. Subcommands that do are excluded in routable.
+var routedCommands = map[string]bool{
+	"people": true,
+	"map":    true,
+	"prose":  true,
+	"tags":   true,
+	"types":  true,
+	"lang":   true,
+	"search": true,
+	"recent": true,
+	"list":   true,
+}
+
+// routable reports whether command can be handed to a running daemon.
+func routable(command string, args []string) bool {
+	if !routedCommands[command] {
+		return false
+	}
+	switch command {
+	case "people":
+		return len(args) == 0 // with a name it opens the editor
+	case "tags":
+		// suggest prompts, rename asks for confirmation
+		return len(args) == 0 || (args[0] != "suggest" && args[0] != "rename")
+	case "lang":
+		for _, arg := range args {
+			if strings.TrimLeft(arg, "-") == "detect" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// appendJob is a queued append waiting for the daemon's writer goroutine.
+type appendJob struct {
+	path string
+	text string
+	done chan error
+}
+
+func socketPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "daemon.sock")
+}
+
+// runDaemon serves requests on a Unix socket in the state directory until it
+// is interrupted. Appends from all clients go through a single queue, so
+// journal entries typed in several terminals at once never interleave.
+func runDaemon(config *CONFIG, args []string) error {
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	gcInterval, err := parseRetention(config.GitGCInterval)
+	if err != nil {
+		return codeErrorf(ErrConfigInvalid, "GIT_GC_INTERVAL: %v", err)
+	}
+	debounce, err := parseRetention(config.WatchDebounce)
+	if err != nil {
+		return codeErrorf(ErrConfigInvalid, "WATCH_DEBOUNCE: %v", err)
+	}
+	path := socketPath(config)
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already running on %s", path)
+	}
+	os.Remove(path) // left behind by a daemon that didn't shut down cleanly
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		listener.Close()
+	}()
+
+	// Keep parsed notes in memory across requests
+	enableNoteCache()
+	idx, err := startIndex(config.NotesDir)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	activeIndex = idx
+
+	queue := make(chan appendJob)
+	go func() {
+		for job := range queue {
+			err := appendNote(config, job.path, job.text)
+			if err == nil {
+				err = idx.refresh()
+			}
+			job.done <- err
+		}
+	}()
+
+	// Apply the trash retention policy now and then
+	go func() {
+		for ; ; time.Sleep(trashPurgeInterval) {
+			autoPurgeTrash(config)
+		}
+	}()
+	// Keep the notes repository packed
+	if gcInterval > 0 {
+		go func() {
+			for ; ; time.Sleep(gcInterval) {
+				autoGitMaintenance(config)
+			}
+		}()
+	}
+	// Push held commits once their squash window has passed
+	if config.GitEnabled && config.GitSquashWindow != "" {
+		go func() {
+			for ; ; time.Sleep(squashCheckInterval) {
+				autoPushSquashed(config)
+			}
+		}()
+	}
+	// Sync notes edited outside syt once they settle
+	if debounce > 0 && len(syncBackends(config)) > 0 {
+		go watchNotes(config, idx, debounce)
+	}
+	// Tell about changes to followed notes that others pushed
+	if config.GitEnabled {
+		go func() {
+			for ; ; time.Sleep(subscriptionCheckInterval) {
+				checkSubscriptions(config)
+			}
+		}()
+	}
+	// Publish scheduled notes as their time arrives
+	go func() {
+		for ; ; time.Sleep(publishCheckInterval) {
+			autoPublish(config)
+		}
+	}()
+
+	// Seal what changed into an encrypted vault
+	if config.VaultContainer != "" {
+		go sealPeriodically(config)
+	}
+
+	fmt.Printf("syt daemon listening on %s\n", path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(queue)
+			os.Remove(path)
+			fmt.Println("syt daemon stopped")
+			return nil
+		}
+		go serveDaemonConn(config, conn, queue)
+	}
+}
+
+func serveDaemonConn(config *CONFIG, conn net.Conn, queue chan<- appendJob) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req daemonRequest
+		var resp daemonResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = daemonResponse{Error: "malformed request: " + err.Error()}
+		} else {
+			resp = handleDaemonRequest(config, req, queue)
+		}
+		if err := enc.Encode(resp); err != nil {
+			log.Printf("daemon: writing response: %v", err)
+			return
+		}
+	}
+}
+
+func handleDaemonRequest(config *CONFIG, req daemonRequest, queue chan<- appendJob) daemonResponse {
+	var resp daemonResponse
+	var err error
+	switch req.Op {
+	case "ping":
+	case "append":
+		job := appendJob{path: req.Path, text: req.Text, done: make(chan error, 1)}
+		queue <- job
+		err = <-job.done
+	case "run":
+		if len(req.Args) == 0 || !routable(req.Args[0], req.Args[1:]) {
+			err = fmt.Errorf("command can't be run by the daemon")
+			break
+		}
+		if req.Config != configFingerprint(config) {
+			err = errConfigDiffers
+			break
+		}
+		client := *config
+		client.Accessible = req.Accessible
+		resp.Output, err = captureOutput(func() error {
+			defer activeIndex.pin()()
+			return runCommand(&client, req.Args[0], req.Args[1:])
+		})
+	case "notes":
+		resp.Notes = activeIndex.snapshot(req.WithBody)
+	default:
+		err = fmt.Errorf("unknown op %q", req.Op)
+	}
+	resp.OK = err == nil
+	if err != nil {
+		resp.Error, resp.Code = err.Error(), errorCode(err)
+	}
+	return resp
+}
+
+// runMu serialises commands run on behalf of clients, since they share the
+// process's stdout and the pinned index snapshot.
+var runMu sync.Mutex
+
+// captureOutput runs fn with stdout redirected and returns what it printed.
+func captureOutput(fn func() error) (string, error) {
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	var buf bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&buf, r)
+		close(copied)
+	}()
+
+	runErr := fn()
+	os.Stdout = stdout
+	w.Close()
+	<-copied
+	r.Close()
+	return buf.String(), runErr
+}
+
+// callDaemon sends a request to a running daemon. It returns errDaemonDown
+// when no daemon is listening, so callers can fall back to doing the work
+// themselves.
+func callDaemon(config *CONFIG, req daemonRequest) (daemonResponse, error) {
+	conn, err := net.DialTimeout("unix", socketPath(config), 200*time.Millisecond)
+	if err != nil {
+		return daemonResponse{}, errDaemonDown
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return daemonResponse{}, err
+	}
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return daemonResponse{}, fmt.Errorf("reading daemon response: %w", err)
+	}
+	if !resp.OK {
+		return resp, withCode(resp.Code, errors.New(resp.Error))
+	}
+	return resp, nil
+}
+
+// callDaemonRun runs a subcommand inside the daemon and returns its output.
+// The daemon can't see our terminal, so colored search output is requested
+// explicitly when we'd have used it. Nor does it share our working
+// directory, so paths are made absolute, and when our settings differ from
+// the daemon's the command is left to us: errDaemonDown.
+func callDaemonRun(config *CONFIG, command string, args []string) (string, error) {
+	if command == "search" && (len(args) == 0 || args[0] != "reindex") && useColor("auto", config.Accessible) {
+		args = append([]string{"--color=always"}, args...)
+	}
+	resp, err := callDaemon(config, daemonRequest{
+		Op:         "run",
+		Args:       append([]string{command}, absoluteArgs(command, args)...),
+		Accessible: config.Accessible,
+		Config:     configFingerprint(config),
+	})
+	if err != nil && err.Error() == errConfigDiffers.Error() {
+		return "", errDaemonDown
+	}
+	return resp.Output, err
+}
+
+var (
+	errDaemonDown    = errors.New("daemon not running")
+	errConfigDiffers = errors.New("the daemon runs with other settings")
+)
+
+// configFingerprint identifies the settings commands run with, leaving out
+// the ones a client passes along or that stop it routing anyway.
+func configFingerprint(config *CONFIG) string {
+	c := *config
+	c.Direct, c.Yes, c.Force, c.Accessible = false, false, false, false
+	c.NotesDir, _ = filepath.Abs(c.NotesDir)
+	c.GitRepoPath, _ = filepath.Abs(c.GitRepoPath)
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// absoluteArgs makes the paths among a command's arguments absolute: -o
+// output files, and for prose the note when it names a file here.
+func absoluteArgs(command string, args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = arg
+		switch {
+		case i > 0 && (args[i-1] == "-o" || args[i-1] == "--o"):
+		case strings.HasPrefix(arg, "-o=") || strings.HasPrefix(arg, "--o="):
+			flag, path, _ := strings.Cut(arg, "=")
+			if abs, err := filepath.Abs(path); err == nil {
+				out[i] = flag + "=" + abs
+			}
+			continue
+		case command != "prose" || strings.HasPrefix(arg, "-") || filepath.IsAbs(arg) || !fileExists(arg):
+			continue
+		}
+		if abs, err := filepath.Abs(arg); err == nil {
+			out[i] = abs
+		}
+	}
+	return out
+}
+
+// lockedAppend appends text to path while holding the file's lock, so
+// writers without a daemon are serialised too.
+func lockedAppend(path, text string) error {
+	unlock, err := acquireLock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return appendToFile(path, text)
+}
+
+// trashPurgeInterval is how often the daemon purges expired trash.
+const trashPurgeInterval = time.Hour
+
+func autoPurgeTrash(config *CONFIG) {
+	expired, err := purgeTrash(config, false)
+	if err != nil {
+		log.Printf("daemon: purging trash: %v", err)
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+	var freed int64
+	for _, e := range expired {
+		freed += e.Size
+	}
+	log.Printf("daemon: purged %d note(s) from the trash (%s freed)", len(expired), formatSize(freed))
+}
+
+// publishCheckInterval is how often the daemon looks for due publish_at notes.
+const publishCheckInterval = time.Minute
+
+// autoPublish publishes due notes. It holds runMu because publishing prints,
+// and client commands capture stdout while they run.
+func autoPublish(config *CONFIG) {
+	runMu.Lock()
+	defer runMu.Unlock()
+	startRun()
+	n, err := publishDue(config)
+	if err != nil {
+		log.Printf("daemon: publishing scheduled notes: %v", err)
+	} else if n > 0 {
+		log.Printf("daemon: published %d scheduled note(s)", n)
+	}
+}
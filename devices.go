@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unionMergeMarker opens the block syt keeps in the repository's
+// info/attributes; unionMergeEnd closes it.
+const (
+	unionMergeMarker = "# syt: union merge (UNION_MERGE_PATHS)"
+	unionMergeEnd    = "# syt: end"
+)
+
+// hostName is the machine's short host name, the default DEVICE_NAME.
+func hostName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "device"
+	}
+	name, _, _ = strings.Cut(name, ".")
+	return name
+}
+
+// deviceBranch is the branch this machine pushes to with
+// GIT_DEVICE_BRANCHES, e.g. notes/laptop.
+func deviceBranch(config *CONFIG) string {
+	return "notes/" + slugify(config.DeviceName)
+}
+
+// pushRemote is the remote the current branch pushes to, origin if it has
+// none configured.
+func pushRemote(root string) string {
+	if branch, err := gitOutput(root, "symbolic-ref", "--short", "HEAD"); err == nil {
+		if remote, err := gitOutput(root, "config", "--get", "branch."+strings.TrimSpace(branch)+".remote"); err == nil {
+			return strings.TrimSpace(remote)
+		}
+	}
+	return "origin"
+}
+
+// pushedRef names what syt's pushes have already reached: this machine's
+// device branch once it exists, otherwise the upstream branch.
+func pushedRef(config *CONFIG, root string) string {
+	if config.DeviceBranches {
+		ref := "refs/remotes/" + pushRemote(root) + "/" + deviceBranch(config)
+		if _, err := gitOutput(root, "rev-parse", "--verify", "--quiet", ref); err == nil {
+			return ref
+		}
+	}
+	return "@{upstream}"
+}
+
+// runSyncMerge brings the notes every machine pushed to its device branch
+// into the current branch, normally main, and pushes the result. Files
+// matching UNION_MERGE_PATHS, such as daily notes that only ever have lines
+// appended, are merged by keeping the lines of both sides, so entries made
+// on two machines the same day don't conflict. Any other conflict aborts
+// that merge and is reported.
+func runSyncMerge(config *CONFIG, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: syt sync merge")
+	}
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	if err := setUnionMerge(config, root); err != nil {
+		return err
+	}
+	remote := pushRemote(root)
+	if err := gitIn(root, "fetch", "--prune", remote); err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+
+	var refs []string
+	if upstream, err := gitOutput(root, "rev-parse", "--abbrev-ref", "@{upstream}"); err == nil {
+		refs = append(refs, strings.TrimSpace(upstream))
+	}
+	out, err := gitOutput(root, "for-each-ref", "--format=%(refname:short)", "refs/remotes/"+remote+"/notes/")
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	refs = append(refs, strings.Fields(out)...)
+
+	merged := 0
+	for _, ref := range refs {
+		if _, err := gitOutput(root, "merge-base", "--is-ancestor", ref, "HEAD"); err == nil {
+			continue
+		}
+		if _, err := gitOutput(root, "merge", "--no-edit", "-m", "Merge notes from "+ref, ref); err != nil {
+			conflicts, _ := gitOutput(root, "diff", "--name-only", "--diff-filter=U")
+			if conflicts = strings.TrimSpace(conflicts); conflicts == "" {
+				return withCode(ErrGitFailed, err)
+			}
+			gitOutput(root, "merge", "--abort")
+			return codeErrorf(ErrGitFailed, "merging %s: conflicts in %s; the merge was undone, run git merge %s to resolve them by hand",
+				ref, strings.Join(strings.Fields(conflicts), ", "), ref)
+		}
+		fmt.Printf("Merged %s.\n", ref)
+		merged++
+	}
+	if merged == 0 {
+		fmt.Println("Every device branch is merged already.")
+		return nil
+	}
+
+	if err := runGitPush(root); err != nil {
+		return err
+	}
+	if config.DeviceBranches {
+		return gitPush(config, root)
+	}
+	return nil
+}
+
+// setUnionMerge marks the files matching UNION_MERGE_PATHS for git's union
+// merge in the repository's info/attributes, which, unlike .gitattributes,
+// is never committed. The patterns are relative to the notes directory.
+func setUnionMerge(config *CONFIG, root string) error {
+	out, err := gitOutput(root, "rev-parse", "--git-path", "info/attributes")
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	path := strings.TrimSpace(out)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	notesDir, err := filepath.Abs(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	prefix, err := filepath.Rel(root, notesDir)
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		switch {
+		case line == unionMergeMarker:
+			inBlock = true
+		case inBlock && line == unionMergeEnd:
+			inBlock = false
+		case !inBlock && line != "":
+			kept = append(kept, line)
+		}
+	}
+	if patterns := splitList(config.UnionMergePaths); len(patterns) > 0 {
+		kept = append(kept, unionMergeMarker)
+		for _, pattern := range patterns {
+			if prefix != "." {
+				pattern = filepath.ToSlash(filepath.Join(prefix, pattern))
+			}
+			kept = append(kept, pattern+" merge=union")
+		}
+		kept = append(kept, unionMergeEnd)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(strings.Join(kept, "\n")+"\n"))
+}
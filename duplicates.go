@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const duplicateSimilarity = 0.8
+
+// findDuplicate returns an existing note whose title matches title exactly
+// (ignoring case and punctuation) or closely enough to be the same topic.
+func findDuplicate(notes []*Note, title string) *Note {
+	want := normalizeTitle(title)
+	if want == "" {
+		return nil
+	}
+	var best *Note
+	bestScore := 0.0
+	for _, note := range notes {
+		have := normalizeTitle(note.Title)
+		if have == want {
+			return note
+		}
+		if score := similarity(have, want); score >= duplicateSimilarity && score > bestScore {
+			best, bestScore = note, score
+		}
+	}
+	return best
+}
+
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range foldText(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// similarity is 1 minus the Levenshtein distance relative to the longer
+// string, so 1 means identical.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// resolveDuplicate warns about an existing note with the same title and asks
+// what to do. It returns the path of the note to edit instead of creating a
+// new one, or "" to go ahead and create it.
+func resolveDuplicate(config *CONFIG, title string) (string, error) {
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return "", err
+	}
+	dup := findDuplicate(notes, title)
+	if dup == nil {
+		return "", nil
+	}
+	fmt.Printf(tr("A note with a similar title already exists: %s (%s)\n"), dup.Title, dup.Path)
+	if !isTerminal(os.Stdin) {
+		return "", nil
+	}
+
+	fmt.Print(tr("[o]pen it, [a]ppend to it, [p]roceed with a new note or [q]uit? [p] "))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "o":
+		return dup.Path, nil
+	case "a":
+		section := fmt.Sprintf("\n## %s\n\n", currentTime().Format("2006-01-02 15:04"))
+		if err := appendToFile(dup.Path, section); err != nil {
+			return "", err
+		}
+		return dup.Path, nil
+	case "q":
+		return "", errors.New(tr("aborted"))
+	}
+	return "", nil
+}
+
+func appendToFile(path, text string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrorCode says what kind of failure an error is, for scripts and hooks
+// that need to tell, say, an expired git credential from a missing note.
+type ErrorCode string
+
+const (
+	ErrInternal          ErrorCode = "Internal" // anything not classified below
+	ErrUsage             ErrorCode = "Usage"
+	ErrConfigInvalid     ErrorCode = "ConfigInvalid"
+	ErrNoteNotFound      ErrorCode = "NoteNotFound"
+	ErrAborted           ErrorCode = "Aborted"
+	ErrEditorFailed      ErrorCode = "EditorFailed"
+	ErrGitFailed         ErrorCode = "GitFailed"
+	ErrGitAuth           ErrorCode = "GitAuth"
+	ErrNotionFailed      ErrorCode = "NotionFailed"
+	ErrNotionRateLimited ErrorCode = "NotionRateLimited"
+	ErrPublishChecks     ErrorCode = "PublishChecks"
+	ErrBudgetExceeded    ErrorCode = "BudgetExceeded"
+)
+
+// codedError attaches an ErrorCode to an error. It wraps the error, so
+// errors.Is and errors.As still see through it, and wrapping it again with
+// %w keeps the code.
+type codedError struct {
+	code ErrorCode
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode tags err with code. A nil err stays nil, and an error that
+// already has a code keeps it, so the innermost classification wins.
+func withCode(code ErrorCode, err error) error {
+	if err == nil || code == "" {
+		return err
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return err
+	}
+	return &codedError{code, err}
+}
+
+// codeErrorf is fmt.Errorf for a classified error.
+func codeErrorf(code ErrorCode, format string, args ...any) error {
+	return withCode(code, fmt.Errorf(format, args...))
+}
+
+// errorCode returns the code err carries, or ErrInternal.
+func errorCode(err error) ErrorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	if strings.HasPrefix(err.Error(), "usage: ") {
+		return ErrUsage
+	}
+	return ErrInternal
+}
+
+// errorReport is how a failure is described in JSON output and to the
+// ERROR_HOOK command.
+type errorReport struct {
+	Command string    `json:"command"`
+	Args    []string  `json:"args,omitempty"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// exitWithError reports a failed command and exits. With --json among the
+// command's arguments, or ERROR_FORMAT=json, the report goes to stdout as
+// JSON instead of a log line, so scripts reading the command's JSON output
+// get one either way. ERROR_HOOK, if set, is run with the report on stdin.
+func exitWithError(config *CONFIG, command string, args []string, err error) {
+	report := errorReport{Command: command, Args: args, Code: errorCode(err), Message: err.Error(), Time: currentTime()}
+	if config.ErrorHook != "" {
+		if hookErr := runErrorHook(config.ErrorHook, report); hookErr != nil {
+			log.Printf("Error hook failed: %v", hookErr)
+		}
+	}
+	asJSON := config.ErrorFormat == "json"
+	for _, arg := range args {
+		asJSON = asJSON || arg == "--json" || arg == "-json"
+	}
+	if asJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]errorReport{"error": report})
+		os.Exit(1)
+	}
+	log.Fatalf(tr("Error: %v"), err)
+}
+
+func runErrorHook(hook string, report errorReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-c", hook)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "SYT_ERROR_CODE="+string(report.Code), "SYT_COMMAND="+report.Command)
+	return cmd.Run()
+}
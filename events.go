@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// noteEvent tells clients that a note appeared, changed or went away.
+type noteEvent struct {
+	ID    uint64 `json:"id"`
+	Type  string `json:"type"` // created, changed or deleted
+	Path  string `json:"path"`
+	Title string `json:"title,omitempty"`
+}
+
+// vaultWatcher polls the vault for changes, the same way the daemon keeps
+// its index fresh, and fans the resulting events out to subscribers. Changes
+// made through the API trigger a poll straight away rather than waiting for
+// the next tick.
+type vaultWatcher struct {
+	config *CONFIG
+
+	mu     sync.Mutex
+	seen   map[string]*Note
+	nextID uint64
+	subs   map[chan noteEvent]bool
+}
+
+func newVaultWatcher(config *CONFIG) (*vaultWatcher, error) {
+	w := &vaultWatcher{config: config, subs: map[chan noteEvent]bool{}}
+	if _, err := w.poll(); err != nil {
+		return nil, err
+	}
+	go func() {
+		for range time.Tick(indexRefresh) {
+			if _, err := w.poll(); err != nil {
+				log.Printf("serve: watching notes: %v", err)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// poll compares the vault with what was seen last time and publishes the
+// differences.
+func (w *vaultWatcher) poll() ([]noteEvent, error) {
+	notes, err := scanNotes(w.config.NotesDir)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	current := make(map[string]*Note, len(notes))
+	var events []noteEvent
+	for _, note := range notes {
+		key := visitKey(w.config, note.Path)
+		current[key] = note
+		if w.seen == nil {
+			continue
+		}
+		old := w.seen[key]
+		switch {
+		case old == nil:
+			events = append(events, noteEvent{Type: "created", Path: key, Title: note.Title})
+		case !old.ModTime.Equal(note.ModTime) || old.Size != note.Size:
+			events = append(events, noteEvent{Type: "changed", Path: key, Title: note.Title})
+		}
+	}
+	for key := range w.seen {
+		if current[key] == nil {
+			events = append(events, noteEvent{Type: "deleted", Path: key})
+		}
+	}
+	w.seen = current
+	for i := range events {
+		w.nextID++
+		events[i].ID = w.nextID
+		for ch := range w.subs {
+			select {
+			case ch <- events[i]:
+			default: // a stalled client misses events rather than blocking everyone
+			}
+		}
+	}
+	return events, nil
+}
+
+func (w *vaultWatcher) subscribe() chan noteEvent {
+	ch := make(chan noteEvent, 64)
+	w.mu.Lock()
+	w.subs[ch] = true
+	w.mu.Unlock()
+	return ch
+}
+
+func (w *vaultWatcher) unsubscribe(ch chan noteEvent) {
+	w.mu.Lock()
+	delete(w.subs, ch)
+	w.mu.Unlock()
+}
+
+// handleEvents streams note events as server-sent events until the client
+// goes away. A comment line every 30 seconds keeps proxies from timing the
+// connection out.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	ch := s.watcher.subscribe()
+	defer s.watcher.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx buffers responses otherwise
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev := <-ch:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "id: %d\nevent: note\ndata: %s\n\n", ev.ID, data)
+		}
+		flusher.Flush()
+	}
+}
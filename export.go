@@ -0,0 +1,202 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runExport writes a slice of the vault, the named notes or those the
+// filters pick, as a zip archive or a single HTML document, for handing over
+// to someone without access to the vault. Archives keep the notes' paths and
+// take along the local images they show. Notes tagged publish are left out
+// while they fail their publish checks, unless --force. With --redact-profile
+// the copy is sanitized as it is written: the vault itself is never changed.
+func runExport(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "zip", "zip or html")
+	out := fs.String("o", "", "output file (default stdout)")
+	profile := fs.String("redact-profile", "", "redact what this profile covers, e.g. gdpr")
+	fs.BoolVar(&config.Force, "force", false, "export notes tagged publish even if they fail their checks")
+	filter := addNoteFilter(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "zip" && *format != "html" {
+		return fmt.Errorf("usage: syt export [--format zip|html] [-o file] [--redact-profile name] [--force] [--tag tag] [--where cond] [note...]")
+	}
+	var redact *redactor
+	if *profile != "" {
+		var err error
+		if redact, err = loadRedactor(*profile); err != nil {
+			return err
+		}
+	}
+	if *format == "zip" && *out == "" && isTerminal(os.Stdout) {
+		return codeErrorf(ErrUsage, "not writing a zip archive to the terminal; use -o file")
+	}
+
+	var notes []*Note
+	if fs.NArg() == 0 {
+		all, err := vaultNotes(config, true)
+		if err != nil {
+			return err
+		}
+		notes = all
+	}
+	for _, arg := range fs.Args() {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			return err
+		}
+		note, err := readNote(path)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+	notes = filter.filter(notes)
+	if redact != nil && redact.people {
+		notes = withoutPersonNotes(config, notes)
+	}
+	// Notes tagged publish leave the vault only once they pass their checks,
+	// as on the site; failures go to stderr, stdout may be the export
+	var passed []*Note
+	for _, note := range notes {
+		if !hasTag(note, "publish") {
+			passed = append(passed, note)
+		} else if ok, err := passesGatesTo(config, os.Stderr, note); err != nil {
+			return err
+		} else if ok {
+			passed = append(passed, note)
+		}
+	}
+	notes = passed
+	if len(notes) == 0 {
+		return codeErrorf(ErrNoteNotFound, "no notes match")
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Path < notes[j].Path })
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	var err error
+	if *format == "zip" {
+		err = writeNoteArchive(config, w, notes, redact)
+	} else {
+		err = writeNoteDocument(w, notes, redact)
+	}
+	if err == nil && redact != nil {
+		fmt.Fprintf(os.Stderr, "Redacted with the %s profile (%s)\n", *profile, redact)
+	}
+	if err == nil && *out != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d note(s) to %s\n", len(notes), *out)
+	}
+	return err
+}
+
+// withoutPersonNotes drops the notes kept in PEOPLE_DIR, which are about
+// one person each.
+func withoutPersonNotes(config *CONFIG, notes []*Note) []*Note {
+	dir := filepath.Join(config.NotesDir, config.PeopleDir)
+	var kept []*Note
+	for _, note := range notes {
+		if rel, err := filepath.Rel(dir, note.Path); err != nil || !filepath.IsLocal(rel) {
+			kept = append(kept, note)
+		}
+	}
+	return kept
+}
+
+// writeNoteArchive zips the notes as they are on disk, at their paths in
+// the vault, along with the vault images they embed. When redacting, the
+// notes are redacted and the images left out, since what they show can't
+// be.
+func writeNoteArchive(config *CONFIG, w io.Writer, notes []*Note, redact *redactor) error {
+	archive := zip.NewWriter(w)
+	added := map[string]bool{}
+	add := func(path string) error {
+		rel := relNotePath(config.NotesDir, path)
+		if added[rel] || !filepath.IsLocal(rel) {
+			return nil
+		}
+		added[rel] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if redact != nil {
+			data = []byte(redact.apply(string(data)))
+		}
+		dst, err := archive.Create(rel)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(data)
+		return err
+	}
+	for _, note := range notes {
+		if err := add(note.Path); err != nil {
+			return err
+		}
+		if redact != nil {
+			continue
+		}
+		for _, m := range mdImage.FindAllStringSubmatch(note.Body, -1) {
+			if remoteImage(m[2]) {
+				continue
+			}
+			image := filepath.Join(filepath.Dir(note.Path), filepath.FromSlash(m[2]))
+			if fileExists(image) {
+				if err := add(image); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return archive.Close()
+}
+
+// writeNoteDocument renders the notes into one HTML page with a table of
+// contents, which also prints well to PDF from a browser.
+func writeNoteDocument(w io.Writer, notes []*Note, redact *redactor) error {
+	text := func(s string) string {
+		if redact != nil {
+			return redact.apply(s)
+		}
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Notes</title>
+<style>body { font: 16px/1.6 system-ui, sans-serif; max-width: 45rem; margin: 2rem auto; padding: 0 1rem; }
+pre { background: #8881; padding: 1rem; overflow-x: auto; } img { max-width: 100%; }
+article { break-before: page; }</style>
+</head><body>
+<nav><ol>
+`)
+	for i, note := range notes {
+		fmt.Fprintf(&b, "<li><a href=\"#note-%d\">%s</a></li>\n", i+1, html.EscapeString(text(noteTitle(note))))
+	}
+	b.WriteString("</ol></nav>\n")
+	for i, note := range notes {
+		fmt.Fprintf(&b, "<article id=\"note-%d\">\n<h1>%s</h1>\n%s</article>\n", i+1,
+			html.EscapeString(text(noteTitle(note))), markdownToHTML(text(withoutComments(note.Body))))
+	}
+	b.WriteString("</body></html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	mrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncFailure records a backend that has failed to take a note, for
+// `syt sync --retry-failed`.
+type SyncFailure struct {
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	At       time.Time `json:"at"`
+}
+
+// pushWithRetry pushes a note to one backend, trying again up to
+// SYNC_RETRIES times with a growing pause. Mistakes in the configuration or
+// the note aren't retried, since they won't go away by themselves, and
+// neither is a push that would go over budget (see budget.go). The outcome
+// is recorded in the state database.
+func pushWithRetry(config *CONFIG, b SyncBackend, notePath string) error {
+	err := checkBudget(config, b.Name(), notePath)
+	attempt := 0
+	for ; err == nil; attempt++ {
+		err = b.Push(config, notePath)
+		if serr := saveUploaded(config); serr != nil {
+			log.Printf("Could not record the upload budget: %v", serr)
+		}
+		if err == nil || attempt >= config.SyncRetries {
+			break
+		}
+		if code := errorCode(err); code == ErrConfigInvalid || code == ErrPublishChecks || code == ErrGitAuth || code == ErrBudgetExceeded {
+			break
+		}
+		wait := syncBackoff(attempt)
+		log.Printf("Syncing to %s failed: %v; retrying in %s", b.Name(), err, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+	if rerr := recordFailure(config, b.Name(), notePath, err, attempt+1); rerr != nil {
+		log.Printf("Could not record the %s sync: %v", b.Name(), rerr)
+	}
+	return err
+}
+
+// syncBackoff is how long to wait before retry attempt+1: two seconds
+// doubling with each attempt, up to a minute, spread so that backends which
+// failed together don't retry together.
+func syncBackoff(attempt int) time.Duration {
+	d := min(2*time.Second<<attempt, time.Minute)
+	return d/2 + time.Duration(mrand.Int64N(int64(d)))
+}
+
+// recordFailure stores that backend failed to take the note, or forgets an
+// earlier failure once it has. A nil err with nothing recorded doesn't touch
+// the state database.
+func recordFailure(config *CONFIG, backend, notePath string, err error, attempts int) error {
+	key := visitKey(config, notePath)
+	if err == nil {
+		state, lerr := loadState(config)
+		if lerr != nil || state.Failed[key][backend] == nil {
+			return lerr
+		}
+	}
+	return updateState(config, func(s *State) error {
+		if err == nil {
+			delete(s.Failed[key], backend)
+			if len(s.Failed[key]) == 0 {
+				delete(s.Failed, key)
+			}
+			return nil
+		}
+		if s.Failed == nil {
+			s.Failed = map[string]map[string]*SyncFailure{}
+		}
+		if s.Failed[key] == nil {
+			s.Failed[key] = map[string]*SyncFailure{}
+		}
+		total := attempts
+		if prev := s.Failed[key][backend]; prev != nil {
+			total += prev.Attempts
+		}
+		s.Failed[key][backend] = &SyncFailure{Error: err.Error(), Attempts: total, At: currentTime()}
+		return nil
+	})
+}
+
+// runSyncRetryFailed is `syt sync --retry-failed`: each note goes again to
+// just the backends that failed to take it. Notes deleted since are
+// forgotten.
+func runSyncRetryFailed(config *CONFIG) error {
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	if len(state.Failed) == 0 {
+		fmt.Println("No failed syncs to retry.")
+		return nil
+	}
+	var keys []string
+	for key := range state.Failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	syncTally = &syncSummary{}
+	defer func() { syncTally = nil }()
+	failed, code := 0, ErrorCode("")
+	for _, key := range keys {
+		path := filepath.Join(config.NotesDir, filepath.FromSlash(key))
+		note, err := readNote(path)
+		if os.IsNotExist(err) {
+			if err := updateState(config, func(s *State) error {
+				delete(s.Failed, key)
+				return nil
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var backends []SyncBackend
+		for _, b := range syncBackends(config) {
+			if state.Failed[key][b.Name()] != nil {
+				backends = append(backends, b)
+			}
+		}
+		if len(backends) == 0 {
+			// The backend has been switched off since
+			continue
+		}
+		var t NoteType
+		if note.Meta["type"] != "" {
+			t, _ = lookupType(note.Meta["type"])
+		}
+		fmt.Printf("Retrying %s\n", key)
+		if err := syncTracked(config, backends, t, path); err != nil {
+			failed, code = failed+1, errorCode(err)
+		}
+	}
+	syncTally.print()
+	if failed > 0 {
+		return codeErrorf(code, "%d note(s) did not sync completely", failed)
+	}
+	return nil
+}
+
+// syncSummary counts, per backend, the notes a run synced, failed to sync
+// and deferred for going over budget.
+type syncSummary struct {
+	mu       sync.Mutex
+	order    []string
+	synced   map[string]int
+	failed   map[string]int
+	deferred map[string]int
+}
+
+// syncTally collects the outcome of every push while a `syt sync` runs; it
+// is nil otherwise.
+var syncTally *syncSummary
+
+func (s *syncSummary) add(backend string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.synced == nil {
+		s.synced, s.failed, s.deferred = map[string]int{}, map[string]int{}, map[string]int{}
+	}
+	if !containsString(s.order, backend) {
+		s.order = append(s.order, backend)
+	}
+	if err != nil && errorCode(err) == ErrBudgetExceeded {
+		s.deferred[backend]++
+	} else if err != nil {
+		s.failed[backend]++
+	} else {
+		s.synced[backend]++
+	}
+}
+
+// batchFailed counts the notes a batch commit was to take, synced ones
+// already counted and deleted ones not, as failed after all.
+func (s *syncSummary) batchFailed(backend string, synced, deleted int) {
+	if s == nil {
+		return
+	}
+	s.add(backend, nil)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced[backend] -= synced + 1
+	s.failed[backend] += synced + deleted
+}
+
+// print writes one line with each backend's counts, as in
+// "Summary: git 3 synced, notion 2 synced 1 failed".
+func (s *syncSummary) print() {
+	if s == nil || len(s.order) == 0 {
+		return
+	}
+	var parts []string
+	deferred := false
+	for _, backend := range s.order {
+		part := fmt.Sprintf("%s %d synced", backend, s.synced[backend])
+		if n := s.failed[backend]; n > 0 {
+			part += fmt.Sprintf(" %d failed", n)
+		}
+		if n := s.deferred[backend]; n > 0 {
+			part += fmt.Sprintf(" %d deferred", n)
+			deferred = true
+		}
+		parts = append(parts, part)
+	}
+	fmt.Println("Summary: " + strings.Join(parts, ", "))
+	if deferred {
+		fmt.Println("Run syt sync --retry-failed to send the deferred notes once the budget allows.")
+	}
+}
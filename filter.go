@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// noteFilter picks the notes an export covers: --tag keeps notes carrying a
+// tag and --where notes whose frontmatter meets a condition. Both can be
+// given several times, and a note has to pass all of them.
+type noteFilter struct {
+	tags  []string
+	where []condition
+}
+
+// condition is one --where test, such as client=acme, status!=draft,
+// created>=2024-01-01 or title~handover. A bare word looks for the text
+// anywhere in the note.
+type condition struct {
+	field, op, value string
+}
+
+var conditionSyntax = regexp.MustCompile(`^\s*([\w.-]+)\s*(!=|>=|<=|=|~|>|<)\s*(.*?)\s*$`)
+
+// addNoteFilter registers the --tag and --where flags on fs.
+func addNoteFilter(fs *flag.FlagSet) *noteFilter {
+	f := &noteFilter{}
+	fs.Func("tag", "only notes with this tag (repeatable)", func(tag string) error {
+		f.tags = append(f.tags, strings.TrimPrefix(tag, "#"))
+		return nil
+	})
+	fs.Func("where", "only notes meeting a condition such as client=acme, created>=2024-01-01 or title~plan (repeatable)", func(s string) error {
+		c, err := parseCondition(s)
+		if err == nil {
+			f.where = append(f.where, c)
+		}
+		return err
+	})
+	return f
+}
+
+func parseCondition(s string) (condition, error) {
+	if m := conditionSyntax.FindStringSubmatch(s); m != nil {
+		return condition{field: strings.ToLower(m[1]), op: m[2], value: strings.Trim(m[3], `"'`)}, nil
+	}
+	if strings.TrimSpace(s) == "" || strings.ContainsAny(s, "=<>~") {
+		return condition{}, fmt.Errorf("%q is not a condition like field=value", s)
+	}
+	return condition{op: "text", value: strings.TrimSpace(s)}, nil
+}
+
+// active reports whether any filter was given.
+func (f *noteFilter) active() bool {
+	return len(f.tags) > 0 || len(f.where) > 0
+}
+
+func (f *noteFilter) match(note *Note) bool {
+	for _, tag := range f.tags {
+		if !hasTag(note, tag) {
+			return false
+		}
+	}
+	for _, c := range f.where {
+		if !c.match(note) {
+			return false
+		}
+	}
+	return true
+}
+
+// filter returns the notes that match.
+func (f *noteFilter) filter(notes []*Note) []*Note {
+	if !f.active() {
+		return notes
+	}
+	var kept []*Note
+	for _, note := range notes {
+		if f.match(note) {
+			kept = append(kept, note)
+		}
+	}
+	return kept
+}
+
+// match compares folded text. A field holding a list, like tags, matches =
+// and != against any one element; <, >, <= and >= compare as strings, which
+// orders ISO dates correctly.
+func (c condition) match(note *Note) bool {
+	if c.op == "text" {
+		return strings.Contains(foldText(note.Title+"\n"+note.Body), foldText(c.value))
+	}
+	value, ok := note.Meta[c.field]
+	switch c.field {
+	case "title":
+		value, ok = noteTitle(note), true
+	case "name":
+		value, ok = note.Name, true
+	}
+	got, want := foldText(value), foldText(c.value)
+	values := []string{got}
+	if strings.HasPrefix(value, "[") {
+		values = nil
+		for _, v := range splitList(strings.Trim(value, "[]")) {
+			values = append(values, foldText(strings.Trim(v, `"'`)))
+		}
+	}
+	switch c.op {
+	case "=":
+		for _, v := range values {
+			if v == want {
+				return true
+			}
+		}
+		return false
+	case "!=":
+		for _, v := range values {
+			if v == want {
+				return false
+			}
+		}
+		return true
+	case "~":
+		return strings.Contains(got, want)
+	}
+	if !ok || got == "" {
+		return false
+	}
+	switch c.op {
+	case ">":
+		return got > want
+	case "<":
+		return got < want
+	case ">=":
+		return got >= want
+	}
+	return got <= want
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// todoMarker matches the markers that mean a note isn't finished.
+var todoMarker = regexp.MustCompile(`\b(TODO|FIXME|XXX|TBD)\b`)
+
+// qualityGates are the checks PUBLISH_CHECKS can require of notes tagged
+// publish before they're exported or uploaded. Each returns its problems.
+var qualityGates = map[string]func(config *CONFIG, note *Note) ([]string, error){
+	"lint": func(config *CONFIG, note *Note) ([]string, error) {
+		return typeProblems(noteTypes(), note), nil
+	},
+	"todo": func(config *CONFIG, note *Note) ([]string, error) {
+		var problems []string
+		for i, line := range strings.Split(stripCodeBlocks(note.Body), "\n") {
+			if m := todoMarker.FindString(line); m != "" {
+				problems = append(problems, fmt.Sprintf("%s marker on body line %d", m, i+1))
+			}
+		}
+		return problems, nil
+	},
+	"prose": func(config *CONFIG, note *Note) ([]string, error) {
+		return proseProblems(config, analyzeProse(note.Body, config.ProseMaxSentence)), nil
+	},
+	"spell": func(config *CONFIG, note *Note) ([]string, error) {
+		misspellings, err := spellcheck(strings.Split(note.Body, "\n"), noteLanguage(config, note))
+		if err != nil {
+			return nil, err
+		}
+		var problems []string
+		for _, m := range misspellings {
+			problems = append(problems, fmt.Sprintf("misspelled %q on body line %d", m.Word, m.Line))
+		}
+		return problems, nil
+	},
+}
+
+// gateFailure is one problem found by a quality gate.
+type gateFailure struct {
+	Gate    string
+	Problem string
+}
+
+// checkGates runs the configured gates over a note. Notes not tagged
+// publish pass trivially.
+func checkGates(config *CONFIG, note *Note) ([]gateFailure, error) {
+	if !hasTag(note, "publish") {
+		return nil, nil
+	}
+	var failures []gateFailure
+	for _, name := range splitList(config.PublishChecks) {
+		gate, ok := qualityGates[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown check %q in PUBLISH_CHECKS", name)
+		}
+		problems, err := gate(config, note)
+		if err != nil {
+			return nil, fmt.Errorf("%s check: %w", name, err)
+		}
+		for _, p := range problems {
+			failures = append(failures, gateFailure{Gate: name, Problem: p})
+		}
+	}
+	return failures, nil
+}
+
+// passesGates reports whether a note may be published, printing the
+// failures if not. --force skips the gates.
+func passesGates(config *CONFIG, note *Note) (bool, error) {
+	return passesGatesTo(config, os.Stdout, note)
+}
+
+// passesGatesTo is passesGates printing the failures to w, for commands
+// whose output is on stdout.
+func passesGatesTo(config *CONFIG, w io.Writer, note *Note) (bool, error) {
+	if config.Force {
+		return true, nil
+	}
+	failures, err := checkGates(config, note)
+	if err != nil || len(failures) == 0 {
+		return err == nil, err
+	}
+	fmt.Fprintf(w, tr("%s is tagged publish but fails its checks:\n"), note.Path)
+	for _, f := range failures {
+		fmt.Fprintf(w, "  [%s] %s\n", f.Gate, f.Problem)
+	}
+	fmt.Fprint(w, tr("Fix them or rerun with --force.\n"))
+	return false, nil
+}
+
+// runCheck runs the quality gates over the given notes, or every note
+// tagged publish.
+func runCheck(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var notes []*Note
+	if fs.NArg() == 0 {
+		all, err := vaultNotes(config, true)
+		if err != nil {
+			return err
+		}
+		for _, note := range all {
+			if hasTag(note, "publish") {
+				notes = append(notes, note)
+			}
+		}
+	}
+	for _, arg := range fs.Args() {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			return err
+		}
+		note, err := readNote(path)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+
+	failed := 0
+	for _, note := range notes {
+		failures, err := checkGates(config, note)
+		if err != nil {
+			return err
+		}
+		for _, f := range failures {
+			fmt.Printf("%s: [%s] %s\n", note.Path, f.Gate, f.Problem)
+		}
+		if len(failures) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d note(s) failed their checks", failed, len(notes))
+	}
+	return nil
+}
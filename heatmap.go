@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// heatLevels shade a day by activity, from none to the busiest.
+var heatLevels = []string{"·", "░", "▒", "▓", "█"}
+
+// runHeatmap renders a contribution-style calendar of the past year: one
+// column per week, one row per weekday.
+func runHeatmap(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("heatmap", flag.ContinueOnError)
+	fromGit := fs.Bool("git", false, "count commits from git history instead of note dates")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := currentTime()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// Start on the Monday 52 weeks back so the grid is whole weeks
+	start := today.AddDate(0, 0, -7*52)
+	start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+
+	counts := map[string]int{}
+	if *fromGit {
+		out, err := gitOutput(config.NotesDir, "log", "--since="+start.Format("2006-01-02"), "--date=short", "--format=%ad", "--", ".")
+		if err != nil {
+			return err
+		}
+		for _, day := range strings.Fields(out) {
+			counts[day]++
+		}
+	} else {
+		notes, err := vaultNotes(config, false)
+		if err != nil {
+			return err
+		}
+		// A note counts on the day it was created and the day it was last edited
+		for _, note := range notes {
+			created := noteDate(note).Format("2006-01-02")
+			counts[created]++
+			if edited := note.ModTime.Format("2006-01-02"); edited != created {
+				counts[edited]++
+			}
+		}
+	}
+
+	if config.Accessible {
+		printHeatmapSummary(counts, start, today)
+		return nil
+	}
+	printHeatmap(counts, start, today)
+	return nil
+}
+
+func heatLevel(n, top int) string {
+	if n == 0 || top == 0 {
+		return heatLevels[0]
+	}
+	return heatLevels[1+(n*(len(heatLevels)-1)-1)/top]
+}
+
+func printHeatmap(counts map[string]int, start, today time.Time) {
+	top, total := 0, 0
+	for d := start; !d.After(today); d = d.AddDate(0, 0, 1) {
+		n := counts[d.Format("2006-01-02")]
+		top, total = max(top, n), total+n
+	}
+	weeks := int(today.Sub(start).Hours()/24)/7 + 1
+
+	// Month names above the week their first day falls in
+	header := []rune(strings.Repeat(" ", weeks+1))
+	for w := 0; w < weeks; w++ {
+		week := start.AddDate(0, 0, 7*w)
+		if week.Day() <= 7 && w+3 <= weeks {
+			copy(header[w:], []rune(week.Format("Jan")))
+		}
+	}
+	fmt.Printf("     %s\n", strings.TrimRight(string(header), " "))
+
+	labels := []string{"Mon", "", "Wed", "", "Fri", "", "Sun"}
+	for row := 0; row < 7; row++ {
+		var b strings.Builder
+		for w := 0; w < weeks; w++ {
+			day := start.AddDate(0, 0, 7*w+row)
+			if day.After(today) {
+				break
+			}
+			b.WriteString(heatLevel(counts[day.Format("2006-01-02")], top))
+		}
+		fmt.Printf("%-4s %s\n", labels[row], b.String())
+	}
+	fmt.Printf("\n     Less %s More   %d in the past year\n", strings.Join(heatLevels, ""), total)
+}
+
+// printHeatmapSummary reports the same data month by month, for screen
+// readers that can't make sense of a character grid.
+func printHeatmapSummary(counts map[string]int, start, today time.Time) {
+	total := 0
+	for m := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location()); !m.After(today); m = m.AddDate(0, 1, 0) {
+		sum, days, busiest, busiestDay := 0, 0, 0, ""
+		for d := m; d.Month() == m.Month() && !d.After(today); d = d.AddDate(0, 0, 1) {
+			if d.Before(start) {
+				continue
+			}
+			day := d.Format("2006-01-02")
+			if n := counts[day]; n > 0 {
+				sum, days = sum+n, days+1
+				if n > busiest {
+					busiest, busiestDay = n, day
+				}
+			}
+		}
+		total += sum
+		if sum == 0 {
+			fmt.Printf("%s: no activity\n", m.Format("2006-01"))
+			continue
+		}
+		fmt.Printf("%s: %d on %d day(s), busiest %s with %d\n", m.Format("2006-01"), sum, days, busiestDay, busiest)
+	}
+	fmt.Printf("Total: %d in the past year\n", total)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// noteCommit is one commit in a note's history.
+type noteCommit struct {
+	hash, date, author, subject string
+	added, deleted              int
+	// path is where the note was at the time, relative to the repository,
+	// and from where it was before when the commit moved it
+	path, from string
+}
+
+// runHistory lists the commits that changed a note, newest first, with the
+// lines each added and removed; --patch shows the changes themselves.
+// Renames are followed, so a moved note keeps its history.
+func runHistory(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := fs.Int("n", 0, "show at most this many commits (0 for all)")
+	patch := fs.Bool("patch", false, "show each change as a diff")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt history [-n count] [--patch] <note>")
+	}
+	path, err := resolveNote(config, fs.Arg(0))
+	if err != nil {
+		if path, err = findNote(config, fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+	root, err := gitRepoRoot(filepath.Dir(path))
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if out, err := gitOutput(root, "status", "--porcelain", "--", abs); err == nil && strings.TrimSpace(out) != "" {
+		fmt.Println("(uncommitted changes)")
+	}
+	if *patch {
+		args := []string{"log", "--follow", "--patch", "--date=short", "--format=%h %ad %an%n    %s"}
+		if *limit > 0 {
+			args = append(args, "-n", strconv.Itoa(*limit))
+		}
+		return gitIn(root, append(args, "--", abs)...)
+	}
+
+	commits, err := noteHistory(root, abs, *limit)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		fmt.Println("No commits yet.")
+		return nil
+	}
+	rel := relNotePath(root, abs)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range commits {
+		subject := c.subject
+		if c.from != "" {
+			subject += " (moved from " + c.from + ")"
+		} else if c.path != "" && c.path != rel {
+			subject += " (as " + c.path + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t+%d -%d\t%s\n", c.date, c.hash, c.author, c.added, c.deleted, subject)
+	}
+	return w.Flush()
+}
+
+// noteHistory returns the commits that changed the file at abs, newest
+// first, following renames; limit bounds how many when above zero.
+func noteHistory(root, abs string, limit int) ([]noteCommit, error) {
+	args := []string{"log", "--follow", "--numstat", "--date=short", "--format=%x00%h%x09%ad%x09%an%x09%s"}
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+	out, err := gitOutput(root, append(args, "--", abs)...)
+	if err != nil {
+		return nil, withCode(ErrGitFailed, err)
+	}
+	var commits []noteCommit
+	for _, entry := range strings.Split(out, "\x00")[1:] {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		fields := strings.SplitN(lines[0], "\t", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		c := noteCommit{hash: fields[0], date: fields[1], author: fields[2], subject: fields[3]}
+		for _, line := range lines[1:] {
+			// added, deleted and the path, "-" counts for binary files
+			stat := strings.SplitN(line, "\t", 3)
+			if len(stat) < 3 {
+				continue
+			}
+			c.added, _ = strconv.Atoi(stat[0])
+			c.deleted, _ = strconv.Atoi(stat[1])
+			c.from, c.path = renamedPaths(stat[2])
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// renamedPaths splits a numstat path, which for a rename is "old => new" or
+// "dir/{old => new}.md", into the old and new names; old is "" otherwise.
+func renamedPaths(path string) (string, string) {
+	if open := strings.Index(path, "{"); open >= 0 {
+		if end := strings.Index(path[open:], "}"); end >= 0 {
+			inner := path[open+1 : open+end]
+			if from, to, ok := strings.Cut(inner, " => "); ok {
+				prefix, suffix := path[:open], path[open+end+1:]
+				return cleanSlash(prefix + from + suffix), cleanSlash(prefix + to + suffix)
+			}
+		}
+	}
+	if from, to, ok := strings.Cut(path, " => "); ok {
+		return from, to
+	}
+	return "", path
+}
+
+// cleanSlash tidies a slash-separated path, as "a//b.md" from renaming
+// "a/{x => }/b.md".
+func cleanSlash(path string) string {
+	return filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// messageLang is the language user-facing messages are shown in, set at
+// startup by setMessageLang.
+var messageLang = "en"
+
+// catalogs translate user-facing messages, keyed by the English text passed
+// to tr. Missing entries fall back to English, so a catalog can be partial.
+var catalogs = map[string]map[string]string{
+	"es": {
+		"Done!\n":                                 "¡Listo!\n",
+		"Note synced to %s.\n":                    "Nota sincronizada con %s.\n",
+		"Error: %v":                               "Error: %v",
+		"Error running on %s: %v":                 "Error al ejecutar en %s: %v",
+		"Error syncing note to %s: %v":            "Error al sincronizar la nota con %s: %v",
+		"unknown command: %s":                     "comando desconocido: %s",
+		"%s (%d file(s))? [y/N] ":                 "¿%s (%d archivo(s))? [s/N] ",
+		"%s needs confirmation; rerun with --yes": "%s requiere confirmación; vuelve a ejecutar con --yes",
+		"aborted":                                 "cancelado",
+		"Move to trash":                           "Mover a la papelera",
+		"Rename tag %s to %s":                     "Renombrar la etiqueta %s a %s",
+		"Store detected languages":                "Guardar los idiomas detectados",
+		"Undo %q":                                 "Deshacer %q",
+		"Moved %s to the trash.\n":                "%s movido a la papelera.\n",
+		"Undid %q (%d file(s)).\n":                "Deshecho %q (%d archivo(s)).\n",
+		"nothing to undo":                         "nada que deshacer",
+		"nothing to add":                          "nada que añadir",
+		"Added to %s\n":                           "Añadido a %s\n",
+		"Renamed %s to %s in %d note(s).\n":       "%s renombrada a %s en %d nota(s).\n",
+		"A note with a similar title already exists: %s (%s)\n":                "Ya existe una nota con un título parecido: %s (%s)\n",
+		"[o]pen it, [a]ppend to it, [p]roceed with a new note or [q]uit? [p] ": "¿[o] abrirla, [a] añadir, [p] crear una nota nueva o [q] salir? [p] ",
+		"Add suggested tags? [a]ll, numbers (e.g. 1,3) or Enter to skip: ":     "¿Añadir etiquetas sugeridas? [a] todas, números (p. ej. 1,3) o Intro para omitir: ",
+		"Tagged with %s\n":                               "Etiquetada con %s\n",
+		"note %q not found":                              "no se encontró la nota %q",
+		"Nothing to purge.\n":                            "Nada que purgar.\n",
+		"Permanently delete from the trash":              "Eliminar definitivamente de la papelera",
+		"Would purge %d note(s) from the trash (%s).\n":  "Se purgarían %d nota(s) de la papelera (%s).\n",
+		"Purged %d note(s) from the trash (%s freed).\n": "%d nota(s) purgada(s) de la papelera (%s liberados).\n",
+		"%s is tagged publish but fails its checks:\n":   "%s está etiquetada publish pero no pasa sus comprobaciones:\n",
+		"Fix them or rerun with --force.\n":              "Corrígelas o vuelve a ejecutar con --force.\n",
+	},
+	"de": {
+		"Done!\n":                                 "Fertig!\n",
+		"Note synced to %s.\n":                    "Notiz mit %s synchronisiert.\n",
+		"Error: %v":                               "Fehler: %v",
+		"Error running on %s: %v":                 "Fehler bei der Ausführung auf %s: %v",
+		"Error syncing note to %s: %v":            "Fehler beim Synchronisieren der Notiz mit %s: %v",
+		"unknown command: %s":                     "unbekannter Befehl: %s",
+		"%s (%d file(s))? [y/N] ":                 "%s (%d Datei(en))? [j/N] ",
+		"%s needs confirmation; rerun with --yes": "%s muss bestätigt werden; mit --yes erneut ausführen",
+		"aborted":                                 "abgebrochen",
+		"Move to trash":                           "In den Papierkorb verschieben",
+		"Rename tag %s to %s":                     "Tag %s in %s umbenennen",
+		"Store detected languages":                "Erkannte Sprachen speichern",
+		"Undo %q":                                 "%q rückgängig machen",
+		"Moved %s to the trash.\n":                "%s in den Papierkorb verschoben.\n",
+		"Undid %q (%d file(s)).\n":                "%q rückgängig gemacht (%d Datei(en)).\n",
+		"nothing to undo":                         "nichts rückgängig zu machen",
+		"nothing to add":                          "nichts hinzuzufügen",
+		"Added to %s\n":                           "Zu %s hinzugefügt\n",
+		"Renamed %s to %s in %d note(s).\n":       "%[1]s in %[3]d Notiz(en) in %[2]s umbenannt.\n",
+		"A note with a similar title already exists: %s (%s)\n":                "Es gibt bereits eine Notiz mit ähnlichem Titel: %s (%s)\n",
+		"[o]pen it, [a]ppend to it, [p]roceed with a new note or [q]uit? [p] ": "[o] öffnen, [a] anhängen, [p] neue Notiz anlegen oder [q] beenden? [p] ",
+		"Add suggested tags? [a]ll, numbers (e.g. 1,3) or Enter to skip: ":     "Vorgeschlagene Tags hinzufügen? [a] alle, Nummern (z. B. 1,3) oder Enter zum Überspringen: ",
+		"Tagged with %s\n":                               "Getaggt mit %s\n",
+		"note %q not found":                              "Notiz %q nicht gefunden",
+		"Nothing to purge.\n":                            "Nichts zu bereinigen.\n",
+		"Permanently delete from the trash":              "Endgültig aus dem Papierkorb löschen",
+		"Would purge %d note(s) from the trash (%s).\n":  "Würde %d Notiz(en) aus dem Papierkorb entfernen (%s).\n",
+		"Purged %d note(s) from the trash (%s freed).\n": "%d Notiz(en) aus dem Papierkorb entfernt (%s freigegeben).\n",
+		"%s is tagged publish but fails its checks:\n":   "%s ist mit publish getaggt, besteht aber die Prüfungen nicht:\n",
+		"Fix them or rerun with --force.\n":              "Beheben oder mit --force erneut ausführen.\n",
+	},
+}
+
+// yesAnswers are the localized answers accepted as "yes" at confirmations.
+var yesAnswers = map[string][]string{
+	"en": {"y", "yes"},
+	"es": {"s", "si", "sí", "y", "yes"},
+	"de": {"j", "ja", "y", "yes"},
+}
+
+// setMessageLang picks the message language from SYT_LANG or the usual
+// locale variables, e.g. LANG=de_DE.UTF-8 selects German.
+func setMessageLang(config *CONFIG) {
+	locale := config.MessageLang
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale != "" {
+			break
+		}
+		locale = os.Getenv(key)
+	}
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "_.-@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalogs[lang]; ok {
+		messageLang = lang
+	}
+}
+
+// tr translates a user-facing message into the message language.
+func tr(msg string) string {
+	if t, ok := catalogs[messageLang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+func isYes(answer string) bool {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	langs := []string{messageLang}
+	if messageLang != "en" {
+		langs = append(langs, "en")
+	}
+	for _, lang := range langs {
+		for _, y := range yesAnswers[lang] {
+			if answer == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const indexRefresh = 2 * time.Second
+
+// noteIndex is the daemon's in-memory copy of the vault. Clients ask the
+// daemon for it over the socket instead of walking and parsing every note
+// themselves, which keeps interactive commands fast on big vaults.
+//
+// The index is a sequence of immutable snapshots. A refresh builds a complete
+// new snapshot and swaps it in, so readers always see one consistent
+// generation of the vault and never wait for a refresh to finish.
+type noteIndex struct {
+	dir     string
+	writeMu sync.Mutex // serialises refreshes
+	current atomic.Pointer[indexSnapshot]
+	pinned  atomic.Pointer[indexSnapshot]
+}
+
+type indexSnapshot struct {
+	generation uint64
+	notes      []*Note // never modified once published
+}
+
+// activeIndex is set in the daemon process once its index is loaded.
+var activeIndex *noteIndex
+
+// startIndex loads the vault and keeps the index fresh in the background.
+func startIndex(notesDir string) (*noteIndex, error) {
+	idx := &noteIndex{dir: notesDir}
+	if err := idx.refresh(); err != nil {
+		return nil, err
+	}
+	go func() {
+		for range time.Tick(indexRefresh) {
+			if err := idx.refresh(); err != nil {
+				log.Printf("daemon: refreshing index: %v", err)
+			}
+		}
+	}()
+	return idx, nil
+}
+
+// refresh rescans the notes directory. Unchanged notes come from the note
+// cache, so this mostly costs one stat per file.
+func (idx *noteIndex) refresh() error {
+	idx.writeMu.Lock()
+	defer idx.writeMu.Unlock()
+	notes, err := scanNotes(idx.dir)
+	if err != nil {
+		return err
+	}
+	next := &indexSnapshot{notes: notes}
+	if cur := idx.current.Load(); cur != nil {
+		next.generation = cur.generation + 1
+	}
+	idx.current.Store(next)
+	return nil
+}
+
+// pin makes every read see the current snapshot until the returned function
+// is called, so a command that looks at the notes several times gets the same
+// answer each time even if a refresh lands in between.
+func (idx *noteIndex) pin() func() {
+	idx.pinned.Store(idx.current.Load())
+	return func() { idx.pinned.Store(nil) }
+}
+
+func (idx *noteIndex) view() *indexSnapshot {
+	if s := idx.pinned.Load(); s != nil {
+		return s
+	}
+	return idx.current.Load()
+}
+
+// snapshot returns copies of the indexed notes, leaving out the bodies
+// unless withBody is set.
+func (idx *noteIndex) snapshot(withBody bool) []*Note {
+	view := idx.view()
+	notes := make([]*Note, len(view.notes))
+	for i, n := range view.notes {
+		notes[i] = n.copy()
+		if !withBody {
+			notes[i].Body = ""
+		}
+	}
+	return notes
+}
+
+// vaultNotes lists the vault's notes, preferring a running daemon's index.
+// Callers that only need titles and metadata pass withBody false to keep the
+// response small.
+func vaultNotes(config *CONFIG, withBody bool) ([]*Note, error) {
+	if activeIndex == nil {
+		resp, err := callDaemon(config, daemonRequest{Op: "notes", WithBody: withBody})
+		if err == nil {
+			return resp.Notes, nil
+		}
+		if err != errDaemonDown {
+			return nil, err
+		}
+	}
+	return loadNotes(config.NotesDir)
+}
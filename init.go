@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// wizardKeys are the settings `syt init` asks about; the rest of an existing
+// config file is carried over untouched.
+var wizardKeys = map[string]bool{
+	"NOTES_DIR": true, "GIT_REPO_PATH": true, "NOTE_EDITOR": true, "GIT_ENABLED": true,
+	"NOTION_ENABLED": true, "NOTION_TOKEN": true, "NOTION_DATABASE_ID": true,
+}
+
+// runInit walks through first-time setup: editor, notes directory, git and
+// Notion. It writes the config file and can set the notes directory up as a
+// git repository. Answers are read line by line, so it can be scripted too.
+func runInit(config *CONFIG, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: syt init")
+	}
+	path := configPath()
+	if path == "" {
+		return fmt.Errorf("can't find a home directory for the config file; set SYT_CONFIG")
+	}
+	in := bufio.NewReader(os.Stdin)
+	ask := func(question, def string) string {
+		if def != "" {
+			fmt.Printf("%s [%s]: ", question, def)
+		} else {
+			fmt.Printf("%s: ", question)
+		}
+		answer, _ := in.ReadString('\n')
+		if answer = strings.TrimSpace(answer); answer != "" {
+			return answer
+		}
+		return def
+	}
+	yesNo := func(question string, def bool) bool {
+		hint := "y/N"
+		if def {
+			hint = "Y/n"
+		}
+		answer := ask(question+" ("+hint+")", "")
+		if answer == "" {
+			return def
+		}
+		return isYes(answer)
+	}
+
+	// Defaults come from the current settings, so rerunning init edits them
+	existing, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Setting up syt; answers go to %s.\n\n", path)
+	editor := config.Editor
+	if v := os.Getenv("EDITOR"); v != "" && existing["NOTE_EDITOR"] == "" && os.Getenv("NOTE_EDITOR") == "" {
+		editor = v
+	}
+	settings := map[string]string{}
+	settings["NOTE_EDITOR"] = ask("Editor", editor)
+
+	notesDir := config.NotesDir
+	if existing["NOTES_DIR"] == "" && os.Getenv("NOTES_DIR") == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			notesDir = filepath.Join(home, "notes")
+		}
+	}
+	notesDir = expandHome(ask("Notes directory", notesDir))
+	if abs, err := filepath.Abs(notesDir); err == nil {
+		notesDir = abs
+	}
+	settings["NOTES_DIR"] = notesDir
+
+	remote := ask("Git remote to push notes to (empty for none)", gitRemote(notesDir))
+	useGit := remote != "" || yesNo("Keep notes in a local git repository?", config.GitEnabled)
+	if useGit {
+		settings["GIT_ENABLED"] = "true"
+		settings["GIT_REPO_PATH"] = notesDir
+	}
+
+	if yesNo("Sync notes to Notion?", config.NotionEnabled) {
+		settings["NOTION_ENABLED"] = "true"
+		// Don't echo a saved secret back to the terminal
+		question := "Notion integration token"
+		if config.NotionToken != "" {
+			question += " (Enter keeps the current one)"
+		}
+		if settings["NOTION_TOKEN"] = ask(question, ""); settings["NOTION_TOKEN"] == "" {
+			settings["NOTION_TOKEN"] = config.NotionToken
+		}
+		settings["NOTION_DATABASE_ID"] = ask("Notion database ID", config.NotionDatabaseID)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// The file may hold tokens, so keep it private
+	if err := os.WriteFile(path, []byte(formatConfigFile(settings, existing)), 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("\nWrote %s.\n", path)
+
+	if err := os.MkdirAll(notesDir, 0755); err != nil {
+		return err
+	}
+	if useGit && !fileExists(filepath.Join(notesDir, ".git")) && yesNo("Run git init in "+notesDir+"?", true) {
+		if err := gitIn(notesDir, "init", "-q"); err != nil {
+			return err
+		}
+	}
+	if remote != "" && remote != gitRemote(notesDir) && fileExists(filepath.Join(notesDir, ".git")) {
+		verb := "add"
+		if gitRemote(notesDir) != "" {
+			verb = "set-url"
+		}
+		if err := gitIn(notesDir, "remote", verb, "origin", remote); err != nil {
+			return err
+		}
+		fmt.Printf("Set origin to %s.\n", remote)
+	}
+	fmt.Println("All set. Try `syt new`.")
+	return nil
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	settings, err := parseTOML(bufio.NewScanner(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// formatConfigFile writes the wizard's settings in tables, after any other
+// settings kept from the old file, which are written under their variable
+// names.
+func formatConfigFile(settings, existing map[string]string) string {
+	var b strings.Builder
+	b.WriteString("# Written by `syt init`. Environment variables override these.\n\n")
+	var kept []string
+	for key := range existing {
+		if !wizardKeys[key] {
+			kept = append(kept, key)
+		}
+	}
+	sort.Strings(kept)
+	for _, key := range kept {
+		fmt.Fprintf(&b, "%s = %s\n", key, strconv.Quote(existing[key]))
+	}
+	if len(kept) > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "notes_dir = %s\n", strconv.Quote(settings["NOTES_DIR"]))
+	if v := settings["GIT_REPO_PATH"]; v != "" {
+		fmt.Fprintf(&b, "git_repo_path = %s\n", strconv.Quote(v))
+	}
+	fmt.Fprintf(&b, "\n[note]\neditor = %s\n", strconv.Quote(settings["NOTE_EDITOR"]))
+	if settings["GIT_ENABLED"] != "" {
+		b.WriteString("\n[git]\nenabled = true\n")
+	}
+	if settings["NOTION_ENABLED"] != "" {
+		fmt.Fprintf(&b, "\n[notion]\nenabled = true\ntoken = %s\ndatabase_id = %s\n",
+			strconv.Quote(settings["NOTION_TOKEN"]), strconv.Quote(settings["NOTION_DATABASE_ID"]))
+	}
+	return b.String()
+}
+
+// gitRemote returns the origin URL of the repository in dir, if any.
+func gitRemote(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "remote", "get-url", "origin").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func gitIn(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// setUpGitRepo makes GIT_REPO_PATH a git repository the first time a note is
+// committed there, instead of failing on git's own error. It clones the
+// history of GIT_REMOTE_URL, or the remote given at the prompt, into the
+// directory, keeping any notes already in it, or with an empty or no remote
+// starts a new repository. With GIT_REMOTE_URL set it doesn't ask; otherwise
+// it needs a terminal to ask on.
+func setUpGitRepo(config *CONFIG) (string, error) {
+	dir := config.GitRepoPath
+	remote := config.GitRemoteURL
+	if remote == "" && !config.Yes {
+		if !isTerminal(os.Stdin) {
+			return "", codeErrorf(ErrGitFailed, "GIT_ENABLED is set but %s isn't a git repository; run syt init, or set GIT_REMOTE_URL to have syt set it up", dir)
+		}
+		answer, _ := readPlainLine(fmt.Sprintf(tr("%s isn't a git repository. Set one up? [Y/n] "), dir))
+		if answer = strings.TrimSpace(answer); answer != "" && !isYes(answer) {
+			return "", withCode(ErrAborted, fmt.Errorf(tr("%s isn't a git repository"), dir))
+		}
+		remote, _ = readPlainLine(tr("Remote URL to clone or push to (empty for none): "))
+		remote = strings.TrimSpace(remote)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := gitIn(dir, "init", "-q"); err != nil {
+		return "", withCode(ErrGitFailed, err)
+	}
+	if remote == "" {
+		fmt.Printf("Started a git repository in %s.\n", dir)
+		return gitRepoRoot(dir)
+	}
+	if err := gitIn(dir, "remote", "add", "origin", remote); err != nil {
+		return "", withCode(ErrGitFailed, err)
+	}
+	// The first push of a new branch sets its upstream
+	if err := gitIn(dir, "config", "push.autoSetupRemote", "true"); err != nil {
+		return "", withCode(ErrGitFailed, err)
+	}
+
+	// ls-remote names the default branch, or nothing for an empty remote
+	out, err := gitOutput(dir, "ls-remote", "--symref", "origin", "HEAD")
+	if err != nil {
+		return "", codeErrorf(ErrGitFailed, "can't reach %s: %v", remote, err)
+	}
+	branch := ""
+	if ref, _, ok := strings.Cut(strings.TrimPrefix(out, "ref: "), "\t"); ok && strings.HasPrefix(out, "ref: ") {
+		branch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if branch == "" {
+		fmt.Printf("Started a git repository in %s pushing to %s.\n", dir, remote)
+		return gitRepoRoot(dir)
+	}
+	if err := gitIn(dir, "fetch", "-q", "origin", branch); err != nil {
+		return "", withCode(ErrGitFailed, err)
+	}
+	// Checking out keeps untracked notes, and refuses if one would be replaced
+	if err := gitIn(dir, "checkout", "-q", "-b", branch, "--track", "origin/"+branch); err != nil {
+		return "", codeErrorf(ErrGitFailed, "checking out %s from %s: %v; a note here has the same name as one in the remote", branch, remote, err)
+	}
+	fmt.Printf("Cloned %s into %s.\n", remote, dir)
+	return gitRepoRoot(dir)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dailyNotePath is the journal note for day t, e.g. journal/2024-05-01.md,
+// or journal/2024-05-01.md.age when notes are encrypted.
+func dailyNotePath(config *CONFIG, t time.Time) (string, error) {
+	folder := ""
+	if jt, err := lookupType("journal"); err == nil {
+		folder = jt.Folder
+	}
+	return sealedPath(config, filepath.Join(config.NotesDir, folder, t.Format("2006-01-02")+".md"))
+}
+
+// ensureDailyNote creates the daily note for t if it doesn't exist yet.
+func ensureDailyNote(config *CONFIG, t time.Time) (string, error) {
+	path, err := dailyNotePath(config, t)
+	if err != nil || fileExists(path) {
+		return path, err
+	}
+	day := t.Format("2006-01-02")
+	header := formatFrontmatter(map[string]string{"title": day, "id": newID(), "type": "journal", "created": day},
+		[]string{"title", "id", "type", "created"})
+
+	// Created exclusively so two terminals creating the note at once don't
+	// clobber it
+	err = createNote(config, path, []byte(header+"# "+day+"\n\n"))
+	if os.IsExist(err) {
+		return path, nil
+	}
+	return path, err
+}
+
+// runToday opens today's daily note with a fresh timestamped section at the
+// end, creating the note first if this is the day's first entry, and syncs it
+// after the editor closes. With DAILY_MODE set a bare `syt new` does this too.
+func runToday(config *CONFIG, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: syt today")
+	}
+	now := currentTime()
+	path, err := ensureDailyNote(config, now)
+	if err != nil {
+		return err
+	}
+	section := fmt.Sprintf("\n## %s\n\n", now.Format("15:04"))
+	_, err = callDaemon(config, daemonRequest{Op: "append", Path: path, Text: section})
+	if err == errDaemonDown {
+		err = appendNote(config, path, section)
+	}
+	if err != nil {
+		return err
+	}
+	return editNote(config, path)
+}
+
+// runAdd appends a timestamped entry to today's journal note. The entry comes
+// from the arguments or, if there are none, from stdin. When the daemon is
+// running the append goes through its queue.
+func runAdd(config *CONFIG, args []string) error {
+	text := strings.Join(args, " ")
+	if text == "" {
+		if isTerminal(os.Stdin) {
+			fmt.Print("> ")
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			text = line
+		} else {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			text = string(data)
+		}
+	}
+	path, err := addEntry(config, currentTime(), text)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(tr("Added to %s\n"), path)
+	return nil
+}
+
+// addEntry appends text, written at now, to that day's journal note and
+// returns the note's path.
+func addEntry(config *CONFIG, now time.Time, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", errors.New(tr("nothing to add"))
+	}
+
+	path, err := ensureDailyNote(config, now)
+	if err != nil {
+		return "", err
+	}
+	entry := fmt.Sprintf("- %s %s\n", now.Format("15:04"), strings.ReplaceAll(text, "\n", "\n  "))
+
+	_, err = callDaemon(config, daemonRequest{Op: "append", Path: path, Text: entry})
+	if err == errDaemonDown {
+		err = appendNote(config, path, entry)
+	}
+	return path, err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runKeys shows who encrypted notes are sealed to, or re-encrypts them:
+//
+//	syt keys
+//	syt keys rotate [--identity old.key] [--dry-run]
+//
+// After AGE_RECIPIENT or GPG_RECIPIENT changes, to add a recovery key or
+// drop a lost laptop's, rotate opens every sealed note, the trash included,
+// and seals it again to the recipients now configured, each with the tool
+// it was sealed with. --identity adds an age key that only the old notes
+// open with. Nothing is written until every note has been opened and sealed
+// again. With VAULT_CONTAINER the container gets a new master key as well,
+// under the passphrase now given. Older git commits and backups keep what
+// they held, readable with the old keys.
+func runKeys(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		return listKeys(config)
+	}
+	if args[0] != "rotate" {
+		return fmt.Errorf("usage: syt keys | syt keys rotate [--identity file] [--dry-run]")
+	}
+	fs := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	identity := fs.String("identity", "", "another age identity to open the notes with")
+	dryRun := fs.Bool("dry-run", false, "list the notes that would be re-encrypted")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: syt keys rotate [--identity file] [--dry-run]")
+	}
+	if *identity != "" {
+		config.AgeIdentity = *identity + "," + config.AgeIdentity
+	}
+	return rotateKeys(config, *dryRun)
+}
+
+func listKeys(config *CONFIG) error {
+	cipher := config.Encryption
+	if cipher == "" {
+		cipher = "off"
+	}
+	fmt.Printf("New notes: %s\n", cipher)
+	for _, list := range []struct{ name, recipients string }{{"age", config.AgeRecipient}, {"gpg", config.GPGRecipient}} {
+		for _, r := range splitList(list.recipients) {
+			fmt.Printf("  %s  %s\n", list.name, r)
+		}
+	}
+	paths, err := sealedNotes(config)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, path := range paths {
+		counts[filepath.Ext(path)]++
+	}
+	for _, ext := range sortedKeys(counts) {
+		fmt.Printf("%d note(s) sealed with %s\n", counts[ext], strings.TrimPrefix(ext, "."))
+	}
+	if config.VaultContainer != "" {
+		fmt.Printf("The vault is kept encrypted in %s\n", config.VaultContainer)
+	}
+	return nil
+}
+
+// sealedNotes lists the encrypted notes in the vault, the trash included.
+func sealedNotes(config *CONFIG) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(config.NotesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() && isSealed(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func rotateKeys(config *CONFIG, dryRun bool) error {
+	paths, err := sealedNotes(config)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 && config.VaultContainer == "" {
+		fmt.Println("No encrypted notes.")
+		return nil
+	}
+	for _, path := range paths {
+		fmt.Printf("  %s\n", relNotePath(config.NotesDir, path))
+	}
+	if dryRun {
+		fmt.Printf("%d note(s) would be re-encrypted.\n", len(paths))
+		if config.VaultContainer != "" {
+			fmt.Println("The vault would get a new key.")
+		}
+		return nil
+	}
+	if err := confirm(config, "Re-encrypt to the keys now configured", len(paths)); err != nil {
+		return err
+	}
+
+	// Every note is opened and sealed again in memory first, so a key that
+	// doesn't work leaves all of them as they were
+	resealed := make([][]byte, len(paths))
+	for i, path := range paths {
+		c := sealedCipher(config, path)
+		sealed, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		plain, err := c.open(sealed)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w; nothing re-encrypted", relNotePath(config.NotesDir, path), err)
+		}
+		if resealed[i], err = c.seal(plain); err != nil {
+			return fmt.Errorf("encrypting %s: %w; nothing re-encrypted", relNotePath(config.NotesDir, path), err)
+		}
+	}
+	var changed []string
+	for i, path := range paths {
+		if err := writeFileAtomic(path, resealed[i]); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(path, stateDir(config)+string(filepath.Separator)) {
+			changed = append(changed, path)
+		}
+	}
+	if len(paths) > 0 {
+		fmt.Printf("Re-encrypted %d note(s).\n", len(paths))
+	}
+	if len(changed) > 0 && config.GitEnabled {
+		if err := commitBatch(config, changed); err != nil {
+			return err
+		}
+		fmt.Println("Earlier commits can still be opened with the old keys.")
+	}
+	if config.VaultContainer != "" {
+		return rotateVaultKey(config)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// languageMarkers are frequent function words that are a good signal of the
+// language a text is written in.
+var languageMarkers = map[string][]string{
+	"en": {"the", "and", "is", "of", "to", "in", "that", "it", "with", "for", "this", "was", "are", "on", "you", "be", "have", "not"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "sie", "ein", "eine", "zu", "den", "auf", "auch", "es", "für", "wir"},
+	"es": {"el", "la", "los", "las", "y", "que", "es", "de", "en", "un", "una", "por", "con", "para", "no", "se", "del", "está"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "que", "pas", "pour", "dans", "qui", "sur", "avec", "ce", "nous", "je"},
+	"it": {"il", "lo", "gli", "che", "è", "di", "un", "una", "per", "non", "con", "sono", "della", "questo", "anche", "come", "ma", "ho"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "ik", "je", "op", "met", "voor", "zijn", "maar", "ook", "wij", "er"},
+	"pt": {"o", "os", "as", "e", "que", "não", "um", "uma", "para", "com", "do", "da", "em", "por", "mais", "é", "mas", "eu"},
+}
+
+var langWord = regexp.MustCompile(`\p{L}+`)
+
+// detectLanguage guesses the ISO 639-1 code of text by counting marker words,
+// returning "" when there is too little text to tell.
+func detectLanguage(text string) string {
+	scores := map[string]int{}
+	words := 0
+	for _, w := range langWord.FindAllString(strings.ToLower(stripCodeBlocks(text)), -1) {
+		words++
+		for lang, markers := range languageMarkers {
+			for _, m := range markers {
+				if w == m {
+					scores[lang]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestScore, second := "", 0, 0
+	for lang, score := range scores {
+		if score > bestScore || (score == bestScore && lang < best) {
+			best, bestScore, second = lang, score, bestScore
+		} else if score > second {
+			second = score
+		}
+	}
+	// Require a few hits and a clear margin over the runner-up
+	if words < 5 || bestScore < 3 || bestScore == second {
+		return ""
+	}
+	return best
+}
+
+// noteLang returns the language stored in the note or detected from its body.
+func noteLang(note *Note) string {
+	if lang := note.Meta["lang"]; lang != "" {
+		return strings.ToLower(lang)
+	}
+	return detectLanguage(note.Body)
+}
+
+// storeLanguage writes the detected language into the note's frontmatter
+// unless it already has one.
+func storeLanguage(path string) error {
+	note, err := readNote(path)
+	if err != nil || note.Meta["lang"] != "" {
+		return err
+	}
+	lang := detectLanguage(note.Body)
+	if lang == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(setFrontmatter(string(content), "lang", lang)))
+}
+
+func runLang(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("lang", flag.ContinueOnError)
+	detect := fs.Bool("detect", false, "detect and store the language of notes that have none")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *detect:
+		var pending []*Note
+		for _, note := range notes {
+			if note.Meta["lang"] == "" && detectLanguage(note.Body) != "" {
+				pending = append(pending, note)
+			}
+		}
+		if err := confirm(config, tr("Store detected languages"), len(pending)); err != nil {
+			return err
+		}
+		op := beginOperation(config, "lang --detect")
+		stored := 0
+		for _, note := range pending {
+			if err := op.saveBefore(note.Path); err != nil {
+				return err
+			}
+			if err := storeLanguage(note.Path); err != nil {
+				return err
+			}
+			stored++
+		}
+		fmt.Printf("Stored language for %d note(s).\n", stored)
+		return op.commit()
+	case fs.NArg() == 1:
+		state, err := loadState(config)
+		if err != nil {
+			return err
+		}
+		for _, note := range notes {
+			if noteLang(note) == strings.ToLower(fs.Arg(0)) {
+				fmt.Printf("%s  %s\n", note.Path, displayTitle(state, note))
+			}
+		}
+	default:
+		counts := map[string]int{}
+		for _, note := range notes {
+			lang := noteLang(note)
+			if lang == "" {
+				lang = "unknown"
+			}
+			counts[lang]++
+		}
+		langs := make([]string, 0, len(counts))
+		for lang := range counts {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+		for _, lang := range langs {
+			fmt.Printf("%-8s %d\n", lang, counts[lang])
+		}
+	}
+	return nil
+}
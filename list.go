@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// runList prints the notes with their creation date, size and title, newest
+// first or by name. A filter keeps the notes whose file name or title
+// contains it, and --tag those carrying a tag (or one nested below it).
+func runList(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	sortBy := fs.String("sort", "date", "order by date or name")
+	reverse := fs.Bool("r", false, "reverse the order")
+	limit := fs.Int("n", 0, "number of notes to show (0 for all)")
+	tag := fs.String("tag", "", "only list notes with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: syt list [--sort date|name] [-r] [-n count] [--tag tag] [filter]")
+	}
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+
+	filter := foldText(fs.Arg(0))
+	kept := notes[:0]
+	for _, note := range notes {
+		if *tag != "" && !hasTag(note, *tag) {
+			continue
+		}
+		if filter == "" || strings.Contains(foldText(note.Name), filter) || strings.Contains(foldText(displayTitle(state, note)), filter) {
+			kept = append(kept, note)
+		}
+	}
+	notes = kept
+	switch *sortBy {
+	case "date":
+		sort.SliceStable(notes, func(i, j int) bool { return noteDate(notes[i]).After(noteDate(notes[j])) })
+	case "name":
+		sort.SliceStable(notes, func(i, j int) bool {
+			return foldText(filepath.Base(notes[i].Path)) < foldText(filepath.Base(notes[j].Path))
+		})
+	default:
+		return fmt.Errorf("unknown sort order %q (want date or name)", *sortBy)
+	}
+	if *reverse {
+		for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+			notes[i], notes[j] = notes[j], notes[i]
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, note := range notes {
+		if i == *limit && *limit > 0 {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", noteDate(note).Format("2006-01-02 15:04"),
+			formatSize(note.Size), relNotePath(config.NotesDir, note.Path), displayTitle(state, note))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Location is a point on the map, stored in frontmatter as "lat,lon".
+type Location struct {
+	Lat float64
+	Lon float64
+}
+
+func (l Location) String() string {
+	return strconv.FormatFloat(l.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(l.Lon, 'f', -1, 64)
+}
+
+func parseLocation(s string) (Location, error) {
+	latStr, lonStr, ok := strings.Cut(strings.TrimSpace(s), ",")
+	if !ok {
+		return Location{}, fmt.Errorf("invalid location %q, expected lat,lon", s)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return Location{}, fmt.Errorf("invalid latitude in %q", s)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return Location{}, fmt.Errorf("invalid longitude in %q", s)
+	}
+	return Location{Lat: lat, Lon: lon}, nil
+}
+
+// resolveLocation picks the location for a new note: the --location flag,
+// then the NOTE_LOCATION default, then the output of LOCATION_HELPER (e.g.
+// CoreLocationCLI on macOS or a geoclue client on Linux). An empty result
+// means the note is not geotagged.
+func resolveLocation(config *CONFIG, flagValue string) (string, error) {
+	value := flagValue
+	if value == "" {
+		value = config.Location
+	}
+	if value == "" && config.LocationHelper != "" {
+		fields := strings.Fields(config.LocationHelper)
+		out, err := exec.Command(fields[0], fields[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("location helper failed: %w", err)
+		}
+		value = string(out)
+	}
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+	loc, err := parseLocation(value)
+	if err != nil {
+		return "", err
+	}
+	return loc.String(), nil
+}
+
+func runMap(config *CONFIG, args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: syt map export [--format geojson|html] [-o file] [--tag tag] [--where cond]")
+	}
+	fs := flag.NewFlagSet("map export", flag.ContinueOnError)
+	format := fs.String("format", "geojson", "output format: geojson or html")
+	out := fs.String("o", "", "output file (default stdout)")
+	filter := addNoteFilter(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	notes = filter.filter(notes)
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	collection := geoJSON(state, notes)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case "geojson":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(collection)
+	case "html":
+		data, err := json.Marshal(collection)
+		if err != nil {
+			return err
+		}
+		page, err := readAsset(config, "themes/map.html")
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New("map").Parse(string(page))
+		if err != nil {
+			return fmt.Errorf("parsing map theme: %w", err)
+		}
+		return tmpl.Execute(w, template.JS(data))
+	default:
+		return fmt.Errorf("unknown map format %q", *format)
+	}
+}
+
+type geoFeature struct {
+	Type       string            `json:"type"`
+	Geometry   geoPoint          `json:"geometry"`
+	Properties map[string]string `json:"properties"`
+}
+
+type geoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+// geoJSON collects every note with a valid location into a FeatureCollection.
+// Notes with malformed locations are skipped.
+func geoJSON(state *State, notes []*Note) geoCollection {
+	collection := geoCollection{Type: "FeatureCollection", Features: []geoFeature{}}
+	for _, note := range notes {
+		raw := note.Meta["location"]
+		if raw == "" {
+			continue
+		}
+		loc, err := parseLocation(raw)
+		if err != nil {
+			continue
+		}
+		collection.Features = append(collection.Features, geoFeature{
+			Type:     "Feature",
+			Geometry: geoPoint{Type: "Point", Coordinates: [2]float64{loc.Lon, loc.Lat}},
+			Properties: map[string]string{
+				"title":   displayTitle(state, note),
+				"path":    note.Path,
+				"created": noteDate(note).Format("2006-01-02"),
+			},
+		})
+	}
+	return collection
+}
@@ -1,97 +1,527 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // CONFIG holds various configuration options
 type CONFIG struct {
-	Editor           string
-	NotesDir         string
-	GitEnabled       bool
-	GitRepoPath      string
-	NotionEnabled    bool
-	NotionToken      string
-	NotionDatabaseID string
+	Editor             string
+	NotesDir           string
+	GitEnabled         bool
+	GitRepoPath        string
+	NotionEnabled      bool
+	NotionToken        string
+	NotionDatabaseID   string
+	PeopleDir          string
+	Location           string
+	LocationHelper     string
+	WeatherEnabled     bool
+	WeatherURL         string
+	SpellLang          string
+	ProseMinEase       float64
+	ProseMaxSentence   int
+	TagSuggestCommand  string
+	Remote             string
+	RemoteCommand      string
+	Direct             bool
+	FoldDiacritics     bool
+	TextLocale         string
+	SearchTokenizer    string
+	SearchStemmer      string
+	SearchStopWords    string
+	ConfirmPolicy      string
+	Yes                bool
+	Accessible         bool
+	MessageLang        string
+	Now                string
+	Seed               string
+	TrashRetention     string
+	TrashMaxSize       string
+	PublishChecks      string
+	Force              bool
+	ImageUploadURL     string
+	ImageUploadCommand string
+	NotionComments     string
+	ConfluenceURL      string
+	ConfluenceUser     string
+	ConfluenceToken    string
+	ConfluenceSpace    string
+	ConfluenceParent   string
+	AnkiDeck           string
+	AnkiConnectURL     string
+	PublishScheduledTo string
+	PublishSiteArgs    string
+	ServeAddr          string
+	ServeTLSCert       string
+	ServeTLSKey        string
+	ServeBasePath      string
+	ServeProxies       string
+	ServePublicURL     string
+	NewNoteHeader      string
+	NoteAuthor         string
+	ErrorFormat        string
+	ErrorHook          string
+	FilenamePrefix     string
+	SparsePaths        string
+	DailyMode          bool
+	GitGCInterval      string
+	GitSquashWindow    string
+	DeviceBranches     bool
+	DeviceName         string
+	UnionMergePaths    string
+	NotionProperties   string
+	NotionRate         string
+	NotionRetries      int
+	GitPullConflict    string
+	GitRemoteURL       string
+	WatchDebounce      string
+	InboxNote          string
+	MentionHandle      string
+	DesktopNotify      bool
+	AttachmentsDir     string
+	GitCommitMessage   string
+	ScanNotebook       string
+	OCRCommand         string
+	GitBatchCommits    bool
+	FormatCommand      string
+	WebhookURL         string
+	SyncRetries        int
+	UploadBudgetMB     int
+	NotionCallBudget   int
+	Encryption         string
+	AgeRecipient       string
+	AgeIdentity        string
+	GPGRecipient       string
+	VaultContainer     string
+	VaultPassCommand   string
 }
 
 func main() {
 	// Load configuration
-	config := loadConfig()
+	config, err := loadConfig()
+	setTextFolding(config)
+	setMessageLang(config)
+	if err != nil {
+		exitWithError(config, "", nil, err)
+	}
 
-	// Create a new note filename
-	noteFile, err := createNewNoteFile(config.NotesDir)
+	// With a remote configured, the vault on that host does all the work
+	args := globalFlags(config, os.Args[1:])
+	if config.Remote != "" {
+		code, err := runRemote(config, args)
+		if err != nil {
+			log.Fatalf(tr("Error running on %s: %v"), config.Remote, err)
+		}
+		os.Exit(code)
+	}
+	if err := setDeterminism(config); err != nil {
+		exitWithError(config, "", args, withCode(ErrUsage, err))
+	}
+	// The daemon has its own clock, so pinned runs stay in this process
+	if config.Now != "" || config.Seed != "" {
+		config.Direct = true
+	}
+
+	// Subcommands; without one syt creates a new note as it always has
+	command := "new"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		command, args = "help", nil
+	}
+
+	// An encrypted vault has to be unlocked before there are notes to work on;
+	// backups are of the sealed container, so they don't need it
+	if config.VaultContainer != "" && command != "vault" && command != "help" && command != "backup" && !vaultUnlocked(config) {
+		exitWithError(config, command, args, codeErrorf(ErrConfigInvalid, "the vault is locked; run syt vault unlock"))
+	}
+
+	// Notes an interrupted run left unsynced are offered for syncing
+	if isTerminal(os.Stdin) && !noResume[command] {
+		offerResume(config)
+	}
+
+	// Read-only commands are answered by a running daemon when possible,
+	// which keeps the parsed notes warm between invocations
+	if !config.Direct && routable(command, args) {
+		output, err := callDaemonRun(config, command, args)
+		if err != errDaemonDown {
+			fmt.Print(output)
+			if err != nil {
+				exitWithError(config, command, args, err)
+			}
+			return
+		}
+	}
+
+	err = runCommand(config, command, args)
+	// Whatever the command changed goes back into the encrypted vault
+	if config.VaultContainer != "" && vaultUnlocked(config) {
+		if sealErr := sealVault(config); sealErr != nil {
+			log.Printf("Could not seal the vault: %v", sealErr)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Error creating new note file: %v", err)
+		exitWithError(config, command, args, err)
 	}
+}
 
-	//Open the note in the configured editor
-	err = openEditor(config.Editor, noteFile)
+// runNew creates a note, opens it in the editor and syncs it afterwards.
+// With -m or --stdin the text is written straight into the note instead and
+// nothing is asked, so scripts and aliases can capture notes. Under
+// DAILY_MODE a new note without a title, type or template goes to today's
+// daily note instead.
+func runNew(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	location := fs.String("location", "", "record a lat,lon location in the note's frontmatter")
+	typeName := fs.String("type", "", "note type (meeting, adr, journal, link, ...)")
+	templateName := fs.String("template", "", "render this template into the note (default: the type's)")
+	autoTag := fs.Bool("auto-tag", false, "add suggested tags without prompting")
+	tagList := fs.String("tags", "", "comma separated tags for the note, e.g. work,ideas")
+	message := fs.String("m", "", "write this text into the note instead of opening the editor")
+	fromStdin := fs.Bool("stdin", false, "read the note's text from stdin instead of opening the editor")
+	fs.BoolVar(&config.Force, "force", false, "sync even if a note tagged publish fails its checks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	usedM := false
+	fs.Visit(func(f *flag.Flag) { usedM = usedM || f.Name == "m" })
+	if usedM && *fromStdin {
+		return fmt.Errorf("usage: syt new [-m text | --stdin] [title]")
+	}
+	capture, text := usedM || *fromStdin, *message
+	if *fromStdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+	if text = strings.TrimSpace(text); capture && text == "" {
+		return errors.New(tr("nothing to add"))
+	}
+	if config.DailyMode && !capture && fs.NArg() == 0 && *typeName == "" && *templateName == "" {
+		return runToday(config, nil)
+	}
+	title := strings.Join(fs.Args(), " ")
+	tags := splitList(*tagList)
+	if title == "" && !capture && isTerminal(os.Stdin) {
+		var prompted []string
+		var err error
+		if title, prompted, err = promptTitle(config); err != nil {
+			return err
+		}
+		tags = dedupe(append(tags, prompted...))
+	}
+
+	dir, body, source := config.NotesDir, "", ""
+	if *typeName != "" {
+		t, err := lookupType(*typeName)
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(config.NotesDir, t.Folder)
+		if *templateName == "" {
+			if body, err = typeTemplate(config, t); err != nil {
+				return err
+			}
+			source = *typeName
+		}
+	}
+	switch {
+	case *templateName != "":
+		var err error
+		if body, err = loadTemplate(config, *templateName); err != nil {
+			return err
+		}
+		source = *templateName
+	case *typeName == "" && config.NewNoteHeader != "":
+		body = renderNoteHeader(config.NewNoteHeader, title, currentTime(), tags)
+	}
+	if source != "" {
+		var err error
+		data := newTemplateData(config, title, strings.ToLower(*typeName), tags)
+		if body, err = renderTemplate(source, body, data); err != nil {
+			return err
+		}
+	}
+
+	loc, err := resolveLocation(config, *location)
 	if err != nil {
-		log.Fatalf("Error opening editor: %v", err)
+		return err
+	}
+	// Every note gets an id, its creation time and a tags list to fill in
+	meta := map[string]string{
+		"title":    title,
+		"id":       newID(),
+		"created":  currentTime().Format("2006-01-02 15:04"),
+		"type":     strings.ToLower(*typeName),
+		"tags":     formatTags(tags),
+		"location": loc,
 	}
 
-	// 4. (Optional) Commit and push to Git
-	if config.GitEnabled {
-		if err := gitCommitAndPush(noteFile, config); err != nil {
-			log.Printf("Error committing/pushing to git: %v", err)
+	// The weather stamp needs a location; failing to get one is not fatal
+	if config.WeatherEnabled && loc != "" {
+		if stamp, err := weatherStamp(config, loc); err != nil {
+			log.Printf("Could not fetch weather: %v", err)
 		} else {
-			fmt.Println("Note committed and pushed to Git.")
+			meta["weather"] = stamp
 		}
 	}
+	if capture {
+		if body = strings.TrimRight(body, "\n"); body != "" {
+			body += "\n\n"
+		}
+		body += text + "\n"
+	}
+	header := formatFrontmatter(meta, []string{"title", "id", "created", "type", "tags", "location", "weather"}) + body
 
-	// todo:Upload to Notion
-	if config.NotionEnabled {
-		content, err := ioutil.ReadFile(noteFile)
+	// Reuse an existing note on the same topic if the user asks to
+	noteFile := ""
+	if title != "" && !capture {
+		if noteFile, err = resolveDuplicate(config, title); err != nil {
+			return err
+		}
+	}
+
+	// An encrypted note is written and edited outside the vault
+	if noteFile == "" {
+		c, err := configuredCipher(config)
 		if err != nil {
-			log.Printf("Error reading note file for Notion upload: %v", err)
-		} else {
-			err := uploadToNotion(config, string(content))
-			if err != nil {
-				log.Printf("Error uploading to Notion: %v", err)
-			} else {
-				fmt.Println("Note uploaded to Notion.")
+			return err
+		}
+		if c != nil {
+			if _, err := newSealedNote(config, c, dir, title, header, capture); err != nil {
+				return err
 			}
+			fmt.Print(tr("Done!\n"))
+			return nil
+		}
+	}
+
+	// Create a new note filename
+	if noteFile == "" {
+		noteFile, err = createNewNoteFile(dir, config.FilenamePrefix, title, header)
+		if err != nil {
+			return fmt.Errorf("creating new note file: %w", err)
+		}
+	}
+
+	// Until it is synced the note is pending, so a run that dies is resumed
+	if err := markPending(config, noteFile); err != nil {
+		log.Printf("Could not record pending sync: %v", err)
+	}
+
+	//Open the note in the configured editor
+	if !capture {
+		if err := openEditor(config.Editor, noteFile); err != nil {
+			return fmt.Errorf("opening editor: %w", err)
+		}
+	}
+	if err := recordVisit(config, noteFile); err != nil {
+		log.Printf("Could not record visit: %v", err)
+	}
+
+	if err := storeLanguage(noteFile); err != nil {
+		log.Printf("Could not store note language: %v", err)
+	}
+	if !capture || *autoTag {
+		if err := offerTags(config, noteFile, *autoTag); err != nil {
+			log.Printf("Could not suggest tags: %v", err)
+		}
+	}
+
+	// A type set while editing files the note under that type's folder
+	if filed, err := fileByType(config, noteFile); err != nil {
+		log.Printf("Could not file note by type: %v", err)
+	} else if filed != noteFile {
+		if err := movePending(config, noteFile, filed); err != nil {
+			log.Printf("Could not record pending sync: %v", err)
+		}
+		noteFile = filed
+	}
+	var noteType NoteType
+	note, err := readNote(noteFile)
+	if err != nil {
+		return err
+	}
+	if note.Meta["type"] != "" {
+		noteType, _ = lookupType(note.Meta["type"])
+	}
+
+	// Captured links get their preview cached right away
+	if linkURL(note) != "" {
+		if err := unfurlNotes(config, []*Note{note}, false, false); err != nil {
+			log.Printf("Could not cache link preview: %v", err)
 		}
 	}
 
-	fmt.Println("Done!")
+	// Failures are reported as they happen; the note itself is safe on disk
+	_ = syncTracked(config, syncBackends(config), noteType, noteFile)
+
+	fmt.Print(tr("Done!\n"))
+	return nil
 }
 
-// loadConfig loads configuration from environment variables (or from a file, if desired).
-func loadConfig() *CONFIG {
+// renderNoteHeader fills in the NEW_NOTE_HEADER template that starts every
+// note created without a type. It may use {{title}}, {{date}}, {{time}} and
+// {{tags}}, and a literal \n stands for a newline so the header can be set
+// from the environment.
+func renderNoteHeader(tmpl, title string, now time.Time, tags []string) string {
+	header := strings.NewReplacer(
+		`\n`, "\n",
+		"{{title}}", title,
+		"{{date}}", now.Format("2006-01-02"),
+		"{{time}}", now.Format("15:04"),
+		"{{tags}}", strings.Join(tags, ", "),
+	).Replace(tmpl)
+	if !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+	return header
+}
 
-	return &CONFIG{
-		Editor:           getEnv("NOTE_EDITOR", "vim"),
-		NotesDir:         getEnv("NOTES_DIR", "./notes"),
-		GitEnabled:       getEnvBool("GIT_ENABLED", false),
-		GitRepoPath:      getEnv("GIT_REPO_PATH", "./notes"),
-		NotionEnabled:    getEnvBool("NOTION_ENABLED", false),
-		NotionToken:      os.Getenv("NOTION_TOKEN"),       // If needed
-		NotionDatabaseID: os.Getenv("NOTION_DATABASE_ID"), // If needed
+// filenamePrefix reads FILENAME_DATE_FORMAT, the Go time layout that starts
+// titled notes' file names. "none" turns the prefix off.
+func filenamePrefix() string {
+	if layout := getEnv("FILENAME_DATE_FORMAT", "2006-01-02"); layout != "none" {
+		return layout
 	}
+	return ""
+}
+
+// loadConfig loads configuration from environment variables and the config
+// file (see config.go), the environment taking precedence. A config file
+// that can't be read is reported, with the settings from the environment
+// still returned so the error can be handled as configured.
+func loadConfig() (*CONFIG, error) {
+	fileErr := withCode(ErrConfigInvalid, loadConfigFile())
+
+	return &CONFIG{
+		Editor:             getEnv("NOTE_EDITOR", "vim"),
+		NotesDir:           notesDir(),
+		GitEnabled:         getEnvBool("GIT_ENABLED", false),
+		GitRepoPath:        getEnv("GIT_REPO_PATH", notesDir()),
+		NotionEnabled:      getEnvBool("NOTION_ENABLED", false),
+		NotionToken:        configValue("NOTION_TOKEN"),       // If needed
+		NotionDatabaseID:   configValue("NOTION_DATABASE_ID"), // If needed
+		PeopleDir:          getEnv("PEOPLE_DIR", "people"),
+		Location:           configValue("NOTE_LOCATION"),
+		LocationHelper:     configValue("LOCATION_HELPER"),
+		WeatherEnabled:     getEnvBool("WEATHER_ENABLED", false),
+		WeatherURL:         getEnv("WEATHER_URL", "https://api.open-meteo.com/v1/forecast"),
+		SpellLang:          getEnv("SPELL_LANG", "en_US"),
+		ProseMinEase:       getEnvFloat("PROSE_MIN_READING_EASE", 30),
+		ProseMaxSentence:   getEnvInt("PROSE_MAX_SENTENCE_WORDS", 40),
+		TagSuggestCommand:  configValue("TAG_SUGGEST_COMMAND"),
+		Remote:             configValue("SYT_REMOTE"),
+		RemoteCommand:      getEnv("SYT_REMOTE_COMMAND", "syt"),
+		FoldDiacritics:     getEnvBool("FOLD_DIACRITICS", true),
+		TextLocale:         getEnv("TEXT_LOCALE", os.Getenv("LANG")),
+		SearchTokenizer:    configValue("SEARCH_TOKENIZER"),
+		SearchStemmer:      configValue("SEARCH_STEMMER"),
+		SearchStopWords:    configValue("SEARCH_STOPWORDS"),
+		ConfirmPolicy:      getEnv("CONFIRM_POLICY", "always"),
+		Accessible:         accessibleOutput(getEnv("ACCESSIBLE_OUTPUT", "auto")),
+		MessageLang:        configValue("SYT_LANG"),
+		Now:                configValue("SYT_NOW"),
+		Seed:               configValue("SYT_SEED"),
+		TrashRetention:     getEnv("TRASH_RETENTION", "30d"),
+		TrashMaxSize:       configValue("TRASH_MAX_SIZE"),
+		PublishChecks:      getEnv("PUBLISH_CHECKS", "lint,todo"),
+		ImageUploadURL:     configValue("IMAGE_UPLOAD_URL"),
+		ImageUploadCommand: configValue("IMAGE_UPLOAD_COMMAND"),
+		NotionComments:     getEnv("NOTION_COMMENTS", "section"),
+		ConfluenceURL:      configValue("CONFLUENCE_URL"),
+		ConfluenceUser:     configValue("CONFLUENCE_USER"),
+		ConfluenceToken:    configValue("CONFLUENCE_TOKEN"),
+		ConfluenceSpace:    configValue("CONFLUENCE_SPACE"),
+		ConfluenceParent:   configValue("CONFLUENCE_PARENT_ID"),
+		AnkiDeck:           getEnv("ANKI_DECK", "syt"),
+		AnkiConnectURL:     getEnv("ANKI_CONNECT_URL", "http://localhost:8765"),
+		PublishScheduledTo: getEnv("PUBLISH_SCHEDULED_TO", "sync"),
+		PublishSiteArgs:    configValue("PUBLISH_SITE_ARGS"),
+		ServeAddr:          getEnv("SERVE_ADDR", "127.0.0.1:8080"),
+		ServeTLSCert:       configValue("SERVE_TLS_CERT"),
+		ServeTLSKey:        configValue("SERVE_TLS_KEY"),
+		ServeBasePath:      configValue("SERVE_BASE_PATH"),
+		ServeProxies:       configValue("SERVE_TRUSTED_PROXIES"),
+		ServePublicURL:     configValue("SERVE_PUBLIC_URL"),
+		NewNoteHeader:      configValue("NEW_NOTE_HEADER"),
+		NoteAuthor:         configValue("NOTE_AUTHOR"),
+		ErrorFormat:        strings.ToLower(configValue("ERROR_FORMAT")),
+		ErrorHook:          configValue("ERROR_HOOK"),
+		FilenamePrefix:     filenamePrefix(),
+		SparsePaths:        configValue("SPARSE_PATHS"),
+		DailyMode:          getEnvBool("DAILY_MODE", false),
+		GitGCInterval:      getEnv("GIT_GC_INTERVAL", "1d"),
+		GitSquashWindow:    configValue("GIT_SQUASH_WINDOW"),
+		DeviceBranches:     getEnvBool("GIT_DEVICE_BRANCHES", false),
+		DeviceName:         getEnv("DEVICE_NAME", hostName()),
+		UnionMergePaths:    getEnv("UNION_MERGE_PATHS", "journal/*.md"),
+		NotionProperties:   configValue("NOTION_PROPERTIES"),
+		NotionRate:         getEnv("NOTION_RATE", "3/s"),
+		NotionRetries:      getEnvInt("NOTION_MAX_RETRIES", 5),
+		GitPullConflict:    strings.ToLower(getEnv("GIT_PULL_CONFLICT", "abort")),
+		GitRemoteURL:       configValue("GIT_REMOTE_URL"),
+		WatchDebounce:      getEnv("WATCH_DEBOUNCE", "30s"),
+		InboxNote:          getEnv("INBOX_NOTE", "inbox.md"),
+		MentionHandle:      strings.TrimPrefix(getEnv("MENTION_HANDLE", os.Getenv("USER")), "@"),
+		DesktopNotify:      getEnvBool("DESKTOP_NOTIFY", true),
+		AttachmentsDir:     getEnv("ATTACHMENTS_DIR", "attachments"),
+		GitCommitMessage:   getEnv("GIT_COMMIT_MESSAGE", "{{.Action}} note: {{.Title}} ({{.Path}})"),
+		ScanNotebook:       getEnv("SCAN_NOTEBOOK", "inbox"),
+		OCRCommand:         configValue("OCR_COMMAND"),
+		GitBatchCommits:    getEnvBool("GIT_BATCH_COMMITS", false),
+		FormatCommand:      configValue("FORMAT_COMMAND"),
+		WebhookURL:         configValue("WEBHOOK_URL"),
+		SyncRetries:        getEnvInt("SYNC_RETRIES", 2),
+		UploadBudgetMB:     getEnvInt("UPLOAD_BUDGET_MB", 0),
+		NotionCallBudget:   getEnvInt("NOTION_CALL_BUDGET", 0),
+		Encryption:         strings.ToLower(configValue("ENCRYPTION")),
+		AgeRecipient:       configValue("AGE_RECIPIENT"),
+		AgeIdentity:        expandHome(getEnv("AGE_IDENTITY", filepath.Join(filepath.Dir(configPath()), "age.key"))),
+		GPGRecipient:       configValue("GPG_RECIPIENT"),
+		VaultContainer:     expandHome(configValue("VAULT_CONTAINER")),
+		VaultPassCommand:   configValue("VAULT_PASSPHRASE_COMMAND"),
+	}, fileErr
 }
 
-func createNewNoteFile(notesDir string) (string, error) {
+// createNewNoteFile creates a note in notesDir starting with header. A
+// titled note is named after its date, written with the prefix layout, and
+// title; an untitled one after the time it was created.
+func createNewNoteFile(notesDir, prefix, title, header string) (string, error) {
 	// Ensure the notes directory exists
 	err := os.MkdirAll(notesDir, 0755)
 	if err != nil {
 		return "", err
 	}
 
-	// Create a note filename based on timestamp
-	timestamp := time.Now().Format("2006-01-02_150405")
-	fileName := fmt.Sprintf("note_%s.md", timestamp)
-	fullPath := notesDir + string(os.PathSeparator) + fileName
+	now := currentTime()
+	base := "note_" + now.Format("2006-01-02_150405")
+	if title != "" {
+		base = strings.TrimSuffix(datedFileName(prefix, now, title), ".md")
+	}
+	fullPath := filepath.Join(notesDir, base+".md")
 
-	// Create an empty file
-	file, err := os.Create(fullPath)
+	// Create an empty file; a name that is taken gets an ID suffix
+	file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	for os.IsExist(err) {
+		fullPath = filepath.Join(notesDir, base+"_"+newID()+".md")
+		file, err = os.OpenFile(fullPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -102,8 +532,9 @@ func createNewNoteFile(notesDir string) (string, error) {
 		}
 	}(file)
 
-	// You can optionally write a header or template content here
-	// e.g. "# My Note\n\n"
+	if _, err := file.WriteString(header); err != nil {
+		return "", err
+	}
 	return fullPath, nil
 }
 
@@ -112,87 +543,168 @@ func openEditor(editor, filePath string) error {
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return withCode(ErrEditorFailed, cmd.Run())
 }
 
 func gitCommitAndPush(noteFile string, config *CONFIG) error {
-	// cd into the Git repository path
-	if err := os.Chdir(config.GitRepoPath); err != nil {
-		return fmt.Errorf("could not chdir to repo path: %w", err)
+	// The notes may be a worktree or a subdirectory of a bigger repository
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		if root, err = setUpGitRepo(config); err != nil {
+			return err
+		}
+	}
+	path, err := filepath.Abs(noteFile)
+	if err != nil {
+		return withCode(ErrGitFailed, err)
 	}
 
-	// Stage the file
-	if err := runCmd("git", "add", noteFile); err != nil {
-		return err
+	// Nothing to commit when the note is as committed, say after a sync saw
+	// it, but a push that failed before may still be owed
+	if out, err := gitOutput(root, "status", "--porcelain", "--", path); err == nil && strings.TrimSpace(out) == "" {
+		if ahead, err := gitOutput(root, "rev-list", "--count", "@{upstream}..HEAD"); err != nil || strings.TrimSpace(ahead) == "0" || config.GitSquashWindow != "" {
+			return nil
+		}
+		return gitPush(config, root)
 	}
 
-	// Commit
-	message := fmt.Sprintf("Add note: %s", noteFile)
-	if err := runCmd("git", "commit", "-m", message); err != nil {
+	_, err = gitOutput(root, "ls-files", "--error-unmatch", "--", path)
+	message, err := commitMessage(config, noteFile, err == nil)
+	if err != nil {
 		return err
 	}
+	args := []string{"-C", root, "commit", "-m", message}
+	if config.GitSquashWindow != "" {
+		// The trailer marks the commit as one syt may squash
+		args = append(args, "-m", noteTrailer+": "+relNotePath(root, path))
+	}
 
-	// Push
-	if err := runCmd("git", "push"); err != nil {
+	// Stage the file
+	if err := runCmd("git", "-C", root, "add", "--", path); err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+
+	// Commit just the note, leaving anything else staged in the repo alone
+	if err := runCmd("git", append(args, "--", path)...); err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+
+	// With a squash window the push waits, so a day's saves go up as one
+	if config.GitSquashWindow != "" {
+		return nil
+	}
+	return gitPush(config, root)
+}
+
+// gitPush pushes the repository at root: the current branch to its upstream,
+// after rebasing onto whatever other machines pushed there, or with
+// GIT_DEVICE_BRANCHES this machine's commits to its own branch.
+func gitPush(config *CONFIG, root string) error {
+	if config.DeviceBranches {
+		return runGitPush(root, pushRemote(root), "HEAD:refs/heads/"+deviceBranch(config))
+	}
+	if err := gitPullRebase(config, root); err != nil {
 		return err
 	}
+	return runGitPush(root)
+}
 
+// gitPullRebase replays local commits on top of the upstream branch so the
+// push that follows isn't rejected. GIT_PULL_CONFLICT picks what happens
+// when both sides changed the same lines; see resolveRebase.
+func gitPullRebase(config *CONFIG, root string) error {
+	args := []string{"pull", "--rebase", "--autostash"}
+	switch config.GitPullConflict {
+	case "off":
+		return nil
+	case "abort", "notify", "keep-both", "union":
+	case "local", "ours":
+		// While rebasing, "theirs" is the commit being replayed
+		args = append(args, "-X", "theirs")
+	case "remote", "theirs":
+		args = append(args, "-X", "ours")
+	default:
+		return codeErrorf(ErrConfigInvalid, "GIT_PULL_CONFLICT: %q is not abort, notify, local, remote, keep-both, union or off", config.GitPullConflict)
+	}
+	if _, err := gitOutput(root, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		// Nothing to pull from; the push sets things straight or says why
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	pull := exec.Command("git", append([]string{"-C", root}, args...)...)
+	pull.Stdin, pull.Stdout, pull.Stderr = os.Stdin, io.Discard, &stderr
+	if err := pull.Run(); err != nil {
+		if len(conflictedFiles(root)) == 0 {
+			if gitAuthFailure(stderr.String()) {
+				return codeErrorf(ErrGitAuth, "git pull: authentication failed: %w", err)
+			}
+			return codeErrorf(ErrGitFailed, "git pull --rebase: %s", strings.TrimSpace(stderr.String()))
+		}
+		return resolveRebase(config, root)
+	}
 	return nil
 }
 
-func uploadToNotion(config *CONFIG, content string) error {
-	// Example of how you might use a Notion library like github.com/jomei/notionapi
-	// Below is a conceptual snippet — you’ll need to adapt it to your usage.
-
-	/*
-	   client := notion.NewClient(notion.Token(config.NotionToken))
-	   // Create a new page in a given database:
-	   newPage := notion.PageCreateRequest{
-	       Parent: notion.Parent{
-	           DatabaseID: notion.DatabaseID(config.NotionDatabaseID),
-	       },
-	       Properties: notion.Properties{
-	           "Title": notion.TitleProperty{
-	               Title: []notion.RichText{
-	                   {
-	                       Text: notion.Text{
-	                           Content: "My New Note",
-	                       },
-	                   },
-	               },
-	           },
-	       },
-	       Children: []notion.Block{
-	           notion.ParagraphBlock{
-	               BasicBlock: notion.BasicBlock{
-	                   Type: notion.BlockTypeParagraph,
-	               },
-	               Paragraph: notion.RichTextBlock{
-	                   Text: []notion.RichText{
-	                       {
-	                           Text: notion.Text{
-	                               Content: content,
-	                           },
-	                       },
-	                   },
-	               },
-	           },
-	       },
-	   }
-
-	   _, err := client.Page.Create(context.Background(), &newPage)
-	   return err
-	*/
-
-	// Since we’re not actually using the Notion client here, just simulate:
-	fmt.Println("Simulating Notion upload with content:")
-	fmt.Println(strings.Repeat("-", 40))
-	fmt.Println(content)
-	fmt.Println(strings.Repeat("-", 40))
-
+// runGitPush runs git push with args, telling a rejected credential apart
+// from other failures.
+func runGitPush(root string, args ...string) error {
+	var stderr bytes.Buffer
+	push := exec.Command("git", append([]string{"-C", root, "push"}, args...)...)
+	push.Stdin, push.Stdout, push.Stderr = os.Stdin, os.Stdout, io.MultiWriter(os.Stderr, &stderr)
+	if err := push.Run(); err != nil {
+		if gitAuthFailure(stderr.String()) {
+			return codeErrorf(ErrGitAuth, "git push: authentication failed: %w", err)
+		}
+		return withCode(ErrGitFailed, err)
+	}
 	return nil
 }
 
+// gitAuthFailure reports whether git's error output is about credentials.
+func gitAuthFailure(stderr string) bool {
+	stderr = strings.ToLower(stderr)
+	for _, s := range []string{"authentication failed", "permission denied", "could not read username", "invalid username or password", "access denied"} {
+		if strings.Contains(stderr, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadToNotion syncs a note to its Notion page, patching only the blocks
+// that changed since the last sync. Without a NOTION_TOKEN the API calls are
+// only printed.
+func uploadToNotion(config *CONFIG, notePath string) error {
+	note, err := readNote(notePath)
+	if err != nil {
+		return fmt.Errorf("reading note file for Notion upload: %w", err)
+	}
+	var api notionAPI = &notionClient{config: config}
+	if config.NotionToken == "" {
+		api = simulatedNotion{databaseID: config.NotionDatabaseID}
+	}
+	return withCode(ErrNotionFailed, syncNotionPage(config, api, note))
+}
+
+// accessibleOutput decides whether to use screen-reader friendly output: no
+// box drawing or color-only signals. "auto" turns it on for dumb terminals,
+// which is what screen reader setups such as Emacspeak report.
+func accessibleOutput(mode string) bool {
+	if mode == "auto" {
+		return os.Getenv("TERM") == "dumb"
+	}
+	val := strings.ToLower(mode)
+	return val == "true" || val == "1"
+}
+
+// isTerminal reports whether f is an interactive terminal rather than a pipe
+// or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // Helper to run a command and get combined output or error
 func runCmd(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
@@ -205,7 +717,7 @@ func runCmd(name string, args ...string) error {
 
 // use os now. todo: load maybe from .syt file in linux. also maybe can define a env file
 func getEnv(key, defaultVal string) string {
-	val := os.Getenv(key)
+	val := configValue(key)
 	if val == "" {
 		return defaultVal
 	}
@@ -213,10 +725,26 @@ func getEnv(key, defaultVal string) string {
 }
 
 func getEnvBool(key string, defaultVal bool) bool {
-	val := os.Getenv(key)
+	val := configValue(key)
 	if val == "" {
 		return defaultVal
 	}
 	val = strings.ToLower(val)
 	return val == "true" || val == "1"
 }
+
+func getEnvInt(key string, defaultVal int) int {
+	val, err := strconv.Atoi(configValue(key))
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	val, err := strconv.ParseFloat(configValue(key), 64)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// legacyName matches the note_<timestamp>.md files created before notes had
+// frontmatter and titled file names.
+var legacyName = regexp.MustCompile(`^note_(\d{4}-\d{2}-\d{2}_\d{6})(?:_[0-9a-f]+)?\.md$`)
+
+// datedFileName is a note's file name in the current layout: its date and
+// a slug of its title, e.g. 2024-05-01_weekly-planning.md. prefix is the
+// time layout the date is written in (FILENAME_DATE_FORMAT); an empty one
+// leaves the date out of titled notes' names.
+func datedFileName(prefix string, t time.Time, title string) string {
+	if title == "" {
+		return t.Format("2006-01-02_150405") + ".md"
+	}
+	if prefix == "" {
+		return slugify(title) + ".md"
+	}
+	// A layout with slashes would make directories, so they become dashes
+	return strings.ReplaceAll(t.Format(prefix), "/", "-") + "_" + slugify(title) + ".md"
+}
+
+// runMigrate upgrades a vault from an older layout. Only v0 exists so far.
+func runMigrate(config *CONFIG, args []string) error {
+	if len(args) == 0 || args[0] != "v0" {
+		return fmt.Errorf("usage: syt migrate v0 [--dry-run]")
+	}
+	fs := flag.NewFlagSet("migrate v0", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "show the changes without making them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	return migrateV0(config, *dryRun)
+}
+
+// migrateV0 moves note_<timestamp>.md files to the dated layout. Each gets
+// the id, created and title frontmatter it lacks, links from other notes
+// are pointed at the new names, and the state kept per note (visits, sync
+// targets) follows it. The file changes can be reverted with `syt undo`.
+func migrateV0(config *CONFIG, dryRun bool) error {
+	notes, err := scanNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	taken := map[string]bool{}
+	for _, note := range notes {
+		taken[note.Path] = true
+	}
+
+	renames := map[string]string{} // old path to new path
+	contents := map[string]string{}
+	for _, note := range notes {
+		m := legacyName.FindStringSubmatch(note.Name)
+		if m == nil {
+			continue
+		}
+		created, err := time.ParseInLocation("2006-01-02_150405", m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		title := note.Meta["title"]
+		if title == "" && noteTitle(note) != strings.TrimSuffix(note.Name, ".md") {
+			title = noteTitle(note)
+		}
+
+		data, err := os.ReadFile(note.Path)
+		if err != nil {
+			return err
+		}
+		content := string(data)
+		for _, kv := range [][2]string{{"id", newID()}, {"created", created.Format("2006-01-02 15:04")}, {"title", title}} {
+			if note.Meta[kv[0]] == "" && kv[1] != "" {
+				content = setFrontmatter(content, kv[0], kv[1])
+			}
+		}
+		contents[note.Path] = content
+
+		dest := filepath.Join(filepath.Dir(note.Path), datedFileName(config.FilenamePrefix, created, title))
+		for taken[dest] {
+			dest = strings.TrimSuffix(dest, ".md") + "_" + newID() + ".md"
+		}
+		taken[dest] = true
+		renames[note.Path] = dest
+	}
+	if len(renames) == 0 {
+		fmt.Println("No v0 notes to migrate.")
+		return nil
+	}
+
+	// Point links at the new names, in migrated notes and all the others
+	links := 0
+	for _, note := range notes {
+		content, ok := contents[note.Path]
+		if !ok {
+			data, err := os.ReadFile(note.Path)
+			if err != nil {
+				return err
+			}
+			content = string(data)
+		}
+		from := note.Path
+		if dest, ok := renames[from]; ok {
+			from = dest
+		}
+		rewritten, n := rewriteLinks(content, note.Path, from, renames)
+		if n > 0 {
+			contents[note.Path] = rewritten
+			links += n
+		}
+	}
+
+	olds := make([]string, 0, len(renames))
+	for old := range renames {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		fmt.Printf("%s -> %s\n", visitKey(config, old), visitKey(config, renames[old]))
+	}
+	fmt.Printf("%d note(s) to rename, %d link(s) to update.\n", len(renames), links)
+	if dryRun {
+		return nil
+	}
+	if err := confirm(config, "Migrate v0 notes", len(contents)); err != nil {
+		return err
+	}
+
+	op := beginOperation(config, "migrate v0")
+	migrate := func() error {
+		for path, content := range contents {
+			if err := op.saveBefore(path); err != nil {
+				return err
+			}
+			if err := writeFileAtomic(path, []byte(content)); err != nil {
+				return err
+			}
+		}
+		for _, old := range olds {
+			if err := os.Rename(old, renames[old]); err != nil {
+				return err
+			}
+			op.moved(old, renames[old])
+		}
+		return nil
+	}
+	if err := migrate(); err != nil {
+		// What was rewritten or renamed already can still be undone
+		if cerr := op.commit(); cerr != nil {
+			return fmt.Errorf("%w; recording the undo failed: %v", err, cerr)
+		}
+		return err
+	}
+	if err := op.commit(); err != nil {
+		return err
+	}
+
+	err = updateState(config, func(state *State) error {
+		for old, dest := range renames {
+			from, to := visitKey(config, old), visitKey(config, dest)
+			if v, ok := state.Visits[from]; ok {
+				state.Visits[to] = v
+				delete(state.Visits, from)
+			}
+			if p, ok := state.Notion[from]; ok {
+				state.Notion[to] = p
+				delete(state.Notion, from)
+			}
+			if id, ok := state.Confluence[from]; ok {
+				state.Confluence[to] = id
+				delete(state.Confluence, from)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	migrated, err := scanNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	if _, err := updateSearchIndex(config, migrated, true); err != nil {
+		return err
+	}
+	fmt.Printf("Migrated %d note(s) and rebuilt the search index.\n", len(renames))
+	return nil
+}
+
+// rewriteLinks points relative markdown links in content at renamed notes.
+// path is where the note was, newPath where it will be.
+func rewriteLinks(content, path, newPath string, renames map[string]string) (string, int) {
+	n := 0
+	out := mdLinkTarget.ReplaceAllStringFunc(content, func(m string) string {
+		parts := mdLinkTarget.FindStringSubmatch(m)
+		target := parts[3]
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "mailto:") {
+			return m
+		}
+		file, anchor, hasAnchor := strings.Cut(target, "#")
+		dest, ok := renames[filepath.Clean(filepath.Join(filepath.Dir(path), filepath.FromSlash(file)))]
+		if !ok {
+			return m
+		}
+		rel, err := filepath.Rel(filepath.Dir(newPath), dest)
+		if err != nil {
+			return m
+		}
+		n++
+		rel = filepath.ToSlash(rel)
+		if hasAnchor {
+			rel += "#" + anchor
+		}
+		return fmt.Sprintf("%s[%s](%s)", parts[1], parts[2], rel)
+	})
+	return out, n
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// viewMarker identifies a directory populated by `syt mount`, so refreshing
+// or unmounting never deletes anything syt didn't create.
+const viewMarker = ".syt-view"
+
+const viewRefresh = 2 * time.Second
+
+// runMount presents the vault under dir in several hierarchies at once:
+// by-tag/, by-date/ and by-project/ (tags below "project/"). Entries are
+// symlinks to the real notes, so editing through any view edits the note.
+// There is no FUSE binding without cgo or third-party modules, so the views
+// are materialised on disk and refreshed until syt is interrupted, at which
+// point they are removed again.
+func runMount(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("mount", flag.ContinueOnError)
+	once := fs.Bool("once", false, "build the views once and exit, leaving them in place")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt mount [--once] <dir>")
+	}
+	dir := fs.Arg(0)
+	absDir, _ := filepath.Abs(dir)
+	absNotes, _ := filepath.Abs(config.NotesDir)
+	if rel, err := filepath.Rel(absNotes, absDir); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("cannot mount views inside the notes directory")
+	}
+	if err := prepareViewDir(dir); err != nil {
+		return err
+	}
+	if err := buildViews(config, dir); err != nil {
+		return err
+	}
+	if *once {
+		return nil
+	}
+
+	fmt.Printf("Views of %s mounted at %s (Ctrl-C to unmount)\n", config.NotesDir, dir)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(viewRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return clearViews(dir)
+		case <-ticker.C:
+			if err := buildViews(config, dir); err != nil {
+				fmt.Fprintf(os.Stderr, "refreshing views: %v\n", err)
+			}
+		}
+	}
+}
+
+func prepareViewDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if len(entries) > 0 && !fileExists(filepath.Join(dir, viewMarker)) {
+		return fmt.Errorf("%s is not empty and was not created by syt mount", dir)
+	}
+	return os.WriteFile(filepath.Join(dir, viewMarker), nil, 0644)
+}
+
+// buildViews rebuilds the view tree from scratch in a staging directory and
+// swaps each view in, so readers don't see a half-built tree for long.
+func buildViews(config *CONFIG, dir string) error {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	views := map[string][]string{} // view path -> note paths
+	add := func(view, path string) {
+		view = filepath.FromSlash(view)
+		views[view] = append(views[view], path)
+	}
+	for _, note := range notes {
+		add("by-date/"+noteDate(note).Format("2006/01"), note.Path)
+		for _, tag := range noteTags(note) {
+			tag = foldText(strings.Trim(tag, "/"))
+			if !viewableTag(tag) {
+				continue
+			}
+			add("by-tag/"+tag, note.Path)
+			if project, ok := strings.CutPrefix(tag, "project/"); ok {
+				name, _, _ := strings.Cut(project, "/")
+				add("by-project/"+name, note.Path)
+			}
+		}
+	}
+
+	for _, top := range []string{"by-date", "by-tag", "by-project"} {
+		staging := filepath.Join(dir, "."+top+".new")
+		os.RemoveAll(staging)
+		if err := os.MkdirAll(staging, 0755); err != nil {
+			return err
+		}
+		for view, paths := range views {
+			rel, ok := strings.CutPrefix(view, top+string(os.PathSeparator))
+			if !ok {
+				continue
+			}
+			viewDir := filepath.Join(staging, rel)
+			if r, err := filepath.Rel(staging, viewDir); err != nil || !filepath.IsLocal(r) {
+				continue
+			}
+			if err := linkNotes(viewDir, paths); err != nil {
+				return err
+			}
+		}
+		final := filepath.Join(dir, top)
+		if err := os.RemoveAll(final); err != nil {
+			return err
+		}
+		if err := os.Rename(staging, final); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// viewableTag reports whether tag can name a view directory: each of its
+// /-separated levels a plain name, so a tag from someone else's note can't
+// put links outside the views.
+func viewableTag(tag string) bool {
+	for _, level := range strings.Split(tag, "/") {
+		if level == "" || level == "." || level == ".." || strings.ContainsAny(level, `\`) || !filepath.IsLocal(level) {
+			return false
+		}
+	}
+	return true
+}
+
+// linkNotes symlinks each note into viewDir, numbering clashing file names.
+func linkNotes(viewDir string, paths []string) error {
+	if err := os.MkdirAll(viewDir, 0755); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		target, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(path)
+		link := filepath.Join(viewDir, name)
+		for i := 2; fileExists(link); i++ {
+			link = filepath.Join(viewDir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ".md"), i, ".md"))
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearViews(dir string) error {
+	for _, top := range []string{"by-date", "by-tag", "by-project"} {
+		if err := os.RemoveAll(filepath.Join(dir, top)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, viewMarker)); err != nil {
+		return err
+	}
+	fmt.Printf("Unmounted %s\n", dir)
+	return os.Remove(dir)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildViewsKeepsTagsInside(t *testing.T) {
+	root := t.TempDir()
+	config := &CONFIG{NotesDir: filepath.Join(root, "notes")}
+	views := filepath.Join(root, "views")
+	if err := os.MkdirAll(config.NotesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	note := "---\ntitle: Pulled\ntags: [../../escape, a/../../escape, project/.., work/x]\n---\nHi\n"
+	if err := os.WriteFile(filepath.Join(config.NotesDir, "pulled.md"), []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareViewDir(views); err != nil {
+		t.Fatal(err)
+	}
+	if err := buildViews(config, views); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(filepath.Join(root, "escape")) || fileExists(filepath.Join(views, "escape")) {
+		t.Error("a tag put a view outside the view tree")
+	}
+	if !fileExists(filepath.Join(views, "by-tag", "work", "x", "pulled.md")) {
+		t.Error("the plain tag has no view")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(views, "by-project")); len(entries) != 0 {
+		t.Errorf("by-project holds %d view(s), want none", len(entries))
+	}
+}
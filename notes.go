@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Note is a markdown file in the notes directory along with the metadata
+// parsed from it.
+type Note struct {
+	Path    string            `json:"path"`
+	Name    string            `json:"name"`
+	Title   string            `json:"title"`
+	Meta    map[string]string `json:"meta"`
+	Body    string            `json:"body,omitempty"`
+	ModTime time.Time         `json:"mtime"`
+	Size    int64             `json:"size"`
+}
+
+// loadNotes returns every markdown note below notesDir, from the in-memory
+// index when running inside the daemon and from disk otherwise.
+func loadNotes(notesDir string) ([]*Note, error) {
+	if activeIndex != nil && activeIndex.dir == notesDir {
+		return activeIndex.snapshot(true), nil
+	}
+	return scanNotes(notesDir)
+}
+
+// scanNotes reads every markdown note below notesDir. Hidden directories
+// (such as .git) are skipped.
+func scanNotes(notesDir string) ([]*Note, error) {
+	var notes []*Note
+	err := filepath.Walk(notesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != notesDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" || isCommentsSidecar(path) {
+			return nil
+		}
+		note, err := readNote(path)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Path < notes[j].Path })
+	return notes, nil
+}
+
+// noteCache holds parsed notes by path in long-running processes (the
+// daemon), so unchanged files aren't read and parsed again.
+var noteCache struct {
+	sync.Mutex
+	enabled bool
+	notes   map[string]*Note
+}
+
+func enableNoteCache() {
+	noteCache.Lock()
+	defer noteCache.Unlock()
+	noteCache.enabled = true
+	noteCache.notes = map[string]*Note{}
+}
+
+// readNote reads and parses the note at path. A file that changes while it
+// is being read is retried, and if it keeps changing the last cached version
+// is returned, so a note that is half-way through being written never shows
+// up parsed.
+func readNote(path string) (*Note, error) {
+	noteCache.Lock()
+	cached, ok := noteCache.notes[path]
+	noteCache.Unlock()
+
+	var info os.FileInfo
+	var content []byte
+	for attempt := 0; ; attempt++ {
+		var err error
+		if info, err = os.Stat(path); err != nil {
+			return nil, err
+		}
+		if ok && cached.ModTime.Equal(info.ModTime()) && cached.Size == info.Size() {
+			return cached.copy(), nil
+		}
+		if content, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+		after, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if after.ModTime().Equal(info.ModTime()) && after.Size() == int64(len(content)) {
+			break
+		}
+		if attempt == 2 {
+			if ok {
+				return cached.copy(), nil
+			}
+			return nil, fmt.Errorf("note %s keeps changing while being read", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	meta, body := parseFrontmatter(string(content))
+	note := &Note{
+		Path:    path,
+		Name:    filepath.Base(path),
+		Meta:    meta,
+		Body:    body,
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+	}
+	note.Title = noteTitle(note)
+
+	noteCache.Lock()
+	if noteCache.enabled {
+		noteCache.notes[path] = note.copy()
+	}
+	noteCache.Unlock()
+	return note, nil
+}
+
+// copy returns a copy of the note that can be modified without touching the
+// cached original.
+func (n *Note) copy() *Note {
+	c := *n
+	c.Meta = make(map[string]string, len(n.Meta))
+	for k, v := range n.Meta {
+		c.Meta[k] = v
+	}
+	return &c
+}
+
+// parseFrontmatter splits a leading "---" delimited block of "key: value"
+// lines from the rest of the content. Only flat keys are supported.
+func parseFrontmatter(content string) (map[string]string, string) {
+	meta := map[string]string{}
+	if !strings.HasPrefix(content, "---\n") {
+		return meta, content
+	}
+	end := strings.Index(content[4:], "\n---")
+	if end < 0 {
+		return meta, content
+	}
+	block := content[4 : 4+end]
+	body := strings.TrimPrefix(content[4+end+4:], "\n")
+
+	scanner := bufio.NewScanner(strings.NewReader(block))
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		val = strings.Trim(val, `"'`)
+		meta[strings.TrimSpace(key)] = val
+	}
+	return meta, body
+}
+
+// noteTitle picks the frontmatter title, the first markdown heading or the
+// file name, in that order.
+func noteTitle(note *Note) string {
+	if title := note.Meta["title"]; title != "" {
+		return title
+	}
+	scanner := bufio.NewScanner(strings.NewReader(note.Body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(line[2:])
+		}
+	}
+	return strings.TrimSuffix(note.Name, filepath.Ext(note.Name))
+}
+
+// noteDate returns when a note was created: the frontmatter "created" field,
+// the timestamp embedded in a note_<timestamp>.md filename, the date a
+// dated file name starts with, or the file's modification time as a last
+// resort.
+func noteDate(note *Note) time.Time {
+	if created := note.Meta["created"]; created != "" {
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, created, time.Local); err == nil {
+				return t
+			}
+		}
+	}
+	name := strings.TrimSuffix(note.Name, ".md")
+	if strings.HasPrefix(name, "note_") {
+		if t, err := time.ParseInLocation("2006-01-02_150405", name[5:], time.Local); err == nil {
+			return t
+		}
+	}
+	if len(name) >= 10 {
+		if t, err := time.ParseInLocation("2006-01-02_150405", name[:min(len(name), 17)], time.Local); err == nil {
+			return t
+		}
+		// Only the day is in the name; the file's time is closer if it's that day
+		if day, err := time.ParseInLocation("2006-01-02", name[:10], time.Local); err == nil {
+			if note.ModTime.Format("2006-01-02") == name[:10] {
+				return note.ModTime
+			}
+			return day
+		}
+	}
+	return note.ModTime
+}
+
+// formatFrontmatter renders meta as a frontmatter block, emitting keys in the
+// given order. Empty values are left out; an empty block yields "".
+func formatFrontmatter(meta map[string]string, keys []string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		if val := meta[key]; val != "" {
+			b.WriteString(key + ": " + val + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "---\n" + b.String() + "---\n\n"
+}
+
+// frontmatterText makes untrusted text safe as a frontmatter value: line
+// breaks, which would start keys of their own, become spaces and the value
+// is quoted.
+func frontmatterText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return `"` + strings.Trim(s, `"'`) + `"`
+}
+
+// resolveNote finds the note named by arg: a path to an existing file, or a
+// file name (with or without .md) anywhere in the notes directory.
+func resolveNote(config *CONFIG, arg string) (string, error) {
+	if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+		return arg, nil
+	}
+	name := arg
+	if filepath.Ext(name) != ".md" {
+		name += ".md"
+	}
+	if path := filepath.Join(config.NotesDir, name); fileExists(path) {
+		return path, nil
+	}
+	for ext := range noteCiphers {
+		if path := filepath.Join(config.NotesDir, name+ext); fileExists(path) {
+			return path, nil
+		}
+	}
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return "", err
+	}
+	for _, note := range notes {
+		if note.Name == filepath.Base(name) {
+			return note.Path, nil
+		}
+	}
+	return "", codeErrorf(ErrNoteNotFound, tr("note %q not found"), arg)
+}
+
+// writeFileAtomic replaces path with data via a temporary file and a rename,
+// so readers see either the old or the new content, never a mix.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	} else {
+		os.Chmod(tmp.Name(), 0644)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// noteTags parses the frontmatter "tags" field, accepting both
+// "[a, b]" and "a, b" forms.
+func noteTags(note *Note) []string {
+	raw := strings.Trim(note.Meta["tags"], "[]")
+	var tags []string
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.Trim(strings.TrimSpace(tag), `"'`)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// hasTag reports whether the note carries tag or any tag nested below it,
+// so "project" matches "project/apollo/design".
+func hasTag(note *Note, tag string) bool {
+	for _, t := range noteTags(note) {
+		if tagMatches(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMatches reports whether tag equals query or lies in its subtree,
+// comparing folded text so "Café" matches "cafe".
+func tagMatches(tag, query string) bool {
+	tag, query = foldText(tag), foldText(strings.Trim(query, "/"))
+	return tag == query || strings.HasPrefix(tag, query+"/")
+}
+
+// setFrontmatter returns content with key set to val in its frontmatter,
+// adding a frontmatter block if the note has none. Other lines are kept as
+// they are.
+func setFrontmatter(content, key, val string) string {
+	if !strings.HasPrefix(content, "---\n") || !strings.Contains(content[4:], "\n---") {
+		return "---\n" + key + ": " + val + "\n---\n\n" + content
+	}
+	end := strings.Index(content[4:], "\n---") + 4
+	lines := strings.Split(content[4:end], "\n")
+	found := false
+	for i, line := range lines {
+		if k, _, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(k) == key {
+			lines[i] = key + ": " + val
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, key+": "+val)
+	}
+	return "---\n" + strings.Join(lines, "\n") + content[end:]
+}
+
+func formatTags(tags []string) string {
+	return "[" + strings.Join(tags, ", ") + "]"
+}
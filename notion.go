@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// notionBlock is one top-level block of a Notion page, as converted from the
+// note's markdown.
+type notionBlock struct {
+	Type     string // paragraph, heading_1..3, bulleted_list_item, numbered_list_item, to_do, quote, code or image
+	Text     string // for images, the source URL
+	Caption  string
+	Language string // of a code block, as written after the fence
+	Checked  bool   // for to_do
+}
+
+func (b notionBlock) hash() string {
+	s := b.Type + "\x00" + b.Text + "\x00" + b.Caption
+	// Only blocks using the newer fields hash them, so stored hashes of
+	// other blocks stay valid
+	if b.Language != "" {
+		s += "\x00" + b.Language
+	}
+	if b.Checked {
+		s += "\x00checked"
+	}
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NotionPage records what a note looks like on Notion after the last sync,
+// so the next sync only touches blocks that changed.
+type NotionPage struct {
+	PageID   string           `json:"page_id"`
+	Props    string           `json:"props,omitempty"` // hash of the properties last set
+	Blocks   []NotionBlockRef `json:"blocks"`
+	Comments []string         `json:"comments,omitempty"` // IDs of comments already imported
+}
+
+// NotionBlockRef pairs a remote block ID with the hash of its content.
+type NotionBlockRef struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+}
+
+// notionAPI is the part of the Notion API syncing needs.
+type notionAPI interface {
+	createPage(title string, props map[string]string, blocks []notionBlock) (pageID string, blockIDs []string, err error)
+	updatePage(pageID, title string, props map[string]string) error
+	appendBlocks(pageID, after string, blocks []notionBlock) ([]string, error)
+	updateBlock(id string, block notionBlock) error
+	deleteBlock(id string) error
+	uploadFile(path string) (id string, err error)
+	comments(pageID string) ([]notionComment, error)
+}
+
+// notionProperties maps the note's frontmatter onto database properties as
+// NOTION_PROPERTIES says, e.g. "title=Name, tags=Tags, created=Created", so
+// notes can land in databases with their own schema. The values are kept as
+// written; the client converts them to the property's type. Fields the note
+// doesn't have are left out.
+func notionProperties(config *CONFIG, note *Note) (map[string]string, error) {
+	props := map[string]string{}
+	for _, pair := range splitList(config.NotionProperties) {
+		field, property, ok := strings.Cut(pair, "=")
+		field, property = strings.TrimSpace(field), strings.TrimSpace(property)
+		if !ok || field == "" || property == "" {
+			return nil, codeErrorf(ErrConfigInvalid, "NOTION_PROPERTIES: %q is not field=Property", pair)
+		}
+		value := note.Meta[field]
+		switch field {
+		case "title":
+			value = noteTitle(note)
+		case "tags":
+			value = strings.Join(noteTags(note), ",")
+		}
+		if value != "" {
+			props[property] = value
+		}
+	}
+	return props, nil
+}
+
+// propsHash identifies a page's title and properties, to tell whether they
+// need setting again.
+func propsHash(title string, props map[string]string) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := title
+	for _, k := range keys {
+		s += "\x00" + k + "\x00" + props[k]
+	}
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// markdownBlocks splits a note body into Notion blocks: headings, fenced
+// code, list items and tasks, quotes, images on a line of their own and
+// paragraphs separated by blank lines.
+func markdownBlocks(body string) []notionBlock {
+	var blocks []notionBlock
+	var para, code []string
+	inFence, lang := false, ""
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, notionBlock{Type: "paragraph", Text: strings.Join(para, "\n")})
+			para = nil
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			if inFence {
+				blocks = append(blocks, notionBlock{Type: "code", Text: strings.Join(code, "\n"), Language: lang})
+				code = nil
+			} else {
+				flush()
+				lang = strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			}
+			inFence = !inFence
+		case inFence:
+			code = append(code, line)
+		case trimmed == "":
+			flush()
+		case imageLine.MatchString(trimmed):
+			flush()
+			m := imageLine.FindStringSubmatch(trimmed)
+			blocks = append(blocks, notionBlock{Type: "image", Text: m[2], Caption: m[1]})
+		case strings.HasPrefix(trimmed, "### "):
+			flush()
+			blocks = append(blocks, notionBlock{Type: "heading_3", Text: trimmed[4:]})
+		case strings.HasPrefix(trimmed, "## "):
+			flush()
+			blocks = append(blocks, notionBlock{Type: "heading_2", Text: trimmed[3:]})
+		case strings.HasPrefix(trimmed, "# "):
+			flush()
+			blocks = append(blocks, notionBlock{Type: "heading_1", Text: trimmed[2:]})
+		case taskLine.MatchString(line):
+			flush()
+			m := taskLine.FindStringSubmatch(line)
+			blocks = append(blocks, notionBlock{Type: "to_do", Text: m[4], Checked: m[2] != " "})
+		case mdBullet.MatchString(line):
+			flush()
+			blocks = append(blocks, notionBlock{Type: "bulleted_list_item", Text: mdBullet.FindStringSubmatch(line)[1]})
+		case mdNumbered.MatchString(line):
+			flush()
+			blocks = append(blocks, notionBlock{Type: "numbered_list_item", Text: mdNumbered.FindStringSubmatch(line)[1]})
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			blocks = append(blocks, notionBlock{Type: "quote", Text: strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))})
+		default:
+			para = append(para, line)
+		}
+	}
+	if inFence {
+		blocks = append(blocks, notionBlock{Type: "code", Text: strings.Join(code, "\n"), Language: lang})
+	}
+	flush()
+	return blocks
+}
+
+// notionEdit is one change to a page's block list.
+type notionEdit struct {
+	Op  string // "keep", "update", "append" or "delete"
+	Old int    // index into the stored blocks, for keep, update and delete
+	New int    // index into the new blocks, for keep, update and append
+}
+
+// diffBlocks computes the edits turning the stored blocks into the new ones,
+// keeping the longest common subsequence untouched. A deleted block directly
+// followed by an added one of the same type becomes an in-place update,
+// since that is a single API call.
+func diffBlocks(old []NotionBlockRef, blocks []notionBlock) []notionEdit {
+	n, m := len(old), len(blocks)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if old[i].Hash == blocks[j].hash() {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []notionEdit
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && old[i].Hash == blocks[j].hash():
+			edits = append(edits, notionEdit{Op: "keep", Old: i, New: j})
+			i, j = i+1, j+1
+		case i < n && j < m && old[i].Type == blocks[j].Type && lcs[i+1][j+1] == lcs[i][j]:
+			edits = append(edits, notionEdit{Op: "update", Old: i, New: j})
+			i, j = i+1, j+1
+		case j < m && (i == n || lcs[i][j+1] >= lcs[i+1][j]):
+			edits = append(edits, notionEdit{Op: "append", New: j})
+			j++
+		default:
+			edits = append(edits, notionEdit{Op: "delete", Old: i})
+			i++
+		}
+	}
+	return edits
+}
+
+// syncNotionPage brings the note's Notion page in line with its content. The
+// first sync creates the page; later ones apply only the block edits. When a
+// call fails part way, what was done is saved all the same, so the next
+// sync picks up from there rather than appending blocks twice.
+func syncNotionPage(config *CONFIG, api notionAPI, note *Note) error {
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	key := visitKey(config, note.Path)
+	blocks, err := resolveImages(config, api, note, markdownBlocks(withoutComments(note.Body)))
+	if err != nil {
+		return err
+	}
+	page := state.Notion[key]
+	title := noteTitle(note)
+	props, err := notionProperties(config, note)
+	if err != nil {
+		return err
+	}
+
+	if page == nil {
+		if err := reserveNotionCalls(config, 1+(len(blocks)+notionMaxChildren-1)/notionMaxChildren); err != nil {
+			return err
+		}
+		pageID, ids, err := api.createPage(title, props, blocks)
+		if pageID == "" {
+			return err
+		}
+		page = &NotionPage{PageID: pageID, Props: propsHash(title, props)}
+		for i, id := range ids {
+			page.Blocks = append(page.Blocks, NotionBlockRef{ID: id, Type: blocks[i].Type, Hash: blocks[i].hash()})
+		}
+		if saveErr := saveNotionPage(config, key, page); err == nil {
+			err = saveErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Notion: created page with %d block(s)\n", len(blocks))
+		return nil
+	}
+
+	edits := diffBlocks(page.Blocks, blocks)
+	// One call for each edit, the properties and the comments
+	calls := 2
+	for _, e := range edits {
+		if e.Op != "keep" {
+			calls++
+		}
+	}
+	if err := reserveNotionCalls(config, calls); err != nil {
+		return err
+	}
+	if hash := propsHash(title, props); hash != page.Props {
+		if err := api.updatePage(page.PageID, title, props); err != nil {
+			return err
+		}
+		page.Props = hash
+		fmt.Println("Notion: updated page properties")
+	}
+
+	var refs []NotionBlockRef
+	updated, appended, deleted := 0, 0, 0
+	// after is the remote block the next append goes below; "" is the top
+	after := ""
+	// next is the first stored block no edit has dealt with yet
+	next := 0
+	for _, e := range edits {
+		var err error
+		switch e.Op {
+		case "keep":
+			refs = append(refs, page.Blocks[e.Old])
+			after = page.Blocks[e.Old].ID
+		case "update":
+			ref := page.Blocks[e.Old]
+			if err = api.updateBlock(ref.ID, blocks[e.New]); err == nil {
+				ref.Hash = blocks[e.New].hash()
+				refs = append(refs, ref)
+				after = ref.ID
+				updated++
+			}
+		case "append":
+			var ids []string
+			if ids, err = api.appendBlocks(page.PageID, after, blocks[e.New:e.New+1]); err == nil {
+				refs = append(refs, NotionBlockRef{ID: ids[0], Type: blocks[e.New].Type, Hash: blocks[e.New].hash()})
+				after = ids[0]
+				appended++
+			}
+		case "delete":
+			if err = api.deleteBlock(page.Blocks[e.Old].ID); err == nil {
+				deleted++
+			}
+		}
+		if err != nil {
+			// The page now holds the edited blocks, then the stored ones
+			// from next on as they were
+			page.Blocks = append(refs, page.Blocks[next:]...)
+			if saveErr := saveNotionPage(config, key, page); saveErr != nil {
+				log.Printf("Could not save the Notion page state: %v", saveErr)
+			}
+			return err
+		}
+		if e.Op != "append" {
+			next = e.Old + 1
+		}
+	}
+	page.Blocks = refs
+	fmt.Printf("Notion: %d updated, %d appended, %d deleted (%d API call(s))\n",
+		updated, appended, deleted, updated+appended+deleted)
+
+	// Feedback left on Notion comes back into the note
+	imported, err := importComments(config, api, note, page)
+	if err != nil {
+		log.Printf("Could not import Notion comments: %v", err)
+	} else if imported > 0 {
+		fmt.Printf("Notion: imported %d comment(s)\n", imported)
+	}
+	return saveNotionPage(config, key, page)
+}
+
+func saveNotionPage(config *CONFIG, key string, page *NotionPage) error {
+	return updateState(config, func(s *State) error {
+		if s.Notion == nil {
+			s.Notion = map[string]*NotionPage{}
+		}
+		s.Notion[key] = page
+		return nil
+	})
+}
+
+// simulatedNotion prints the calls it would make instead of making them.
+type simulatedNotion struct {
+	databaseID string
+}
+
+func (n simulatedNotion) createPage(title string, props map[string]string, blocks []notionBlock) (string, []string, error) {
+	fmt.Printf("Simulating Notion page creation %q in database %s:\n", title, n.databaseID)
+	printProps(props)
+	ids := make([]string, len(blocks))
+	for i, b := range blocks {
+		ids[i] = newID()
+		fmt.Printf("  + %s %s\n", b.Type, abbreviate(b.Text))
+	}
+	return newID(), ids, nil
+}
+
+func (simulatedNotion) updatePage(pageID, title string, props map[string]string) error {
+	fmt.Printf("Simulating Notion page update %q:\n", title)
+	printProps(props)
+	return nil
+}
+
+func printProps(props map[string]string) {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %s = %s\n", k, abbreviate(props[k]))
+	}
+}
+
+func (simulatedNotion) appendBlocks(pageID, after string, blocks []notionBlock) ([]string, error) {
+	ids := make([]string, len(blocks))
+	for i, b := range blocks {
+		ids[i] = newID()
+		fmt.Printf("  + %s %s\n", b.Type, abbreviate(b.Text))
+	}
+	return ids, nil
+}
+
+func (simulatedNotion) updateBlock(id string, b notionBlock) error {
+	fmt.Printf("  ~ %s %s\n", b.Type, abbreviate(b.Text))
+	return nil
+}
+
+func (simulatedNotion) deleteBlock(id string) error {
+	fmt.Printf("  - block %s\n", id)
+	return nil
+}
+
+func (simulatedNotion) uploadFile(path string) (string, error) {
+	fmt.Printf("Simulating Notion file upload of %s\n", path)
+	return newID(), nil
+}
+
+func (simulatedNotion) comments(pageID string) ([]notionComment, error) {
+	return nil, nil
+}
+
+func abbreviate(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 60 {
+		return string(r[:57]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand/v2"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	notionAPIURL  = "https://api.notion.com/v1"
+	notionVersion = "2022-06-28"
+
+	// notionMaxChildren is how many blocks one request may append, and
+	// notionMaxText how long one rich text object may be.
+	notionMaxChildren = 100
+	notionMaxText     = 2000
+)
+
+// notionClient talks to the Notion API with NOTION_TOKEN, creating pages in
+// NOTION_DATABASE_ID.
+type notionClient struct {
+	config *CONFIG
+	schema map[string]string // property name to type, looked up once
+}
+
+func (c *notionClient) createPage(title string, props map[string]string, blocks []notionBlock) (string, []string, error) {
+	if c.config.NotionDatabaseID == "" {
+		return "", nil, codeErrorf(ErrConfigInvalid, "set NOTION_DATABASE_ID to sync notes to Notion")
+	}
+	properties, err := c.properties(title, props)
+	if err != nil {
+		return "", nil, err
+	}
+	in := map[string]any{
+		"parent":     map[string]string{"database_id": c.config.NotionDatabaseID},
+		"properties": properties,
+	}
+	var page struct {
+		ID string `json:"id"`
+	}
+	if err := c.do("POST", "/pages", in, &page); err != nil {
+		return "", nil, err
+	}
+	ids, err := c.appendBlocks(page.ID, "", blocks)
+	return page.ID, ids, err
+}
+
+func (c *notionClient) updatePage(pageID, title string, props map[string]string) error {
+	properties, err := c.properties(title, props)
+	if err != nil {
+		return err
+	}
+	return c.do("PATCH", "/pages/"+url.PathEscape(pageID), map[string]any{"properties": properties}, nil)
+}
+
+// databaseSchema returns the type of each of the database's properties.
+func (c *notionClient) databaseSchema() (map[string]string, error) {
+	if c.schema != nil {
+		return c.schema, nil
+	}
+	var db struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+	}
+	if err := c.do("GET", "/databases/"+url.PathEscape(c.config.NotionDatabaseID), nil, &db); err != nil {
+		return nil, err
+	}
+	c.schema = map[string]string{}
+	for name, p := range db.Properties {
+		c.schema[name] = p.Type
+	}
+	return c.schema, nil
+}
+
+// properties converts mapped frontmatter values to the API form of each
+// property's type. Unless the mapping names the title property, the title
+// goes to whichever property the database uses for it, "Name" unless
+// someone renamed it.
+func (c *notionClient) properties(title string, props map[string]string) (map[string]any, error) {
+	schema, err := c.databaseSchema()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	titled := false
+	for name, value := range props {
+		kind, ok := schema[name]
+		if !ok {
+			return nil, codeErrorf(ErrConfigInvalid, "NOTION_PROPERTIES: the Notion database has no property %q", name)
+		}
+		v, err := notionPropertyValue(kind, value)
+		if err != nil {
+			return nil, codeErrorf(ErrConfigInvalid, "NOTION_PROPERTIES: property %q: %v", name, err)
+		}
+		out[name] = v
+		titled = titled || kind == "title"
+	}
+	if !titled {
+		for name, kind := range schema {
+			if kind == "title" {
+				out[name] = map[string]any{"title": notionRichText(title)}
+				titled = true
+			}
+		}
+	}
+	if !titled {
+		return nil, codeErrorf(ErrNotionFailed, "Notion database %s has no title property", c.config.NotionDatabaseID)
+	}
+	return out, nil
+}
+
+// notionPropertyValue is value as a property of type kind.
+func notionPropertyValue(kind, value string) (map[string]any, error) {
+	switch kind {
+	case "title", "rich_text":
+		return map[string]any{kind: notionRichText(value)}, nil
+	case "select", "status":
+		return map[string]any{kind: map[string]string{"name": value}}, nil
+	case "multi_select":
+		var options []map[string]string
+		for _, name := range splitList(strings.Trim(value, "[]")) {
+			options = append(options, map[string]string{"name": strings.Trim(name, `"'`)})
+		}
+		return map[string]any{kind: options}, nil
+	case "date":
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				start := t.Format(time.RFC3339)
+				if layout == "2006-01-02" {
+					start = t.Format(layout)
+				}
+				return map[string]any{kind: map[string]string{"start": start}}, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a date", value)
+	case "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return map[string]any{kind: n}, nil
+	case "checkbox":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not true or false", value)
+		}
+		return map[string]any{kind: b}, nil
+	case "url", "email", "phone_number":
+		return map[string]any{kind: value}, nil
+	}
+	return nil, fmt.Errorf("properties of type %s can't be set from frontmatter", kind)
+}
+
+// appendBlocks adds blocks below the block after, or at the end of the page
+// when after is empty, a hundred at a time as the API allows. On an error it
+// still returns the IDs of the blocks created before it.
+func (c *notionClient) appendBlocks(pageID, after string, blocks []notionBlock) ([]string, error) {
+	var ids []string
+	for len(blocks) > 0 {
+		n := min(len(blocks), notionMaxChildren)
+		children := make([]map[string]any, n)
+		for i, b := range blocks[:n] {
+			children[i] = notionBlockJSON(b)
+		}
+		in := map[string]any{"children": children}
+		if after != "" {
+			in["after"] = after
+		}
+		var out struct {
+			Results []struct {
+				ID string `json:"id"`
+			} `json:"results"`
+		}
+		if err := c.do("PATCH", "/blocks/"+url.PathEscape(pageID)+"/children", in, &out); err != nil {
+			return ids, err
+		}
+		if len(out.Results) < n {
+			return ids, codeErrorf(ErrNotionFailed, "Notion created %d of %d block(s)", len(out.Results), n)
+		}
+		// With after set the results can go on to the blocks that were
+		// already below it, so only the first n are ours
+		for _, r := range out.Results[:n] {
+			ids = append(ids, r.ID)
+		}
+		after, blocks = ids[len(ids)-1], blocks[n:]
+	}
+	return ids, nil
+}
+
+func (c *notionClient) updateBlock(id string, b notionBlock) error {
+	content := notionBlockJSON(b)
+	return c.do("PATCH", "/blocks/"+url.PathEscape(id), map[string]any{b.Type: content[b.Type]}, nil)
+}
+
+func (c *notionClient) deleteBlock(id string) error {
+	return c.do("DELETE", "/blocks/"+url.PathEscape(id), nil, nil)
+}
+
+// uploadFile sends a file through Notion's file uploads: one request to
+// open the upload, one carrying the content.
+func (c *notionClient) uploadFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	var upload struct {
+		ID string `json:"id"`
+	}
+	in := map[string]string{"filename": filepath.Base(path), "content_type": contentType}
+	if err := c.do("POST", "/file_uploads", in, &upload); err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="file"; filename=%q`, filepath.Base(path))},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(content); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+	if err := c.send("POST", "/file_uploads/"+url.PathEscape(upload.ID)+"/send", form.FormDataContentType(), body.Bytes(), nil); err != nil {
+		return "", err
+	}
+	return upload.ID, nil
+}
+
+func (c *notionClient) comments(pageID string) ([]notionComment, error) {
+	var comments []notionComment
+	cursor := ""
+	for {
+		query := url.Values{"block_id": {pageID}, "page_size": {"100"}}
+		if cursor != "" {
+			query.Set("start_cursor", cursor)
+		}
+		var out struct {
+			Results []struct {
+				ID          string    `json:"id"`
+				CreatedTime time.Time `json:"created_time"`
+				CreatedBy   struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"created_by"`
+				RichText []struct {
+					PlainText string `json:"plain_text"`
+				} `json:"rich_text"`
+			} `json:"results"`
+			HasMore    bool   `json:"has_more"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := c.do("GET", "/comments?"+query.Encode(), nil, &out); err != nil {
+			return nil, err
+		}
+		for _, r := range out.Results {
+			var text strings.Builder
+			for _, t := range r.RichText {
+				text.WriteString(t.PlainText)
+			}
+			author := r.CreatedBy.Name
+			if author == "" {
+				author = r.CreatedBy.ID
+			}
+			comments = append(comments, notionComment{ID: r.ID, Author: author, Created: r.CreatedTime, Text: text.String()})
+		}
+		if !out.HasMore || out.NextCursor == "" {
+			return comments, nil
+		}
+		cursor = out.NextCursor
+	}
+}
+
+func (c *notionClient) do(method, path string, in, out any) error {
+	var body []byte
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = data, "application/json"
+	}
+	return c.send(method, path, contentType, body, out)
+}
+
+// notionPace spaces out requests to stay under NOTION_RATE. It is shared by
+// every client in the process, so the daemon's concurrent syncs keep to it
+// together.
+var notionPace struct {
+	sync.Mutex
+	next time.Time
+}
+
+// waitTurn blocks until the next request may go out.
+func (c *notionClient) waitTurn() error {
+	count, per, err := parseRate(c.config.NotionRate)
+	if err != nil {
+		return codeErrorf(ErrConfigInvalid, "NOTION_RATE: %v", err)
+	}
+	if count == 0 {
+		return nil
+	}
+	notionPace.Lock()
+	now := time.Now()
+	slot := notionPace.next
+	if slot.Before(now) {
+		slot = now
+	}
+	notionPace.next = slot.Add(per / time.Duration(count))
+	notionPace.Unlock()
+	time.Sleep(slot.Sub(now))
+	return nil
+}
+
+// send makes a request and decodes the reply into out, retrying when Notion
+// says to slow down or is briefly unavailable, as far as retryable allows.
+// Retries back off exponentially with jitter, or wait as long as a
+// Retry-After header asks. Notion's error replies carry a code and message,
+// which end up in the error.
+func (c *notionClient) send(method, path, contentType string, body []byte, out any) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for attempt := 0; ; attempt++ {
+		if err := c.waitTurn(); err != nil {
+			return err
+		}
+		if err := notionCallAllowed(c.config); err != nil {
+			return err
+		}
+		uploadedBytes.Add(int64(len(body)))
+		req, err := http.NewRequest(method, notionAPIURL+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.config.NotionToken)
+		req.Header.Set("Notion-Version", notionVersion)
+		req.Header.Set("Accept", "application/json")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := client.Do(req)
+		status, retryAfter := 0, ""
+		var data []byte
+		if err == nil {
+			status, retryAfter = resp.StatusCode, resp.Header.Get("Retry-After")
+			data, err = io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+			resp.Body.Close()
+		}
+		if retryable(method, path, status, retryAfter, err) && attempt < c.config.NotionRetries {
+			wait := notionBackoff(attempt, retryAfter)
+			log.Printf("Notion %s %s: %s; retrying in %s", method, path, retryReason(status, err), wait.Round(time.Millisecond))
+			time.Sleep(wait)
+			continue
+		}
+		if err != nil {
+			return withCode(ErrNotionFailed, err)
+		}
+		if status >= 300 {
+			var apiErr struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			message := abbreviate(string(data))
+			if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+				message = apiErr.Code + ": " + apiErr.Message
+			}
+			code := ErrNotionFailed
+			if status == http.StatusTooManyRequests {
+				code = ErrNotionRateLimited
+			}
+			return codeErrorf(code, "notion %s %s: %d %s: %s", method, req.URL.Path, status, http.StatusText(status), message)
+		}
+		if out != nil {
+			return json.Unmarshal(data, out)
+		}
+		return nil
+	}
+}
+
+// retryable reports whether a request that failed with status, or err, is
+// worth sending again. One that adds a page or blocks may have gone through
+// all the same, and sending it again would add them twice, so it is only
+// repeated when Notion turned it away; otherwise the next sync reads what
+// is there.
+func retryable(method, path string, status int, retryAfter string, err error) bool {
+	if (method == "POST" && path == "/pages") ||
+		(method == "PATCH" && strings.HasPrefix(path, "/blocks/") && strings.HasSuffix(path, "/children")) {
+		return status == http.StatusTooManyRequests || (status == http.StatusServiceUnavailable && retryAfter != "")
+	}
+	return err != nil || status == http.StatusTooManyRequests || status == http.StatusConflict || status >= 500
+}
+
+// notionBackoff is how long to wait before retry attempt+1: what
+// Retry-After asks for if it says, otherwise half a second doubling with
+// each attempt, up to a minute, with a random spread so clients that failed
+// together don't retry together.
+func notionBackoff(attempt int, retryAfter string) time.Duration {
+	if secs, err := strconv.ParseFloat(retryAfter, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(retryAfter); err == nil {
+		return max(time.Until(at), 0)
+	}
+	d := min(500*time.Millisecond<<attempt, time.Minute)
+	return d/2 + time.Duration(mrand.Int64N(int64(d)))
+}
+
+func retryReason(status int, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if status == http.StatusTooManyRequests {
+		return "rate limited"
+	}
+	return http.StatusText(status)
+}
+
+// notionBlockJSON is the API form of a block.
+func notionBlockJSON(b notionBlock) map[string]any {
+	var content map[string]any
+	switch b.Type {
+	case "image":
+		content = map[string]any{"caption": notionRichText(b.Caption)}
+		if id, ok := strings.CutPrefix(b.Text, "file_upload:"); ok {
+			content["type"] = "file_upload"
+			content["file_upload"] = map[string]string{"id": id}
+		} else {
+			content["type"] = "external"
+			content["external"] = map[string]string{"url": b.Text}
+		}
+	case "code":
+		content = map[string]any{"rich_text": notionRichText(b.Text), "language": notionLanguage(b.Language)}
+	case "to_do":
+		content = map[string]any{"rich_text": notionInline(b.Text), "checked": b.Checked}
+	default:
+		content = map[string]any{"rich_text": notionInline(b.Text)}
+	}
+	return map[string]any{"object": "block", "type": b.Type, b.Type: content}
+}
+
+// notionRichText is plain text as rich text objects, split to fit the
+// API's length limit.
+func notionRichText(s string) []map[string]any {
+	return notionTextRun(s, nil, "")
+}
+
+func notionTextRun(s string, annotations map[string]bool, link string) []map[string]any {
+	var out []map[string]any
+	r := []rune(s)
+	for len(r) > 0 {
+		n := min(len(r), notionMaxText)
+		text := map[string]any{"content": string(r[:n])}
+		if link != "" {
+			text["link"] = map[string]string{"url": link}
+		}
+		obj := map[string]any{"type": "text", "text": text}
+		if len(annotations) > 0 {
+			obj["annotations"] = annotations
+		}
+		out = append(out, obj)
+		r = r[n:]
+	}
+	return out
+}
+
+// notionSpan matches the inline markdown notionInline turns into
+// annotations: code, bold, italic and links.
+var notionSpan = regexp.MustCompile("`([^`]+)`|\\*\\*([^*]+)\\*\\*|__([^_]+)__|\\*([^*]+)\\*|\\b_([^_]+)_\\b|\\[([^\\]]+)\\]\\(([^)\\s]+)\\)")
+
+// notionInline converts a line of markdown into rich text, so bold, italic,
+// inline code and links keep their formatting on Notion.
+func notionInline(s string) []map[string]any {
+	out := []map[string]any{}
+	for s != "" {
+		loc := notionSpan.FindStringSubmatchIndex(s)
+		if loc == nil {
+			return append(out, notionRichText(s)...)
+		}
+		out = append(out, notionRichText(s[:loc[0]])...)
+		group := func(i int) string { return s[loc[2*i]:loc[2*i+1]] }
+		switch {
+		case loc[2] >= 0:
+			out = append(out, notionTextRun(group(1), map[string]bool{"code": true}, "")...)
+		case loc[4] >= 0:
+			out = append(out, notionTextRun(group(2), map[string]bool{"bold": true}, "")...)
+		case loc[6] >= 0:
+			out = append(out, notionTextRun(group(3), map[string]bool{"bold": true}, "")...)
+		case loc[8] >= 0:
+			out = append(out, notionTextRun(group(4), map[string]bool{"italic": true}, "")...)
+		case loc[10] >= 0:
+			out = append(out, notionTextRun(group(5), map[string]bool{"italic": true}, "")...)
+		default:
+			out = append(out, notionTextRun(group(6), nil, group(7))...)
+		}
+		s = s[loc[1]:]
+	}
+	return out
+}
+
+// notionLanguages are the fence languages Notion knows under another name;
+// names it doesn't know at all become plain text, which it always accepts.
+var notionLanguages = map[string]string{
+	"": "plain text", "text": "plain text", "txt": "plain text",
+	"sh": "shell", "zsh": "shell", "console": "shell", "bash": "bash",
+	"js": "javascript", "javascript": "javascript", "jsx": "javascript",
+	"ts": "typescript", "typescript": "typescript", "tsx": "typescript",
+	"py": "python", "python": "python", "rb": "ruby", "ruby": "ruby",
+	"go": "go", "golang": "go", "rs": "rust", "rust": "rust",
+	"c": "c", "cpp": "c++", "c++": "c++", "cs": "c#", "csharp": "c#",
+	"java": "java", "kotlin": "kotlin", "kt": "kotlin", "swift": "swift",
+	"php": "php", "sql": "sql", "html": "html", "css": "css", "scss": "scss",
+	"json": "json", "yaml": "yaml", "yml": "yaml", "toml": "toml", "xml": "xml",
+	"md": "markdown", "markdown": "markdown", "diff": "diff", "docker": "docker",
+	"dockerfile": "docker", "makefile": "makefile", "make": "makefile",
+	"lua": "lua", "r": "r", "scala": "scala", "haskell": "haskell", "hs": "haskell",
+	"elixir": "elixir", "erlang": "erlang", "clojure": "clojure", "perl": "perl",
+	"powershell": "powershell", "ps1": "powershell", "graphql": "graphql",
+	"mermaid": "mermaid", "latex": "latex", "tex": "latex", "nix": "nix",
+}
+
+// notionLanguage maps the word after a code fence to Notion's name for the
+// language.
+func notionLanguage(lang string) string {
+	fields := strings.Fields(strings.ToLower(lang))
+	if len(fields) == 0 {
+		return "plain text"
+	}
+	if name, ok := notionLanguages[fields[0]]; ok {
+		return name
+	}
+	return "plain text"
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func textBlocks(texts ...string) []notionBlock {
+	var blocks []notionBlock
+	for _, text := range texts {
+		blocks = append(blocks, notionBlock{Type: "paragraph", Text: text})
+	}
+	return blocks
+}
+
+func storedRefs(blocks []notionBlock) []NotionBlockRef {
+	var refs []NotionBlockRef
+	for i, b := range blocks {
+		refs = append(refs, NotionBlockRef{ID: fmt.Sprint("b", i), Type: b.Type, Hash: b.hash()})
+	}
+	return refs
+}
+
+func TestDiffBlocks(t *testing.T) {
+	old := textBlocks("one", "two", "three")
+	tests := []struct {
+		name   string
+		blocks []notionBlock
+		want   []notionEdit
+	}{
+		{"unchanged", textBlocks("one", "two", "three"), []notionEdit{
+			{Op: "keep", Old: 0, New: 0}, {Op: "keep", Old: 1, New: 1}, {Op: "keep", Old: 2, New: 2},
+		}},
+		{"edited", textBlocks("one", "TWO", "three"), []notionEdit{
+			{Op: "keep", Old: 0, New: 0}, {Op: "update", Old: 1, New: 1}, {Op: "keep", Old: 2, New: 2},
+		}},
+		{"inserted", textBlocks("one", "new", "two", "three"), []notionEdit{
+			{Op: "keep", Old: 0, New: 0}, {Op: "append", New: 1}, {Op: "keep", Old: 1, New: 2}, {Op: "keep", Old: 2, New: 3},
+		}},
+		{"removed", textBlocks("one", "three"), []notionEdit{
+			{Op: "keep", Old: 0, New: 0}, {Op: "delete", Old: 1}, {Op: "keep", Old: 2, New: 1},
+		}},
+		{"retyped", []notionBlock{{Type: "heading_1", Text: "one"}, {Type: "paragraph", Text: "two"}, {Type: "paragraph", Text: "three"}}, []notionEdit{
+			{Op: "append", New: 0}, {Op: "delete", Old: 0}, {Op: "keep", Old: 1, New: 1}, {Op: "keep", Old: 2, New: 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffBlocks(storedRefs(old), tt.blocks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffBlocks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeNotion keeps one page's blocks in memory. The call numbered failAt
+// fails, to stop a sync part way.
+type fakeNotion struct {
+	ids    []string
+	blocks map[string]notionBlock
+	calls  int
+	failAt int
+	nextID int
+}
+
+func (n *fakeNotion) call() error {
+	n.calls++
+	if n.calls == n.failAt {
+		return errors.New("503 service unavailable")
+	}
+	return nil
+}
+
+func (n *fakeNotion) newID() string {
+	n.nextID++
+	return fmt.Sprint("block-", n.nextID)
+}
+
+// createPage failing still makes the page with its first block, as the real
+// client does when a later batch of blocks doesn't go up.
+func (n *fakeNotion) createPage(title string, props map[string]string, blocks []notionBlock) (string, []string, error) {
+	err := n.call()
+	if err != nil {
+		blocks = blocks[:1]
+	}
+	n.blocks = map[string]notionBlock{}
+	for _, b := range blocks {
+		id := n.newID()
+		n.ids = append(n.ids, id)
+		n.blocks[id] = b
+	}
+	return "page", slices.Clone(n.ids), err
+}
+
+func (n *fakeNotion) updatePage(pageID, title string, props map[string]string) error {
+	return n.call()
+}
+
+func (n *fakeNotion) appendBlocks(pageID, after string, blocks []notionBlock) ([]string, error) {
+	if err := n.call(); err != nil {
+		return nil, err
+	}
+	at := 0
+	if after != "" {
+		at = slices.Index(n.ids, after) + 1
+	}
+	var ids []string
+	for _, b := range blocks {
+		id := n.newID()
+		ids = append(ids, id)
+		n.blocks[id] = b
+	}
+	n.ids = slices.Insert(n.ids, at, ids...)
+	return ids, nil
+}
+
+func (n *fakeNotion) updateBlock(id string, block notionBlock) error {
+	if err := n.call(); err != nil {
+		return err
+	}
+	n.blocks[id] = block
+	return nil
+}
+
+func (n *fakeNotion) deleteBlock(id string) error {
+	if err := n.call(); err != nil {
+		return err
+	}
+	n.ids = slices.DeleteFunc(n.ids, func(s string) bool { return s == id })
+	return nil
+}
+
+func (n *fakeNotion) uploadFile(path string) (string, error) {
+	return "", errors.New("no uploads")
+}
+
+func (n *fakeNotion) comments(pageID string) ([]notionComment, error) {
+	return nil, nil
+}
+
+// texts is what the page shows, top to bottom.
+func (n *fakeNotion) texts() []string {
+	var texts []string
+	for _, id := range n.ids {
+		texts = append(texts, n.blocks[id].Text)
+	}
+	return texts
+}
+
+func writeTestNote(t *testing.T, path, body string) *Note {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("---\ntitle: Test\n---\n"+body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	note, err := readNote(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return note
+}
+
+func TestSyncNotionPageResumesAfterFailure(t *testing.T) {
+	config := &CONFIG{NotesDir: t.TempDir(), NotionComments: "off"}
+	path := filepath.Join(config.NotesDir, "note.md")
+	api := &fakeNotion{}
+	if err := syncNotionPage(config, api, writeTestNote(t, path, "one\n\ntwo\n\nthree\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The third call of the next sync, the second block edit, fails
+	note := writeTestNote(t, path, "zero\n\none\n\nTWO\n\nfour\n\nthree\n")
+	want := []string{"zero", "one", "TWO", "four", "three"}
+	api.calls, api.failAt = 0, 3
+	if err := syncNotionPage(config, api, note); err == nil {
+		t.Fatal("sync succeeded despite the failing call")
+	}
+	api.failAt = 0
+	if err := syncNotionPage(config, api, note); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.texts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("page holds %q, want %q", got, want)
+	}
+
+	// Once in step, syncing again changes nothing
+	api.calls = 0
+	if err := syncNotionPage(config, api, note); err != nil {
+		t.Fatal(err)
+	}
+	if api.calls != 0 {
+		t.Errorf("an unchanged note took %d call(s)", api.calls)
+	}
+}
+
+func TestSyncNotionPageCreateFailsPartWay(t *testing.T) {
+	config := &CONFIG{NotesDir: t.TempDir(), NotionComments: "off"}
+	path := filepath.Join(config.NotesDir, "note.md")
+	note := writeTestNote(t, path, "one\n\ntwo\n\nthree\n")
+	api := &fakeNotion{failAt: 1}
+	if err := syncNotionPage(config, api, note); err == nil {
+		t.Fatal("sync succeeded despite the failing call")
+	}
+	if err := syncNotionPage(config, api, note); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := api.texts(), []string{"one", "two", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("page holds %q, want %q", got, want)
+	}
+}
+
+func TestNotionRetryable(t *testing.T) {
+	timeout := errors.New("i/o timeout")
+	tests := []struct {
+		method, path string
+		status       int
+		retryAfter   string
+		err          error
+		want         bool
+	}{
+		{"GET", "/comments", 0, "", timeout, true},
+		{"PATCH", "/blocks/b1", 502, "", nil, true},
+		{"DELETE", "/blocks/b1", 409, "", nil, true},
+		{"PATCH", "/pages/p1", 400, "", nil, false},
+		{"POST", "/pages", 0, "", timeout, false},
+		{"POST", "/pages", 502, "", nil, false},
+		{"POST", "/pages", 409, "", nil, false},
+		{"POST", "/pages", 503, "", nil, false},
+		{"POST", "/pages", 503, "2", nil, true},
+		{"POST", "/pages", 429, "", nil, true},
+		{"PATCH", "/blocks/p1/children", 0, "", timeout, false},
+		{"PATCH", "/blocks/p1/children", 500, "", nil, false},
+		{"PATCH", "/blocks/p1/children", 429, "1", nil, true},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.method, tt.path, tt.status, tt.retryAfter, tt.err); got != tt.want {
+			t.Errorf("retryable(%s %s, %d, %q, %v) = %v, want %v", tt.method, tt.path, tt.status, tt.retryAfter, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxPicks is how many candidates the picker offers.
+const maxPicks = 15
+
+// runOpen opens a note in the editor and syncs it afterwards, the way `syt
+// new` does for a fresh one. The note is named exactly or by a pattern that
+// is fuzzy-matched against file names and titles; when several notes match
+// equally well a picker asks which one.
+func runOpen(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: syt open <note or pattern>")
+	}
+	pattern := strings.Join(args, " ")
+	path, err := resolveNote(config, pattern)
+	if err != nil {
+		if path, err = findNote(config, pattern); err != nil {
+			return err
+		}
+	}
+	return editNote(config, path)
+}
+
+// editNote opens path in the editor, then records the visit and syncs it.
+func editNote(config *CONFIG, path string) error {
+	if isSealed(path) {
+		return editSealedNote(config, path)
+	}
+	if err := markPending(config, path); err != nil {
+		log.Printf("Could not record pending sync: %v", err)
+	}
+	if err := openEditor(config.Editor, path); err != nil {
+		return fmt.Errorf("opening editor: %w", err)
+	}
+	if err := recordVisit(config, path); err != nil {
+		log.Printf("Could not record visit: %v", err)
+	}
+
+	note, err := readNote(path)
+	if err != nil {
+		return err
+	}
+	var t NoteType
+	if note.Meta["type"] != "" {
+		t, _ = lookupType(note.Meta["type"])
+	}
+	_ = syncTracked(config, syncBackends(config), t, path)
+	return nil
+}
+
+// findNote picks the note pattern fuzzy-matches best, asking when the best
+// score is shared.
+func findNote(config *CONFIG, pattern string) (string, error) {
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return "", err
+	}
+	type match struct {
+		note  *Note
+		score int
+	}
+	var matches []match
+	for _, note := range notes {
+		name := strings.TrimSuffix(note.Name, ".md")
+		if score := max(fuzzyScore(pattern, name), fuzzyScore(pattern, note.Title)); score > 0 {
+			matches = append(matches, match{note, score})
+		}
+	}
+	if len(matches) == 0 {
+		return "", codeErrorf(ErrNoteNotFound, tr("note %q not found"), pattern)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return noteDate(matches[i].note).After(noteDate(matches[j].note))
+	})
+	tied := 1
+	for tied < len(matches) && matches[tied].score == matches[0].score {
+		tied++
+	}
+	if tied == 1 {
+		return matches[0].note.Path, nil
+	}
+
+	choices := make([]*Note, 0, maxPicks)
+	for _, m := range matches[:min(len(matches), maxPicks)] {
+		choices = append(choices, m.note)
+	}
+	return pickNote(config, pattern, choices)
+}
+
+// pickNote lists choices and reads which one to open. Without a terminal
+// to ask on it lists them in the error instead.
+func pickNote(config *CONFIG, pattern string, choices []*Note) (string, error) {
+	if !isTerminal(os.Stdin) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%q matches several notes:", pattern)
+		for _, note := range choices {
+			fmt.Fprintf(&b, "\n  %s  %s", relNotePath(config.NotesDir, note.Path), note.Title)
+		}
+		return "", fmt.Errorf("%s", b.String())
+	}
+	for i, note := range choices {
+		fmt.Printf("%2d. %s  %s  (%s)\n", i+1, noteDate(note).Format("2006-01-02"), note.Title, relNotePath(config.NotesDir, note.Path))
+	}
+	fmt.Print("Open which one? [1] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return choices[0].Path, nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(choices) {
+		return "", fmt.Errorf("no note %q in the list", answer)
+	}
+	return choices[n-1].Path, nil
+}
+
+// fuzzyScore rates s against pattern, whose characters have to appear in s
+// in order. Characters at the start of a word and runs of consecutive ones
+// score higher, and containing the pattern outright higher still. Zero
+// means no match. Both are folded, and spaces in the pattern are ignored.
+func fuzzyScore(pattern, s string) int {
+	p := []rune(strings.ReplaceAll(foldText(pattern), " ", ""))
+	t := []rune(foldText(s))
+	if len(p) == 0 {
+		return 0
+	}
+	score, run, j := 0, 0, 0
+	for i := 0; i < len(t) && j < len(p); i++ {
+		if t[i] != p[j] {
+			run = 0
+			continue
+		}
+		run++
+		score += 1 + run
+		if i == 0 || !(unicode.IsLetter(t[i-1]) || unicode.IsDigit(t[i-1])) {
+			score += 3
+		}
+		j++
+	}
+	if j < len(p) {
+		return 0
+	}
+	if strings.Contains(string(t), string(p)) {
+		score += 2 * len(p)
+	}
+	return score
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PendingSync records a note that syt opened for editing and hasn't synced
+// yet. A record outliving the process that made it means the run died (or
+// a backend failed) between the edit and the sync.
+type PendingSync struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// noResume are the commands that don't offer to resume pending syncs: the
+// long-running ones and those that do it themselves.
+var noResume = map[string]bool{"daemon": true, "serve": true, "mount": true, "sync": true, "help": true}
+
+// markPending records that path is being edited by this process.
+func markPending(config *CONFIG, path string) error {
+	key := visitKey(config, path)
+	return updateState(config, func(s *State) error {
+		if s.Pending == nil {
+			s.Pending = map[string]*PendingSync{}
+		}
+		s.Pending[key] = &PendingSync{PID: os.Getpid(), Started: currentTime()}
+		return nil
+	})
+}
+
+// movePending carries a pending record over when a note is moved before it
+// is synced.
+func movePending(config *CONFIG, from, to string) error {
+	fromKey, toKey := visitKey(config, from), visitKey(config, to)
+	return updateState(config, func(s *State) error {
+		if p, ok := s.Pending[fromKey]; ok {
+			delete(s.Pending, fromKey)
+			s.Pending[toKey] = p
+		}
+		return nil
+	})
+}
+
+func clearPending(config *CONFIG, path string) error {
+	key := visitKey(config, path)
+	state, err := loadState(config)
+	if err != nil || state.Pending[key] == nil {
+		return err
+	}
+	return updateState(config, func(s *State) error {
+		delete(s.Pending, key)
+		return nil
+	})
+}
+
+// syncTracked syncs a note and, once every backend has it, drops its
+// pending record.
+func syncTracked(config *CONFIG, backends []SyncBackend, t NoteType, path string) error {
+	err := syncNote(config, backends, t, path)
+	if err == nil {
+		if err := clearPending(config, path); err != nil {
+			log.Printf("Could not clear pending sync: %v", err)
+		}
+	}
+	return err
+}
+
+// stalePending returns the notes whose pending record was left by a
+// process that is no longer running, oldest first.
+func stalePending(config *CONFIG) ([]string, error) {
+	state, err := loadState(config)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key, p := range state.Pending {
+		if alive, known := processAlive(p.PID); known && alive && p.PID != os.Getpid() {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return state.Pending[keys[i]].Started.Before(state.Pending[keys[j]].Started) })
+	var paths []string
+	for _, key := range keys {
+		paths = append(paths, filepath.Join(config.NotesDir, filepath.FromSlash(key)))
+	}
+	return paths, nil
+}
+
+// offerResume asks whether to sync the notes an earlier run left unsynced.
+// It is quiet when there are none.
+func offerResume(config *CONFIG) {
+	paths, err := stalePending(config)
+	if err != nil || len(paths) == 0 {
+		return
+	}
+	fmt.Printf("%d note(s) were edited but not synced when syt last stopped:\n", len(paths))
+	for _, path := range paths {
+		fmt.Printf("  %s\n", relNotePath(config.NotesDir, path))
+	}
+	if !config.Yes {
+		fmt.Print("Sync them now? [Y/n] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.TrimSpace(answer); answer != "" && !isYes(answer) {
+			fmt.Println("Run `syt sync --pending` to sync them later.")
+			return
+		}
+	}
+	if err := resumePending(config, paths); err != nil {
+		log.Printf(tr("Error: %v"), err)
+	}
+}
+
+// resumePending runs the sync step for notes whose earlier run didn't get
+// that far. Notes deleted since are forgotten.
+func resumePending(config *CONFIG, paths []string) error {
+	backends := syncBackends(config)
+	failed, code := 0, ErrorCode("")
+	for _, path := range paths {
+		note, err := readNote(path)
+		if os.IsNotExist(err) {
+			if err := clearPending(config, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var t NoteType
+		if note.Meta["type"] != "" {
+			t, _ = lookupType(note.Meta["type"])
+		}
+		if len(backends) == 0 {
+			err = clearPending(config, path)
+		} else {
+			err = syncTracked(config, backends, t, path)
+		}
+		if err != nil {
+			failed, code = failed+1, errorCode(err)
+		}
+	}
+	if failed > 0 {
+		return codeErrorf(code, "%d note(s) did not sync completely", failed)
+	}
+	return nil
+}
+
+// runSyncPending is `syt sync --pending`, the non-interactive way to resume.
+func runSyncPending(config *CONFIG) error {
+	paths, err := stalePending(config)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Println("No notes are waiting to be synced.")
+		return nil
+	}
+	return resumePending(config, paths)
+}
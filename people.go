@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// mentionPattern matches @handles while ignoring e-mail addresses.
+var mentionPattern = regexp.MustCompile(`(^|[^\w.@])@([A-Za-z][\w-]*)`)
+
+const (
+	mentionsStart = "<!-- syt:mentions -->"
+	mentionsEnd   = "<!-- /syt:mentions -->"
+)
+
+// Person aggregates the mentions of a single @handle across the notes.
+type Person struct {
+	Name     string
+	Mentions int
+	Last     time.Time
+	Notes    []*Note
+}
+
+func runPeople(config *CONFIG, args []string) error {
+	notes, err := vaultNotes(config, true)
+	if err != nil {
+		return err
+	}
+	people := indexPeople(config, notes)
+
+	if len(args) == 0 {
+		return printPeople(people)
+	}
+	return openPerson(config, people, strings.TrimPrefix(args[0], "@"))
+}
+
+// extractMentions returns the distinct handles mentioned in text, lowercased.
+func extractMentions(text string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(m[2])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// indexPeople builds the person list from the person notes in PeopleDir and
+// every handle mentioned anywhere in the vault.
+func indexPeople(config *CONFIG, notes []*Note) map[string]*Person {
+	people := map[string]*Person{}
+	peopleDir := filepath.Join(config.NotesDir, config.PeopleDir)
+
+	for _, note := range notes {
+		if filepath.Dir(note.Path) == peopleDir {
+			name := strings.ToLower(strings.TrimSuffix(note.Name, ".md"))
+			if people[name] == nil {
+				people[name] = &Person{Name: name}
+			}
+		}
+	}
+
+	for _, note := range notes {
+		self := ""
+		if filepath.Dir(note.Path) == peopleDir {
+			self = strings.ToLower(strings.TrimSuffix(note.Name, ".md"))
+		}
+		for _, name := range extractMentions(stripMentionsSection(note.Body)) {
+			if name == self {
+				continue
+			}
+			p := people[name]
+			if p == nil {
+				p = &Person{Name: name}
+				people[name] = p
+			}
+			p.Mentions++
+			p.Notes = append(p.Notes, note)
+			if d := noteDate(note); d.After(p.Last) {
+				p.Last = d
+			}
+		}
+	}
+
+	for _, p := range people {
+		sort.Slice(p.Notes, func(i, j int) bool {
+			return noteDate(p.Notes[i]).After(noteDate(p.Notes[j]))
+		})
+	}
+	return people
+}
+
+func printPeople(people map[string]*Person) error {
+	list := make([]*Person, 0, len(people))
+	for _, p := range people {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Mentions != list[j].Mentions {
+			return list[i].Mentions > list[j].Mentions
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMENTIONS\tLAST")
+	for _, p := range list {
+		last := "-"
+		if !p.Last.IsZero() {
+			last = p.Last.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "@%s\t%d\t%s\n", p.Name, p.Mentions, last)
+	}
+	return w.Flush()
+}
+
+// openPerson creates the person note if needed, refreshes its list of recent
+// mentions and opens it in the editor.
+func openPerson(config *CONFIG, people map[string]*Person, name string) error {
+	name = strings.ToLower(name)
+	dir := filepath.Join(config.NotesDir, config.PeopleDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name+".md")
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		content = []byte(fmt.Sprintf("# @%s\n\n", name))
+	} else if err != nil {
+		return err
+	}
+
+	var recent []*Note
+	if p := people[name]; p != nil {
+		recent = p.Notes
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	updated := stripMentionsSection(string(content))
+	updated = strings.TrimRight(updated, "\n") + "\n\n" + renderMentions(config, state, recent)
+	if err := writeFileAtomic(path, []byte(updated)); err != nil {
+		return err
+	}
+	if err := openEditor(config.Editor, path); err != nil {
+		return err
+	}
+	return recordVisit(config, path)
+}
+
+func renderMentions(config *CONFIG, state *State, notes []*Note) string {
+	const limit = 10
+	var b strings.Builder
+	b.WriteString(mentionsStart + "\n")
+	b.WriteString("## Recent mentions\n\n")
+	if len(notes) == 0 {
+		b.WriteString("_No mentions yet._\n")
+	}
+	for i, note := range notes {
+		if i == limit {
+			break
+		}
+		rel, err := filepath.Rel(filepath.Join(config.NotesDir, config.PeopleDir), note.Path)
+		if err != nil {
+			rel = note.Path
+		}
+		fmt.Fprintf(&b, "- %s [%s](%s)\n", noteDate(note).Format("2006-01-02"), displayTitle(state, note), filepath.ToSlash(rel))
+	}
+	b.WriteString(mentionsEnd + "\n")
+	return b.String()
+}
+
+// stripMentionsSection removes the generated mentions block so it is neither
+// counted as mentions nor duplicated when regenerated.
+func stripMentionsSection(content string) string {
+	start := strings.Index(content, mentionsStart)
+	if start < 0 {
+		return content
+	}
+	end := strings.Index(content[start:], mentionsEnd)
+	if end < 0 {
+		return content[:start]
+	}
+	return content[:start] + strings.TrimPrefix(content[start+end+len(mentionsEnd):], "\n")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A sync pipeline is the list of stages a note goes through after it is
+// edited, in order. Each notebook (top-level directory of the vault) can have
+// its own, with "default" for the rest:
+//
+//	[pipeline]
+//	default = ["format", "lint", "git", "notion"]
+//	journal = ["format", "git", "webhook"]
+//
+//	[pipeline.stage.notion]
+//	continue_on_error = false
+//
+// A stage can be switched off with enabled = false. By default a failing
+// format or lint stage stops the pipeline and a failing backend doesn't.
+// Without any pipeline configured, notes pass the publish checks and then go
+// to every enabled backend. Encrypted notes only ever go to git.
+
+// pipelineStages are the stages a pipeline can name.
+var pipelineStages = map[string]SyncBackend{
+	"format":  formatStage{},
+	"lint":    lintStage{},
+	"git":     gitBackend{},
+	"notion":  notionBackend{},
+	"webhook": webhookBackend{},
+}
+
+// syncStage is a stage of a note's pipeline with its settings.
+type syncStage struct {
+	SyncBackend
+	continueOnError bool
+}
+
+// isBackend reports whether the stage sends the note somewhere, which note
+// types can restrict with NOTE_TYPE_<NAME>_SYNC.
+func isBackend(name string) bool {
+	return name != "format" && name != "lint"
+}
+
+// writesNote reports whether the backend changes the note while pushing it:
+// Notion does when it imports comments into the note's Comments section.
+func writesNote(config *CONFIG, name string) bool {
+	return name == "notion" && strings.ToLower(config.NotionComments) == "section"
+}
+
+// notePipeline returns the stages for the note at path: its notebook's
+// pipeline, the default one, or the publish checks followed by backends.
+func notePipeline(config *CONFIG, backends []SyncBackend, path string) ([]syncStage, error) {
+	names := splitList(configValue("PIPELINE_DEFAULT"))
+	if rel, err := filepath.Rel(config.NotesDir, path); err == nil {
+		if notebook, _, ok := strings.Cut(filepath.ToSlash(rel), "/"); ok {
+			if v := configValue("PIPELINE_" + tomlKey(notebook)); v != "" {
+				names = splitList(v)
+			}
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"lint"}
+		for _, b := range backends {
+			names = append(names, b.Name())
+		}
+	}
+
+	var stages []syncStage
+	for _, name := range names {
+		name = strings.ToLower(name)
+		stage, ok := pipelineStages[name]
+		if !ok {
+			return nil, codeErrorf(ErrConfigInvalid, "unknown pipeline stage %q (want format, lint, git, notion or webhook)", name)
+		}
+		key := "PIPELINE_STAGE_" + tomlKey(name) + "_"
+		if !getEnvBool(key+"ENABLED", true) || (isSealed(path) && name != "git") {
+			continue
+		}
+		stages = append(stages, syncStage{stage, getEnvBool(key+"CONTINUE_ON_ERROR", isBackend(name))})
+	}
+	return stages, nil
+}
+
+// formatStage tidies the note with FORMAT_COMMAND, run with the note's path
+// in place of {} or appended. Without one it normalizes line endings and
+// ends the file with a single newline.
+type formatStage struct{}
+
+func (formatStage) Name() string { return "format" }
+
+func (formatStage) Push(config *CONFIG, notePath string) error {
+	if config.FormatCommand != "" {
+		name, args := fileCommand(config.FormatCommand, notePath)
+		cmd := exec.Command(name, args...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+	data, err := os.ReadFile(notePath)
+	if err != nil {
+		return err
+	}
+	tidy := strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") + "\n"
+	if tidy == string(data) {
+		return nil
+	}
+	return writeFileAtomic(notePath, []byte(tidy))
+}
+
+// lintStage runs the publish checks.
+type lintStage struct{}
+
+func (lintStage) Name() string { return "lint" }
+
+func (lintStage) Push(config *CONFIG, notePath string) error {
+	note, err := readNote(notePath)
+	if err != nil {
+		return err
+	}
+	if ok, err := passesGates(config, note); err != nil {
+		return fmt.Errorf("running publish checks: %w", err)
+	} else if !ok {
+		return codeErrorf(ErrPublishChecks, "%s failed its publish checks", notePath)
+	}
+	return nil
+}
+
+// webhookBackend POSTs the note as JSON to WEBHOOK_URL.
+type webhookBackend struct{}
+
+func (webhookBackend) Name() string { return "webhook" }
+
+func (webhookBackend) Push(config *CONFIG, notePath string) error {
+	if config.WebhookURL == "" {
+		return codeErrorf(ErrConfigInvalid, "the webhook stage needs WEBHOOK_URL")
+	}
+	note, err := readNote(notePath)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{
+		"event": "sync",
+		"path":  visitKey(config, notePath),
+		"title": noteTitle(note),
+		"meta":  note.Meta,
+		"body":  note.Body,
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	uploadedBytes.Add(int64(len(body)))
+	resp, err := client.Post(config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// fileCommand splits a configured command and puts path in it, in place of
+// {} or at the end.
+func fileCommand(command, path string) (string, []string) {
+	fields := strings.Fields(command)
+	args, substituted := fields[1:], false
+	for i, arg := range args {
+		if strings.Contains(arg, "{}") {
+			args[i], substituted = strings.ReplaceAll(arg, "{}", path), true
+		}
+	}
+	if !substituted {
+		args = append(args, path)
+	}
+	return fields[0], args
+}
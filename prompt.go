@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxTitleHistory is how many entered titles the prompt remembers.
+const maxTitleHistory = 200
+
+// promptTitle asks for a new note's title. Words written as #tag are taken
+// out of the title and returned as tags; Tab completes them from the tags
+// already in the vault and the arrow keys recall earlier titles.
+func promptTitle(config *CONFIG) (string, []string, error) {
+	history := loadTitleHistory(config)
+	var known []string
+	if notes, err := vaultNotes(config, false); err == nil {
+		seen := map[string]bool{}
+		for _, note := range notes {
+			for _, tag := range noteTags(note) {
+				if !seen[tag] {
+					seen[tag] = true
+					known = append(known, tag)
+				}
+			}
+		}
+		sort.Strings(known)
+	}
+	complete := func(word string) []string {
+		prefix, ok := strings.CutPrefix(word, "#")
+		if !ok {
+			return nil
+		}
+		var matches []string
+		for _, tag := range known {
+			if strings.HasPrefix(foldText(tag), foldText(prefix)) {
+				matches = append(matches, "#"+tag)
+			}
+		}
+		return matches
+	}
+
+	var line string
+	var err error
+	if config.Accessible {
+		line, err = readPlainLine("Title (Enter for none): ")
+	} else {
+		line, err = readLine("Title (Enter for none): ", history, complete)
+	}
+	if err == io.EOF {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var words, tags []string
+	for _, word := range strings.Fields(line) {
+		if tag, ok := strings.CutPrefix(word, "#"); ok && tag != "" {
+			tags = append(tags, tag)
+		} else {
+			words = append(words, word)
+		}
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		if err := saveTitleHistory(config, append(history, line)); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not save title history: %v\n", err)
+		}
+	}
+	return strings.Join(words, " "), dedupe(tags), nil
+}
+
+func titleHistoryPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "titles")
+}
+
+// loadTitleHistory returns the titles entered before, oldest first.
+func loadTitleHistory(config *CONFIG) []string {
+	data, err := os.ReadFile(titleHistoryPath(config))
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// saveTitleHistory stores history, dropping earlier copies of repeated
+// titles and all but the newest maxTitleHistory.
+func saveTitleHistory(config *CONFIG, history []string) error {
+	var kept []string
+	seen := map[string]bool{}
+	for i := len(history) - 1; i >= 0 && len(kept) < maxTitleHistory; i-- {
+		if h := history[i]; h != "" && !seen[h] {
+			seen[h] = true
+			kept = append(kept, h)
+		}
+	}
+	var b strings.Builder
+	for i := len(kept) - 1; i >= 0; i-- {
+		b.WriteString(kept[i] + "\n")
+	}
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(titleHistoryPath(config), []byte(b.String()))
+}
+
+func readPlainLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// readLine reads a line from the terminal with a little editing: Up and
+// Down walk history, Tab completes the word being typed from complete, and
+// Ctrl-U clears the line. The terminal is switched to raw mode with stty;
+// where that fails it is a plain read.
+func readLine(prompt string, history []string, complete func(word string) []string) (string, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return readPlainLine(prompt)
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return readPlainLine(prompt)
+	}
+	defer stty(strings.TrimSpace(saved))
+
+	in := bufio.NewReader(os.Stdin)
+	var buf []rune
+	draft, pos := "", len(history)
+	redraw := func() { fmt.Print("\r\x1b[K" + prompt + string(buf)) }
+	redraw()
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			fmt.Println()
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Println()
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Println()
+			return "", withCode(ErrAborted, errors.New(tr("aborted")))
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Println()
+				return "", io.EOF
+			}
+		case 21: // Ctrl-U
+			buf = buf[:0]
+		case 127, 8:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		case '\t':
+			buf = completeWord(buf, complete)
+		case 27:
+			key := readEscape(in)
+			switch {
+			case key == "[A" && pos > 0:
+				if pos == len(history) {
+					draft = string(buf)
+				}
+				pos--
+				buf = []rune(history[pos])
+			case key == "[B" && pos < len(history):
+				pos++
+				if pos == len(history) {
+					buf = []rune(draft)
+				} else {
+					buf = []rune(history[pos])
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf, r)
+			}
+		}
+		redraw()
+	}
+}
+
+// completeWord completes the last word of buf. A single candidate is taken
+// whole; several are extended to their common prefix, or listed when that
+// adds nothing.
+func completeWord(buf []rune, complete func(string) []string) []rune {
+	line := string(buf)
+	start := strings.LastIndexAny(line, " \t") + 1
+	word := line[start:]
+	matches := complete(word)
+	switch {
+	case len(matches) == 1:
+		return []rune(line[:start] + matches[0] + " ")
+	case len(matches) > 1:
+		prefix := matches[0]
+		for _, m := range matches[1:] {
+			for !strings.HasPrefix(m, prefix) {
+				prefix = prefix[:len(prefix)-1]
+			}
+		}
+		if len(prefix) > len(word) {
+			return []rune(line[:start] + prefix)
+		}
+		fmt.Print("\r\n" + strings.Join(matches, "  ") + "\r\n")
+	}
+	return buf
+}
+
+// readEscape reads the rest of an escape sequence such as "[A" after ESC.
+func readEscape(in *bufio.Reader) string {
+	b, err := in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return ""
+	}
+	seq := []byte{b}
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return string(seq)
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			return string(seq)
+		}
+	}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	sentenceEnd  = regexp.MustCompile(`[.!?]+(\s+|$)`)
+	wordPattern  = regexp.MustCompile(`[\p{L}']+`)
+	markdownJunk = regexp.MustCompile("(?m)^\\s*(#+|[-*+]|\\d+\\.|>)\\s+|\\[([^\\]]*)\\]\\([^)]*\\)|[*_`]")
+	passiveVoice = regexp.MustCompile(`(?i)\b(am|is|are|was|were|be|been|being)\s+(\w+ly\s+)?(\w+ed|\w+en)\b`)
+)
+
+var fillerWords = []string{
+	"actually", "basically", "just", "really", "very", "quite", "simply",
+	"literally", "totally", "obviously", "somewhat", "kind of", "sort of",
+}
+
+// ProseReport summarises the readability of a piece of text.
+type ProseReport struct {
+	Sentences     int
+	Words         int
+	Syllables     int
+	ReadingEase   float64
+	GradeLevel    float64
+	AvgSentence   float64
+	LongestWords  int
+	LongSentences int
+	PassiveVoice  []string
+	Fillers       map[string]int
+}
+
+func runProse(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("prose", flag.ContinueOnError)
+	lint := fs.Bool("lint", false, "check every note tagged publish against the prose thresholds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *lint {
+		return lintProse(config)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt prose <note> | syt prose --lint")
+	}
+	path, err := resolveNote(config, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	note, err := readNote(path)
+	if err != nil {
+		return err
+	}
+	printProse(analyzeProse(note.Body, config.ProseMaxSentence))
+	return nil
+}
+
+// lintProse enforces the configured thresholds on notes tagged publish.
+func lintProse(config *CONFIG) error {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, note := range notes {
+		if !hasTag(note, "publish") {
+			continue
+		}
+		for _, problem := range proseProblems(config, analyzeProse(note.Body, config.ProseMaxSentence)) {
+			fmt.Printf("%s: %s\n", note.Path, problem)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d prose problem(s) found", failed)
+	}
+	return nil
+}
+
+func proseProblems(config *CONFIG, r ProseReport) []string {
+	var problems []string
+	if r.Words > 0 && r.ReadingEase < config.ProseMinEase {
+		problems = append(problems, fmt.Sprintf("reading ease %.1f is below %.1f", r.ReadingEase, config.ProseMinEase))
+	}
+	if r.LongSentences > 0 {
+		problems = append(problems, fmt.Sprintf("%d sentence(s) longer than %d words", r.LongSentences, config.ProseMaxSentence))
+	}
+	return problems
+}
+
+// analyzeProse computes Flesch reading ease, Flesch-Kincaid grade level,
+// sentence statistics, passive constructions and filler word counts.
+func analyzeProse(body string, maxSentence int) ProseReport {
+	text := markdownJunk.ReplaceAllString(stripCodeBlocks(body), "$2")
+	r := ProseReport{Fillers: map[string]int{}}
+
+	for _, sentence := range sentenceEnd.Split(text, -1) {
+		words := wordPattern.FindAllString(sentence, -1)
+		if len(words) == 0 {
+			continue
+		}
+		r.Sentences++
+		r.Words += len(words)
+		for _, w := range words {
+			r.Syllables += syllables(w)
+		}
+		if len(words) > r.LongestWords {
+			r.LongestWords = len(words)
+		}
+		if len(words) > maxSentence {
+			r.LongSentences++
+		}
+	}
+	for _, m := range passiveVoice.FindAllString(text, -1) {
+		r.PassiveVoice = append(r.PassiveVoice, m)
+	}
+	lower := " " + strings.ToLower(wordPattern.ReplaceAllStringFunc(text, func(s string) string { return s + " " })) + " "
+	for _, filler := range fillerWords {
+		if n := strings.Count(lower, " "+filler+" "); n > 0 {
+			r.Fillers[filler] = n
+		}
+	}
+
+	if r.Sentences > 0 && r.Words > 0 {
+		wps := float64(r.Words) / float64(r.Sentences)
+		spw := float64(r.Syllables) / float64(r.Words)
+		r.AvgSentence = wps
+		r.ReadingEase = 206.835 - 1.015*wps - 84.6*spw
+		r.GradeLevel = 0.39*wps + 11.8*spw - 15.59
+	}
+	return r
+}
+
+// syllables estimates the syllable count of an English word by counting
+// vowel groups, ignoring a silent trailing "e".
+func syllables(word string) int {
+	word = strings.ToLower(word)
+	count := 0
+	prevVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+// stripCodeBlocks drops fenced code blocks, which would skew prose metrics.
+func stripCodeBlocks(body string) string {
+	var b strings.Builder
+	inFence := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func printProse(r ProseReport) {
+	fmt.Printf("Words:             %d\n", r.Words)
+	fmt.Printf("Sentences:         %d\n", r.Sentences)
+	fmt.Printf("Avg sentence:      %.1f words (longest %d)\n", r.AvgSentence, r.LongestWords)
+	fmt.Printf("Long sentences:    %d\n", r.LongSentences)
+	fmt.Printf("Reading ease:      %.1f\n", r.ReadingEase)
+	fmt.Printf("Grade level:       %.1f\n", r.GradeLevel)
+
+	if len(r.PassiveVoice) > 0 {
+		fmt.Printf("\nPassive voice (%d):\n", len(r.PassiveVoice))
+		for _, p := range r.PassiveVoice {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if len(r.Fillers) > 0 {
+		words := make([]string, 0, len(r.Fillers))
+		for w := range r.Fillers {
+			words = append(words, w)
+		}
+		sort.Strings(words)
+		fmt.Println("\nFiller words:")
+		for _, w := range words {
+			fmt.Printf("  %-10s %d\n", w, r.Fillers[w])
+		}
+	}
+}
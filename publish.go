@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+)
+
+// runPublish sends notes to a publishing target.
+func runPublish(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: syt publish confluence|site|queue [flags]")
+	}
+	switch args[0] {
+	case "confluence":
+		return publishConfluence(config, args[1:])
+	case "site":
+		return publishSite(config, args[1:])
+	case "queue":
+		return runPublishQueue(config, args[1:])
+	}
+	return fmt.Errorf("unknown publishing target %q", args[0])
+}
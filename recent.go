@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// maxVisitSamples is how many recent visit times are kept per note for the
+// frecency calculation.
+const maxVisitSamples = 10
+
+// Visits records how often and how recently syt opened a note.
+type Visits struct {
+	Count int         `json:"count"`
+	Times []time.Time `json:"times"` // most recent last
+}
+
+// recordVisit notes that path was opened for editing.
+func recordVisit(config *CONFIG, path string) error {
+	key := visitKey(config, path)
+	return updateState(config, func(s *State) error {
+		if s.Visits == nil {
+			s.Visits = map[string]*Visits{}
+		}
+		v := s.Visits[key]
+		if v == nil {
+			v = &Visits{}
+			s.Visits[key] = v
+		}
+		v.Count++
+		v.Times = append(v.Times, currentTime())
+		if len(v.Times) > maxVisitSamples {
+			v.Times = v.Times[len(v.Times)-maxVisitSamples:]
+		}
+		return nil
+	})
+}
+
+// visitKey identifies a note in the state database by its path relative to
+// the notes directory, so it survives NOTES_DIR being given differently.
+func visitKey(config *CONFIG, path string) string {
+	if rel, err := filepath.Rel(config.NotesDir, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// frecency scores a note the way browsers rank history: the visit count
+// weighted by how recent the sampled visits are.
+func frecency(v *Visits, now time.Time) float64 {
+	if v == nil || len(v.Times) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, t := range v.Times {
+		switch age := now.Sub(t); {
+		case age < 4*24*time.Hour:
+			total += 100
+		case age < 14*24*time.Hour:
+			total += 70
+		case age < 31*24*time.Hour:
+			total += 50
+		case age < 90*24*time.Hour:
+			total += 30
+		default:
+			total += 10
+		}
+	}
+	return float64(v.Count) * total / float64(len(v.Times))
+}
+
+// lastTouched is the later of the last syt visit and the file's mtime.
+func lastTouched(config *CONFIG, state *State, note *Note) time.Time {
+	t := note.ModTime
+	if v := state.Visits[visitKey(config, note.Path)]; v != nil && len(v.Times) > 0 && v.Times[len(v.Times)-1].After(t) {
+		t = v.Times[len(v.Times)-1]
+	}
+	return t
+}
+
+// sortByFrecency orders notes most frecent first, falling back to the most
+// recently touched.
+func sortByFrecency(config *CONFIG, state *State, notes []*Note) {
+	now := currentTime()
+	score := map[*Note]float64{}
+	for _, n := range notes {
+		score[n] = frecency(state.Visits[visitKey(config, n.Path)], now)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		if score[notes[i]] != score[notes[j]] {
+			return score[notes[i]] > score[notes[j]]
+		}
+		return lastTouched(config, state, notes[i]).After(lastTouched(config, state, notes[j]))
+	})
+}
+
+func runRecent(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("recent", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "number of notes to show")
+	byFrecency := fs.Bool("frecent", false, "order by frecency instead of last edit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+
+	if *byFrecency {
+		sortByFrecency(config, state, notes)
+	} else {
+		sort.SliceStable(notes, func(i, j int) bool {
+			return lastTouched(config, state, notes[i]).After(lastTouched(config, state, notes[j]))
+		})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, note := range notes {
+		if i == *limit {
+			break
+		}
+		visits := 0
+		if v := state.Visits[visitKey(config, note.Path)]; v != nil {
+			visits = v.Count
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", lastTouched(config, state, note).Format("2006-01-02 15:04"), note.Path, visits, displayTitle(state, note))
+	}
+	return w.Flush()
+}
+
+// runLast reopens the note touched most recently, by syt or otherwise.
+func runLast(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("last", flag.ContinueOnError)
+	printOnly := fs.Bool("print", false, "print the note's path instead of opening it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	var last *Note
+	for _, note := range notes {
+		if last == nil || lastTouched(config, state, note).After(lastTouched(config, state, last)) {
+			last = note
+		}
+	}
+	if last == nil {
+		return fmt.Errorf("no notes in %s yet", config.NotesDir)
+	}
+	if *printOnly {
+		fmt.Println(last.Path)
+		return nil
+	}
+	return editNote(config, last.Path)
+}
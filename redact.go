@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redaction profiles live in the config file, one table per profile:
+//
+//	[redact.gdpr]
+//	rules = ["email", "phone", "people"]
+//	words = ["Project Falcon"]
+//	pattern = 'ACME-\d{4}'
+//
+// rules picks from the built-in rules, words lists terms to blank out
+// wherever they appear and pattern is one regular expression for anything
+// else. The gdpr profile works without a table, as the three rules above
+// and location.
+var redactRules = map[string]struct {
+	pattern *regexp.Regexp
+	label   string
+}{
+	"email": {regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`), "[email]"},
+	"phone": {regexp.MustCompile(`(?:\+|\(|\b)\d[\d ()./-]{6,}\d\b`), "[phone]"},
+	"ip":    {regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[ip]"},
+	"iban":  {regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){3,7}(?: ?[A-Z0-9]{1,3})?\b`), "[iban]"},
+	// the coordinates `syt new --location` records
+	"location": {regexp.MustCompile(`(?m)^location:[ \t]*\S.*$`), "location: [location]"},
+}
+
+// personTag matches tags naming people, such as #person/alice or
+// people/bob in a tags list.
+var personTag = regexp.MustCompile(`(?i)\b(person|people)/[\w/-]+`)
+
+// isoDate tells dates and times apart from phone numbers.
+var isoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+// redactor applies a redaction profile to note text.
+type redactor struct {
+	rules  []string
+	people bool
+	words  []string
+	custom *regexp.Regexp
+}
+
+// loadRedactor reads the named redaction profile.
+func loadRedactor(name string) (*redactor, error) {
+	key := "REDACT_" + tomlKey(name) + "_"
+	r := &redactor{words: splitList(configValue(key + "WORDS"))}
+	rules := splitList(configValue(key + "RULES"))
+	if len(rules) == 0 && len(r.words) == 0 && configValue(key+"PATTERN") == "" {
+		if strings.ToLower(name) != "gdpr" {
+			return nil, codeErrorf(ErrConfigInvalid, "no redaction profile %q; add a [redact.%s] table to the config file", name, name)
+		}
+		rules = []string{"email", "phone", "people", "location"}
+	}
+	for _, rule := range rules {
+		rule = strings.ToLower(rule)
+		if _, ok := redactRules[rule]; !ok && rule != "people" {
+			return nil, codeErrorf(ErrConfigInvalid, "redaction profile %s: unknown rule %q (want email, phone, ip, iban, location or people)", name, rule)
+		}
+		if rule == "people" {
+			r.people = true
+		} else {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	if pattern := configValue(key + "PATTERN"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, codeErrorf(ErrConfigInvalid, "redaction profile %s: %v", name, err)
+		}
+		r.custom = re
+	}
+	return r, nil
+}
+
+// apply returns text with everything the profile covers replaced by a
+// label saying what was there. People are @mentions and person tags; the
+// person notes themselves are left out of a redacted export by the caller.
+func (r *redactor) apply(text string) string {
+	for _, word := range r.words {
+		re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(word))
+		text = re.ReplaceAllString(text, "[redacted]")
+	}
+	if r.custom != nil {
+		text = r.custom.ReplaceAllString(text, "[redacted]")
+	}
+	for _, name := range r.rules {
+		rule := redactRules[name]
+		text = rule.pattern.ReplaceAllStringFunc(text, func(m string) string {
+			if name == "phone" && (isoDate.MatchString(m) || countDigits(m) < 9) {
+				return m
+			}
+			return rule.label
+		})
+	}
+	if r.people {
+		text = mentionPattern.ReplaceAllString(text, "${1}@[person]")
+		text = personTag.ReplaceAllString(text, "${1}/[person]")
+	}
+	return text
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *redactor) String() string {
+	parts := append([]string{}, r.rules...)
+	if r.people {
+		parts = append(parts, "people")
+	}
+	if len(r.words) > 0 {
+		parts = append(parts, fmt.Sprintf("%d word(s)", len(r.words)))
+	}
+	if r.custom != nil {
+		parts = append(parts, "pattern")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// globalFlags strips the flags that apply to every command off the front of
+// args. The remote host comes from --remote (or SYT_REMOTE), and --local
+// ignores a configured remote for one invocation. --direct bypasses a running
+// daemon and --yes answers confirmations. --now and --seed pin the clock and
+// the ID generator for reproducible output.
+func globalFlags(config *CONFIG, args []string) []string {
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--yes" || args[0] == "-y":
+			config.Yes = true
+			args = args[1:]
+		case args[0] == "--now" && len(args) > 1:
+			config.Now = args[1]
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--now="):
+			config.Now = strings.TrimPrefix(args[0], "--now=")
+			args = args[1:]
+		case args[0] == "--seed" && len(args) > 1:
+			config.Seed = args[1]
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--seed="):
+			config.Seed = strings.TrimPrefix(args[0], "--seed=")
+			args = args[1:]
+		case args[0] == "--direct":
+			config.Direct = true
+			args = args[1:]
+		case args[0] == "--local":
+			config.Remote = ""
+			args = args[1:]
+		case args[0] == "--remote" && len(args) > 1:
+			config.Remote = args[1]
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--remote="):
+			config.Remote = strings.TrimPrefix(args[0], "--remote=")
+			args = args[1:]
+		default:
+			return args
+		}
+	}
+	return args
+}
+
+// runRemote runs syt with args on the configured remote host over ssh, so the
+// vault there is used as if it were local. A terminal is allocated when we
+// have one, which lets the remote editor and prompts work. It returns the
+// remote exit code.
+func runRemote(config *CONFIG, args []string) (int, error) {
+	sshArgs := []string{}
+	if isTerminal(os.Stdin) {
+		sshArgs = append(sshArgs, "-t")
+	}
+	remoteCmd := []string{config.RemoteCommand}
+	if config.Yes {
+		remoteCmd = append(remoteCmd, "--yes")
+	}
+	if config.Now != "" {
+		remoteCmd = append(remoteCmd, "--now", shellQuote(config.Now))
+	}
+	if config.Seed != "" {
+		remoteCmd = append(remoteCmd, "--seed", shellQuote(config.Seed))
+	}
+	for _, arg := range args {
+		remoteCmd = append(remoteCmd, shellQuote(arg))
+	}
+	sshArgs = append(sshArgs, config.Remote, "--", strings.Join(remoteCmd, " "))
+
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// shellQuote quotes s for the remote POSIX shell ssh hands the command to.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,@+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
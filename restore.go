@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runRestore puts a note back the way it was at a git revision, after
+// showing what would change and asking. Without --at it goes back one step:
+// to the last commit when the note has uncommitted changes, and otherwise to
+// the version before its last commit. --at takes anything git names a
+// commit by, such as a hash from `syt history`, or a date for the version
+// then. Deleted notes can be restored by their path. The restore can be
+// undone with `syt undo` and is synced like an edit.
+func runRestore(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	at := fs.String("at", "", "the revision or date (2006-01-02) to restore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt restore [--at revision|date] <note>")
+	}
+	path, err := resolveNote(config, fs.Arg(0))
+	if err != nil {
+		deleted := filepath.Join(config.NotesDir, filepath.FromSlash(fs.Arg(0)))
+		if strings.HasSuffix(deleted, ".md") && !fileExists(deleted) {
+			path = deleted
+		} else if path, err = findNote(config, fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+	root, err := gitRepoRoot(config.NotesDir)
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	key := visitKey(config, path)
+
+	commits, err := noteHistory(root, abs, 0)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return codeErrorf(ErrNoteNotFound, "%s has never been committed", key)
+	}
+	rev, err := restoreRevision(root, abs, *at, commits)
+	if err != nil {
+		return err
+	}
+	// The note may have had another name then
+	old := ""
+	for _, c := range commits {
+		if _, err := gitOutput(root, "merge-base", "--is-ancestor", c.hash, rev); err == nil && c.path != "" {
+			old = c.path
+			break
+		}
+	}
+	if old == "" {
+		return codeErrorf(ErrNoteNotFound, "%s didn't exist at %s", key, rev)
+	}
+	target, err := gitOutput(root, "show", rev+":"+old)
+	if err != nil {
+		return codeErrorf(ErrNoteNotFound, "%s didn't exist at %s", key, rev)
+	}
+	current, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Printf("%s was deleted; it will be brought back as it was at %s.\n", key, rev)
+	case err != nil:
+		return err
+	case string(current) == target:
+		fmt.Printf("%s is already as it was at %s.\n", key, rev)
+		return nil
+	default:
+		fmt.Print(unifiedDiff(string(current), target, "current/"+key, rev+"/"+old))
+	}
+	if err := confirm(config, "Restore "+key+" to "+rev, 1); err != nil {
+		return err
+	}
+	op := beginOperation(config, "restore "+key)
+	if err := op.saveBefore(path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(target)); err != nil {
+		return err
+	}
+	if err := op.commit(); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s to %s.\n", key, rev)
+
+	note, err := readNote(path)
+	if err != nil {
+		return err
+	}
+	var t NoteType
+	if note.Meta["type"] != "" {
+		t, _ = lookupType(note.Meta["type"])
+	}
+	return syncTracked(config, syncBackends(config), t, path)
+}
+
+// restoreRevision works out the short hash of the commit to restore from.
+func restoreRevision(root, abs, at string, commits []noteCommit) (string, error) {
+	if at == "" {
+		if out, err := gitOutput(root, "status", "--porcelain", "--", abs); err == nil && strings.TrimSpace(out) != "" {
+			at = "HEAD"
+		} else if len(commits) < 2 {
+			return "", codeErrorf(ErrUsage, "the note has no earlier version")
+		} else {
+			at = commits[1].hash
+		}
+	} else if day, err := time.ParseInLocation("2006-01-02", at, time.Local); err == nil {
+		// The last commit of that day
+		out, err := gitOutput(root, "rev-list", "-1", "--before="+day.AddDate(0, 0, 1).Format(time.RFC3339), "HEAD")
+		if err != nil || strings.TrimSpace(out) == "" {
+			return "", codeErrorf(ErrUsage, "no commits before %s", at)
+		}
+		at = strings.TrimSpace(out)
+	}
+	out, err := gitOutput(root, "rev-parse", "--short", "--verify", "--quiet", at+"^{commit}")
+	if err != nil {
+		return "", codeErrorf(ErrUsage, "%s is not a revision", at)
+	}
+	return strings.TrimSpace(out), nil
+}
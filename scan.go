@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxScanSize bounds an uploaded scan.
+	maxScanSize = 32 << 20
+	// ocrTimeout bounds one run of OCR_COMMAND.
+	ocrTimeout = 2 * time.Minute
+)
+
+// handleScan files a document scanned on a phone, POSTed to
+// /api/capture?type=scan either as the "file" field of a multipart form,
+// which may also carry a "title" and a "text", or as the raw body named by
+// ?name=. Images and PDFs are accepted. The file becomes an attachment and a
+// new note in SCAN_NOTEBOOK links to it, with the text OCR_COMMAND read from
+// it when one is set.
+func (s *server) handleScan(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxScanSize)
+	var data []byte
+	name, title, text := r.URL.Query().Get("name"), r.URL.Query().Get("title"), ""
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			httpError(w, http.StatusBadRequest, "scan: "+err.Error())
+			return
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		name = header.Filename
+		if v := r.FormValue("title"); v != "" {
+			title = v
+		}
+		text = strings.TrimSpace(r.FormValue("text"))
+	} else {
+		var err error
+		if data, err = io.ReadAll(r.Body); err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if len(data) == 0 {
+		httpError(w, http.StatusBadRequest, "scan: empty upload")
+		return
+	}
+
+	kind, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if !strings.HasPrefix(kind, "image/") && kind != "application/pdf" {
+		httpError(w, http.StatusUnsupportedMediaType, "scan: want an image or a PDF, got "+kind)
+		return
+	}
+	now := currentTime()
+	if name = filepath.Base(name); name == "." || name == "/" || name == "" {
+		name = "scan"
+	}
+	if filepath.Ext(name) == "" {
+		if exts, _ := mime.ExtensionsByType(kind); len(exts) > 0 {
+			name = now.Format("2006-01-02_150405") + "_" + name + exts[0]
+		}
+	}
+	// The title is written into the frontmatter, where another line could
+	// set tags or publish_at that a capture token mustn't
+	if title = strings.Join(strings.Fields(title), " "); title == "" {
+		title = "Scan " + now.Format("2006-01-02 15:04")
+	}
+
+	dst, a, err := storeAttachment(s.config, name, data)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dir := filepath.Join(s.config.NotesDir, s.config.ScanNotebook)
+	// The link is relative to the note, which is created next
+	link, err := attachmentMarkdown(filepath.Join(dir, "scan.md"), dst, a)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body := link + "\n"
+	if text != "" {
+		body += "\n" + text + "\n"
+	}
+	if ocr := scanText(s.config, dst); ocr != "" {
+		body += "\n## Text\n\n" + ocr + "\n"
+	}
+	meta := map[string]string{
+		"title":   frontmatterText(title),
+		"id":      newID(),
+		"created": now.Format("2006-01-02 15:04"),
+		"tags":    formatTags([]string{"scan"}),
+	}
+	header := formatFrontmatter(meta, []string{"title", "id", "created", "tags"}) + body
+	path, err := createSealedNote(s.config, dir, title, header)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.watcher.poll()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]string{"path": visitKey(s.config, path), "attachment": visitKey(s.config, dst)})
+}
+
+// scanText runs OCR_COMMAND on the file and returns what it printed. The
+// file's path replaces {} in the command, as in "tesseract {} stdout", or is
+// appended when there's no {}. OCR failing only leaves the text out.
+func scanText(config *CONFIG, path string) string {
+	if strings.TrimSpace(config.OCRCommand) == "" {
+		return ""
+	}
+	name, args := fileCommand(config.OCRCommand, path)
+	ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		log.Printf("OCR of %s failed: %v", filepath.Base(path), err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
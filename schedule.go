@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Notes schedule themselves through frontmatter:
+//
+//	recur: daily|weekly|monthly|yearly   repeats from the note's date
+//	remind: 2026-03-01 09:00             a one-off reminder
+//	expires: 2026-06-30                  the note goes stale after this
+//	publish_at: 2026-04-01 08:00         a draft goes out (see scheduled.go)
+//
+// scheduleEvent is one of those firing.
+type scheduleEvent struct {
+	Time time.Time
+	Kind string // "recur", "remind", "expire" or "publish"
+	Note *Note
+}
+
+// recurrence steps a time forward by one period.
+var recurrences = map[string]func(time.Time) time.Time{
+	"daily":   func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	"weekly":  func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	"monthly": func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	"yearly":  func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+}
+
+// noteEvents returns what the note's schedule fires in (from, to]. The
+// first occurrence of a recurring note is its own date, which isn't
+// reported as it is the note itself.
+func noteEvents(note *Note, from, to time.Time) []scheduleEvent {
+	var events []scheduleEvent
+	within := func(t time.Time) bool { return t.After(from) && !t.After(to) }
+
+	if next, ok := recurrences[strings.ToLower(note.Meta["recur"])]; ok {
+		for t := next(noteDate(note)); !t.After(to); t = next(t) {
+			if within(t) {
+				events = append(events, scheduleEvent{Time: t, Kind: "recur", Note: note})
+			}
+		}
+	}
+	if t, ok := publishPending(note); ok && within(t) {
+		events = append(events, scheduleEvent{Time: t, Kind: "publish", Note: note})
+	}
+	for key, kind := range map[string]string{"remind": "remind", "expires": "expire"} {
+		if raw := note.Meta[key]; raw != "" {
+			if t, err := parseTimestamp(raw); err == nil && within(t) {
+				events = append(events, scheduleEvent{Time: t, Kind: kind, Note: note})
+			}
+		}
+	}
+	return events
+}
+
+// dueEvents returns everything that fired since the given time, up to what
+// the clock says is now, oldest first.
+func dueEvents(notes []*Note, c Clock, since time.Time) []scheduleEvent {
+	var events []scheduleEvent
+	for _, note := range notes {
+		events = append(events, noteEvents(note, since, c.Now())...)
+	}
+	sortEvents(events)
+	return events
+}
+
+func sortEvents(events []scheduleEvent) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+}
+
+func printEvents(state *State, events []scheduleEvent) {
+	for _, e := range events {
+		fmt.Printf("%s  %-7s  %s (%s)\n", e.Time.Format("2006-01-02 15:04"), e.Kind, displayTitle(state, e.Note), e.Note.Path)
+	}
+}
+
+// runDue lists what fired today: reminders, recurrences and expired notes.
+func runDue(config *CONFIG, args []string) error {
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	now := clock.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	printEvents(state, dueEvents(notes, clock, today.Add(-time.Nanosecond)))
+	return nil
+}
+
+// runSimulate steps a fake clock through a window a day at a time and
+// reports what `syt due` would have shown along the way. It is not listed in
+// the usage; it exists for checking schedules and for tests.
+func runSimulate(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fromFlag := fs.String("from", "", "start of the window (default now)")
+	toFlag := fs.String("to", "", "end of the window (required)")
+	step := fs.Duration("step", 24*time.Hour, "how far the clock advances per tick")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *toFlag == "" {
+		return fmt.Errorf("usage: syt simulate [--from time] --to time [--step duration]")
+	}
+	if *step <= 0 {
+		return fmt.Errorf("--step must be positive")
+	}
+	from := clock.Now()
+	if *fromFlag != "" {
+		t, err := parseTimestamp(*fromFlag)
+		if err != nil {
+			return err
+		}
+		from = t
+	}
+	to, err := parseTimestamp(*toFlag)
+	if err != nil {
+		return err
+	}
+	if to.Before(from) {
+		return fmt.Errorf("--to is before --from")
+	}
+
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	fake := &fakeClock{now: from.Add(-time.Nanosecond)}
+	for fake.Now().Before(to) {
+		since := fake.Now()
+		fake.Advance(*step)
+		if fake.Now().After(to) {
+			fake.now = to
+		}
+		printEvents(state, dueEvents(notes, fake, since))
+	}
+	return nil
+}
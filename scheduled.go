@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// A note with "publish_at: <time>" in its frontmatter is a draft until that
+// time. Then it is published to the PUBLISH_SCHEDULED_TO targets (sync,
+// confluence and/or site) and its status flips to "published".
+
+// publishPending reports whether a note is queued for publishing and when.
+func publishPending(note *Note) (time.Time, bool) {
+	raw := note.Meta["publish_at"]
+	if raw == "" || strings.EqualFold(note.Meta["status"], "published") {
+		return time.Time{}, false
+	}
+	t, err := parseTimestamp(raw)
+	return t, err == nil
+}
+
+// scheduledLater reports whether a note is waiting for its publish time,
+// so exports leave it alone until then.
+func scheduledLater(note *Note, now time.Time) bool {
+	t, ok := publishPending(note)
+	return ok && t.After(now)
+}
+
+// publishDue publishes every queued note whose time has come and returns
+// how many were published.
+func publishDue(config *CONFIG) (int, error) {
+	notes, err := vaultNotes(config, true)
+	if err != nil {
+		return 0, err
+	}
+	now := currentTime()
+	published := 0
+	for _, note := range notes {
+		t, ok := publishPending(note)
+		if !ok || t.After(now) {
+			continue
+		}
+		if err := publishScheduled(config, note); err != nil {
+			log.Printf("Could not publish %s: %v", note.Path, err)
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+// publishScheduled runs a due note through the configured targets and, if
+// they all succeed, marks it published. A note failing its quality gates is
+// an error, so it stays queued and is tried again once it is fixed.
+func publishScheduled(config *CONFIG, note *Note) error {
+	if ok, err := passesGates(config, note); err != nil {
+		return err
+	} else if !ok {
+		return codeErrorf(ErrPublishChecks, "%s failed its publish checks", note.Path)
+	}
+	for _, target := range splitList(config.PublishScheduledTo) {
+		var err error
+		switch strings.ToLower(target) {
+		case "sync":
+			var t NoteType
+			if note.Meta["type"] != "" {
+				t, _ = lookupType(note.Meta["type"])
+			}
+			err = syncNote(config, syncBackends(config), t, note.Path)
+		case "confluence":
+			err = publishConfluence(config, []string{note.Path})
+		case "site":
+			// The site only takes notes tagged publish
+			if !hasTag(note, "publish") {
+				err = fmt.Errorf("%s isn't tagged publish, so the site leaves it out", note.Path)
+			} else {
+				err = publishSite(config, strings.Fields(config.PublishSiteArgs))
+			}
+		default:
+			err = fmt.Errorf("unknown PUBLISH_SCHEDULED_TO target %q", target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	content, err := os.ReadFile(note.Path)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(note.Path, []byte(setFrontmatter(string(content), "status", "published"))); err != nil {
+		return err
+	}
+	fmt.Printf("Published scheduled note %s\n", note.Path)
+	return nil
+}
+
+// runPublishQueue lists the notes waiting to be published, or with "run"
+// publishes the ones that are due now.
+func runPublishQueue(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "run" {
+		n, err := publishDue(config)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Published %d scheduled note(s).\n", n)
+		return nil
+	}
+	notes, err := vaultNotes(config, false)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	var queue []scheduleEvent
+	for _, note := range notes {
+		if t, ok := publishPending(note); ok {
+			queue = append(queue, scheduleEvent{Time: t, Kind: "publish", Note: note})
+		}
+	}
+	sortEvents(queue)
+	printEvents(state, queue)
+	return nil
+}
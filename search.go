@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// searchResult is one matching note, as printed or encoded with --json.
+type searchResult struct {
+	Path    string        `json:"path"`
+	Title   string        `json:"title"`
+	Score   float64       `json:"score"`
+	Matches int           `json:"matches"` // number of matching lines
+	Lines   []matchedLine `json:"lines"`
+}
+
+// matchedLine is a line of a result. Ranges are byte offsets of the matched
+// words within Text; context lines have none.
+type matchedLine struct {
+	Line    int      `json:"line"`
+	Text    string   `json:"text"`
+	Context bool     `json:"context,omitempty"`
+	Ranges  [][2]int `json:"ranges,omitempty"`
+}
+
+const (
+	colorMatch = "\x1b[1;31m"
+	colorPath  = "\x1b[35m"
+	colorReset = "\x1b[0m"
+)
+
+func runSearch(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "reindex" {
+		return runReindex(config, args[1:])
+	}
+
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	after := fs.Int("A", 0, "lines of context after each match")
+	before := fs.Int("B", 0, "lines of context before each match")
+	context := fs.Int("C", 0, "lines of context around each match")
+	asJSON := fs.Bool("json", false, "print results as JSON with match offsets")
+	color := fs.String("color", "auto", "highlight matches: auto, always or never")
+	var mode scanMode
+	fs.BoolVar(&mode.literal, "literal", false, "scan for the exact text instead of using the index")
+	fs.BoolVar(&mode.ignoreCase, "i", false, "scan for the text ignoring case (implies --literal)")
+	fs.BoolVar(&mode.wholeWord, "w", false, "scan for the text as whole words only (implies --literal)")
+	tag := fs.String("tag", "", "only search notes with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return fmt.Errorf("usage: syt search [-A n] [-B n] [-C n] [--json] [--literal] [-i] [-w] [--tag tag] <query> | syt search reindex")
+	}
+	if *context > 0 {
+		*after, *before = max(*after, *context), max(*before, *context)
+	}
+
+	var results []searchResult
+	var err error
+	if mode.literal || mode.ignoreCase || mode.wholeWord {
+		results, err = grepNotes(config, query, mode, *before, *after)
+	} else {
+		results, err = searchNotes(config, query, *before, *after)
+	}
+	if err != nil {
+		return err
+	}
+	if *tag != "" {
+		if results, err = resultsTagged(config, results, *tag); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	printSearchResults(results, useColor(*color, config.Accessible), config.Accessible)
+	return nil
+}
+
+// searchNotes runs query against the vault's search index, best match first.
+func searchNotes(config *CONFIG, query string, before, after int) ([]searchResult, error) {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := updateSearchIndex(config, notes, false)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := map[string]*Note{}
+	for _, note := range notes {
+		byPath[note.Path] = note
+	}
+	scores := idx.lookup(query)
+	terms := map[string]bool{}
+	for _, t := range idx.tokens(query) {
+		terms[t] = true
+	}
+
+	results := []searchResult{}
+	for path, score := range scores {
+		note := byPath[path]
+		if note == nil {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		result := searchResult{Path: path, Title: displayTitle(state, note), Score: score}
+		match := func(line string) [][2]int { return matchRanges(idx, terms, line) }
+		result.Lines, result.Matches = matchLines(splitLines(content), before, after, match)
+		results = append(results, result)
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// resultsTagged keeps the results whose note carries tag.
+func resultsTagged(config *CONFIG, results []searchResult, tag string) ([]searchResult, error) {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return nil, err
+	}
+	tagged := map[string]bool{}
+	for _, note := range notes {
+		tagged[note.Path] = hasTag(note, tag)
+	}
+	kept := results[:0]
+	for _, r := range results {
+		if tagged[r.Path] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// scanMode configures a literal scan of the notes, grep-style, for text the
+// index can't find as such: phrases, punctuation or a word's exact case.
+type scanMode struct {
+	literal    bool
+	ignoreCase bool
+	wholeWord  bool
+}
+
+// grepNotes reads every note looking for query as written. A note scores
+// the number of times it occurs.
+func grepNotes(config *CONFIG, query string, mode scanMode, before, after int) ([]searchResult, error) {
+	pattern := regexp.QuoteMeta(query)
+	if mode.ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	match := func(line string) [][2]int {
+		var ranges [][2]int
+		for _, m := range re.FindAllStringIndex(line, -1) {
+			if !mode.wholeWord || isWordBoundary(line, m[0], m[1]) {
+				ranges = append(ranges, [2]int{m[0], m[1]})
+			}
+		}
+		return ranges
+	}
+
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return nil, err
+	}
+	results := []searchResult{}
+	for _, note := range notes {
+		content, err := os.ReadFile(note.Path)
+		if err != nil {
+			return nil, err
+		}
+		result := searchResult{Path: note.Path, Title: displayTitle(state, note)}
+		result.Lines, result.Matches = matchLines(splitLines(content), before, after, match)
+		if result.Matches == 0 {
+			continue
+		}
+		for _, l := range result.Lines {
+			result.Score += float64(len(l.Ranges))
+		}
+		results = append(results, result)
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// isWordBoundary reports whether line[start:end] is neither preceded nor
+// followed by a letter or digit.
+func isWordBoundary(line string, start, end int) bool {
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	if r, _ := utf8.DecodeLastRuneInString(line[:start]); start > 0 && isWord(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(line[end:]); end < len(line) && isWord(r) {
+		return false
+	}
+	return true
+}
+
+func splitLines(content []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// sortResults orders results best match first, then by path.
+func sortResults(results []searchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+}
+
+// matchLines finds the lines match finds anything in, plus the requested
+// context around them, and returns them with the number of matching lines.
+func matchLines(lines []string, before, after int, match func(string) [][2]int) ([]matchedLine, int) {
+	ranges := make([][][2]int, len(lines))
+	show := make([]bool, len(lines))
+	count := 0
+	for i, line := range lines {
+		ranges[i] = match(line)
+		if len(ranges[i]) == 0 {
+			continue
+		}
+		count++
+		for j := max(0, i-before); j <= min(len(lines)-1, i+after); j++ {
+			show[j] = true
+		}
+	}
+
+	var out []matchedLine
+	for i, line := range lines {
+		if show[i] {
+			out = append(out, matchedLine{Line: i + 1, Text: line, Context: len(ranges[i]) == 0, Ranges: ranges[i]})
+		}
+	}
+	return out, count
+}
+
+// matchRanges returns the byte ranges of the words in line whose index terms
+// are among the query terms.
+func matchRanges(idx *searchIndex, terms map[string]bool, line string) [][2]int {
+	var ranges [][2]int
+	start := -1
+	check := func(end int) {
+		for _, t := range idx.tokens(line[start:end]) {
+			if terms[t] {
+				ranges = append(ranges, [2]int{start, end})
+				break
+			}
+		}
+		start = -1
+	}
+	for i, r := range line {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			check(i)
+		}
+	}
+	if start >= 0 {
+		check(len(line))
+	}
+	return ranges
+}
+
+// useColor resolves a --color setting. "auto" honours NO_COLOR and stays off
+// in accessible mode.
+func useColor(mode string, accessible bool) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return !accessible && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// printSearchResults prints results grep-style: "N:" for matching lines and
+// "N-" for context. Accessible mode spells that out instead.
+func printSearchResults(results []searchResult, color, accessible bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+	for _, r := range results {
+		fmt.Printf("%s  %s (%.2f, %d matching line(s))\n", paint(colorPath, r.Path), r.Title, r.Score, r.Matches)
+		prev := 0
+		for _, l := range r.Lines {
+			if prev > 0 && l.Line > prev+1 && !accessible {
+				fmt.Println("  --")
+			}
+			prev = l.Line
+			if accessible {
+				kind := "match"
+				if l.Context {
+					kind = "context"
+				}
+				fmt.Printf("  %s, line %d: %s\n", kind, l.Line, l.Text)
+				continue
+			}
+			sep := ":"
+			if l.Context {
+				sep = "-"
+			}
+			text, last := "", 0
+			for _, rg := range l.Ranges {
+				text += l.Text[last:rg[0]] + paint(colorMatch, l.Text[rg[0]:rg[1]])
+				last = rg[1]
+			}
+			text += l.Text[last:]
+			fmt.Printf("  %d%s %s\n", l.Line, sep, text)
+		}
+	}
+}
+
+// runReindex rebuilds the search index from scratch, optionally changing the
+// vault's index settings.
+func runReindex(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("search reindex", flag.ContinueOnError)
+	tokenizer := fs.String("tokenizer", "", "tokenizer to index with: word, cjk or ngram")
+	stemmer := fs.String("stem", "", "stem words for a language (en, de, es, fr) or none")
+	stopWords := fs.String("stopwords", "", "drop stop words of a language (en, de, es, fr, ...) or none")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	for _, f := range []struct{ flag, setting *string }{
+		{tokenizer, &config.SearchTokenizer},
+		{stemmer, &config.SearchStemmer},
+		{stopWords, &config.SearchStopWords},
+	} {
+		if *f.flag != "" {
+			*f.setting = *f.flag
+		}
+	}
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	idx, err := updateSearchIndex(config, notes, true)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d note(s), %d term(s) with the %s tokenizer", len(idx.Docs), len(idx.Postings), idx.Tokenizer)
+	if idx.Stemmer != "" {
+		fmt.Printf(", %s stemming", idx.Stemmer)
+	}
+	if idx.StopWords != "" {
+		fmt.Printf(", %s stop words", idx.StopWords)
+	}
+	fmt.Println(".")
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Tokenizers available for the search index. "word" splits on anything that
+// isn't a letter or digit; "cjk" does the same but indexes runs of Chinese,
+// Japanese and Korean characters as overlapping bigrams, since those scripts
+// don't separate words with spaces; "ngram" indexes character trigrams of
+// every word, which lets any substring of three or more characters match.
+var tokenizers = map[string]func(string) []string{
+	"word":  wordTokens,
+	"cjk":   cjkTokens,
+	"ngram": ngramTokens,
+}
+
+// searchIndex is an inverted index of the vault persisted in the state
+// directory. It is brought up to date incrementally before each search.
+type searchIndex struct {
+	indexSettings
+	Docs     map[string]indexedDoc     `json:"docs"`
+	Postings map[string]map[string]int `json:"postings"` // term -> path -> frequency
+}
+
+// indexSettings decide how text is turned into terms. They are stored with
+// the index, so they are a per-vault setting; changing them rebuilds it.
+type indexSettings struct {
+	Tokenizer string `json:"tokenizer"`
+	Stemmer   string `json:"stemmer,omitempty"`   // language code, "" for none
+	StopWords string `json:"stopwords,omitempty"` // language code, "" to keep all words
+}
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type indexedDoc struct {
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	Length  int       `json:"length"` // number of tokens
+}
+
+func searchIndexPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "index.json")
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func wordTokens(text string) []string {
+	return strings.FieldsFunc(foldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func cjkTokens(text string) []string {
+	var tokens []string
+	for _, word := range wordTokens(text) {
+		var run []rune
+		flush := func() {
+			if len(run) == 1 {
+				tokens = append(tokens, string(run))
+			}
+			for i := 0; i+1 < len(run); i++ {
+				tokens = append(tokens, string(run[i:i+2]))
+			}
+			run = run[:0]
+		}
+		start := 0
+		runes := []rune(word)
+		for i, r := range runes {
+			if isCJK(r) {
+				if i > start {
+					tokens = append(tokens, string(runes[start:i]))
+				}
+				run = append(run, r)
+				start = i + 1
+			} else if len(run) > 0 {
+				flush()
+			}
+		}
+		flush()
+		if start < len(runes) {
+			tokens = append(tokens, string(runes[start:]))
+		}
+	}
+	return tokens
+}
+
+func ngramTokens(text string) []string {
+	var tokens []string
+	for _, word := range wordTokens(text) {
+		runes := []rune(word)
+		if len(runes) <= 3 {
+			tokens = append(tokens, word)
+			continue
+		}
+		for i := 0; i+3 <= len(runes); i++ {
+			tokens = append(tokens, string(runes[i:i+3]))
+		}
+	}
+	return tokens
+}
+
+// vaultIndexSettings returns the settings the vault should be indexed with:
+// SEARCH_TOKENIZER, SEARCH_STEMMER and SEARCH_STOPWORDS where set ("none"
+// turns stemming or stop words off), otherwise whatever the existing index was
+// built with.
+func vaultIndexSettings(config *CONFIG, idx *searchIndex) (indexSettings, error) {
+	var s indexSettings
+	if idx != nil {
+		s = idx.indexSettings
+	}
+	pick := func(current *string, configured string) {
+		if configured == "none" {
+			*current = ""
+		} else if configured != "" {
+			*current = configured
+		}
+	}
+	pick(&s.Tokenizer, config.SearchTokenizer)
+	pick(&s.Stemmer, config.SearchStemmer)
+	pick(&s.StopWords, config.SearchStopWords)
+	if s.Tokenizer == "" {
+		s.Tokenizer = "cjk"
+	}
+
+	if _, ok := tokenizers[s.Tokenizer]; !ok {
+		return s, fmt.Errorf("unknown tokenizer %q (want word, cjk or ngram)", s.Tokenizer)
+	}
+	if _, ok := stemmers[s.Stemmer]; s.Stemmer != "" && !ok {
+		return s, fmt.Errorf("no stemmer for language %q", s.Stemmer)
+	}
+	if _, ok := searchStopWords[s.StopWords]; s.StopWords != "" && !ok {
+		return s, fmt.Errorf("no stop words for language %q", s.StopWords)
+	}
+	return s, nil
+}
+
+func loadSearchIndex(config *CONFIG) (*searchIndex, error) {
+	data, err := os.ReadFile(searchIndexPath(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx := &searchIndex{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		// A corrupt index is just rebuilt
+		return nil, nil
+	}
+	return idx, nil
+}
+
+// updateSearchIndex loads the index, reindexes notes that were added, changed
+// or removed since it was written, and saves it. Changing the index settings
+// throws the old index away; rebuild forces that too.
+func updateSearchIndex(config *CONFIG, notes []*Note, rebuild bool) (*searchIndex, error) {
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return nil, err
+	}
+	unlock, err := acquireLock(searchIndexPath(config) + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	idx, err := loadSearchIndex(config)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := vaultIndexSettings(config, idx)
+	if err != nil {
+		return nil, err
+	}
+	if rebuild || idx == nil || idx.indexSettings != settings {
+		idx = &searchIndex{indexSettings: settings, Docs: map[string]indexedDoc{}, Postings: map[string]map[string]int{}}
+	}
+
+	changed := false
+	seen := map[string]bool{}
+	for _, note := range notes {
+		seen[note.Path] = true
+		doc, ok := idx.Docs[note.Path]
+		if ok && doc.ModTime.Equal(note.ModTime) && doc.Size == note.Size {
+			continue
+		}
+		idx.remove(note.Path)
+		idx.add(note)
+		changed = true
+	}
+	for path := range idx.Docs {
+		if !seen[path] {
+			idx.remove(path)
+			changed = true
+		}
+	}
+	if !changed {
+		return idx, nil
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return nil, err
+	}
+	return idx, writeFileAtomic(searchIndexPath(config), data)
+}
+
+// tokens turns text into index terms: tokenized, without stop words and
+// stemmed, as configured.
+func (idx *searchIndex) tokens(text string) []string {
+	tokens := tokenizers[idx.Tokenizer](text)
+	stop := searchStopWords[idx.StopWords]
+	stem := stemmers[idx.Stemmer]
+	terms := tokens[:0]
+	for _, t := range tokens {
+		if stop[t] {
+			continue
+		}
+		if stem != nil {
+			t = stem(t)
+		}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+func (idx *searchIndex) add(note *Note) {
+	tokens := idx.tokens(note.Title + "\n" + strings.Join(noteTags(note), " ") + "\n" + note.Body)
+	for _, t := range tokens {
+		if idx.Postings[t] == nil {
+			idx.Postings[t] = map[string]int{}
+		}
+		idx.Postings[t][note.Path]++
+	}
+	idx.Docs[note.Path] = indexedDoc{ModTime: note.ModTime, Size: note.Size, Length: len(tokens)}
+}
+
+func (idx *searchIndex) remove(path string) {
+	if _, ok := idx.Docs[path]; !ok {
+		return
+	}
+	for term, docs := range idx.Postings {
+		delete(docs, path)
+		if len(docs) == 0 {
+			delete(idx.Postings, term)
+		}
+	}
+	delete(idx.Docs, path)
+}
+
+// lookup returns the paths containing every term of the query with their
+// BM25 relevance scores.
+func (idx *searchIndex) lookup(query string) map[string]float64 {
+	terms := dedupe(idx.tokens(query))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	matches := map[string]float64{}
+	for path := range idx.Postings[terms[0]] {
+		matches[path] = 0
+	}
+	for _, term := range terms[1:] {
+		for path := range matches {
+			if _, ok := idx.Postings[term][path]; !ok {
+				delete(matches, path)
+			}
+		}
+	}
+
+	n := float64(len(idx.Docs))
+	avgLen := 0.0
+	for _, doc := range idx.Docs {
+		avgLen += float64(doc.Length)
+	}
+	if n > 0 {
+		avgLen /= n
+	}
+	for _, term := range terms {
+		docs := idx.Postings[term]
+		idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+		for path := range matches {
+			tf := float64(docs[path])
+			norm := 1 - bm25B + bm25B*float64(idx.Docs[path].Length)/avgLen
+			matches[path] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// server is `syt serve`: a small HTTP API over the vault plus a web UI.
+// Every API request needs a bearer token (see tokens.go) whose scope covers
+// the endpoint.
+type server struct {
+	config  *CONFIG
+	limiter rateLimiter
+	proxies []netip.Prefix // peers whose X-Forwarded-* headers are believed
+	watcher *vaultWatcher
+	// basePath is the URL prefix we're mounted under, "" or e.g. "/syt"
+	basePath string
+}
+
+// runServe starts the HTTP server, or manages its tokens with
+// `syt serve token ...`.
+func runServe(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "token" {
+		return runToken(config, args[1:])
+	}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", config.ServeAddr, "address to listen on")
+	certFile := fs.String("tls-cert", config.ServeTLSCert, "TLS certificate file")
+	keyFile := fs.String("tls-key", config.ServeTLSKey, "TLS key file")
+	basePath := fs.String("base-path", config.ServeBasePath, "URL prefix to serve under, e.g. /syt")
+	insecure := fs.Bool("insecure", false, "allow plain HTTP on a non-loopback address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key go together")
+	}
+	proxies, err := parseProxies(config.ServeProxies)
+	if err != nil {
+		return err
+	}
+	// Tokens travel in every request, so off this machine they need TLS,
+	// either here or at a trusted proxy in front
+	if *certFile == "" && len(proxies) == 0 && !*insecure && !loopbackAddr(*addr) {
+		return fmt.Errorf("refusing to serve plain HTTP on %s; set SERVE_TLS_CERT/SERVE_TLS_KEY, SERVE_TRUSTED_PROXIES or pass --insecure", *addr)
+	}
+	tokens, err := loadTokens(config)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens yet; create one with `syt serve token add <name>`.")
+	}
+
+	enableNoteCache()
+	watcher, err := newVaultWatcher(config)
+	if err != nil {
+		return err
+	}
+	s := &server{config: config, proxies: proxies, watcher: watcher, basePath: strings.TrimSuffix("/"+strings.Trim(*basePath, "/"), "/")}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.withProxy(withBasePath(*basePath, s.routes())),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	// Stop cleanly on Ctrl-C or SIGTERM, so syt seals an encrypted vault
+	// before it exits
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	if config.VaultContainer != "" {
+		go sealPeriodically(config)
+	}
+
+	prefix := strings.TrimSuffix(*basePath, "/") + "/"
+	if *certFile == "" {
+		log.Printf("Serving %s on http://%s%s", config.NotesDir, *addr, prefix)
+		err = srv.ListenAndServe()
+	} else {
+		certs, certErr := newCertReloader(*certFile, *keyFile)
+		if certErr != nil {
+			return certErr
+		}
+		srv.TLSConfig = certs.tlsConfig()
+		log.Printf("Serving %s on https://%s%s", config.NotesDir, *addr, prefix)
+		err = srv.ListenAndServeTLS("", "")
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /{file}", s.handleWebFile)
+	mux.Handle("GET /api/notes", s.authorize(scopeRead, s.handleList))
+	mux.Handle("GET /api/notes/{path...}", s.authorize(scopeRead, s.handleGet))
+	mux.Handle("PUT /api/notes/{path...}", s.authorize(scopeFull, s.handlePut))
+	mux.Handle("DELETE /api/notes/{path...}", s.authorize(scopeFull, s.handleDelete))
+	mux.Handle("GET /api/search", s.authorize(scopeRead, s.handleSearch))
+	mux.Handle("POST /api/capture", s.authorize(scopeCapture, s.handleCapture))
+	mux.Handle("GET /api/events", s.authorize(scopeRead, s.handleEvents))
+	mux.HandleFunc("GET /share/{token}", s.handleShare)
+	mux.HandleFunc("/.well-known/caldav", s.handleDAVWellKnown)
+	mux.HandleFunc("OPTIONS /dav/", s.handleDAVOptions)
+	mux.Handle("PROPFIND /dav/", s.authorize(scopeRead, s.handlePropfind))
+	mux.Handle("REPORT /dav/", s.authorize(scopeRead, s.handleReport))
+	mux.Handle("GET /dav/", s.authorize(scopeRead, s.handleDAVGet))
+	mux.Handle("PUT /dav/", s.authorize(scopeFull, s.handleDAVPut))
+	return mux
+}
+
+// authorize wraps an endpoint with token authentication, the scope check
+// and the token's rate limit. Tokens are reloaded on every request so adding,
+// rotating or revoking one takes effect without a restart. Browsers can't set
+// headers on an EventSource, so event streams may pass the token as
+// ?access_token= instead, and CalDAV clients only do basic auth, so the
+// password of a basic login is taken as a token too.
+func (s *server) authorize(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.Header.Get("Accept") == "text/event-stream" {
+			secret = r.URL.Query().Get("access_token")
+			ok = secret != ""
+		}
+		if !ok {
+			_, secret, ok = r.BasicAuth()
+		}
+		if !ok {
+			// Only ask CalDAV clients for basic auth: browsers would pop
+			// up a login dialog over the web UI
+			if strings.HasPrefix(r.URL.Path, "/dav/") {
+				w.Header().Set("WWW-Authenticate", `Basic realm="syt"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="syt"`)
+			}
+			httpError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		tokens, err := loadTokens(s.config)
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		now := currentTime()
+		token := matchToken(tokens, strings.TrimSpace(secret), now)
+		switch {
+		case token == nil:
+			log.Printf("rejected token from %s", clientIP(r))
+			httpError(w, http.StatusUnauthorized, "invalid token")
+		case !token.allows(scope):
+			httpError(w, http.StatusForbidden, fmt.Sprintf("token %q has %s scope; this needs %s", token.Name, token.Scope, scope))
+		case !s.limiter.allow(token, now):
+			w.Header().Set("Retry-After", "1")
+			httpError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		default:
+			next(w, r)
+		}
+	})
+}
+
+// withBasePath mounts h under prefix, for running behind a proxy that
+// forwards e.g. https://example.com/syt/ to us.
+func withBasePath(prefix string, h http.Handler) http.Handler {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return h
+	}
+	mux := http.NewServeMux()
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, h))
+	mux.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+	return mux
+}
+
+// withProxy applies the X-Forwarded-For and X-Forwarded-Proto headers of
+// requests that come from SERVE_TRUSTED_PROXIES, so logs show the real
+// client and HSTS is sent when the proxy terminates TLS. Anyone else's
+// forwarding headers are dropped.
+func (s *server) withProxy(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.trusted(r.RemoteAddr) {
+			if hops := strings.Split(r.Header.Get("X-Forwarded-For"), ","); hops[0] != "" {
+				// The nearest hop that isn't one of our proxies is the client
+				for i := len(hops) - 1; i >= 0; i-- {
+					hop := strings.TrimSpace(hops[i])
+					if _, err := netip.ParseAddr(hop); err != nil {
+						break
+					}
+					r.RemoteAddr = net.JoinHostPort(hop, "0")
+					if !s.trusted(r.RemoteAddr) {
+						break
+					}
+				}
+			}
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto == "https" && r.TLS == nil {
+				r.URL.Scheme = "https"
+			}
+		} else {
+			r.Header.Del("X-Forwarded-For")
+			r.Header.Del("X-Forwarded-Proto")
+		}
+		if r.TLS != nil || r.URL.Scheme == "https" {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) trusted(remoteAddr string) bool {
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, p := range s.proxies {
+		if p.Contains(addr.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxies reads a comma separated list of addresses and CIDR ranges.
+func parseProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", item)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// webFiles are the web UI's files below assets/web, with their types.
+var webFiles = map[string]string{
+	"index.html":           "text/html; charset=utf-8",
+	"sw.js":                "text/javascript; charset=utf-8",
+	"manifest.webmanifest": "application/manifest+json",
+	"icon.svg":             "image/svg+xml",
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	s.serveWebFile(w, "index.html")
+}
+
+func (s *server) handleWebFile(w http.ResponseWriter, r *http.Request) {
+	s.serveWebFile(w, r.PathValue("file"))
+}
+
+// serveWebFile serves part of the web UI. The service worker does its own
+// caching, so browsers are told to revalidate everything.
+func (s *server) serveWebFile(w http.ResponseWriter, name string) {
+	contentType, ok := webFiles[name]
+	if !ok {
+		httpError(w, http.StatusNotFound, "not found")
+		return
+	}
+	data, err := readAsset(s.config, "web/"+name)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	notes, err := vaultNotes(s.config, false)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	list := make([]*Note, 0, len(notes))
+	for _, note := range notes {
+		n := note.copy()
+		n.Path, n.Body = visitKey(s.config, note.Path), ""
+		list = append(list, n)
+	}
+	writeJSON(w, list)
+}
+
+func (s *server) handleGet(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.notePath(w, r)
+	if !ok {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		httpError(w, http.StatusNotFound, "no such note")
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write(content)
+}
+
+// handlePut creates or replaces a note. Like every other edit it is recorded
+// so `syt undo` can revert it.
+func (s *server) handlePut(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.notePath(w, r)
+	if !ok {
+		return
+	}
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	op := beginOperation(s.config, "serve PUT "+visitKey(s.config, path))
+	err = op.saveBefore(path)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(path, content)
+	}
+	if err == nil {
+		err = op.commit()
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.watcher.poll()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.notePath(w, r)
+	if !ok {
+		return
+	}
+	if !fileExists(path) {
+		httpError(w, http.StatusNotFound, "no such note")
+		return
+	}
+	op := beginOperation(s.config, "serve DELETE "+visitKey(s.config, path))
+	err := trashNote(s.config, op, path)
+	if err == nil {
+		err = op.commit()
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.watcher.poll()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		httpError(w, http.StatusBadRequest, "missing q")
+		return
+	}
+	results, err := searchNotes(s.config, query, 0, 0)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range results {
+		results[i].Path = visitKey(s.config, results[i].Path)
+	}
+	writeJSON(w, results)
+}
+
+// handleCapture appends the request body (plain text, or JSON with a "text"
+// field) to today's journal note, like `syt add`. JSON captures may carry the
+// time they were written, so entries queued by an offline client land in the
+// right day's note at the right time. With ?type=scan it takes a scanned
+// document instead; see handleScan.
+func (s *server) handleCapture(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("type") == "scan" {
+		s.handleScan(w, r)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	text, at := string(body), currentTime()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			Text string    `json:"text"`
+			Time time.Time `json:"time"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		text = req.Text
+		if !req.Time.IsZero() {
+			at = req.Time.In(time.Local)
+		}
+	}
+	path, err := addEntry(s.config, at, text)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.watcher.poll()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]string{"path": visitKey(s.config, path)})
+}
+
+// notePath maps the {path} in a request to a note in the vault, rejecting
+// anything that isn't a markdown file inside it or that sits in a hidden
+// directory such as .git or .syt.
+func (s *server) notePath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	rel, err := noteRelPath(r.PathValue("path"))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return filepath.Join(s.config.NotesDir, rel), true
+}
+
+func noteRelPath(p string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(p))
+	if !filepath.IsLocal(rel) || filepath.Ext(rel) != ".md" {
+		return "", errors.New("not a note path")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", errors.New("not a note path")
+		}
+	}
+	return rel, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
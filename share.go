@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Share is a read-only link to one note, served by `syt serve` at
+// /share/<token>. The token carries the share's ID and expiry, signed with
+// the vault's share key, and the share must still be listed in shares.json,
+// so deleting the entry (or the key) revokes it.
+type Share struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"` // relative to the notes directory
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func sharesPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "shares.json")
+}
+
+func shareKeyPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "share.key")
+}
+
+func loadShares(config *CONFIG) ([]*Share, error) {
+	data, err := os.ReadFile(sharesPath(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var shares []*Share
+	if err := json.Unmarshal(data, &shares); err != nil {
+		return nil, fmt.Errorf("corrupt share file %s: %w", sharesPath(config), err)
+	}
+	return shares, nil
+}
+
+// updateShares applies fn to the share list under its lock, dropping shares
+// that have expired along the way.
+func updateShares(config *CONFIG, fn func([]*Share) ([]*Share, error)) error {
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLock(sharesPath(config) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	shares, err := loadShares(config)
+	if err != nil {
+		return err
+	}
+	live := shares[:0]
+	for _, s := range shares {
+		if currentTime().Before(s.Expires) {
+			live = append(live, s)
+		}
+	}
+	if shares, err = fn(live); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(shares, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sharesPath(config), data)
+}
+
+// shareKey returns the vault's signing key, creating it on first use.
+func shareKey(config *CONFIG) ([]byte, error) {
+	data, err := os.ReadFile(shareKeyPath(config))
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(shareKeyPath(config), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return shareKey(config) // someone else just made it
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
+
+func signShare(key []byte, s *Share) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", s.ID, s.Path, s.Expires.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func shareToken(key []byte, s *Share) string {
+	return s.ID + "." + strconv.FormatInt(s.Expires.Unix(), 10) + "." + signShare(key, s)
+}
+
+// verifyShare finds the live share a token refers to, checking its signature
+// and expiry.
+func verifyShare(config *CONFIG, token string, now time.Time) (*Share, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed share link")
+	}
+	shares, err := loadShares(config)
+	if err != nil {
+		return nil, err
+	}
+	key, err := shareKey(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range shares {
+		if s.ID != parts[0] {
+			continue
+		}
+		if parts[1] != strconv.FormatInt(s.Expires.Unix(), 10) || !hmac.Equal([]byte(parts[2]), []byte(signShare(key, s))) {
+			break
+		}
+		if !now.Before(s.Expires) {
+			return nil, fmt.Errorf("share link expired")
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("share link revoked or invalid")
+}
+
+// shareURL is where a share can be opened: SERVE_PUBLIC_URL when the server
+// sits behind a proxy or a public name, else the local listen address.
+func shareURL(config *CONFIG, token string) string {
+	base := config.ServePublicURL
+	if base == "" {
+		scheme := "http"
+		if config.ServeTLSCert != "" {
+			scheme = "https"
+		}
+		base = scheme + "://" + config.ServeAddr + "/" + strings.Trim(config.ServeBasePath, "/")
+	}
+	return strings.TrimSuffix(base, "/") + "/share/" + url.PathEscape(token)
+}
+
+// runShare creates, lists and revokes share links.
+func runShare(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "link":
+		fs := flag.NewFlagSet("share link", flag.ContinueOnError)
+		expires := fs.String("expires", "7d", "how long the link works, e.g. 12h or 30d")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: syt share link [--expires 7d] <note>")
+		}
+		ttl, err := parseRetention(*expires)
+		if err != nil || ttl == 0 {
+			return fmt.Errorf("invalid expiry %q", *expires)
+		}
+		path, err := resolveNote(config, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		key, err := shareKey(config)
+		if err != nil {
+			return err
+		}
+		now := currentTime()
+		share := &Share{ID: newID(), Path: visitKey(config, path), Created: now, Expires: now.Add(ttl).Truncate(time.Second)}
+		if err := updateShares(config, func(shares []*Share) ([]*Share, error) {
+			return append(shares, share), nil
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Shared %s until %s:\n%s\n", share.Path, share.Expires.Format("2006-01-02 15:04"), shareURL(config, shareToken(key, share)))
+		return nil
+
+	case "list":
+		shares, err := loadShares(config)
+		if err != nil {
+			return err
+		}
+		sort.Slice(shares, func(i, j int) bool { return shares[i].Created.Before(shares[j].Created) })
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNOTE\tEXPIRES")
+		for _, s := range shares {
+			if currentTime().Before(s.Expires) {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", s.ID, s.Path, s.Expires.Format("2006-01-02 15:04"))
+			}
+		}
+		return w.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: syt share revoke <id | note>")
+		}
+		// A note revokes every link to it
+		target := args[1]
+		if path, err := resolveNote(config, target); err == nil {
+			target = visitKey(config, path)
+		}
+		return updateShares(config, func(shares []*Share) ([]*Share, error) {
+			var kept []*Share
+			for _, s := range shares {
+				if s.ID != target && s.Path != target {
+					kept = append(kept, s)
+				}
+			}
+			if len(kept) == len(shares) {
+				return nil, fmt.Errorf("no share link matches %q", args[1])
+			}
+			fmt.Printf("Revoked %d share link(s).\n", len(shares)-len(kept))
+			return kept, nil
+		})
+	}
+	return fmt.Errorf("usage: syt share [link [--expires 7d] <note> | list | revoke <id | note>]")
+}
+
+// handleShare renders a shared note as a standalone read-only page. Pages
+// are locked down with a CSP that allows no scripts, so a shared note can't
+// reach the API tokens the web UI keeps for this origin.
+func (s *server) handleShare(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src * data:; style-src 'unsafe-inline'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	share, err := verifyShare(s.config, r.PathValue("token"), currentTime())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	note, err := readNote(filepath.Join(s.config.NotesDir, filepath.FromSlash(share.Path)))
+	if err != nil {
+		http.Error(w, "shared note no longer exists", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>body { font: 16px/1.6 system-ui, sans-serif; max-width: 45rem; margin: 2rem auto; padding: 0 1rem; }
+pre { background: #8881; padding: 1rem; overflow-x: auto; } img { max-width: 100%%; }</style>
+</head><body>
+%s
+</body></html>
+`, html.EscapeString(note.Title), markdownToHTML(withoutComments(note.Body)))
+}
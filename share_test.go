@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyShare(t *testing.T) {
+	config := &CONFIG{NotesDir: t.TempDir()}
+	now := time.Now()
+	share := &Share{ID: "abc123", Path: "ideas.md", Created: now, Expires: now.Add(time.Hour)}
+	err := updateShares(config, func(shares []*Share) ([]*Share, error) {
+		return append(shares, share, &Share{ID: "def456", Path: "other.md", Created: now, Expires: now.Add(time.Hour)}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := shareKey(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := shareToken(key, share)
+
+	if s, err := verifyShare(config, token, now); err != nil || s.Path != "ideas.md" {
+		t.Fatalf("verifyShare = %v, %v", s, err)
+	}
+	if _, err := verifyShare(config, token, now.Add(2*time.Hour)); err == nil {
+		t.Error("an expired link opened")
+	}
+
+	id, rest, _ := strings.Cut(token, ".")
+	expiry, sig, _ := strings.Cut(rest, ".")
+	longer := strings.Join([]string{id, "9999999999", sig}, ".")
+	other := strings.Join([]string{"def456", expiry, sig}, ".")
+	forged := strings.Join([]string{id, expiry, sig[:len(sig)-2] + "AA"}, ".")
+	for name, token := range map[string]string{"extended": longer, "for another note": other, "forged": forged, "malformed": id} {
+		if _, err := verifyShare(config, token, now); err == nil {
+			t.Errorf("a %s link opened", name)
+		}
+	}
+
+	// A new key revokes every link signed with the old one
+	if err := os.Remove(shareKeyPath(config)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyShare(config, token, now); err == nil {
+		t.Error("a link signed with the old key opened")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// siteEngine describes how a static site generator wants its content.
+type siteEngine struct {
+	content string // default content directory, relative to the site root
+	static  string // where images go, relative to the site root
+	urlBase string // URL prefix the static directory is served under
+	// fileName returns a note's file name in the content directory
+	fileName func(slug string, note *Note) string
+	// frontmatter renders the header for a published note
+	frontmatter func(note *Note, tags []string) string
+	// link is how one published note refers to another
+	link func(slug string, note *Note) string
+}
+
+var siteEngines = map[string]siteEngine{
+	"hugo": {
+		content: "content/notes",
+		static:  "static/images",
+		urlBase: "/images/",
+		fileName: func(slug string, note *Note) string {
+			return slug + ".md"
+		},
+		frontmatter: func(note *Note, tags []string) string {
+			return fmt.Sprintf("---\ntitle: %s\ndate: %s\ndraft: false\ntags: [%s]\n---\n",
+				yamlQuote(noteTitle(note)), noteDate(note).Format("2006-01-02T15:04:05Z07:00"), quoteList(tags))
+		},
+		link: func(slug string, note *Note) string {
+			return `{{< relref "` + slug + `.md" >}}`
+		},
+	},
+	"jekyll": {
+		content: "_posts",
+		static:  "assets/images",
+		urlBase: "/assets/images/",
+		fileName: func(slug string, note *Note) string {
+			return noteDate(note).Format("2006-01-02") + "-" + slug + ".md"
+		},
+		frontmatter: func(note *Note, tags []string) string {
+			return fmt.Sprintf("---\nlayout: post\ntitle: %s\ndate: %s\ntags: [%s]\n---\n",
+				yamlQuote(noteTitle(note)), noteDate(note).Format("2006-01-02 15:04:05 -0700"), quoteList(tags))
+		},
+		link: func(slug string, note *Note) string {
+			return "{% post_url " + noteDate(note).Format("2006-01-02") + "-" + slug + " %}"
+		},
+	},
+}
+
+func yamlQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = yamlQuote(item)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+var nonSlug = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify turns a title into a lowercase, dash-separated file name.
+func slugify(title string) string {
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(foldText(title)), "-"), "-")
+	if slug == "" {
+		slug = "note"
+	}
+	return slug
+}
+
+// mdLinkTarget matches markdown links and images with their targets.
+var mdLinkTarget = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// publishSite copies notes tagged publish into a Hugo or Jekyll site,
+// adapting their frontmatter, pointing links between published notes at
+// their site URLs and copying local images into the site's static files.
+func publishSite(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("publish site", flag.ContinueOnError)
+	engineName := fs.String("engine", "hugo", "static site generator: hugo or jekyll")
+	root := fs.String("site", ".", "root of the site repository")
+	out := fs.String("out", "", "content directory, relative to the site root (default content/notes or _posts)")
+	commit := fs.Bool("commit", false, "commit the published files in the site repository")
+	fs.BoolVar(&config.Force, "force", false, "publish notes even if they fail their checks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	engine, ok := siteEngines[*engineName]
+	if !ok {
+		return fmt.Errorf("unknown site engine %q (want hugo or jekyll)", *engineName)
+	}
+	contentDir := engine.content
+	if *out != "" {
+		contentDir = *out
+	}
+
+	notes, err := vaultNotes(config, true)
+	if err != nil {
+		return err
+	}
+	var published []*Note
+	for _, note := range notes {
+		if !hasTag(note, "publish") || scheduledLater(note, currentTime()) {
+			continue
+		}
+		if ok, err := passesGates(config, note); err != nil {
+			return err
+		} else if ok {
+			published = append(published, note)
+		}
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].Path < published[j].Path })
+
+	// Work out every note's slug first so links between them can be rewritten
+	slugs := map[string]string{}
+	byPath := map[string]*Note{}
+	taken := map[string]bool{}
+	for _, note := range published {
+		slug := slugify(noteTitle(note))
+		for i := 2; taken[slug]; i++ {
+			slug = fmt.Sprintf("%s-%d", slugify(noteTitle(note)), i)
+		}
+		taken[slug] = true
+		slugs[filepath.Clean(note.Path)] = slug
+		byPath[filepath.Clean(note.Path)] = note
+	}
+
+	dest := filepath.Join(*root, contentDir)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	var written []string
+	for _, note := range published {
+		body, images, err := rewriteForSite(note, slugs, byPath, engine)
+		if err != nil {
+			return err
+		}
+		for src, name := range images {
+			target := filepath.Join(*root, engine.static, name)
+			if err := copyFile(src, target); err != nil {
+				return fmt.Errorf("copying image %s: %w", src, err)
+			}
+			written = append(written, target)
+		}
+		var tags []string
+		for _, tag := range noteTags(note) {
+			if !strings.EqualFold(tag, "publish") {
+				tags = append(tags, tag)
+			}
+		}
+		path := filepath.Join(dest, engine.fileName(slugs[filepath.Clean(note.Path)], note))
+		if err := writeFileAtomic(path, []byte(engine.frontmatter(note, tags)+body)); err != nil {
+			return err
+		}
+		written = append(written, path)
+		fmt.Printf("Published %s -> %s\n", note.Path, path)
+	}
+	if len(published) == 0 {
+		fmt.Println("No notes tagged publish.")
+		return nil
+	}
+
+	if *commit {
+		rel := make([]string, 0, len(written))
+		for _, path := range written {
+			r, err := filepath.Rel(*root, path)
+			if err != nil {
+				return err
+			}
+			rel = append(rel, r)
+		}
+		if _, err := gitOutput(*root, append([]string{"add", "--"}, rel...)...); err != nil {
+			return err
+		}
+		if err := exec.Command("git", "-C", *root, "diff", "--cached", "--quiet").Run(); err == nil {
+			fmt.Println("Site already up to date.")
+			return nil
+		}
+		if _, err := gitOutput(*root, "commit", "-m", fmt.Sprintf("Publish %d note(s) from syt", len(published))); err != nil {
+			return err
+		}
+		fmt.Println("Committed to the site repository.")
+	}
+	return nil
+}
+
+// rewriteForSite adapts a note body for the site: links to other published
+// notes point at their pages, links to unpublished notes become plain text,
+// and local images are renamed into the static directory. It returns the
+// body and the images to copy, by source path.
+func rewriteForSite(note *Note, slugs map[string]string, byPath map[string]*Note, engine siteEngine) (string, map[string]string, error) {
+	images := map[string]string{}
+	dir := filepath.Dir(note.Path)
+	body := mdLinkTarget.ReplaceAllStringFunc(withoutComments(note.Body), func(m string) string {
+		parts := mdLinkTarget.FindStringSubmatch(m)
+		bang, text, target := parts[1], parts[2], parts[3]
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "mailto:") {
+			return m
+		}
+		local := filepath.Clean(filepath.Join(dir, filepath.FromSlash(target)))
+		if bang != "" {
+			if !fileExists(local) {
+				return m
+			}
+			name := slugs[filepath.Clean(note.Path)] + "-" + filepath.Base(local)
+			images[local] = name
+			return fmt.Sprintf("![%s](%s%s)", text, engine.urlBase, name)
+		}
+		path, anchor, _ := strings.Cut(local, "#")
+		if slug, ok := slugs[path]; ok {
+			url := engine.link(slug, byPath[path])
+			if anchor != "" {
+				url += "#" + anchor
+			}
+			return fmt.Sprintf("[%s](%s)", text, url)
+		}
+		if filepath.Ext(path) == ".md" {
+			return text // an unpublished note would be a broken link
+		}
+		return m
+	})
+	return body, images, nil
+}
+
+func copyFile(src, dest string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(dest, data)
+}
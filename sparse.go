@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runClone clones a shared vault into NOTES_DIR. With notebooks given by
+// --sparse or SPARSE_PATHS only those directories (and the files at the top
+// of the vault) are checked out, and the notes outside them aren't even
+// downloaded, which keeps huge team vaults manageable. Everything that reads
+// notes from disk (list, search and its index) then sees just that subset.
+// --depth and --filter trim years of history from the clone when only the
+// current notes are needed on a new machine.
+func runClone(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("clone", flag.ContinueOnError)
+	sparse := fs.String("sparse", config.SparsePaths, "comma separated notebooks (directories) to check out")
+	depth := fs.Int("depth", 0, "fetch only the last n commits (0 for the full history)")
+	filter := fs.String("filter", "", "partial clone filter, e.g. blob:none to fetch old note versions on demand")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *depth < 0 {
+		return fmt.Errorf("usage: syt clone [--sparse dir,...] [--depth n] [--filter spec] <url>")
+	}
+	if entries, err := os.ReadDir(config.NotesDir); err == nil && len(entries) > 0 {
+		return codeErrorf(ErrConfigInvalid, "%s already exists and isn't empty", config.NotesDir)
+	}
+	paths, err := sparsePaths(splitList(*sparse))
+	if err != nil {
+		return err
+	}
+
+	cloneArgs := []string{"clone"}
+	if *depth > 0 {
+		cloneArgs = append(cloneArgs, "--depth", strconv.Itoa(*depth))
+	}
+	if *filter == "" && len(paths) > 0 {
+		*filter = "blob:none"
+	}
+	if *filter != "" {
+		cloneArgs = append(cloneArgs, "--filter="+*filter)
+	}
+	if len(paths) > 0 {
+		cloneArgs = append(cloneArgs, "--sparse")
+	}
+	if err := runCmd("git", append(cloneArgs, fs.Arg(0), config.NotesDir)...); err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	if len(paths) > 0 {
+		if err := gitIn(config.NotesDir, append([]string{"sparse-checkout", "set", "--cone"}, paths...)...); err != nil {
+			return withCode(ErrGitFailed, err)
+		}
+	}
+	return reportCheckout(config)
+}
+
+// runSparse shows or changes which notebooks of a sparse vault are checked
+// out.
+func runSparse(config *CONFIG, args []string) error {
+	sub := "list"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	switch {
+	case sub == "list" && len(args) == 0:
+		if !isSparse(config.NotesDir) {
+			fmt.Println("The whole vault is checked out.")
+			return nil
+		}
+		return withCode(ErrGitFailed, gitIn(config.NotesDir, "sparse-checkout", "list"))
+	case (sub == "set" || sub == "add") && len(args) > 0:
+		paths, err := sparsePaths(args)
+		if err != nil {
+			return err
+		}
+		gitArgs := append([]string{"sparse-checkout", sub}, paths...)
+		if sub == "set" || !isSparse(config.NotesDir) {
+			gitArgs = append([]string{"sparse-checkout", "set", "--cone"}, paths...)
+		}
+		if err := gitIn(config.NotesDir, gitArgs...); err != nil {
+			return withCode(ErrGitFailed, err)
+		}
+	case sub == "disable" && len(args) == 0:
+		if err := gitIn(config.NotesDir, "sparse-checkout", "disable"); err != nil {
+			return withCode(ErrGitFailed, err)
+		}
+	default:
+		return fmt.Errorf("usage: syt sparse [list | set <dir>... | add <dir>... | disable]")
+	}
+	return reportCheckout(config)
+}
+
+// sparsePaths checks that notebooks are directories inside the vault and
+// puts them in the form git's cone mode wants.
+func sparsePaths(dirs []string) ([]string, error) {
+	var paths []string
+	for _, dir := range dirs {
+		p := filepath.ToSlash(filepath.Clean(strings.Trim(dir, "/")))
+		if !filepath.IsLocal(p) || p == "." {
+			return nil, codeErrorf(ErrUsage, "%q is not a notebook inside the vault", dir)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+func isSparse(dir string) bool {
+	out, err := gitOutput(dir, "config", "--bool", "core.sparseCheckout")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// reportCheckout brings the search index in line with what is checked out
+// now and says how many notes that is.
+func reportCheckout(config *CONFIG) error {
+	notes, err := scanNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	if _, err := updateSearchIndex(config, notes, false); err != nil {
+		return err
+	}
+	fmt.Printf("%d note(s) checked out in %s.\n", len(notes), config.NotesDir)
+	return nil
+}
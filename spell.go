@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// dictionaries maps short language codes to hunspell dictionary names.
+var dictionaries = map[string]string{
+	"en": "en_US",
+	"de": "de_DE",
+	"es": "es_ES",
+	"fr": "fr_FR",
+	"it": "it_IT",
+	"nl": "nl_NL",
+	"pt": "pt_PT",
+}
+
+// Misspelling is a word hunspell did not recognise.
+type Misspelling struct {
+	Line        int
+	Column      int
+	Word        string
+	Suggestions []string
+}
+
+func runSpell(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("spell", flag.ContinueOnError)
+	interactive := fs.Bool("i", false, "interactively fix misspellings")
+	lang := fs.String("lang", "", "override the note's language (e.g. en, de_DE or en,de)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt spell [-i] [--lang code] <note>")
+	}
+
+	path, err := resolveNote(config, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	note, err := readNote(path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	language := *lang
+	if language == "" {
+		language = noteLanguage(config, note)
+	}
+	lines := strings.Split(string(content), "\n")
+	misspellings, err := spellcheck(lines, language)
+	if err != nil {
+		return err
+	}
+
+	if !*interactive {
+		for _, m := range misspellings {
+			fmt.Printf("%s:%d:%d: %s", path, m.Line, m.Column, m.Word)
+			if len(m.Suggestions) > 0 {
+				fmt.Printf(" (%s)", strings.Join(m.Suggestions, ", "))
+			}
+			fmt.Println()
+		}
+		if len(misspellings) > 0 {
+			return fmt.Errorf("%d misspelling(s) found", len(misspellings))
+		}
+		return nil
+	}
+
+	if fixMisspellings(lines, misspellings) {
+		op := beginOperation(config, "spell -i "+path)
+		if err := op.saveBefore(path); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, []byte(strings.Join(lines, "\n"))); err != nil {
+			return err
+		}
+		return op.commit()
+	}
+	return nil
+}
+
+// noteLanguage returns the note's stored or detected language, falling back
+// to the configured default.
+func noteLanguage(config *CONFIG, note *Note) string {
+	if lang := noteLang(note); lang != "" {
+		return lang
+	}
+	return config.SpellLang
+}
+
+// hunspellDicts turns "en,de_DE" into hunspell's "en_US,de_DE".
+func hunspellDicts(language string) string {
+	var dicts []string
+	for _, code := range strings.Split(language, ",") {
+		code = strings.TrimSpace(code)
+		if d, ok := dictionaries[strings.ToLower(code)]; ok {
+			code = d
+		}
+		dicts = append(dicts, strings.ReplaceAll(code, "-", "_"))
+	}
+	return strings.Join(dicts, ",")
+}
+
+// spellcheck runs hunspell in pipe mode over the note, skipping frontmatter
+// and fenced code blocks. Line numbers refer to the file.
+func spellcheck(lines []string, language string) ([]Misspelling, error) {
+	if _, err := exec.LookPath("hunspell"); err != nil {
+		return nil, fmt.Errorf("hunspell not found in PATH")
+	}
+
+	checkable := make([]string, len(lines))
+	inFrontmatter := len(lines) > 0 && lines[0] == "---"
+	inFence := false
+	for i, line := range lines {
+		switch {
+		case inFrontmatter:
+			if i > 0 && line == "---" {
+				inFrontmatter = false
+			}
+		case strings.HasPrefix(strings.TrimSpace(line), "```"):
+			inFence = !inFence
+		case !inFence:
+			checkable[i] = line
+		}
+	}
+
+	var input strings.Builder
+	for _, line := range checkable {
+		// A leading ^ stops hunspell from treating the line as a command
+		input.WriteString("^" + line + "\n")
+	}
+
+	cmd := exec.Command("hunspell", "-a", "-d", hunspellDicts(language))
+	cmd.Stdin = strings.NewReader(input.String())
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running hunspell: %w", err)
+	}
+
+	var result []Misspelling
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	scanner.Scan() // version banner
+	lineNo := 0
+	for scanner.Scan() {
+		text := scanner.Text()
+		if text == "" {
+			lineNo++
+			continue
+		}
+		if text[0] != '&' && text[0] != '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || lineNo >= len(lines) {
+			continue
+		}
+		m := Misspelling{Line: lineNo + 1, Word: fields[1]}
+		m.Column = strings.Index(lines[lineNo], m.Word) + 1
+		if _, suggestions, ok := strings.Cut(text, ": "); ok && text[0] == '&' {
+			m.Suggestions = strings.Split(suggestions, ", ")
+		}
+		result = append(result, m)
+	}
+	return result, scanner.Err()
+}
+
+// fixMisspellings prompts for a replacement for each misspelling and edits
+// lines in place. It reports whether anything changed.
+func fixMisspellings(lines []string, misspellings []Misspelling) bool {
+	reader := bufio.NewReader(os.Stdin)
+	changed := false
+	for _, m := range misspellings {
+		line := lines[m.Line-1]
+		fmt.Printf("\nline %d: %s\n  %q\n", m.Line, line, m.Word)
+		for i, s := range m.Suggestions {
+			fmt.Printf("  %d) %s\n", i+1, s)
+		}
+		fmt.Print("number, r) replace, s) skip, q) quit: ")
+
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return changed
+		}
+		answer = strings.TrimSpace(answer)
+
+		replacement := ""
+		switch {
+		case answer == "q":
+			return changed
+		case answer == "r":
+			fmt.Print("replacement: ")
+			text, err := reader.ReadString('\n')
+			if err != nil {
+				return changed
+			}
+			replacement = strings.TrimSpace(text)
+		default:
+			if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(m.Suggestions) {
+				replacement = m.Suggestions[n-1]
+			}
+		}
+		if replacement == "" {
+			continue
+		}
+
+		// Earlier fixes on the same line may have shifted the word
+		col := strings.Index(line, m.Word)
+		if col < 0 {
+			continue
+		}
+		lines[m.Line-1] = line[:col] + replacement + line[col+len(m.Word):]
+		changed = true
+	}
+	return changed
+}
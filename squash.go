@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noteTrailer marks the commits syt makes for a note while a squash window
+// is set; only those, and ones starting with noteCommitPrefix as every note
+// commit did before GIT_COMMIT_MESSAGE, are ever squashed.
+const (
+	noteTrailer      = "Syt-Note"
+	noteCommitPrefix = "Add note: "
+)
+
+// squashCheckInterval is how often the daemon looks for held commits whose
+// squash window has passed.
+const squashCheckInterval = time.Minute
+
+// heldCommit is a commit made locally but not pushed yet.
+type heldCommit struct {
+	hash    string
+	parents []string
+	when    time.Time
+	subject string
+	paths   []string
+	// syt is set for commits syt made for a note
+	syt bool
+}
+
+// pushSquashed pushes the commits held back by GIT_SQUASH_WINDOW, first
+// squashing them into one commit per note per day. Unless now is set it
+// waits until nothing has been committed for the window, so a burst of
+// saves goes up together. History syt didn't write (a merge, a commit made
+// by hand) is pushed as it is rather than rewritten. It returns how many
+// commits there were.
+func pushSquashed(config *CONFIG, now bool) (int, error) {
+	window, err := parseRetention(config.GitSquashWindow)
+	if err != nil {
+		return 0, codeErrorf(ErrConfigInvalid, "GIT_SQUASH_WINDOW: %v", err)
+	}
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		return 0, withCode(ErrGitFailed, err)
+	}
+	// Commits go through the same lock, so none lands mid-squash
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return 0, err
+	}
+	unlock, err := acquireLockWait(filepath.Join(stateDir(config), "sync.lock"), syncLockTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	commits, err := heldCommits(root, pushedRef(config, root))
+	if err != nil {
+		return 0, withCode(ErrGitFailed, err)
+	}
+	if len(commits) == 0 {
+		return 0, nil
+	}
+	if !now && currentTime().Sub(commits[len(commits)-1].when) < window {
+		return 0, nil
+	}
+	if squashable(commits) {
+		if err := squashCommits(root, commits); err != nil {
+			return 0, withCode(ErrGitFailed, fmt.Errorf("squashing commits: %w", err))
+		}
+	}
+	return len(commits), gitPush(config, root)
+}
+
+// heldCommits lists the commits on HEAD that pushed, the ref they're pushed
+// to, doesn't have yet, oldest first.
+func heldCommits(root, pushed string) ([]heldCommit, error) {
+	if _, err := gitOutput(root, "rev-parse", "--verify", "--quiet", pushed); err != nil {
+		return nil, fmt.Errorf("%s has no upstream branch to push to: %w", root, err)
+	}
+	out, err := gitOutput(root, "-c", "core.quotePath=false", "log", "--reverse", "--name-only",
+		"--format=%x00%H%x09%P%x09%at%x09%(trailers:key="+noteTrailer+",valueonly,separator=%x2C)%x09%s", pushed+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var commits []heldCommit
+	for _, chunk := range strings.Split(out, "\x00")[1:] {
+		lines := strings.Split(strings.TrimSpace(chunk), "\n")
+		fields := strings.SplitN(lines[0], "\t", 5)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("unexpected git log output %q", lines[0])
+		}
+		at, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected commit time %q", fields[2])
+		}
+		c := heldCommit{hash: fields[0], parents: strings.Fields(fields[1]), when: time.Unix(at, 0), subject: fields[4],
+			syt: fields[3] != "" || strings.HasPrefix(fields[4], noteCommitPrefix)}
+		for _, line := range lines[1:] {
+			if line != "" {
+				c.paths = append(c.paths, line)
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// squashable reports whether every commit is one syt made for a single note.
+func squashable(commits []heldCommit) bool {
+	for _, c := range commits {
+		if len(c.parents) != 1 || len(c.paths) != 1 || !c.syt {
+			return false
+		}
+	}
+	return true
+}
+
+// squashCommits rewrites commits as one commit per note and day, each
+// holding the note as it was after that day's last save. The commits are
+// built in a scratch index, so the work tree and whatever is staged stay
+// untouched; the final tree is the same as before, which is checked before
+// the branch is moved.
+func squashCommits(root string, commits []heldCommit) error {
+	type group struct {
+		path  string
+		first int
+		last  int
+		count int
+	}
+	var groups []*group
+	byKey := map[string]*group{}
+	for i, c := range commits {
+		key := c.paths[0] + "\x00" + c.when.Format("2006-01-02")
+		g := byKey[key]
+		if g == nil {
+			g = &group{path: c.paths[0], first: i}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.last, g.count = i, g.count+1
+	}
+	if len(groups) == len(commits) {
+		return nil
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].last < groups[j].last })
+
+	index, err := os.CreateTemp("", "syt-index-")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	os.Remove(index.Name()) // git wants to create it itself
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+
+	parent := commits[0].parents[0]
+	if _, err := gitWithEnv(root, env, "read-tree", parent); err != nil {
+		return err
+	}
+	var tree string
+	for _, g := range groups {
+		last := commits[g.last]
+		entry, err := gitWithEnv(root, env, "ls-tree", last.hash, "--", g.path)
+		if err != nil {
+			return err
+		}
+		if entry == "" {
+			_, err = gitWithEnv(root, env, "update-index", "--force-remove", "--", g.path)
+		} else {
+			mode, rest, _ := strings.Cut(entry, " ")
+			_, rest, _ = strings.Cut(rest, " ")
+			blob, _, _ := strings.Cut(rest, "\t")
+			_, err = gitWithEnv(root, env, "update-index", "--add", "--cacheinfo", mode+","+blob+","+g.path)
+		}
+		if err != nil {
+			return err
+		}
+		if tree, err = gitWithEnv(root, env, "write-tree"); err != nil {
+			return err
+		}
+
+		args := []string{"commit-tree", tree, "-p", parent, "-m", commits[g.first].subject}
+		if g.count > 1 {
+			args = append(args, "-m", fmt.Sprintf("Squashed from %d saves on %s.", g.count, last.when.Format("2006-01-02")))
+		}
+		date := fmt.Sprintf("GIT_AUTHOR_DATE=%d %s", last.when.Unix(), last.when.Format("-0700"))
+		if parent, err = gitWithEnv(root, append(env, date), args...); err != nil {
+			return err
+		}
+	}
+
+	head := commits[len(commits)-1].hash
+	want, err := gitOutput(root, "rev-parse", head+"^{tree}")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(want) != tree {
+		return fmt.Errorf("squashed tree %s differs from %s", tree, strings.TrimSpace(want))
+	}
+	_, err = gitOutput(root, "update-ref", "-m", "syt: squash saves", "HEAD", parent, head)
+	return err
+}
+
+// gitWithEnv runs git in dir with extra environment variables and returns
+// its trimmed output.
+func gitWithEnv(dir string, env []string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// autoPushSquashed pushes held commits once their window has passed. It
+// holds runMu because pushing prints, and client commands capture stdout
+// while they run.
+func autoPushSquashed(config *CONFIG) {
+	runMu.Lock()
+	defer runMu.Unlock()
+	n, err := pushSquashed(config, false)
+	if err != nil {
+		log.Printf("daemon: pushing held commits: %v", err)
+	} else if n > 0 {
+		log.Printf("daemon: pushed %d held commit(s)", n)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// State is syt's local database, kept as JSON in the state directory. It
+// holds derived data that shouldn't live in the notes themselves.
+type State struct {
+	Links  map[string]LinkPreview `json:"links,omitempty"`
+	Visits map[string]*Visits     `json:"visits,omitempty"`
+	Notion map[string]*NotionPage `json:"notion,omitempty"`
+	// Uploads maps the SHA-1 of an uploaded attachment to where it went.
+	Uploads map[string]string `json:"uploads,omitempty"`
+	// Confluence maps notes to the Confluence pages they were published as.
+	Confluence map[string]string `json:"confluence,omitempty"`
+	// Pending holds the notes being edited and not yet synced.
+	Pending map[string]*PendingSync `json:"pending,omitempty"`
+	// Read holds when notes were marked read with `syt unread --mark`.
+	Read map[string]time.Time `json:"read,omitempty"`
+	// Subscriptions are the notes and tags `syt subscribe` follows.
+	Subscriptions *Subscriptions `json:"subscriptions,omitempty"`
+	// Attachments holds the metadata of files notes link to.
+	Attachments map[string]*Attachment `json:"attachments,omitempty"`
+	// Failed holds, per note, the backends that failed to take it.
+	Failed map[string]map[string]*SyncFailure `json:"failed,omitempty"`
+	// Upload is what has been sent today, for UPLOAD_BUDGET_MB.
+	Upload *UploadBudget `json:"upload,omitempty"`
+}
+
+const (
+	stateLockTimeout = 5 * time.Second
+	stateLockStale   = 30 * time.Second
+)
+
+// stateDir is where syt keeps its own bookkeeping inside the notes directory.
+func stateDir(config *CONFIG) string {
+	return filepath.Join(config.NotesDir, ".syt")
+}
+
+func statePath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "state.json")
+}
+
+// loadState reads the state database; a missing file yields an empty State.
+func loadState(config *CONFIG) (*State, error) {
+	state := &State{}
+	data, err := os.ReadFile(statePath(config))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("corrupt state database %s: %w", statePath(config), err)
+	}
+	return state, nil
+}
+
+// updateState applies fn to the state database under an exclusive lock, so
+// concurrent syt processes don't lose each other's writes.
+func updateState(config *CONFIG, fn func(*State) error) error {
+	unlock, err := lockState(config)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	if err := fn(state); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename so readers never see a partial file
+	tmp := statePath(config) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath(config))
+}
+
+// lockState takes the state lock file.
+func lockState(config *CONFIG) (func(), error) {
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return nil, err
+	}
+	return acquireLock(filepath.Join(stateDir(config), "state.lock"))
+}
+
+// acquireLock creates lockPath exclusively, waiting for other holders and
+// breaking locks left behind by processes that died while holding them. The
+// returned function releases the lock.
+func acquireLock(lockPath string) (func(), error) {
+	return acquireLockWait(lockPath, stateLockTimeout)
+}
+
+// acquireLockWait is acquireLock with a custom wait, for locks held across
+// slow operations such as a git push. A lock whose holder is still running
+// is never broken; one from a dead process is broken straight away, and one
+// whose holder can't be determined once it is older than stateLockStale.
+func acquireLockWait(lockPath string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if lockAbandoned(lockPath) {
+			breakLock(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// lockAbandoned reports whether the process that took lockPath is gone.
+func lockAbandoned(lockPath string) bool {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return false // released meanwhile, or unreadable: just retry
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid > 0 {
+		if alive, known := processAlive(pid); known {
+			return !alive
+		}
+	}
+	info, err := os.Stat(lockPath)
+	return err == nil && time.Since(info.ModTime()) > stateLockStale
+}
+
+// breakLock moves an abandoned lock out of the way. Of several processes
+// finding the same one, only the first rename succeeds; the others would move
+// whatever lock was taken since, so the lock moved is checked once more and
+// put back if its holder is alive.
+func breakLock(lockPath string) {
+	moved := fmt.Sprintf("%s.stale-%d-%s", lockPath, os.Getpid(), newID())
+	if err := os.Rename(lockPath, moved); err != nil {
+		return // broken or released meanwhile
+	}
+	if !lockAbandoned(moved) {
+		os.Link(moved, lockPath)
+	}
+	os.Remove(moved)
+}
+
+// processAlive reports whether pid is running, and whether that could be
+// determined at all on this platform.
+func processAlive(pid int) (alive, known bool) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false, true
+	}
+	err = p.Signal(syscall.Signal(0))
+	switch {
+	case err == nil, errors.Is(err, os.ErrPermission), errors.Is(err, syscall.EPERM):
+		return true, true
+	case errors.Is(err, os.ErrProcessDone), errors.Is(err, syscall.ESRCH):
+		return false, true
+	}
+	return false, false
+}
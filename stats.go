@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// monthStats is the state of the vault at the end of a month.
+type monthStats struct {
+	Month string         `json:"month"` // YYYY-MM
+	Notes int            `json:"notes"`
+	Words int            `json:"words"`
+	Tags  map[string]int `json:"tags,omitempty"`
+}
+
+type dayCount struct {
+	Day     string `json:"day"`
+	Commits int    `json:"commits"`
+}
+
+type tagTrend struct {
+	Tag    string `json:"tag"`
+	Counts []int  `json:"counts"` // one per month, aligned with Months
+}
+
+type historyStats struct {
+	Months      []monthStats   `json:"months"`
+	Weekdays    map[string]int `json:"weekdays"`
+	BusiestDays []dayCount     `json:"busiest_days"`
+	TagTrends   []tagTrend     `json:"tag_trends"`
+}
+
+// blobStats is what a single note version contributes.
+type blobStats struct {
+	words int
+	tags  []string
+}
+
+// chartWidth is the longest bar drawn in terminal charts.
+const chartWidth = 40
+
+func runStats(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	history := fs.Bool("history", false, "chart vault growth, writing days and tag trends from git history")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	topTags := fs.Int("tags", 5, "number of tags to follow in the trends")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*history {
+		return printCurrentStats(config, *asJSON)
+	}
+
+	stats, err := vaultHistory(config.NotesDir, *topTags)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	printHistory(stats, config.Accessible)
+	return nil
+}
+
+func printCurrentStats(config *CONFIG, asJSON bool) error {
+	notes, err := vaultNotes(config, true)
+	if err != nil {
+		return err
+	}
+	month := monthStats{Month: currentTime().Format("2006-01"), Notes: len(notes), Tags: map[string]int{}}
+	for _, note := range notes {
+		month.Words += len(strings.Fields(note.Body))
+		for _, tag := range noteTags(note) {
+			month.Tags[foldText(tag)]++
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(month)
+	}
+	fmt.Printf("Notes: %d\nWords: %d\nTags:  %d\n", month.Notes, month.Words, len(month.Tags))
+	return nil
+}
+
+// vaultHistory replays the git history of notesDir month by month.
+func vaultHistory(notesDir string, topTags int) (*historyStats, error) {
+	out, err := gitOutput(notesDir, "log", "--reverse", "--date=iso-strict", "--format=%H %ad", "--", ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading git history (is %s in a git repository?): %w", notesDir, err)
+	}
+
+	stats := &historyStats{Weekdays: map[string]int{}}
+	perDay := map[string]int{}
+	var months []string
+	lastCommit := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		hash, date, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			continue
+		}
+		month := t.Format("2006-01")
+		if _, seen := lastCommit[month]; !seen {
+			months = append(months, month)
+		}
+		lastCommit[month] = hash
+		perDay[t.Format("2006-01-02")]++
+		stats.Weekdays[t.Weekday().String()]++
+	}
+	if len(months) == 0 {
+		return nil, fmt.Errorf("no git history for %s", notesDir)
+	}
+
+	// Months without commits carry the previous month's vault forward
+	cache := map[string]blobStats{}
+	first, _ := time.Parse("2006-01", months[0])
+	last, _ := time.Parse("2006-01", months[len(months)-1])
+	var prev monthStats
+	for t := first; !t.After(last); t = t.AddDate(0, 1, 0) {
+		month := t.Format("2006-01")
+		if hash, ok := lastCommit[month]; ok {
+			m, err := statsAt(notesDir, hash, cache)
+			if err != nil {
+				return nil, err
+			}
+			prev = m
+		}
+		prev.Month = month
+		stats.Months = append(stats.Months, prev)
+	}
+
+	for day, n := range perDay {
+		stats.BusiestDays = append(stats.BusiestDays, dayCount{Day: day, Commits: n})
+	}
+	sort.Slice(stats.BusiestDays, func(i, j int) bool {
+		a, b := stats.BusiestDays[i], stats.BusiestDays[j]
+		return a.Commits > b.Commits || (a.Commits == b.Commits && a.Day < b.Day)
+	})
+	if len(stats.BusiestDays) > 5 {
+		stats.BusiestDays = stats.BusiestDays[:5]
+	}
+
+	// Follow the tags most used at the end of the history
+	latest := stats.Months[len(stats.Months)-1].Tags
+	tags := make([]string, 0, len(latest))
+	for tag := range latest {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return latest[tags[i]] > latest[tags[j]] || (latest[tags[i]] == latest[tags[j]] && tags[i] < tags[j])
+	})
+	if len(tags) > topTags {
+		tags = tags[:topTags]
+	}
+	for _, tag := range tags {
+		trend := tagTrend{Tag: tag}
+		for _, m := range stats.Months {
+			trend.Counts = append(trend.Counts, m.Tags[tag])
+		}
+		stats.TagTrends = append(stats.TagTrends, trend)
+	}
+	return stats, nil
+}
+
+// statsAt counts the notes, words and tags in the vault as of commit. Note
+// versions are cached by blob so unchanged notes are only read once.
+func statsAt(notesDir, commit string, cache map[string]blobStats) (monthStats, error) {
+	m := monthStats{Tags: map[string]int{}}
+	out, err := gitOutput(notesDir, "ls-tree", "-r", commit, "--", ".")
+	if err != nil {
+		return m, err
+	}
+	var blobs, missing []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		info, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || fields[1] != "blob" || path.Ext(name) != ".md" || isCommentsSidecar(name) || hiddenPath(name) {
+			continue
+		}
+		blobs = append(blobs, fields[2])
+		if _, ok := cache[fields[2]]; !ok {
+			missing = append(missing, fields[2])
+		}
+	}
+	if err := readBlobs(notesDir, missing, func(hash string, content []byte) {
+		meta, body := parseFrontmatter(string(content))
+		cache[hash] = blobStats{words: len(strings.Fields(body)), tags: noteTags(&Note{Meta: meta})}
+	}); err != nil {
+		return m, err
+	}
+	for _, hash := range blobs {
+		b := cache[hash]
+		m.Notes++
+		m.Words += b.words
+		for _, tag := range b.tags {
+			m.Tags[foldText(tag)]++
+		}
+	}
+	return m, nil
+}
+
+// hiddenPath reports whether a repository path is inside a dot directory,
+// which scanNotes skips too.
+func hiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// readBlobs streams the given blobs through one `git cat-file --batch`.
+func readBlobs(dir string, hashes []string, fn func(hash string, content []byte)) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	cmd := exec.Command("git", "-C", dir, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r := bufio.NewReader(stdout)
+	for range hashes {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			cmd.Wait()
+			return fmt.Errorf("reading git objects: %w", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			cmd.Wait()
+			return fmt.Errorf("unexpected git cat-file output %q", strings.TrimSpace(header))
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			cmd.Wait()
+			return err
+		}
+		content := make([]byte, size+1) // the object plus its trailing newline
+		if _, err := io.ReadFull(r, content); err != nil {
+			cmd.Wait()
+			return err
+		}
+		fn(fields[0], content[:size])
+	}
+	return cmd.Wait()
+}
+
+// gitOutput runs git in dir and returns its standard output.
+func gitOutput(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// bar draws value as a horizontal bar scaled so top fills chartWidth.
+func bar(value, top int) string {
+	if top <= 0 || value <= 0 {
+		return ""
+	}
+	return strings.Repeat("█", max(1, value*chartWidth/top))
+}
+
+// printHistory renders the history as terminal bar charts. Accessible mode
+// prints plain figures instead of bars.
+func printHistory(stats *historyStats, accessible bool) {
+	maxNotes, maxWords := 0, 0
+	for _, m := range stats.Months {
+		maxNotes = max(maxNotes, m.Notes)
+		maxWords = max(maxWords, m.Words)
+	}
+
+	fmt.Println("Vault growth")
+	for _, m := range stats.Months {
+		if accessible {
+			fmt.Printf("%s: %d notes, %d words\n", m.Month, m.Notes, m.Words)
+		} else {
+			fmt.Printf("%s  %-*s %d notes, %d words\n", m.Month, chartWidth, bar(m.Notes, maxNotes), m.Notes, m.Words)
+		}
+	}
+
+	fmt.Println("\nWriting days")
+	maxDay := 0
+	for _, n := range stats.Weekdays {
+		maxDay = max(maxDay, n)
+	}
+	for d := time.Monday; ; d = (d + 1) % 7 {
+		n := stats.Weekdays[d.String()]
+		if accessible {
+			fmt.Printf("%s: %d commit(s)\n", d, n)
+		} else {
+			fmt.Printf("%-9s  %-*s %d\n", d, chartWidth, bar(n, maxDay), n)
+		}
+		if d == time.Sunday {
+			break
+		}
+	}
+	fmt.Println("\nBusiest days")
+	for _, d := range stats.BusiestDays {
+		fmt.Printf("%s: %d commit(s)\n", d.Day, d.Commits)
+	}
+
+	if len(stats.TagTrends) == 0 {
+		return
+	}
+	fmt.Println("\nTag adoption (notes per month)")
+	for _, trend := range stats.TagTrends {
+		if accessible {
+			parts := make([]string, len(trend.Counts))
+			for i, n := range trend.Counts {
+				parts[i] = fmt.Sprintf("%s %d", stats.Months[i].Month, n)
+			}
+			fmt.Printf("%s: %s\n", trend.Tag, strings.Join(parts, ", "))
+			continue
+		}
+		fmt.Printf("%-20s %s %d\n", trend.Tag, sparkline(trend.Counts), trend.Counts[len(trend.Counts)-1])
+	}
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws counts as a row of block characters.
+func sparkline(counts []int) string {
+	top := 0
+	for _, n := range counts {
+		top = max(top, n)
+	}
+	var b strings.Builder
+	for _, n := range counts {
+		if top == 0 {
+			b.WriteRune(sparks[0])
+			continue
+		}
+		b.WriteRune(sparks[n*(len(sparks)-1)/top])
+	}
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package main
+
+import "strings"
+
+// stemmers reduce words to a common stem so "running" matches "runs". English
+// uses the Porter algorithm; the others strip common inflectional suffixes.
+var stemmers = map[string]func(string) string{
+	"en": porterStem,
+	"de": suffixStemmer([]string{"ungen", "heiten", "keiten", "ung", "heit", "keit", "isch", "lich", "ern", "em", "en", "er", "es", "e", "s", "n"}),
+	"es": suffixStemmer([]string{"amientos", "imientos", "amiento", "imiento", "aciones", "ación", "mente", "ando", "iendo", "ados", "idos", "ado", "ido", "es", "as", "os", "a", "o", "e", "s"}),
+	"fr": suffixStemmer([]string{"issements", "issement", "ations", "ation", "ement", "ements", "euses", "euse", "ités", "ité", "ives", "ive", "ifs", "if", "es", "er", "ez", "e", "s", "x"}),
+}
+
+// searchStopWords are dropped from indexed text and queries when stop-word
+// removal is on. They extend the function words used for language detection.
+var searchStopWords = func() map[string]map[string]bool {
+	extra := map[string][]string{
+		"en": {"a", "an", "as", "at", "by", "from", "or", "but", "if", "then", "so", "we", "i", "he", "she", "they", "them", "its", "were", "been", "has", "had", "do", "does", "did"},
+		"de": {"dem", "des", "einen", "einem", "einer", "oder", "aber", "wenn", "dass", "im", "am", "um", "war", "sind", "hat"},
+		"es": {"al", "lo", "le", "les", "su", "sus", "pero", "si", "más", "como", "muy", "ya"},
+		"fr": {"du", "de", "au", "aux", "ou", "mais", "si", "son", "sa", "ses", "il", "elle", "ils", "elles", "vous"},
+	}
+	sets := map[string]map[string]bool{}
+	for lang, words := range languageMarkers {
+		set := map[string]bool{}
+		for _, w := range append(words, extra[lang]...) {
+			set[foldText(w)] = true
+		}
+		sets[lang] = set
+	}
+	return sets
+}()
+
+// suffixStemmer strips the longest matching suffix while keeping a stem of
+// at least three letters.
+func suffixStemmer(suffixes []string) func(string) string {
+	return func(word string) string {
+		best := ""
+		for _, s := range suffixes {
+			s = foldText(s)
+			if len(s) > len(best) && strings.HasSuffix(word, s) && len([]rune(word))-len([]rune(s)) >= 3 {
+				best = s
+			}
+		}
+		return strings.TrimSuffix(word, best)
+	}
+}
+
+// porterStem implements M. F. Porter's 1980 suffix stripping algorithm.
+func porterStem(word string) string {
+	if len(word) <= 2 || strings.IndexFunc(word, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+		return word
+	}
+	w := []byte(word)
+
+	// Step 1a
+	switch {
+	case hasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "ies"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "ss"):
+	case hasSuffix(w, "s"):
+		w = w[:len(w)-1]
+	}
+
+	// Step 1b
+	step1bExtra := false
+	switch {
+	case hasSuffix(w, "eed"):
+		if measure(w[:len(w)-3]) > 0 {
+			w = w[:len(w)-1]
+		}
+	case hasSuffix(w, "ed") && hasVowel(w[:len(w)-2]):
+		w = w[:len(w)-2]
+		step1bExtra = true
+	case hasSuffix(w, "ing") && hasVowel(w[:len(w)-3]):
+		w = w[:len(w)-3]
+		step1bExtra = true
+	}
+	if step1bExtra {
+		switch {
+		case hasSuffix(w, "at"), hasSuffix(w, "bl"), hasSuffix(w, "iz"):
+			w = append(w, 'e')
+		case doubleConsonant(w) && !hasSuffix(w, "l") && !hasSuffix(w, "s") && !hasSuffix(w, "z"):
+			w = w[:len(w)-1]
+		case measure(w) == 1 && cvc(w):
+			w = append(w, 'e')
+		}
+	}
+
+	// Step 1c
+	if hasSuffix(w, "y") && hasVowel(w[:len(w)-1]) {
+		w[len(w)-1] = 'i'
+	}
+
+	// Step 2
+	w = replaceSuffix(w, 0, [][2]string{
+		{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+		{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+		{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+		{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+		{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	})
+
+	// Step 3
+	w = replaceSuffix(w, 0, [][2]string{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+		{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+	})
+
+	// Step 4
+	for _, s := range []string{"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement",
+		"ment", "ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize"} {
+		if !hasSuffix(w, s) {
+			continue
+		}
+		stem := w[:len(w)-len(s)]
+		if measure(stem) > 1 && (s != "ion" || hasSuffix(stem, "s") || hasSuffix(stem, "t")) {
+			w = stem
+		}
+		break
+	}
+
+	// Step 5a
+	if hasSuffix(w, "e") {
+		stem := w[:len(w)-1]
+		if m := measure(stem); m > 1 || (m == 1 && !cvc(stem)) {
+			w = stem
+		}
+	}
+	// Step 5b
+	if measure(w) > 1 && doubleConsonant(w) && hasSuffix(w, "l") {
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
+
+func hasSuffix(w []byte, s string) bool {
+	return len(w) >= len(s) && string(w[len(w)-len(s):]) == s
+}
+
+// replaceSuffix applies the first rule whose suffix matches, if the stem
+// left over has a measure above minMeasure.
+func replaceSuffix(w []byte, minMeasure int, rules [][2]string) []byte {
+	for _, r := range rules {
+		if hasSuffix(w, r[0]) {
+			stem := w[:len(w)-len(r[0])]
+			if measure(stem) > minMeasure {
+				return append(stem[:len(stem):len(stem)], r[1]...)
+			}
+			return w
+		}
+	}
+	return w
+}
+
+func isConsonant(w []byte, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isConsonant(w, i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences in w ("m" in Porter's paper).
+func measure(w []byte) int {
+	m := 0
+	i := 0
+	for i < len(w) && isConsonant(w, i) {
+		i++
+	}
+	for i < len(w) {
+		for i < len(w) && !isConsonant(w, i) {
+			i++
+		}
+		if i == len(w) {
+			break
+		}
+		m++
+		for i < len(w) && isConsonant(w, i) {
+			i++
+		}
+	}
+	return m
+}
+
+func hasVowel(w []byte) bool {
+	for i := range w {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func doubleConsonant(w []byte) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isConsonant(w, n-1)
+}
+
+// cvc reports whether w ends consonant-vowel-consonant with the last
+// consonant not w, x or y.
+func cvc(w []byte) bool {
+	n := len(w)
+	if n < 3 || !isConsonant(w, n-1) || isConsonant(w, n-2) || !isConsonant(w, n-3) {
+		return false
+	}
+	c := w[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
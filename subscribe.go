@@ -0,0 +1,262 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// subscriptionCheckInterval is how often the daemon looks for changes to
+// subscribed notes.
+const subscriptionCheckInterval = time.Minute
+
+// Subscriptions are the notes and tags you follow in a shared vault. Seen is
+// the commit the daemon last checked.
+type Subscriptions struct {
+	Notes []string `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Seen  string   `json:"seen,omitempty"`
+}
+
+// runSubscribe follows notes and tags, or with --remove stops following
+// them; without arguments it lists what you follow. The daemon then tells
+// you when someone else changes one of them or mentions you.
+func runSubscribe(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("subscribe", flag.ContinueOnError)
+	var tags []string
+	fs.Func("tag", "follow notes with this tag (repeatable)", func(tag string) error {
+		tags = append(tags, strings.TrimPrefix(tag, "#"))
+		return nil
+	})
+	remove := fs.Bool("remove", false, "stop following the notes and tags given")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && len(tags) == 0 {
+		if *remove {
+			return fmt.Errorf("usage: syt subscribe [--remove] [--tag tag]... [note...]")
+		}
+		return printSubscriptions(config)
+	}
+	var notes []string
+	for _, arg := range fs.Args() {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			if path, err = findNote(config, arg); err != nil {
+				return err
+			}
+		}
+		notes = append(notes, visitKey(config, path))
+	}
+
+	return updateState(config, func(s *State) error {
+		if s.Subscriptions == nil {
+			s.Subscriptions = &Subscriptions{}
+		}
+		sub := s.Subscriptions
+		if *remove {
+			sub.Notes = removeStrings(sub.Notes, notes)
+			sub.Tags = removeStrings(sub.Tags, tags)
+		} else {
+			sub.Notes = appendNew(sub.Notes, notes...)
+			sub.Tags = appendNew(sub.Tags, tags...)
+		}
+		verb := "Following"
+		if *remove {
+			verb = "No longer following"
+		}
+		for _, key := range notes {
+			fmt.Printf("%s %s\n", verb, key)
+		}
+		for _, tag := range tags {
+			fmt.Printf("%s #%s\n", verb, tag)
+		}
+		return nil
+	})
+}
+
+func printSubscriptions(config *CONFIG) error {
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	sub := state.Subscriptions
+	if sub == nil || len(sub.Notes)+len(sub.Tags) == 0 {
+		fmt.Println("Not following any notes or tags.")
+		return nil
+	}
+	for _, key := range sub.Notes {
+		fmt.Println(key)
+	}
+	for _, tag := range sub.Tags {
+		fmt.Println("#" + tag)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendNew(list []string, items ...string) []string {
+	for _, item := range items {
+		if !containsString(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func removeStrings(list, drop []string) []string {
+	var kept []string
+	for _, item := range list {
+		if !containsString(drop, item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// checkSubscriptions looks at the commits that reached the current branch
+// since the last check, from a pull before a push or a sync merge, and for
+// each note someone else changed that you follow or that now mentions
+// @MENTION_HANDLE, adds a line to INBOX_NOTE and raises a desktop
+// notification. The first check only remembers where the branch is.
+func checkSubscriptions(config *CONFIG) {
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		return
+	}
+	out, err := gitOutput(root, "rev-parse", "HEAD")
+	if err != nil {
+		return
+	}
+	head := strings.TrimSpace(out)
+	state, err := loadState(config)
+	if err != nil {
+		log.Printf("daemon: checking subscriptions: %v", err)
+		return
+	}
+	sub := state.Subscriptions
+	if sub == nil {
+		sub = &Subscriptions{}
+	}
+	seen := sub.Seen
+	if seen == head {
+		return
+	}
+	if err := updateState(config, func(s *State) error {
+		if s.Subscriptions == nil {
+			s.Subscriptions = &Subscriptions{}
+		}
+		s.Subscriptions.Seen = head
+		return nil
+	}); err != nil || seen == "" {
+		return
+	}
+
+	changes, _, err := othersChanges(root, config.NotesDir, seen+".."+head)
+	if err != nil {
+		log.Printf("daemon: checking subscriptions: %v", err)
+		return
+	}
+	inbox := filepath.Join(config.NotesDir, config.InboxNote)
+	var keys []string
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := filepath.Join(config.NotesDir, filepath.FromSlash(key))
+		if path == inbox {
+			continue
+		}
+		note, err := readNote(path)
+		if err != nil {
+			continue
+		}
+		why := subscriptionReason(config, root, sub, seen, head, key, note)
+		if why == "" {
+			continue
+		}
+		c := changes[key]
+		title := noteTitle(note)
+		if err := addToInbox(config, inbox, fmt.Sprintf("- %s [%s](%s) %s by %s\n", c.when.Format("2006-01-02 15:04"), title, key, why, c.author)); err != nil {
+			log.Printf("daemon: writing %s: %v", config.InboxNote, err)
+		}
+		if config.DesktopNotify {
+			notifyDesktop(title, why+" by "+c.author)
+		}
+	}
+}
+
+// subscriptionReason says why a changed note concerns you, or "" if it
+// doesn't.
+func subscriptionReason(config *CONFIG, root string, sub *Subscriptions, from, to, key string, note *Note) string {
+	if config.MentionHandle != "" {
+		abs, _ := filepath.Abs(note.Path)
+		if diff, err := gitOutput(root, "diff", "-U0", from, to, "--", abs); err == nil {
+			for _, line := range strings.Split(diff, "\n") {
+				if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") &&
+					containsString(extractMentions(line), strings.ToLower(config.MentionHandle)) {
+					return "mentioned you"
+				}
+			}
+		}
+	}
+	if containsString(sub.Notes, key) {
+		return "changed"
+	}
+	for _, tag := range sub.Tags {
+		if hasTag(note, tag) {
+			return "changed (#" + tag + ")"
+		}
+	}
+	return ""
+}
+
+// addToInbox appends an entry to the inbox note, creating it first.
+func addToInbox(config *CONFIG, inbox, entry string) error {
+	inbox, err := sealedPath(config, inbox)
+	if err != nil {
+		return err
+	}
+	if err := createNote(config, inbox, []byte("---\ntitle: Inbox\n---\n\n")); err != nil && !os.IsExist(err) {
+		return err
+	}
+	err = appendNote(config, inbox, entry)
+	if err == nil && activeIndex != nil {
+		err = activeIndex.refresh()
+	}
+	return err
+}
+
+// notifyDesktop raises a desktop notification with notify-send or, on macOS,
+// osascript. Where neither is around it does nothing.
+func notifyDesktop(title, text string) {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title %q", text, "syt: "+title))
+	default:
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return
+		}
+		cmd = exec.Command("notify-send", "syt: "+title, text)
+	}
+	if err := cmd.Run(); err != nil {
+		log.Printf("daemon: desktop notification: %v", err)
+	}
+}
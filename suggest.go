@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxTagSuggestions = 3
+	minTagSimilarity  = 0.1
+)
+
+var suggestWord = regexp.MustCompile(`\p{L}{3,}`)
+
+var suggestStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true,
+	"you": true, "all": true, "any": true, "can": true, "had": true, "her": true,
+	"was": true, "one": true, "our": true, "out": true, "has": true, "have": true,
+	"this": true, "that": true, "with": true, "from": true, "they": true, "will": true,
+	"what": true, "when": true, "there": true, "their": true, "about": true, "which": true,
+}
+
+// suggestTags proposes tags for note. With TAG_SUGGEST_COMMAND set, the note
+// is piped to that command (e.g. a wrapper around an LLM) which prints
+// comma-separated tags; otherwise tags are ranked by TF-IDF similarity between
+// the note and the notes already carrying each tag.
+func suggestTags(config *CONFIG, note *Note, notes []*Note) ([]string, error) {
+	var suggestions []string
+	if config.TagSuggestCommand != "" {
+		fields := strings.Fields(config.TagSuggestCommand)
+		cmd := exec.Command(fields[0], fields[1:]...)
+		cmd.Stdin = strings.NewReader(note.Body)
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("tag suggestion command failed: %w", err)
+		}
+		suggestions = splitList(strings.ReplaceAll(string(out), "\n", ","))
+	} else {
+		suggestions = similarTags(note, notes)
+	}
+
+	var fresh []string
+	for _, tag := range suggestions {
+		if !hasTag(note, tag) && len(fresh) < maxTagSuggestions {
+			fresh = append(fresh, tag)
+		}
+	}
+	return fresh, nil
+}
+
+func similarTags(note *Note, notes []*Note) []string {
+	docs := map[*Note]map[string]float64{}
+	df := map[string]int{}
+	for _, n := range notes {
+		tf := termFrequencies(n.Body)
+		docs[n] = tf
+		for term := range tf {
+			df[term]++
+		}
+	}
+	total := float64(len(notes) + 1)
+	weigh := func(tf map[string]float64) map[string]float64 {
+		v := map[string]float64{}
+		for term, f := range tf {
+			v[term] = f * math.Log(total/float64(df[term]+1))
+		}
+		return v
+	}
+
+	// Sum the weighted vectors of each tag's notes into one profile per tag
+	profiles := map[string]map[string]float64{}
+	for _, n := range notes {
+		if n.Path == note.Path {
+			continue
+		}
+		v := weigh(docs[n])
+		for _, tag := range noteTags(n) {
+			tag = foldText(tag)
+			if profiles[tag] == nil {
+				profiles[tag] = map[string]float64{}
+			}
+			for term, w := range v {
+				profiles[tag][term] += w
+			}
+		}
+	}
+
+	target := weigh(termFrequencies(note.Body))
+	type scored struct {
+		tag   string
+		score float64
+	}
+	var ranked []scored
+	for tag, profile := range profiles {
+		if s := cosine(target, profile); s >= minTagSimilarity {
+			ranked = append(ranked, scored{tag, s})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+
+	tags := make([]string, len(ranked))
+	for i, r := range ranked {
+		tags[i] = r.tag
+	}
+	return tags
+}
+
+func termFrequencies(text string) map[string]float64 {
+	tf := map[string]float64{}
+	for _, w := range suggestWord.FindAllString(strings.ToLower(text), -1) {
+		if !suggestStopWords[w] {
+			tf[w]++
+		}
+	}
+	return tf
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for term, w := range a {
+		dot += w * b[term]
+		na += w * w
+	}
+	for _, w := range b {
+		nb += w * w
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// offerTags suggests tags for the note at path and adds them: all of them
+// when auto is set, otherwise the ones picked at an interactive prompt.
+// Without a terminal and without auto nothing is added.
+func offerTags(config *CONFIG, path string, auto bool) error {
+	if !auto && !isTerminal(os.Stdin) {
+		return nil
+	}
+	note, err := readNote(path)
+	if err != nil {
+		return err
+	}
+	notes, err := vaultNotes(config, true)
+	if err != nil {
+		return err
+	}
+	suggestions, err := suggestTags(config, note, notes)
+	if err != nil || len(suggestions) == 0 {
+		return err
+	}
+
+	chosen := suggestions
+	if !auto {
+		chosen = nil
+		for i, tag := range suggestions {
+			fmt.Printf("  %d) %s\n", i+1, tag)
+		}
+		fmt.Print(tr("Add suggested tags? [a]ll, numbers (e.g. 1,3) or Enter to skip: "))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "a" {
+			chosen = suggestions
+		}
+		for _, field := range splitList(answer) {
+			if n, err := strconv.Atoi(field); err == nil && n >= 1 && n <= len(suggestions) {
+				chosen = append(chosen, suggestions[n-1])
+			}
+		}
+	}
+	if len(chosen) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tags := dedupe(append(noteTags(note), chosen...))
+	if err := writeFileAtomic(path, []byte(setFrontmatter(string(content), "tags", formatTags(tags)))); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Tagged with %s\n"), strings.Join(chosen, ", "))
+	return nil
+}
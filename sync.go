@@ -0,0 +1,295 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncBackend is a destination notes are pushed to after editing.
+type SyncBackend interface {
+	Name() string
+	Push(config *CONFIG, notePath string) error
+}
+
+type gitBackend struct{}
+
+func (gitBackend) Name() string { return "git" }
+
+// syncLockTimeout bounds how long a push waits for another process's push.
+const syncLockTimeout = 2 * time.Minute
+
+// gitBatch collects the notes `syt sync --batch` commits together once they
+// have all synced elsewhere; while it is nil each note gets its own commit.
+var gitBatch *[]string
+
+func (gitBackend) Push(config *CONFIG, notePath string) error {
+	if gitBatch != nil {
+		*gitBatch = append(*gitBatch, notePath)
+		return nil
+	}
+	// Concurrent commits would trip over git's index lock, so pushes take turns
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLockWait(filepath.Join(stateDir(config), "sync.lock"), syncLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := gitCommitAndPush(notePath, config); err != nil {
+		return err
+	}
+	countPushed(notePath)
+	return nil
+}
+
+// countPushed adds the notes git pushed to the upload total, once each;
+// what goes up is roughly the note, compressed a little.
+func countPushed(paths ...string) {
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			uploadedBytes.Add(info.Size())
+		}
+	}
+}
+
+// gitRepoRoot finds the top of the work tree dir belongs to. It is dir
+// itself for a plain notes repository, and the repository (or linked
+// worktree) root when the notes are a subdirectory of a larger project.
+func gitRepoRoot(dir string) (string, error) {
+	out, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not in a git work tree: %w", dir, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// autoGitMaintenance lets git pack loose objects and prune what is no longer
+// needed once enough has piled up, so the notes repository stays quick after
+// years of one-note commits. It does nothing when there's no repository.
+func autoGitMaintenance(config *CONFIG) {
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		return
+	}
+	if _, err := gitOutput(root, "gc", "--auto", "--quiet"); err != nil {
+		log.Printf("daemon: git maintenance: %v", err)
+	}
+}
+
+type notionBackend struct{}
+
+func (notionBackend) Name() string { return "notion" }
+
+func (notionBackend) Push(config *CONFIG, notePath string) error {
+	return uploadToNotion(config, notePath)
+}
+
+// syncBackends returns the backends enabled in config, in push order.
+func syncBackends(config *CONFIG) []SyncBackend {
+	var backends []SyncBackend
+	if config.GitEnabled {
+		backends = append(backends, gitBackend{})
+	}
+	if config.NotionEnabled {
+		backends = append(backends, notionBackend{})
+	}
+	if config.WebhookURL != "" {
+		backends = append(backends, webhookBackend{})
+	}
+	return backends
+}
+
+// syncNote runs a note through its pipeline (see pipeline.go): by default
+// the publish checks, then every enabled backend its type syncs to.
+// Backends next to each other in the pipeline push at the same time, each
+// retrying on its own, except one that writes the note, which goes first so
+// the others push what it wrote. A failing backend is reported but doesn't
+// stop the others; a failing format or lint stage stops the pipeline. The
+// returned error says whether the note went everywhere it should have.
+func syncNote(config *CONFIG, backends []SyncBackend, t NoteType, notePath string) error {
+	if len(backends) == 0 {
+		return nil
+	}
+	stages, err := notePipeline(config, backends, notePath)
+	if err != nil {
+		log.Printf("Could not run the sync pipeline: %v", err)
+		return err
+	}
+	failed, code := 0, ErrorCode("")
+	for len(stages) > 0 {
+		if name := stages[0].Name(); !isBackend(name) {
+			if err := stages[0].Push(config, notePath); err != nil {
+				if !stages[0].continueOnError {
+					log.Printf("Sync stopped at %s: %v", name, err)
+					return err
+				}
+				log.Printf("Sync stage %s failed: %v", name, err)
+				failed, code = failed+1, errorCode(err)
+			}
+			stages = stages[1:]
+			continue
+		}
+
+		var group []syncStage
+		for len(stages) > 0 && isBackend(stages[0].Name()) {
+			if name := stages[0].Name(); t.syncsTo(name) && hasBackend(backends, name) {
+				group = append(group, stages[0])
+			}
+			stages = stages[1:]
+		}
+		errs := make([]error, len(group))
+		for i, stage := range group {
+			if writesNote(config, stage.Name()) {
+				errs[i] = pushWithRetry(config, stage, notePath)
+			}
+		}
+		var wg sync.WaitGroup
+		for i, stage := range group {
+			if writesNote(config, stage.Name()) {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = pushWithRetry(config, stage, notePath)
+			}()
+		}
+		wg.Wait()
+
+		stop := false
+		for i, stage := range group {
+			syncTally.add(stage.Name(), errs[i])
+			if errs[i] != nil && errorCode(errs[i]) == ErrBudgetExceeded {
+				log.Printf("Not syncing note to %s: %v", stage.Name(), errs[i])
+				failed, code = failed+1, ErrBudgetExceeded
+			} else if errs[i] != nil {
+				log.Printf(tr("Error syncing note to %s: %v"), stage.Name(), errs[i])
+				failed, code = failed+1, errorCode(errs[i])
+				stop = stop || !stage.continueOnError
+			} else {
+				fmt.Printf(tr("Note synced to %s.\n"), stage.Name())
+			}
+		}
+		if stop {
+			break
+		}
+	}
+	if failed > 0 {
+		return codeErrorf(code, "%s: %d stage(s) failed", notePath, failed)
+	}
+	return nil
+}
+
+// hasBackend reports whether the named backend is enabled, so a pipeline
+// naming notion does nothing until NOTION_ENABLED is set.
+func hasBackend(backends []SyncBackend, name string) bool {
+	for _, b := range backends {
+		if b.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runSync pushes existing notes to the enabled backends again, for notes
+// edited outside `syt new`.
+func runSync(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "merge" {
+		return runSyncMerge(config, args[1:])
+	}
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	fs.BoolVar(&config.Force, "force", false, "sync even if a note tagged publish fails its checks")
+	pending := fs.Bool("pending", false, "sync the notes an interrupted run left unsynced")
+	push := fs.Bool("push", false, "squash and push the commits GIT_SQUASH_WINDOW is holding back")
+	all := fs.Bool("all", false, "sync every note git sees as changed")
+	batch := fs.Bool("batch", config.GitBatchCommits, "commit the notes together instead of one commit each")
+	retryFailed := fs.Bool("retry-failed", false, "sync notes again to the backends that failed to take them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *retryFailed && !*pending && !*push && !*all && fs.NArg() == 0:
+		return runSyncRetryFailed(config)
+	case *pending && !*push && !*all && fs.NArg() == 0:
+		return runSyncPending(config)
+	case *push && !*pending && !*all && fs.NArg() == 0:
+		n, err := pushSquashed(config, true)
+		if err == nil {
+			fmt.Printf("Pushed %d held commit(s).\n", n)
+		}
+		return err
+	case (fs.NArg() == 0) == !*all || *pending || *push || *retryFailed:
+		return fmt.Errorf("usage: syt sync [--force] [--batch] <note>... | syt sync --all [--batch] | syt sync --pending | syt sync --retry-failed | syt sync --push | syt sync merge")
+	}
+	backends := syncBackends(config)
+	if len(backends) == 0 {
+		return fmt.Errorf("no sync backend enabled (set GIT_ENABLED or NOTION_ENABLED)")
+	}
+	paths := fs.Args()
+	var deleted []string
+	if *all {
+		var err error
+		if paths, deleted, err = changedNotes(config); err != nil {
+			return err
+		}
+		if len(paths)+len(deleted) == 0 {
+			fmt.Println("No notes have changed.")
+			return nil
+		}
+	}
+	if *batch && config.GitEnabled {
+		gitBatch = &[]string{}
+		defer func() { gitBatch = nil }()
+	} else if len(deleted) > 0 {
+		fmt.Printf("Not syncing %d deleted note(s) without --batch.\n", len(deleted))
+	}
+
+	syncTally = &syncSummary{}
+	defer func() { syncTally = nil }()
+	failed, code := 0, ErrorCode("")
+	for _, arg := range paths {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			return err
+		}
+		note, err := readNote(path)
+		if err != nil {
+			return err
+		}
+		var t NoteType
+		if note.Meta["type"] != "" {
+			t, _ = lookupType(note.Meta["type"])
+		}
+		if err := syncTracked(config, backends, t, path); err != nil {
+			failed, code = failed+1, errorCode(err)
+		}
+	}
+	if gitBatch != nil {
+		notes := append(*gitBatch, deleted...)
+		gitBatch = nil
+		if err := commitBatch(config, notes); err != nil {
+			log.Printf(tr("Error syncing note to %s: %v"), "git", err)
+			failed, code = failed+len(notes), errorCode(err)
+			syncTally.batchFailed("git", len(notes)-len(deleted), len(deleted))
+			// Offer them again next time, as an interrupted sync would be
+			for _, path := range notes {
+				markPending(config, path)
+				recordFailure(config, "git", path, err, 1)
+			}
+		}
+	}
+	if len(paths)+len(deleted) > 1 || failed > 0 {
+		syncTally.print()
+	}
+	if failed > 0 {
+		return codeErrorf(code, "%d note(s) did not sync completely", failed)
+	}
+	return nil
+}
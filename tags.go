@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+func runTags(config *CONFIG, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "rename":
+			if len(args) != 3 {
+				return fmt.Errorf("usage: syt tags rename <from> <to>")
+			}
+			return renameTag(config, args[1], args[2])
+		case "suggest":
+			if len(args) != 2 {
+				return fmt.Errorf("usage: syt tags suggest <note>")
+			}
+			path, err := resolveNote(config, args[1])
+			if err != nil {
+				return err
+			}
+			return offerTags(config, path, false)
+		case "notes":
+			if len(args) != 2 {
+				return fmt.Errorf("usage: syt tags notes <tag>")
+			}
+			return printTaggedNotes(config, args[1])
+		}
+	}
+
+	fs := flag.NewFlagSet("tags", flag.ContinueOnError)
+	tree := fs.Bool("tree", false, "show nested tags as a tree")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, note := range notes {
+		for _, tag := range noteTags(note) {
+			counts[foldText(tag)]++
+		}
+	}
+	if *tree {
+		printTagTree(counts, config.Accessible)
+		return nil
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		fmt.Printf("%-30s %d\n", tag, counts[tag])
+	}
+	return nil
+}
+
+type tagNode struct {
+	total    int // notes tagged anywhere in this subtree
+	children map[string]*tagNode
+}
+
+// printTagTree renders tags split on "/" as an indented tree, showing the
+// number of tagged notes in each subtree. In accessible mode every line
+// carries the full tag path instead of relying on box-drawing indentation.
+func printTagTree(counts map[string]int, accessible bool) {
+	root := &tagNode{children: map[string]*tagNode{}}
+	for tag, n := range counts {
+		node := root
+		for _, part := range strings.Split(tag, "/") {
+			child := node.children[part]
+			if child == nil {
+				child = &tagNode{children: map[string]*tagNode{}}
+				node.children[part] = child
+			}
+			child.total += n
+			node = child
+		}
+	}
+	printTagNode(root, "", "", accessible)
+}
+
+func printTagNode(node *tagNode, prefix, path string, accessible bool) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		child := node.children[name]
+		if accessible {
+			fmt.Printf("%s%s: %d note(s)\n", path, name, child.total)
+			printTagNode(child, "", path+name+"/", true)
+			continue
+		}
+		branch, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Printf("%s%s%s (%d)\n", prefix, branch, name, child.total)
+		printTagNode(child, prefix+indent, "", false)
+	}
+}
+
+func printTaggedNotes(config *CONFIG, tag string) error {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if hasTag(note, tag) {
+			fmt.Printf("%s  %s  %s\n", noteDate(note).Format("2006-01-02"), note.Path, displayTitle(state, note))
+		}
+	}
+	return nil
+}
+
+// renameTag renames from to to in every note, carrying nested tags along:
+// renaming project/apollo to project/artemis also turns
+// project/apollo/design into project/artemis/design.
+func renameTag(config *CONFIG, from, to string) error {
+	from, to = strings.Trim(from, "/"), strings.Trim(to, "/")
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	renames := map[*Note][]string{}
+	var affected []*Note
+	depth := len(strings.Split(from, "/"))
+	for _, note := range notes {
+		tags := noteTags(note)
+		changed := false
+		for i, tag := range tags {
+			if tagMatches(tag, from) {
+				// The match is on folded text, so keep the nested part by
+				// segments rather than by from's length in bytes
+				tags[i] = strings.Join(append([]string{to}, strings.Split(tag, "/")[depth:]...), "/")
+				changed = true
+			}
+		}
+		if changed {
+			renames[note] = tags
+			affected = append(affected, note)
+		}
+	}
+	if err := confirm(config, fmt.Sprintf(tr("Rename tag %s to %s"), from, to), len(affected)); err != nil {
+		return err
+	}
+
+	op := beginOperation(config, fmt.Sprintf("tags rename %s %s", from, to))
+	renamed := 0
+	for _, note := range affected {
+		tags := renames[note]
+		content, err := os.ReadFile(note.Path)
+		if err != nil {
+			return err
+		}
+		updated := setFrontmatter(string(content), "tags", formatTags(dedupe(tags)))
+		if err := op.saveBefore(note.Path); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(note.Path, []byte(updated)); err != nil {
+			return err
+		}
+		renamed++
+	}
+	fmt.Printf(tr("Renamed %s to %s in %d note(s).\n"), from, to, renamed)
+	return op.commit()
+}
+
+func dedupe(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		if key := foldText(v); !seen[key] {
+			seen[key] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
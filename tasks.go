@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// taskLine matches a markdown checkbox, "- [ ] call Bob" or "* [x] done",
+// keeping the indent and bullet so the box can be ticked in place.
+var taskLine = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+\[)([ xX])(\]\s+)(.*)$`)
+
+// taskDue picks up an optional due date written into the task's text.
+var taskDue = regexp.MustCompile(`(?:^|\s)due:(\d{4}-\d{2}-\d{2})\b`)
+
+// Task is a checkbox in a note.
+type Task struct {
+	UID  string
+	Path string
+	Line int // 0-based, within the whole file
+	Text string
+	Done bool
+	Due  time.Time
+	Note *Note
+}
+
+// noteTasks finds the checkboxes in a note. A task's UID comes from its note
+// and text, so it survives lines moving around; identical tasks in one note
+// are told apart by how many came before.
+func noteTasks(config *CONFIG, note *Note, content string) []Task {
+	var tasks []Task
+	seen := map[string]int{}
+	inFence := false
+	for i, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		m := taskLine.FindStringSubmatch(line)
+		if inFence || m == nil {
+			continue
+		}
+		text := strings.TrimSpace(m[4])
+		key := visitKey(config, note.Path) + "\n" + text
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s\n%d", key, seen[key])))
+		seen[key]++
+		t := Task{UID: hex.EncodeToString(sum[:10]), Path: note.Path, Line: i, Text: text, Done: m[2] != " ", Note: note}
+		if d := taskDue.FindStringSubmatch(text); d != nil {
+			t.Due, _ = time.ParseInLocation("2006-01-02", d[1], time.Local)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// vaultTasks returns every task in the vault; with openOnly, just those
+// still to do.
+func vaultTasks(config *CONFIG, openOnly bool) ([]Task, error) {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for _, note := range notes {
+		content, err := os.ReadFile(note.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range noteTasks(config, note, string(content)) {
+			if !openOnly || !t.Done {
+				tasks = append(tasks, t)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// setTaskDone ticks or unticks the task with uid in its note, recorded as an
+// undoable operation. It reports whether the task was found.
+func setTaskDone(config *CONFIG, uid string, done bool) (bool, error) {
+	tasks, err := vaultTasks(config, false)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tasks {
+		if t.UID != uid {
+			continue
+		}
+		if t.Done == done {
+			return true, nil
+		}
+		content, err := os.ReadFile(t.Path)
+		if err != nil {
+			return true, err
+		}
+		lines := strings.Split(string(content), "\n")
+		box := " "
+		if done {
+			box = "x"
+		}
+		lines[t.Line] = taskLine.ReplaceAllString(lines[t.Line], "${1}"+box+"${3}${4}")
+
+		op := beginOperation(config, "tasks done "+visitKey(config, t.Path))
+		if err := op.saveBefore(t.Path); err != nil {
+			return true, err
+		}
+		if err := writeFileAtomic(t.Path, []byte(strings.Join(lines, "\n"))); err != nil {
+			return true, err
+		}
+		return true, op.commit()
+	}
+	return false, nil
+}
+
+// runTasks lists open tasks or exports them as an iCalendar file of VTODOs.
+// `syt serve` also offers them as a CalDAV collection at /dav/tasks/.
+func runTasks(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "export" {
+		fs := flag.NewFlagSet("tasks export", flag.ContinueOnError)
+		out := fs.String("o", "", "write to this file instead of stdout")
+		all := fs.Bool("all", false, "include completed tasks")
+		filter := addNoteFilter(fs)
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		tasks, err := vaultTasks(config, !*all)
+		if err != nil {
+			return err
+		}
+		if tasks, err = tasksMatching(config, tasks, filter); err != nil {
+			return err
+		}
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		_, err = io.WriteString(w, icalendar(config, tasks...))
+		return err
+	}
+
+	fs := flag.NewFlagSet("tasks", flag.ContinueOnError)
+	all := fs.Bool("all", false, "include completed tasks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tasks, err := vaultTasks(config, !*all)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		box := "[ ]"
+		if t.Done {
+			box = "[x]"
+		}
+		fmt.Printf("%s %s  (%s:%d)\n", box, t.Text, visitKey(config, t.Path), t.Line+1)
+	}
+	return nil
+}
+
+// tasksMatching keeps the tasks in notes filter matches.
+func tasksMatching(config *CONFIG, tasks []Task, filter *noteFilter) ([]Task, error) {
+	if !filter.active() {
+		return tasks, nil
+	}
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return nil, err
+	}
+	kept := map[string]bool{}
+	for _, note := range filter.filter(notes) {
+		kept[note.Path] = true
+	}
+	var out []Task
+	for _, t := range tasks {
+		if kept[t.Path] {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// icalendar renders tasks as a VCALENDAR with one VTODO each.
+func icalendar(config *CONFIG, tasks ...Task) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//syt//tasks//EN\r\n")
+	for _, t := range tasks {
+		b.WriteString(vtodo(config, t))
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+func vtodo(config *CONFIG, t Task) string {
+	var b strings.Builder
+	prop := func(name, value string) { b.WriteString(foldICS(name + ":" + value)) }
+	prop("BEGIN", "VTODO")
+	prop("UID", t.UID+"@syt")
+	prop("DTSTAMP", t.Note.ModTime.UTC().Format("20060102T150405Z"))
+	prop("LAST-MODIFIED", t.Note.ModTime.UTC().Format("20060102T150405Z"))
+	prop("SUMMARY", escapeICS(strings.TrimSpace(taskDue.ReplaceAllString(t.Text, ""))))
+	prop("DESCRIPTION", escapeICS(t.Note.Title+" ("+visitKey(config, t.Path)+")"))
+	if t.Done {
+		prop("STATUS", "COMPLETED")
+	} else {
+		prop("STATUS", "NEEDS-ACTION")
+	}
+	if !t.Due.IsZero() {
+		prop("DUE;VALUE=DATE", t.Due.Format("20060102"))
+	}
+	if tags := noteTags(t.Note); len(tags) > 0 {
+		for i := range tags {
+			tags[i] = escapeICS(tags[i])
+		}
+		prop("CATEGORIES", strings.Join(tags, ","))
+	}
+	prop("END", "VTODO")
+	return b.String()
+}
+
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICS ends a content line, folding it at 75 octets as RFC 5545 asks
+// without splitting a UTF-8 sequence.
+func foldICS(line string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateData is what note templates can refer to, e.g. {{.Title}} or
+// {{.Now.Format "Monday 2 January"}}.
+type templateData struct {
+	Title  string
+	Date   string // 2006-01-02
+	Time   string // 15:04
+	Now    time.Time
+	Author string
+	Type   string
+	Tags   []string
+}
+
+func newTemplateData(config *CONFIG, title, typeName string, tags []string) templateData {
+	now := currentTime()
+	return templateData{
+		Title:  title,
+		Date:   now.Format("2006-01-02"),
+		Time:   now.Format("15:04"),
+		Now:    now,
+		Author: noteAuthor(config),
+		Type:   typeName,
+		Tags:   tags,
+	}
+}
+
+// templatesDir holds the user's note templates, next to the config file.
+func templatesDir() string {
+	if path := configPath(); path != "" {
+		return filepath.Join(filepath.Dir(path), "templates")
+	}
+	return ""
+}
+
+// loadTemplate reads the template called name from the templates directory,
+// falling back to the bundled ones.
+func loadTemplate(config *CONFIG, name string) (string, error) {
+	file := strings.TrimSuffix(name, ".md") + ".md"
+	if filepath.Base(file) != file {
+		return "", fmt.Errorf("invalid template name %q", name)
+	}
+	if dir := templatesDir(); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	data, err := readAsset(config, "templates/"+file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("no template %q in %s", name, templatesDir())
+	}
+	return string(data), err
+}
+
+// renderTemplate executes a note template. Referring to a field that doesn't
+// exist is an error rather than a silent blank.
+func renderTemplate(name, text string, data any) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"join":  strings.Join,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// commitData is what GIT_COMMIT_MESSAGE can refer to: the note template
+// fields, with Title falling back to the file name, and the note's Path in
+// the vault, its File name and the Action, Add or Update.
+type commitData struct {
+	templateData
+	Path   string
+	File   string
+	Action string
+}
+
+// commitMessage renders GIT_COMMIT_MESSAGE for a commit of the note at path.
+func commitMessage(config *CONFIG, path string, tracked bool) (string, error) {
+	data := commitData{
+		Path:   relNotePath(config.NotesDir, path),
+		File:   filepath.Base(path),
+		Action: "Add",
+	}
+	if tracked {
+		data.Action = "Update"
+	}
+	name := data.File
+	if isSealed(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	title, typeName, tags := strings.TrimSuffix(name, ".md"), "", []string(nil)
+	if note, err := readNote(path); err == nil {
+		if note.Meta["title"] != "" {
+			title = note.Meta["title"]
+		}
+		typeName, tags = note.Meta["type"], noteTags(note)
+	}
+	data.templateData = newTemplateData(config, title, typeName, tags)
+
+	message, err := renderTemplate("GIT_COMMIT_MESSAGE", config.GitCommitMessage, data)
+	if err != nil {
+		return "", withCode(ErrConfigInvalid, err)
+	}
+	if message = strings.TrimSpace(message); message == "" {
+		return "", codeErrorf(ErrConfigInvalid, "GIT_COMMIT_MESSAGE gives an empty message for %s", data.Path)
+	}
+	return message, nil
+}
+
+// noteAuthor is NOTE_AUTHOR, else the git user name, else the login name.
+func noteAuthor(config *CONFIG) string {
+	if config.NoteAuthor != "" {
+		return config.NoteAuthor
+	}
+	if out, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return name
+		}
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// textFolding controls how foldText normalises text for matching. It is set
+// from the configuration at startup.
+var textFolding = struct {
+	diacritics bool // "café" matches "cafe"
+	turkish    bool // Turkish/Azeri casing: I ↔ ı, İ ↔ i
+}{diacritics: true}
+
+var (
+	decompositions = map[rune][2]rune{}
+	compositions   = map[[2]rune]rune{}
+)
+
+// foldedLetters are letters with a stroke or similar that have no canonical
+// decomposition but should still match their base letter.
+var foldedLetters = map[rune]string{
+	'ø': "o", 'ł': "l", 'đ': "d", 'ħ': "h", 'ŧ': "t", 'ß': "ss", 'æ': "ae", 'œ': "oe",
+}
+
+func init() {
+	for _, p := range canonicalPairs {
+		decompositions[p[0]] = [2]rune{p[1], p[2]}
+		compositions[[2]rune{p[1], p[2]}] = p[0]
+	}
+}
+
+func setTextFolding(config *CONFIG) {
+	textFolding.diacritics = config.FoldDiacritics
+	lang := strings.ToLower(config.TextLocale)
+	textFolding.turkish = strings.HasPrefix(lang, "tr") || strings.HasPrefix(lang, "az")
+}
+
+// composeText puts s in composed form, merging base letters and combining
+// marks into precomposed letters (NFC for Latin, Greek and Cyrillic text), so
+// "e" + U+0301 and "é" compare equal.
+func composeText(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if n := len(out); n > 0 && unicode.Is(unicode.Mn, r) {
+			if c, ok := compositions[[2]rune{out[n-1], r}]; ok {
+				out[n-1] = c
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// foldText normalises s for comparisons: composed form, locale-aware case
+// folding and, unless disabled, removal of diacritics.
+func foldText(s string) string {
+	s = composeText(s)
+	if textFolding.turkish {
+		s = strings.ToLowerSpecial(unicode.TurkishCase, s)
+	} else {
+		s = strings.ToLower(s)
+	}
+	s = strings.NewReplacer("ß", "ss", "ẞ", "ss", "ς", "σ").Replace(s)
+	if !textFolding.diacritics {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if f, ok := foldedLetters[r]; ok {
+			b.WriteString(f)
+			continue
+		}
+		for {
+			d, ok := decompositions[r]
+			if !ok {
+				break
+			}
+			r = d[0]
+		}
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
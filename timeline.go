@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// journalEntry matches an entry `syt add` wrote into a daily note.
+var journalEntry = regexp.MustCompile(`^- (\d{2}):(\d{2}) (.*)$`)
+
+// timelineItem is one dated point in a topic's history.
+type timelineItem struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"` // note, journal, task, remind, expire or publish
+	Title   string    `json:"title"`
+	Snippet string    `json:"snippet,omitempty"`
+	Path    string    `json:"path"`
+}
+
+// runTimeline tells the story of a tag: the notes carrying or mentioning it,
+// journal entries and tasks that mention it, and the tagged notes' scheduled
+// events, oldest first.
+func runTimeline(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("timeline", flag.ContinueOnError)
+	tag := fs.String("tag", "", "the tag to follow, nested tags included")
+	since := fs.String("since", "", "leave out anything before this date")
+	asJSON := fs.Bool("json", false, "print the timeline as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tag == "" && fs.NArg() == 1 {
+		*tag = fs.Arg(0)
+	}
+	*tag = strings.TrimPrefix(*tag, "#")
+	if *tag == "" {
+		return fmt.Errorf("usage: syt timeline [--since date] [--json] --tag <tag>")
+	}
+	var from time.Time
+	if *since != "" {
+		t, err := parseTimestamp(*since)
+		if err != nil {
+			return err
+		}
+		from = t
+	}
+
+	notes, err := vaultNotes(config, true)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	var items []timelineItem
+	for _, note := range notes {
+		items = append(items, noteTimeline(config, state, note, *tag)...)
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if !item.Time.Before(from) {
+			kept = append(kept, item)
+		}
+	}
+	items = kept
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Time.Before(items[j].Time) })
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+	if len(items) == 0 {
+		fmt.Printf("Nothing mentions #%s.\n", *tag)
+		return nil
+	}
+	month := ""
+	for _, item := range items {
+		if m := item.Time.Format("January 2006"); m != month {
+			if month != "" {
+				fmt.Println()
+			}
+			fmt.Println(m)
+			month = m
+		}
+		fmt.Printf("  %s  %-7s  %s (%s)\n", item.Time.Format("2006-01-02 15:04"), item.Kind, item.Title, item.Path)
+		if item.Snippet != "" {
+			fmt.Printf("                            %s\n", item.Snippet)
+		}
+	}
+	return nil
+}
+
+// noteTimeline collects what one note contributes to tag's timeline.
+func noteTimeline(config *CONFIG, state *State, note *Note, tag string) []timelineItem {
+	mention := regexp.MustCompile(`(?i)(^|[^\w#])#` + regexp.QuoteMeta(tag) + `(/[\w/-]*)?\b`)
+	path := visitKey(config, note.Path)
+	title := displayTitle(state, note)
+	lines := strings.Split(note.Body, "\n")
+	var items []timelineItem
+
+	tagged := hasTag(note, tag)
+	mentioned := ""
+	for _, line := range lines {
+		if mention.MatchString(line) {
+			mentioned = line
+			break
+		}
+	}
+
+	// Journal entries and tasks stand on their own, so a daily note that
+	// merely mentions the tag in one entry doesn't show up as a whole
+	entries := false
+	if note.Meta["type"] == "journal" {
+		day := noteDate(note)
+		for _, line := range lines {
+			m := journalEntry.FindStringSubmatch(line)
+			if m == nil || (!tagged && !mention.MatchString(line)) {
+				continue
+			}
+			var hour, min int
+			fmt.Sscanf(m[1]+" "+m[2], "%d %d", &hour, &min)
+			at := time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, day.Location())
+			items = append(items, timelineItem{Time: at, Kind: "journal", Title: abbreviate(m[3]), Path: path})
+			entries = true
+		}
+	}
+	for _, t := range noteTasks(config, note, note.Body) {
+		if !t.Due.IsZero() && (tagged || mention.MatchString(t.Text)) {
+			title := "[ ] " + t.Text
+			if t.Done {
+				title = "[x] " + t.Text
+			}
+			items = append(items, timelineItem{Time: t.Due, Kind: "task", Title: abbreviate(title), Path: path})
+		}
+	}
+
+	if (tagged || mentioned != "") && !entries {
+		snippet := mentioned
+		if snippet == "" {
+			snippet = firstParagraph(note.Body)
+		}
+		items = append(items, timelineItem{Time: noteDate(note), Kind: "note", Title: title, Snippet: abbreviate(snippet), Path: path})
+	}
+	if tagged {
+		// Recurrences repeat the note itself, so only one-off events count
+		for _, e := range noteEvents(note, time.Time{}, currentTime().AddDate(1, 0, 0)) {
+			if e.Kind != "recur" {
+				items = append(items, timelineItem{Time: e.Time, Kind: e.Kind, Title: title, Path: path})
+			}
+		}
+	}
+	return items
+}
+
+// firstParagraph returns the first line of prose in a note body.
+func firstParagraph(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "```") {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves the certificate in SERVE_TLS_CERT/SERVE_TLS_KEY and
+// reloads it when the files change, so a certificate renewed by certbot, lego
+// or acme.sh is picked up without restarting `syt serve`. ACME isn't done
+// in-process: that needs golang.org/x/crypto/acme, and syt sticks to the
+// standard library.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load returns the current certificate, rereading the files at most every
+// few seconds and only when their modification time moved. A renewal that
+// leaves a broken pair keeps the previous certificate in use.
+func (r *certReloader) load() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.cert != nil && now.Sub(r.checked) < 5*time.Second {
+		return r.cert, nil
+	}
+	r.checked = now
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if r.cert != nil {
+				return r.cert, nil
+			}
+			return nil, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if r.cert != nil && !latest.After(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	r.cert, r.modTime = &cert, latest
+	return r.cert, nil
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.load()
+		},
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Token scopes. Capture and read tokens can do only what their scope says,
+// so a read-only dashboard can't write; full tokens can do everything.
+const (
+	scopeCapture = "capture" // append to the journal, nothing else
+	scopeRead    = "read"    // list, read and search notes
+	scopeFull    = "full"    // everything, including writes and deletes
+)
+
+// APIToken is a credential for `syt serve`. Only a hash of the secret is
+// stored; the secret itself is shown once, when it is created or rotated.
+type APIToken struct {
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	Hash    string    `json:"hash"`
+	Rate    string    `json:"rate,omitempty"` // e.g. "60/m"; empty means unlimited
+	Created time.Time `json:"created"`
+	// After a rotation the previous secret keeps working until PrevExpires
+	PrevHash    string    `json:"prev_hash,omitempty"`
+	PrevExpires time.Time `json:"prev_expires,omitempty"`
+}
+
+// allows reports whether the token's scope covers the required one.
+func (t *APIToken) allows(required string) bool {
+	switch t.Scope {
+	case scopeFull:
+		return true
+	case scopeRead, scopeCapture:
+		return required == t.Scope
+	}
+	return false
+}
+
+func tokensPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "tokens.json")
+}
+
+func loadTokens(config *CONFIG) ([]*APIToken, error) {
+	data, err := os.ReadFile(tokensPath(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("corrupt token file %s: %w", tokensPath(config), err)
+	}
+	return tokens, nil
+}
+
+// updateTokens applies fn to the token file under its lock.
+func updateTokens(config *CONFIG, fn func([]*APIToken) ([]*APIToken, error)) error {
+	if err := os.MkdirAll(stateDir(config), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLock(tokensPath(config) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tokens, err := loadTokens(config)
+	if err != nil {
+		return err
+	}
+	if tokens, err = fn(tokens); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The file only holds hashes, but there's no reason for others to read it
+	tmp := tokensPath(config) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, tokensPath(config))
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "syt_" + hex.EncodeToString(b), nil
+}
+
+// matchToken finds the token a secret belongs to.
+func matchToken(tokens []*APIToken, secret string, now time.Time) *APIToken {
+	hash := hashToken(secret)
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			return t
+		}
+		if t.PrevHash != "" && now.Before(t.PrevExpires) &&
+			subtle.ConstantTimeCompare([]byte(t.PrevHash), []byte(hash)) == 1 {
+			return t
+		}
+	}
+	return nil
+}
+
+// parseRate reads a limit such as "60/m", "5/s" or "1000/h".
+func parseRate(rate string) (int, time.Duration, error) {
+	if rate == "" {
+		return 0, 0, nil
+	}
+	n, unit, ok := strings.Cut(rate, "/")
+	count, err := strconv.Atoi(n)
+	if !ok || err != nil || count <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q (want e.g. 60/m)", rate)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return 0, 0, fmt.Errorf("invalid rate unit in %q (want s, m or h)", rate)
+	}
+	return count, per, nil
+}
+
+// rateLimiter keeps a token bucket per API token.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes one request from the token's bucket, reporting whether the
+// token is within its rate.
+func (l *rateLimiter) allow(t *APIToken, now time.Time) bool {
+	count, per, err := parseRate(t.Rate)
+	if err != nil || count == 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	b := l.buckets[t.Name]
+	if b == nil {
+		b = &bucket{tokens: float64(count), last: now}
+		l.buckets[t.Name] = b
+	}
+	b.tokens = min(float64(count), b.tokens+now.Sub(b.last).Seconds()*float64(count)/per.Seconds())
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// runToken manages API tokens: add, list, rotate and revoke.
+func runToken(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		tokens, err := loadTokens(config)
+		if err != nil {
+			return err
+		}
+		sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPE\tRATE\tCREATED")
+		for _, t := range tokens {
+			rate := t.Rate
+			if rate == "" {
+				rate = "unlimited"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, t.Scope, rate, t.Created.Format("2006-01-02"))
+		}
+		return w.Flush()
+
+	case "add":
+		fs := flag.NewFlagSet("serve token add", flag.ContinueOnError)
+		scope := fs.String("scope", scopeRead, "capture, read or full")
+		rate := fs.String("rate", "", "request limit such as 60/m (default unlimited)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: syt serve token add [--scope capture|read|full] [--rate 60/m] <name>")
+		}
+		if *scope != scopeCapture && *scope != scopeRead && *scope != scopeFull {
+			return fmt.Errorf("unknown scope %q (want capture, read or full)", *scope)
+		}
+		if _, _, err := parseRate(*rate); err != nil {
+			return err
+		}
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		name := fs.Arg(0)
+		err = updateTokens(config, func(tokens []*APIToken) ([]*APIToken, error) {
+			for _, t := range tokens {
+				if t.Name == name {
+					return nil, fmt.Errorf("token %q already exists; rotate or revoke it", name)
+				}
+			}
+			return append(tokens, &APIToken{Name: name, Scope: *scope, Hash: hashToken(secret), Rate: *rate, Created: currentTime()}), nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s token %q. It won't be shown again:\n%s\n", *scope, name, secret)
+		return nil
+
+	case "rotate":
+		fs := flag.NewFlagSet("serve token rotate", flag.ContinueOnError)
+		grace := fs.Duration("grace", 24*time.Hour, "how long the old secret keeps working")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: syt serve token rotate [--grace 24h] <name>")
+		}
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		err = updateTokens(config, func(tokens []*APIToken) ([]*APIToken, error) {
+			for _, t := range tokens {
+				if t.Name == fs.Arg(0) {
+					t.PrevHash, t.PrevExpires = t.Hash, currentTime().Add(*grace)
+					t.Hash = hashToken(secret)
+					return tokens, nil
+				}
+			}
+			return nil, fmt.Errorf("no token named %q", fs.Arg(0))
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotated %q; the old secret works for another %s. New secret:\n%s\n", fs.Arg(0), *grace, secret)
+		return nil
+
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: syt serve token revoke <name>")
+		}
+		return updateTokens(config, func(tokens []*APIToken) ([]*APIToken, error) {
+			for i, t := range tokens {
+				if t.Name == args[1] {
+					fmt.Printf("Revoked token %q.\n", t.Name)
+					return append(tokens[:i], tokens[i+1:]...), nil
+				}
+			}
+			return nil, fmt.Errorf("no token named %q", args[1])
+		})
+	}
+	return fmt.Errorf("unknown token command %q", args[0])
+}
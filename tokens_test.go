@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenAllows(t *testing.T) {
+	tests := []struct {
+		scope, required string
+		want            bool
+	}{
+		{scopeCapture, scopeCapture, true},
+		{scopeCapture, scopeRead, false},
+		{scopeCapture, scopeFull, false},
+		{scopeRead, scopeCapture, false},
+		{scopeRead, scopeRead, true},
+		{scopeRead, scopeFull, false},
+		{scopeFull, scopeCapture, true},
+		{scopeFull, scopeRead, true},
+		{scopeFull, scopeFull, true},
+		{"admin", scopeRead, false},
+	}
+	for _, tt := range tests {
+		token := &APIToken{Name: "t", Scope: tt.scope}
+		if got := token.allows(tt.required); got != tt.want {
+			t.Errorf("%s token allows %s = %v, want %v", tt.scope, tt.required, got, tt.want)
+		}
+	}
+}
+
+// testServer is a server with one token of each scope, whose secret is
+// "secret-" and the scope.
+func testServer(t *testing.T) *server {
+	t.Helper()
+	config := &CONFIG{NotesDir: t.TempDir()}
+	err := updateTokens(config, func([]*APIToken) ([]*APIToken, error) {
+		var tokens []*APIToken
+		for _, scope := range []string{scopeCapture, scopeRead, scopeFull} {
+			tokens = append(tokens, &APIToken{Name: scope + "-token", Scope: scope, Hash: hashToken("secret-" + scope)})
+		}
+		return tokens, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server{config: config}
+}
+
+func TestAuthorize(t *testing.T) {
+	s := testServer(t)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	for _, route := range []string{scopeCapture, scopeRead, scopeFull} {
+		handler := s.authorize(route, ok)
+		for _, scope := range []string{"", "wrong", scopeCapture, scopeRead, scopeFull} {
+			r := httptest.NewRequest("GET", "/api/x", nil)
+			if scope != "" {
+				r.Header.Set("Authorization", "Bearer secret-"+scope)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			want := http.StatusForbidden
+			switch {
+			case scope == "" || scope == "wrong":
+				want = http.StatusUnauthorized
+			case scope == route || scope == scopeFull:
+				want = http.StatusNoContent
+			}
+			if w.Code != want {
+				t.Errorf("%q token on a %s route: %d, want %d", scope, route, w.Code, want)
+			}
+		}
+	}
+}
+
+// TestReadTokenCantWrite goes through the real routes, so an endpoint given
+// too weak a scope shows up too.
+func TestReadTokenCantWrite(t *testing.T) {
+	mux := testServer(t).routes()
+	for _, req := range []struct{ method, path string }{
+		{"POST", "/api/capture"},
+		{"POST", "/api/capture?type=scan"},
+		{"PUT", "/api/notes/a.md"},
+		{"DELETE", "/api/notes/a.md"},
+		{"PUT", "/dav/a.ics"},
+	} {
+		r := httptest.NewRequest(req.method, req.path, strings.NewReader("text"))
+		r.Header.Set("Authorization", "Bearer secret-"+scopeRead)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("read token on %s %s: %d, want %d", req.method, req.path, w.Code, http.StatusForbidden)
+		}
+	}
+}
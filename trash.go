@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func trashDir(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "trash")
+}
+
+// runRm moves notes to the trash. `syt undo` puts them back.
+func runRm(config *CONFIG, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: syt rm <note>...")
+	}
+	var paths []string
+	for _, arg := range args {
+		path, err := resolveNote(config, arg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	if err := confirm(config, tr("Move to trash"), len(paths)); err != nil {
+		return err
+	}
+
+	op := beginOperation(config, "rm "+strings.Join(args, " "))
+	for _, path := range paths {
+		if err := trashNote(config, op, path); err != nil {
+			// The notes moved already can still be put back
+			if cerr := op.commit(); cerr != nil {
+				return fmt.Errorf("%w; recording the undo failed: %v", err, cerr)
+			}
+			return err
+		}
+		fmt.Printf(tr("Moved %s to the trash.\n"), path)
+	}
+	return op.commit()
+}
+
+// trashNote moves one note to the trash as part of op.
+func trashNote(config *CONFIG, op *Operation, path string) error {
+	if err := os.MkdirAll(trashDir(config), 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(trashDir(config), currentTime().Format("20060102T150405")+"_"+newID()+"_"+filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	op.moved(path, dest)
+	return nil
+}
+
+// trashEntry is a note sitting in the trash.
+type trashEntry struct {
+	Path    string
+	Trashed time.Time
+	Size    int64
+}
+
+// listTrash returns the trash's contents, oldest first. The time a note was
+// trashed comes from the prefix runRm gives its name.
+func listTrash(config *CONFIG) ([]trashEntry, error) {
+	files, err := os.ReadDir(trashDir(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []trashEntry
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || f.IsDir() {
+			continue
+		}
+		trashed := info.ModTime()
+		if stamp, _, ok := strings.Cut(f.Name(), "_"); ok {
+			if t, err := time.ParseInLocation("20060102T150405", stamp, time.Local); err == nil {
+				trashed = t
+			}
+		}
+		entries = append(entries, trashEntry{Path: filepath.Join(trashDir(config), f.Name()), Trashed: trashed, Size: info.Size()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Trashed.Before(entries[j].Trashed) })
+	return entries, nil
+}
+
+// expiredTrash picks what the retention policy removes: everything older
+// than TRASH_RETENTION, then the oldest notes until the trash fits in
+// TRASH_MAX_SIZE.
+func expiredTrash(config *CONFIG, entries []trashEntry, now time.Time) ([]trashEntry, error) {
+	retention, err := parseRetention(config.TrashRetention)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := parseSize(config.TrashMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []trashEntry
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	for _, e := range entries {
+		if (retention > 0 && now.Sub(e.Trashed) > retention) || (maxSize > 0 && total > maxSize) {
+			expired = append(expired, e)
+			total -= e.Size
+		}
+	}
+	return expired, nil
+}
+
+// purgeTrash permanently deletes what the retention policy expires.
+func purgeTrash(config *CONFIG, dryRun bool) ([]trashEntry, error) {
+	entries, err := listTrash(config)
+	if err != nil {
+		return nil, err
+	}
+	expired, err := expiredTrash(config, entries, currentTime())
+	if err != nil || dryRun {
+		return expired, err
+	}
+	for i, e := range expired {
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return expired[:i], err
+		}
+	}
+	return expired, nil
+}
+
+// runGC applies the trash retention policy and summarizes what went.
+func runGC(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "show what would be removed without removing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	expired, err := purgeTrash(config, true)
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		fmt.Print(tr("Nothing to purge.\n"))
+		return nil
+	}
+	if !*dryRun {
+		if err := confirm(config, tr("Permanently delete from the trash"), len(expired)); err != nil {
+			return err
+		}
+		if expired, err = purgeTrash(config, false); err != nil {
+			return err
+		}
+	}
+	printPurgeSummary(expired, *dryRun)
+	return nil
+}
+
+func printPurgeSummary(expired []trashEntry, dryRun bool) {
+	var freed int64
+	for _, e := range expired {
+		freed += e.Size
+		fmt.Printf("  %s  %s\n", e.Trashed.Format("2006-01-02"), filepath.Base(e.Path))
+	}
+	if dryRun {
+		fmt.Printf(tr("Would purge %d note(s) from the trash (%s).\n"), len(expired), formatSize(freed))
+	} else {
+		fmt.Printf(tr("Purged %d note(s) from the trash (%s freed).\n"), len(expired), formatSize(freed))
+	}
+}
+
+// parseRetention reads a duration such as "30d", "12h" or "0" (keep forever).
+func parseRetention(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid retention %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid retention %q", s)
+	}
+	return d, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}}
+
+// parseSize reads a size such as "100MB" or "512K"; empty means no limit.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, unit = strings.TrimSpace(num), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
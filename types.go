@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NoteType collects the defaults applied to notes whose frontmatter has a
+// matching "type" field.
+type NoteType struct {
+	Name     string
+	Folder   string   // subdirectory of NotesDir the notes live in
+	Template string   // template (relative to NotesDir) rendered into new notes; defaults to the templates/<name>.md asset
+	Sync     []string // backends the notes go to; empty means all enabled ones
+	Required []string // frontmatter fields checked by `syt types lint`
+}
+
+var builtinTypes = map[string]NoteType{
+	"meeting": {Folder: "meetings", Required: []string{"title"}},
+	"adr":     {Folder: "adr", Required: []string{"title", "status"}},
+	"journal": {Folder: "journal", Sync: []string{"git"}},
+	"link":    {Folder: "links"},
+}
+
+// noteTypes returns the built-in types plus any listed in NOTE_TYPES. Each
+// setting can be overridden with NOTE_TYPE_<NAME>_FOLDER, _TEMPLATE, _SYNC
+// and _REQUIRED.
+func noteTypes() map[string]NoteType {
+	names := map[string]bool{}
+	for name := range builtinTypes {
+		names[name] = true
+	}
+	for _, name := range splitList(configValue("NOTE_TYPES")) {
+		names[strings.ToLower(name)] = true
+	}
+
+	types := map[string]NoteType{}
+	for name := range names {
+		t := builtinTypes[name]
+		t.Name = name
+		prefix := "NOTE_TYPE_" + strings.ToUpper(name) + "_"
+		t.Folder = getEnv(prefix+"FOLDER", t.Folder)
+		t.Template = getEnv(prefix+"TEMPLATE", t.Template)
+		if v := configValue(prefix + "SYNC"); v != "" {
+			t.Sync = splitList(v)
+		}
+		if v := configValue(prefix + "REQUIRED"); v != "" {
+			t.Required = splitList(v)
+		}
+		types[name] = t
+	}
+	return types
+}
+
+func lookupType(name string) (NoteType, error) {
+	t, ok := noteTypes()[strings.ToLower(name)]
+	if !ok {
+		return NoteType{}, fmt.Errorf("unknown note type %q", name)
+	}
+	return t, nil
+}
+
+// syncsTo reports whether notes of this type go to the given backend.
+func (t NoteType) syncsTo(backend string) bool {
+	if len(t.Sync) == 0 {
+		return true
+	}
+	for _, b := range t.Sync {
+		if strings.EqualFold(b, backend) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeTemplate returns the template content for new notes of type t.
+func typeTemplate(config *CONFIG, t NoteType) (string, error) {
+	if t.Template == "" {
+		// Fall back to the bundled (or installed) template for the type
+		data, err := readAsset(config, "templates/"+t.Name+".md")
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return string(data), err
+	}
+	data, err := os.ReadFile(filepath.Join(config.NotesDir, t.Template))
+	if err != nil {
+		return "", fmt.Errorf("reading template for type %s: %w", t.Name, err)
+	}
+	return string(data), nil
+}
+
+// fileByType moves a note into its type's folder if it isn't there yet and
+// returns the note's (possibly new) path.
+func fileByType(config *CONFIG, path string) (string, error) {
+	note, err := readNote(path)
+	if err != nil || note.Meta["type"] == "" {
+		return path, err
+	}
+	t, err := lookupType(note.Meta["type"])
+	if err != nil || t.Folder == "" {
+		return path, nil
+	}
+	dir := filepath.Join(config.NotesDir, t.Folder)
+	if filepath.Clean(filepath.Dir(path)) == filepath.Clean(dir) {
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return path, err
+	}
+	dest := filepath.Join(dir, filepath.Base(path))
+	if fileExists(dest) {
+		return path, fmt.Errorf("cannot file note under %s: %s already exists", t.Folder, dest)
+	}
+	return dest, os.Rename(path, dest)
+}
+
+func runTypes(config *CONFIG, args []string) error {
+	if len(args) > 0 && args[0] == "lint" {
+		return lintTypes(config)
+	}
+	types := noteTypes()
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := types[name]
+		sync := "all"
+		if len(t.Sync) > 0 {
+			sync = strings.Join(t.Sync, ",")
+		}
+		fmt.Printf("%-10s folder=%s template=%s sync=%s required=%s\n",
+			name, t.Folder, t.Template, sync, strings.Join(t.Required, ","))
+	}
+	return nil
+}
+
+// lintTypes checks that typed notes carry their type's required fields.
+func lintTypes(config *CONFIG) error {
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	types := noteTypes()
+	problems := 0
+	for _, note := range notes {
+		for _, problem := range typeProblems(types, note) {
+			fmt.Printf("%s: %s\n", note.Path, problem)
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d type problem(s) found", problems)
+	}
+	return nil
+}
+
+// typeProblems lists what's wrong with a note against its declared type.
+func typeProblems(types map[string]NoteType, note *Note) []string {
+	name := strings.ToLower(note.Meta["type"])
+	if name == "" {
+		return nil
+	}
+	t, ok := types[name]
+	if !ok {
+		return []string{fmt.Sprintf("unknown type %q", name)}
+	}
+	var problems []string
+	for _, field := range t.Required {
+		if note.Meta[field] == "" {
+			problems = append(problems, fmt.Sprintf("%s note is missing %q", name, field))
+		}
+	}
+	return problems
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxUndoOperations is how many operations the undo journal remembers.
+const maxUndoOperations = 50
+
+// Operation is an entry in the undo journal: a command that changed notes
+// and what the affected files looked like before it ran.
+type Operation struct {
+	ID      string       `json:"id"`
+	Time    time.Time    `json:"time"`
+	Command string       `json:"command"`
+	Changes []FileChange `json:"changes"`
+	config  *CONFIG
+}
+
+// FileChange describes one file touched by an operation. Backup names the
+// saved copy of its previous content, empty if the file didn't exist; MovedTo
+// is set when the file was moved rather than edited.
+type FileChange struct {
+	Path    string `json:"path"`
+	Backup  string `json:"backup,omitempty"`
+	MovedTo string `json:"moved_to,omitempty"`
+}
+
+func undoDir(config *CONFIG) string {
+	return filepath.Join(stateDir(config), "undo")
+}
+
+func undoJournalPath(config *CONFIG) string {
+	return filepath.Join(undoDir(config), "journal.json")
+}
+
+// beginOperation starts recording an undoable operation. Call saveBefore (or
+// moved) for every file before changing it, then commit.
+func beginOperation(config *CONFIG, command string) *Operation {
+	now := currentTime()
+	return &Operation{
+		ID:      now.Format("20060102T150405.000000000") + "_" + newID(),
+		Time:    now,
+		Command: command,
+		config:  config,
+	}
+}
+
+// saveBefore keeps a copy of path's current content, if it has any.
+func (op *Operation) saveBefore(path string) error {
+	for _, c := range op.Changes {
+		if c.Path == path && c.MovedTo == "" {
+			return nil // the first copy is the one to restore
+		}
+	}
+	change := FileChange{Path: path}
+	content, err := os.ReadFile(path)
+	if err == nil {
+		dir := filepath.Join(undoDir(op.config), op.ID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		change.Backup = fmt.Sprintf("%d_%s", len(op.Changes), filepath.Base(path))
+		if err := os.WriteFile(filepath.Join(dir, change.Backup), content, 0644); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	op.Changes = append(op.Changes, change)
+	return nil
+}
+
+// moved records that from was renamed to to.
+func (op *Operation) moved(from, to string) {
+	op.Changes = append(op.Changes, FileChange{Path: from, MovedTo: to})
+}
+
+// commit appends the operation to the journal, dropping the oldest entries
+// beyond maxUndoOperations. Operations that changed nothing aren't recorded.
+func (op *Operation) commit() error {
+	if len(op.Changes) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(undoDir(op.config), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLock(undoJournalPath(op.config) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ops, err := loadUndoJournal(op.config)
+	if err != nil {
+		return err
+	}
+	ops = append(ops, *op)
+	for len(ops) > maxUndoOperations {
+		os.RemoveAll(filepath.Join(undoDir(op.config), ops[0].ID))
+		ops = ops[1:]
+	}
+	return saveUndoJournal(op.config, ops)
+}
+
+func loadUndoJournal(config *CONFIG) ([]Operation, error) {
+	data, err := os.ReadFile(undoJournalPath(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("corrupt undo journal: %w", err)
+	}
+	return ops, nil
+}
+
+func saveUndoJournal(config *CONFIG, ops []Operation) error {
+	data, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(undoJournalPath(config), data)
+}
+
+// runUndo reverts the most recent operation, or lists the journal.
+func runUndo(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	list := fs.Bool("list", false, "list the operations that can be undone")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(undoDir(config), 0755); err != nil {
+		return err
+	}
+	unlock, err := acquireLock(undoJournalPath(config) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ops, err := loadUndoJournal(config)
+	if err != nil {
+		return err
+	}
+	if *list {
+		for i := len(ops) - 1; i >= 0; i-- {
+			fmt.Printf("%s  %-30s %d file(s)\n", ops[i].Time.Format("2006-01-02 15:04:05"), ops[i].Command, len(ops[i].Changes))
+		}
+		return nil
+	}
+	if len(ops) == 0 {
+		return errors.New(tr("nothing to undo"))
+	}
+
+	op := ops[len(ops)-1]
+	if err := confirm(config, fmt.Sprintf(tr("Undo %q"), op.Command), len(op.Changes)); err != nil {
+		return err
+	}
+	if err := revertOperation(config, op); err != nil {
+		return err
+	}
+	os.RemoveAll(filepath.Join(undoDir(config), op.ID))
+	if err := saveUndoJournal(config, ops[:len(ops)-1]); err != nil {
+		return err
+	}
+	fmt.Printf(tr("Undid %q (%d file(s)).\n"), op.Command, len(op.Changes))
+	return nil
+}
+
+// revertOperation restores files in reverse order of change.
+func revertOperation(config *CONFIG, op Operation) error {
+	dir := filepath.Join(undoDir(config), op.ID)
+	var failed []string
+	for i := len(op.Changes) - 1; i >= 0; i-- {
+		c := op.Changes[i]
+		var err error
+		switch {
+		case c.MovedTo != "":
+			if err = os.MkdirAll(filepath.Dir(c.Path), 0755); err == nil {
+				err = os.Rename(c.MovedTo, c.Path)
+			}
+		case c.Backup != "":
+			var content []byte
+			if content, err = os.ReadFile(filepath.Join(dir, c.Backup)); err == nil {
+				if err = os.MkdirAll(filepath.Dir(c.Path), 0755); err == nil {
+					err = writeFileAtomic(c.Path, content)
+				}
+			}
+		default:
+			// The operation created the file
+			if err = os.Remove(c.Path); os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", c.Path, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not restore:\n  %s", strings.Join(failed, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LinkPreview is the fetched title and description of a captured URL.
+type LinkPreview struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+var (
+	bareURL      = regexp.MustCompile(`^<?(https?://\S+?)>?$`)
+	titleTag     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaTag      = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttr     = regexp.MustCompile(`(?is)(name|property|content)\s*=\s*("[^"]*"|'[^']*')`)
+	collapseWS   = regexp.MustCompile(`\s+`)
+	maxPageBytes = int64(512 << 10)
+)
+
+// linkURL returns the URL a note consists of, ignoring headings and blank
+// lines, or "" when the note is more than a captured link.
+func linkURL(note *Note) string {
+	url := ""
+	for _, line := range strings.Split(note.Body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := bareURL.FindStringSubmatch(line)
+		if m == nil || url != "" {
+			return ""
+		}
+		url = m[1]
+	}
+	return url
+}
+
+// displayTitle is the title to show for a note in listings: the unfurled page
+// title for link notes that have one cached, otherwise the note's own title.
+func displayTitle(state *State, note *Note) string {
+	if url := linkURL(note); url != "" && state != nil {
+		if p, ok := state.Links[url]; ok && p.Title != "" {
+			return p.Title
+		}
+	}
+	return note.Title
+}
+
+func runUnfurl(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("unfurl", flag.ContinueOnError)
+	refresh := fs.Bool("refresh", false, "refetch previews that are already cached")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	notes, err := loadNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	return unfurlNotes(config, notes, *refresh, true)
+}
+
+// unfurlNotes fetches previews for link notes missing from the cache. Fetch
+// failures are reported but don't stop the remaining notes.
+func unfurlNotes(config *CONFIG, notes []*Note, refresh, verbose bool) error {
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	fetched := map[string]LinkPreview{}
+	for _, note := range notes {
+		url := linkURL(note)
+		if url == "" {
+			continue
+		}
+		if _, ok := state.Links[url]; ok && !refresh {
+			continue
+		}
+		preview, err := fetchPreview(url)
+		if err != nil {
+			fmt.Printf("%s: %v\n", url, err)
+			continue
+		}
+		fetched[url] = preview
+		if verbose {
+			fmt.Printf("%s: %s\n", url, preview.Title)
+		}
+	}
+	if len(fetched) == 0 {
+		return nil
+	}
+	return updateState(config, func(s *State) error {
+		if s.Links == nil {
+			s.Links = map[string]LinkPreview{}
+		}
+		for url, p := range fetched {
+			s.Links[url] = p
+		}
+		return nil
+	})
+}
+
+func fetchPreview(url string) (LinkPreview, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return LinkPreview{}, fmt.Errorf("fetching preview: %s", resp.Status)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return LinkPreview{}, err
+	}
+
+	preview := LinkPreview{Fetched: time.Now()}
+	if m := titleTag.FindSubmatch(page); m != nil {
+		preview.Title = cleanText(string(m[1]))
+	}
+	for _, tag := range metaTag.FindAll(page, -1) {
+		var key, content string
+		for _, attr := range metaAttr.FindAllSubmatch(tag, -1) {
+			val := strings.Trim(string(attr[2]), `"'`)
+			if strings.EqualFold(string(attr[1]), "content") {
+				content = val
+			} else {
+				key = strings.ToLower(val)
+			}
+		}
+		switch key {
+		case "og:title":
+			preview.Title = cleanText(content)
+		case "og:description", "description":
+			if preview.Description == "" || key == "og:description" {
+				preview.Description = cleanText(content)
+			}
+		}
+	}
+	return preview, nil
+}
+
+func cleanText(s string) string {
+	return strings.TrimSpace(collapseWS.ReplaceAllString(html.UnescapeString(s), " "))
+}
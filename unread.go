@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// othersChange is the latest commit by someone else to a note.
+type othersChange struct {
+	when   time.Time
+	author string
+	added  bool
+}
+
+// runUnread lists the notes others in a shared vault created or changed
+// since you last read them, newest first, as a small team feed. A note
+// counts as read once syt opened it, you committed to it yourself, or it was
+// marked with --mark. Read times are only kept locally.
+func runUnread(config *CONFIG, args []string) error {
+	fs := flag.NewFlagSet("unread", flag.ContinueOnError)
+	mark := fs.Bool("mark", false, "mark the listed notes, or the ones named, as read")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	root, err := gitRepoRoot(config.GitRepoPath)
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+	state, err := loadState(config)
+	if err != nil {
+		return err
+	}
+	changes, mine, err := othersChanges(root, config.NotesDir, "HEAD")
+	if err != nil {
+		return withCode(ErrGitFailed, err)
+	}
+
+	var unread []string
+	for key, c := range changes {
+		if c.when.After(lastRead(state, key, mine[key])) {
+			unread = append(unread, key)
+		}
+	}
+	sort.Slice(unread, func(i, j int) bool {
+		if a, b := changes[unread[i]].when, changes[unread[j]].when; !a.Equal(b) {
+			return a.After(b)
+		}
+		return unread[i] < unread[j]
+	})
+
+	if *mark {
+		keys := unread
+		if fs.NArg() > 0 {
+			keys = nil
+			for _, arg := range fs.Args() {
+				path, err := resolveNote(config, arg)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, visitKey(config, path))
+			}
+		}
+		if err := markRead(config, keys); err != nil {
+			return err
+		}
+		fmt.Printf("Marked %d note(s) read.\n", len(keys))
+		return nil
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: syt unread [--mark [note...]]")
+	}
+	if len(unread) == 0 {
+		fmt.Println("Nothing new from others.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range unread {
+		c := changes[key]
+		what := "updated"
+		if c.added {
+			what = "new"
+		}
+		title := key
+		if note, err := readNote(filepath.Join(config.NotesDir, filepath.FromSlash(key))); err == nil {
+			title = displayTitle(state, note)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.when.Format("2006-01-02 15:04"), what, c.author, key, title)
+	}
+	return w.Flush()
+}
+
+// lastRead is when a note was last read: the latest of an explicit mark, a
+// visit and your own last commit to it.
+func lastRead(state *State, key string, committed time.Time) time.Time {
+	t := committed
+	if r := state.Read[key]; r.After(t) {
+		t = r
+	}
+	if v := state.Visits[key]; v != nil && len(v.Times) > 0 && v.Times[len(v.Times)-1].After(t) {
+		t = v.Times[len(v.Times)-1]
+	}
+	return t
+}
+
+// markRead records the notes, keyed like visits, as read now.
+func markRead(config *CONFIG, keys []string) error {
+	now := currentTime()
+	return updateState(config, func(s *State) error {
+		if s.Read == nil {
+			s.Read = map[string]time.Time{}
+		}
+		for _, key := range keys {
+			s.Read[key] = now
+		}
+		return nil
+	})
+}
+
+// othersChanges walks the history of the notes in notesDir over revs, such
+// as HEAD or old..new, and returns, per note that still exists, the latest
+// change by someone else and the time of your own latest commit. You are the
+// repository's user.email, or user.name where no email is set.
+func othersChanges(root, notesDir, revs string) (map[string]othersChange, map[string]time.Time, error) {
+	me, field := "", 2
+	if out, err := gitOutput(root, "config", "user.email"); err == nil {
+		me = strings.TrimSpace(out)
+	}
+	if me == "" {
+		if out, err := gitOutput(root, "config", "user.name"); err == nil {
+			me, field = strings.TrimSpace(out), 1
+		}
+	}
+	abs, err := filepath.Abs(notesDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := gitOutput(root, "log", "--no-renames", "--name-status", "--format=%x00%at%x09%an%x09%ae", revs, "--", abs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := map[string]othersChange{}
+	mine := map[string]time.Time{}
+	for _, entry := range strings.Split(out, "\x00")[1:] {
+		lines := strings.Split(entry, "\n")
+		header := strings.Split(lines[0], "\t")
+		if len(header) < 3 {
+			continue
+		}
+		sec, _ := strconv.ParseInt(header[0], 10, 64)
+		when := time.Unix(sec, 0)
+		ours := me != "" && strings.EqualFold(header[field], me)
+		for _, line := range lines[1:] {
+			status, file, ok := strings.Cut(line, "\t")
+			if !ok || !strings.HasSuffix(file, ".md") {
+				continue
+			}
+			path := filepath.Join(root, filepath.FromSlash(file))
+			rel, err := filepath.Rel(abs, path)
+			if err != nil || !filepath.IsLocal(rel) || !fileExists(path) {
+				continue
+			}
+			key := filepath.ToSlash(rel)
+			// The log is newest first, so the first commit seen is the latest
+			if ours {
+				if _, seen := mine[key]; !seen {
+					mine[key] = when
+				}
+			} else if _, seen := changes[key]; !seen {
+				changes[key] = othersChange{when: when, author: header[1], added: status == "A"}
+			}
+		}
+	}
+	return changes, mine, nil
+}
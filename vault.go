@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vaultPair is a note matched across two vaults; either side may be missing.
+type vaultPair struct {
+	Ours, Theirs *Note
+	How          string // "path", "id" or "title"
+}
+
+func (p vaultPair) status() string {
+	switch {
+	case p.Ours == nil:
+		return "added"
+	case p.Theirs == nil:
+		return "only here"
+	case !sameContent(p.Ours.Path, p.Theirs.Path):
+		return "changed"
+	case p.How != "path":
+		return "moved"
+	}
+	return "same"
+}
+
+// runVault compares this vault with another notes directory, or merges the
+// other one in. With VAULT_CONTAINER it also sets up, unlocks and locks the
+// encrypted container (see vaultcrypt.go).
+func runVault(config *CONFIG, args []string) error {
+	if len(args) > 0 && (args[0] == "init" || args[0] == "unlock" || args[0] == "lock" || args[0] == "status") {
+		return runVaultCrypt(config, args[0], args[1:])
+	}
+	if len(args) == 0 || (args[0] != "diff" && args[0] != "merge") {
+		return fmt.Errorf("usage: syt vault diff [-p] <dir> | syt vault merge [--prefer newer|ours|theirs] [--dry-run] <dir> | syt vault init [dir] | syt vault unlock | syt vault lock | syt vault status")
+	}
+	fs := flag.NewFlagSet("vault "+args[0], flag.ContinueOnError)
+	patch := fs.Bool("p", false, "show the content differences")
+	prefer := fs.String("prefer", "newer", "for changed notes keep the newer, ours or theirs")
+	dryRun := fs.Bool("dry-run", false, "show what merging would do")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: syt vault %s <dir>", args[0])
+	}
+	other := fs.Arg(0)
+	if info, err := os.Stat(other); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", other)
+	}
+	ours, err := scanNotes(config.NotesDir)
+	if err != nil {
+		return err
+	}
+	theirs, err := scanNotes(other)
+	if err != nil {
+		return err
+	}
+	pairs := matchVaults(config.NotesDir, ours, other, theirs)
+
+	if args[0] == "diff" {
+		printVaultDiff(config, other, pairs, *patch)
+		return nil
+	}
+	if *prefer != "newer" && *prefer != "ours" && *prefer != "theirs" {
+		return fmt.Errorf("unknown --prefer %q (want newer, ours or theirs)", *prefer)
+	}
+	return mergeVault(config, other, pairs, *prefer, *dryRun)
+}
+
+// matchVaults pairs notes by relative path first, then by frontmatter id,
+// then by title where the title is unique on both sides.
+func matchVaults(ourDir string, ours []*Note, theirDir string, theirs []*Note) []vaultPair {
+	var pairs []vaultPair
+	taken := map[*Note]bool{}
+	theirByPath := map[string]*Note{}
+	for _, n := range theirs {
+		theirByPath[relNotePath(theirDir, n.Path)] = n
+	}
+	var unmatched []*Note
+	for _, n := range ours {
+		if t := theirByPath[relNotePath(ourDir, n.Path)]; t != nil {
+			pairs = append(pairs, vaultPair{Ours: n, Theirs: t, How: "path"})
+			taken[t] = true
+		} else {
+			unmatched = append(unmatched, n)
+		}
+	}
+
+	keys := []struct {
+		how string
+		key func(*Note) string
+	}{
+		{"id", func(n *Note) string { return n.Meta["id"] }},
+		{"title", func(n *Note) string { return foldText(n.Title) }},
+	}
+	for _, k := range keys {
+		ourCount, theirCount := map[string]int{}, map[string]int{}
+		byKey := map[string]*Note{}
+		for _, n := range theirs {
+			if key := k.key(n); key != "" && !taken[n] {
+				theirCount[key]++
+				byKey[key] = n
+			}
+		}
+		for _, n := range unmatched {
+			ourCount[k.key(n)]++
+		}
+		var rest []*Note
+		for _, n := range unmatched {
+			key := k.key(n)
+			if key != "" && ourCount[key] == 1 && theirCount[key] == 1 {
+				pairs = append(pairs, vaultPair{Ours: n, Theirs: byKey[key], How: k.how})
+				taken[byKey[key]] = true
+			} else {
+				rest = append(rest, n)
+			}
+		}
+		unmatched = rest
+	}
+
+	for _, n := range unmatched {
+		pairs = append(pairs, vaultPair{Ours: n})
+	}
+	for _, t := range theirs {
+		if !taken[t] {
+			pairs = append(pairs, vaultPair{Theirs: t})
+		}
+	}
+	return pairs
+}
+
+func relNotePath(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+func sameContent(a, b string) bool {
+	da, errA := os.ReadFile(a)
+	db, errB := os.ReadFile(b)
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+func printVaultDiff(config *CONFIG, other string, pairs []vaultPair, patch bool) {
+	counts := map[string]int{}
+	for _, p := range pairs {
+		status := p.status()
+		counts[status]++
+		switch status {
+		case "added":
+			fmt.Printf("+ %s\n", relNotePath(other, p.Theirs.Path))
+		case "only here":
+			fmt.Printf("- %s\n", visitKey(config, p.Ours.Path))
+		case "moved":
+			fmt.Printf("R %s -> %s (same %s)\n", visitKey(config, p.Ours.Path), relNotePath(other, p.Theirs.Path), p.How)
+		case "changed":
+			name := visitKey(config, p.Ours.Path)
+			if theirs := relNotePath(other, p.Theirs.Path); theirs != name {
+				name += " -> " + theirs
+			}
+			fmt.Printf("M %s\n", name)
+			if patch {
+				a, _ := os.ReadFile(p.Ours.Path)
+				b, _ := os.ReadFile(p.Theirs.Path)
+				fmt.Print(unifiedDiff(string(a), string(b), "ours/"+visitKey(config, p.Ours.Path), "theirs/"+relNotePath(other, p.Theirs.Path)))
+			}
+		}
+	}
+	fmt.Printf("%d same, %d changed, %d moved, %d only in %s, %d only here\n",
+		counts["same"], counts["changed"], counts["moved"], counts["added"], other, counts["only here"])
+}
+
+// mergeVault brings the other vault's notes in: new ones are copied to the
+// same relative path (or next to it if that is taken), changed ones are
+// resolved by prefer. Nothing here is ever deleted, and the whole merge is
+// one undoable operation.
+func mergeVault(config *CONFIG, other string, pairs []vaultPair, prefer string, dryRun bool) error {
+	type copyPlan struct{ from, to, why string }
+	var plan []copyPlan
+	for _, p := range pairs {
+		switch p.status() {
+		case "added":
+			to := filepath.Join(config.NotesDir, filepath.FromSlash(relNotePath(other, p.Theirs.Path)))
+			if fileExists(to) {
+				to = strings.TrimSuffix(to, ".md") + "_" + newID() + ".md"
+			}
+			plan = append(plan, copyPlan{p.Theirs.Path, to, "new"})
+		case "changed":
+			take := prefer == "theirs" || (prefer == "newer" && p.Theirs.ModTime.After(p.Ours.ModTime))
+			if take {
+				plan = append(plan, copyPlan{p.Theirs.Path, p.Ours.Path, "theirs"})
+			}
+		}
+	}
+	if len(plan) == 0 {
+		fmt.Println("Nothing to merge.")
+		return nil
+	}
+	for _, c := range plan {
+		fmt.Printf("%-6s  %s\n", c.why, visitKey(config, c.to))
+	}
+	if dryRun {
+		return nil
+	}
+	if err := confirm(config, "Merge "+other, len(plan)); err != nil {
+		return err
+	}
+
+	op := beginOperation(config, "vault merge "+other)
+	for _, c := range plan {
+		if err := mergeCopy(op, c.from, c.to); err != nil {
+			// The notes merged already can still be undone
+			if cerr := op.commit(); cerr != nil {
+				return fmt.Errorf("%w; recording the undo failed: %v", err, cerr)
+			}
+			return err
+		}
+	}
+	if err := op.commit(); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d note(s) from %s.\n", len(plan), other)
+	return nil
+}
+
+// mergeCopy copies one note of the other vault over to as part of op.
+func mergeCopy(op *Operation, from, to string) error {
+	if err := op.saveBefore(to); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(to, data)
+}
+
+// unifiedDiff renders the line differences between a and b as a unified
+// diff with three lines of context.
+func unifiedDiff(a, b, nameA, nameB string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	n, m := len(x), len(y)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	type line struct {
+		op   byte
+		text string
+		i, j int // position in x and y before this line
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i], i, j})
+			i, j = i+1, j+1
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', x[i], i, j})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		start := max(0, k-context)
+		end := k
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			gap := end
+			for gap < len(lines) && lines[gap].op == ' ' {
+				gap++
+			}
+			if gap == len(lines) || gap-end > 2*context {
+				end = min(len(lines), end+context)
+				break
+			}
+			end = gap
+		}
+		oldLen, newLen := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				oldLen++
+			}
+			if l.op != '-' {
+				newLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", lines[start].i+1, oldLen, lines[start].j+1, newLen)
+		for _, l := range lines[start:end] {
+			out.WriteString(string(l.op) + l.text + "\n")
+		}
+		k = end
+	}
+	return out.String()
+}
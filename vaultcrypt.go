@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// With VAULT_CONTAINER set the whole vault is kept encrypted on disk, in the
+// manner of gocryptfs: every file, git history included, is sealed on its
+// own with AES-256-GCM under a name derived from its path, so the container
+// gives away neither contents nor names. `syt vault unlock` decrypts it into
+// VAULT_MOUNT, a directory in memory-backed $XDG_RUNTIME_DIR by default,
+// and NOTES_DIR points there; after each command syt seals whatever changed
+// back into the container. `syt vault lock` seals and wipes the working
+// copy. The master key is random and stored wrapped by a key derived from
+// the passphrase, which is asked for or printed by VAULT_PASSPHRASE_COMMAND;
+// `syt keys rotate` replaces both.
+
+const (
+	// vaultKDFIterations is the PBKDF2-SHA256 cost for new containers
+	vaultKDFIterations = 600000
+	// vaultSessionName holds the key and what was last sealed while the
+	// vault is unlocked; it lives in the state directory and is never sealed
+	vaultSessionName = "vault-session.json"
+)
+
+// vaultHeader is vault.json in the container.
+type vaultHeader struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	// Key is the master key sealed with the passphrase key
+	Key string `json:"key"`
+}
+
+// vaultSession is what an unlocked vault keeps in its working copy.
+type vaultSession struct {
+	Key    string                  `json:"key"`
+	Sealed map[string]*sealedEntry `json:"sealed"`
+}
+
+// sealedEntry is a file as it was when last sealed. Directories are sealed
+// too, as git needs its empty ones.
+type sealedEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Dir     bool      `json:"dir,omitempty"`
+}
+
+// vaultKeys are the keys derived from the master key.
+type vaultKeys struct {
+	content cipher.AEAD
+	names   []byte
+}
+
+// vaultMount is where an unlocked vault's files are, VAULT_MOUNT or a
+// directory under $XDG_RUNTIME_DIR (or the temporary directory) named after
+// the container.
+func vaultMount(container string) string {
+	base, rel := vaultMountBase(container)
+	return filepath.Join(base, rel)
+}
+
+// vaultMountBase splits vaultMount into a directory that is there already
+// and the part of the path syt creates under it.
+func vaultMountBase(container string) (base, rel string) {
+	if mount := configValue("VAULT_MOUNT"); mount != "" {
+		mount = filepath.Clean(expandHome(mount))
+		return filepath.Dir(mount), filepath.Base(mount)
+	}
+	name := filepath.Join("syt-vault", filepath.Base(filepath.Clean(container)))
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir, name
+	}
+	return os.TempDir(), filepath.Join(fmt.Sprintf("syt-%d", os.Getuid()), name)
+}
+
+// makeVaultMount creates the working copy's directory and any it sits in
+// below the existing base, each private. One that is there already must be
+// a real directory of this user's that no one else can get into: in a
+// shared /tmp anyone could have made it first.
+func makeVaultMount(config *CONFIG) error {
+	base, rel := vaultMountBase(config.VaultContainer)
+	if os.Getenv("XDG_RUNTIME_DIR") == "" && configValue("VAULT_MOUNT") == "" {
+		fmt.Fprintf(os.Stderr, "%s may be on disk; set VAULT_MOUNT to a directory on tmpfs to keep the plain text in memory.\n", base)
+	}
+	dir := base
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		info, err := os.Lstat(dir)
+		if err != nil {
+			return err
+		}
+		// Only the owner may chmod, so leaving the mode as it is tells
+		// whether the directory is ours
+		if !info.IsDir() || info.Mode().Perm()&0077 != 0 || os.Chmod(dir, info.Mode().Perm()) != nil {
+			return codeErrorf(ErrConfigInvalid, "refusing to unlock the vault into %s: it isn't a private directory of yours", dir)
+		}
+	}
+	return nil
+}
+
+// notesDir is NOTES_DIR, or the working copy of an encrypted vault.
+func notesDir() string {
+	if container := configValue("VAULT_CONTAINER"); container != "" {
+		return vaultMount(expandHome(container))
+	}
+	return getEnv("NOTES_DIR", "./notes")
+}
+
+func vaultSessionPath(config *CONFIG) string {
+	return filepath.Join(stateDir(config), vaultSessionName)
+}
+
+// vaultUnlocked reports whether the encrypted vault has a working copy.
+func vaultUnlocked(config *CONFIG) bool {
+	return fileExists(vaultSessionPath(config))
+}
+
+// runVaultCrypt is `syt vault init|unlock|lock|status`.
+func runVaultCrypt(config *CONFIG, sub string, args []string) error {
+	if config.VaultContainer == "" {
+		return codeErrorf(ErrConfigInvalid, "set VAULT_CONTAINER to the directory the encrypted vault is kept in")
+	}
+	switch sub {
+	case "init":
+		if len(args) > 1 {
+			return fmt.Errorf("usage: syt vault init [dir to import]")
+		}
+		return initVaultContainer(config, args)
+	case "unlock":
+		return unlockVault(config)
+	case "lock":
+		return lockVault(config)
+	default:
+		return vaultStatus(config)
+	}
+}
+
+func initVaultContainer(config *CONFIG, args []string) error {
+	headerPath := filepath.Join(config.VaultContainer, "vault.json")
+	if fileExists(headerPath) {
+		return fmt.Errorf("%s already holds a vault", config.VaultContainer)
+	}
+	if err := makeVaultMount(config); err != nil {
+		return err
+	}
+	pass, err := vaultPassphrase(config, true)
+	if err != nil {
+		return err
+	}
+	header, master, err := newVaultKey(pass)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(config.VaultContainer, "files"), 0700); err != nil {
+		return err
+	}
+	if err := writeVaultHeader(config, header); err != nil {
+		return err
+	}
+	fmt.Printf("Created an encrypted vault in %s.\n", config.VaultContainer)
+
+	if err := startVaultSession(config, master); err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		n, err := copyTree(args[0], config.NotesDir)
+		if err != nil {
+			return err
+		}
+		if err := sealVault(config); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d file(s) from %s. Delete the plain copy there once you have checked the vault.\n", n, args[0])
+	}
+	fmt.Printf("Unlocked at %s.\n", config.NotesDir)
+	return nil
+}
+
+// newVaultKey makes a master key and the header keeping it sealed with the
+// key derived from pass.
+func newVaultKey(pass string) (*vaultHeader, []byte, error) {
+	master := make([]byte, 32)
+	salt := make([]byte, 16)
+	rand.Read(master)
+	rand.Read(salt)
+	header := &vaultHeader{Version: 1, KDF: "pbkdf2-sha256", Iterations: vaultKDFIterations, Salt: base64.StdEncoding.EncodeToString(salt)}
+	kek, err := passphraseKey(header, pass)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, kek.NonceSize())
+	rand.Read(nonce)
+	header.Key = base64.StdEncoding.EncodeToString(kek.Seal(nonce, nonce, master, []byte("syt vault key")))
+	return header, master, nil
+}
+
+func passphraseKey(header *vaultHeader, pass string) (cipher.AEAD, error) {
+	if header.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("the vault uses %s, which this syt doesn't know", header.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(header.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt vault header: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, pass, salt, header.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func readVaultHeader(config *CONFIG) (*vaultHeader, error) {
+	data, err := os.ReadFile(filepath.Join(config.VaultContainer, "vault.json"))
+	if os.IsNotExist(err) {
+		return nil, codeErrorf(ErrConfigInvalid, "no vault in %s; run syt vault init", config.VaultContainer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := &vaultHeader{}
+	if err := json.Unmarshal(data, header); err != nil {
+		return nil, fmt.Errorf("corrupt vault header: %w", err)
+	}
+	return header, nil
+}
+
+func writeVaultHeader(config *CONFIG, header *vaultHeader) error {
+	data, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(config.VaultContainer, "vault.json"), data)
+}
+
+// openVaultKey unwraps the master key with the passphrase.
+func openVaultKey(config *CONFIG) ([]byte, error) {
+	header, err := readVaultHeader(config)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := vaultPassphrase(config, false)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := passphraseKey(header, pass)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(header.Key)
+	if err != nil || len(wrapped) < kek.NonceSize() {
+		return nil, fmt.Errorf("corrupt vault header")
+	}
+	master, err := kek.Open(nil, wrapped[:kek.NonceSize()], wrapped[kek.NonceSize():], []byte("syt vault key"))
+	if err != nil {
+		return nil, withCode(ErrAborted, errors.New("wrong passphrase"))
+	}
+	return master, nil
+}
+
+// vaultPassphrase runs VAULT_PASSPHRASE_COMMAND, or asks on the terminal
+// without echoing, twice when confirm is set.
+func vaultPassphrase(config *CONFIG, confirm bool) (string, error) {
+	if config.VaultPassCommand != "" {
+		fields := strings.Fields(config.VaultPassCommand)
+		out, err := exec.Command(fields[0], fields[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("VAULT_PASSPHRASE_COMMAND: %w", err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	if !isTerminal(os.Stdin) {
+		return "", codeErrorf(ErrAborted, "the vault passphrase is needed; set VAULT_PASSPHRASE_COMMAND to run without a terminal")
+	}
+	pass, err := readSecret("Vault passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", withCode(ErrAborted, errors.New(tr("aborted")))
+	}
+	if confirm {
+		again, err := readSecret("Again: ")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", codeErrorf(ErrAborted, "the passphrases don't match")
+		}
+	}
+	return pass, nil
+}
+
+// readSecret reads a line from the terminal with echo off.
+func readSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if _, err := stty("-echo"); err == nil {
+		defer stty("echo")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Println()
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// deriveVaultKeys derives the content and name keys from the master key.
+func deriveVaultKeys(master []byte) (*vaultKeys, error) {
+	contentKey, err := hkdf.Key(sha256.New, master, nil, "syt vault content", 32)
+	if err != nil {
+		return nil, err
+	}
+	names, err := hkdf.Key(sha256.New, master, nil, "syt vault names", 32)
+	if err != nil {
+		return nil, err
+	}
+	content, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultKeys{content: content, names: names}, nil
+}
+
+// sealedName is the name a file at rel has in the container.
+func (k *vaultKeys) sealedName(rel string) string {
+	mac := hmac.New(sha256.New, k.names)
+	mac.Write([]byte(rel))
+	return hex.EncodeToString(mac.Sum(nil))[:40]
+}
+
+// sealFile encrypts a file with its path, mode and modification time, which
+// the name is bound to, so files can't be swapped around in the container.
+func (k *vaultKeys) sealFile(rel string, mode fs.FileMode, mtime time.Time, data []byte) []byte {
+	plain := make([]byte, 0, 14+len(rel)+len(data))
+	plain = binary.BigEndian.AppendUint32(plain, uint32(mode&(fs.ModeDir|fs.ModePerm)))
+	plain = binary.BigEndian.AppendUint64(plain, uint64(mtime.UnixNano()))
+	plain = binary.BigEndian.AppendUint16(plain, uint16(len(rel)))
+	plain = append(plain, rel...)
+	plain = append(plain, data...)
+	nonce := make([]byte, k.content.NonceSize())
+	rand.Read(nonce)
+	return k.content.Seal(nonce, nonce, plain, []byte(k.sealedName(rel)))
+}
+
+// openFile decrypts a file from the container named name.
+func (k *vaultKeys) openFile(name string, sealed []byte) (rel string, mode fs.FileMode, mtime time.Time, data []byte, err error) {
+	n := k.content.NonceSize()
+	if len(sealed) < n {
+		return "", 0, time.Time{}, nil, fmt.Errorf("%s is damaged", name)
+	}
+	plain, err := k.content.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil || len(plain) < 14 {
+		return "", 0, time.Time{}, nil, fmt.Errorf("%s is damaged or not from this vault", name)
+	}
+	mode = fs.FileMode(binary.BigEndian.Uint32(plain))
+	mtime = time.Unix(0, int64(binary.BigEndian.Uint64(plain[4:])))
+	size := int(binary.BigEndian.Uint16(plain[12:]))
+	if len(plain) < 14+size {
+		return "", 0, time.Time{}, nil, fmt.Errorf("%s is damaged", name)
+	}
+	return string(plain[14 : 14+size]), mode, mtime, plain[14+size:], nil
+}
+
+// startVaultSession makes the working copy and records the key in it.
+func startVaultSession(config *CONFIG, master []byte) error {
+	if err := os.MkdirAll(stateDir(config), 0700); err != nil {
+		return err
+	}
+	return saveVaultSession(config, &vaultSession{Key: base64.StdEncoding.EncodeToString(master), Sealed: map[string]*sealedEntry{}})
+}
+
+func loadVaultSession(config *CONFIG) (*vaultSession, *vaultKeys, error) {
+	data, err := os.ReadFile(vaultSessionPath(config))
+	if os.IsNotExist(err) {
+		return nil, nil, codeErrorf(ErrConfigInvalid, "the vault is locked; run syt vault unlock")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	session := &vaultSession{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, nil, fmt.Errorf("corrupt vault session: %w", err)
+	}
+	master, err := base64.StdEncoding.DecodeString(session.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("corrupt vault session: %w", err)
+	}
+	keys, err := deriveVaultKeys(master)
+	return session, keys, err
+}
+
+func saveVaultSession(config *CONFIG, session *vaultSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	tmp := vaultSessionPath(config) + ".new"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, vaultSessionPath(config))
+}
+
+func unlockVault(config *CONFIG) error {
+	if vaultUnlocked(config) {
+		fmt.Printf("The vault is already unlocked at %s.\n", config.NotesDir)
+		return nil
+	}
+	master, err := openVaultKey(config)
+	if err != nil {
+		return err
+	}
+	keys, err := deriveVaultKeys(master)
+	if err != nil {
+		return err
+	}
+	if err := makeVaultMount(config); err != nil {
+		return err
+	}
+	n, err := openVaultFiles(config, master, keys)
+	if err != nil {
+		// Leave no plain text from a container that didn't open cleanly
+		os.RemoveAll(config.NotesDir)
+		return err
+	}
+	fmt.Printf("Unlocked %d file(s) at %s.\n", n, config.NotesDir)
+	return nil
+}
+
+// openVaultFiles decrypts the container into the working copy and starts
+// the session.
+func openVaultFiles(config *CONFIG, master []byte, keys *vaultKeys) (int, error) {
+	session := &vaultSession{Key: base64.StdEncoding.EncodeToString(master), Sealed: map[string]*sealedEntry{}}
+	entries, err := os.ReadDir(filepath.Join(config.VaultContainer, "files"))
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		sealed, err := os.ReadFile(filepath.Join(config.VaultContainer, "files", e.Name()))
+		if err != nil {
+			return 0, err
+		}
+		rel, mode, mtime, data, err := keys.openFile(e.Name(), sealed)
+		if err != nil {
+			return 0, err
+		}
+		path := filepath.Join(config.NotesDir, filepath.FromSlash(rel))
+		if !strings.HasPrefix(path, filepath.Clean(config.NotesDir)+string(filepath.Separator)) {
+			return 0, fmt.Errorf("%s names a file outside the vault", e.Name())
+		}
+		if mode.IsDir() {
+			if err := os.MkdirAll(path, mode.Perm()); err != nil {
+				return 0, err
+			}
+			session.Sealed[rel] = &sealedEntry{ModTime: mtime, Dir: true}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(path, data, mode.Perm()); err != nil {
+			return 0, err
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return 0, err
+		}
+		sum := sha256.Sum256(data)
+		session.Sealed[rel] = &sealedEntry{Size: int64(len(data)), ModTime: mtime, SHA256: hex.EncodeToString(sum[:])}
+	}
+	if err := os.MkdirAll(stateDir(config), 0700); err != nil {
+		return 0, err
+	}
+	return len(entries), saveVaultSession(config, session)
+}
+
+// sealVault writes the files changed in the working copy since they were
+// last sealed into the container, and removes the ones deleted.
+func sealVault(config *CONFIG) error {
+	if err := os.MkdirAll(config.VaultContainer, 0700); err != nil {
+		return err
+	}
+	unlock, err := acquireLockWait(filepath.Join(config.VaultContainer, "vault.lock"), syncLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	session, keys, err := loadVaultSession(config)
+	if err != nil {
+		return err
+	}
+	var sealErr error
+	session.Sealed, sealErr = sealChanges(config, filepath.Join(config.VaultContainer, "files"), session.Sealed, keys)
+	if err := saveVaultSession(config, session); err != nil {
+		return err
+	}
+	return sealErr
+}
+
+// sealChanges is the body of sealVault, sealing into the directory files;
+// it returns the entries as they are once sealed, keeping those it couldn't
+// seal so they are tried again, and the last error.
+func sealChanges(config *CONFIG, files string, sealed map[string]*sealedEntry, keys *vaultKeys) (map[string]*sealedEntry, error) {
+	now := map[string]*sealedEntry{}
+	var failed error
+	filepath.WalkDir(config.NotesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == config.NotesDir {
+			return nil
+		}
+		if d.IsDir() {
+			rel := relNotePath(config.NotesDir, path)
+			if e := sealed[rel]; e != nil && e.Dir {
+				now[rel] = e
+			} else if info, err := d.Info(); err == nil {
+				if err := writeFileAtomic(filepath.Join(files, keys.sealedName(rel)), keys.sealFile(rel, info.Mode(), info.ModTime(), nil)); err != nil {
+					failed = err
+					return nil
+				}
+				now[rel] = &sealedEntry{ModTime: info.ModTime(), Dir: true}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		name := d.Name()
+		if path == vaultSessionPath(config) || strings.HasPrefix(name, vaultSessionName) || strings.HasSuffix(name, ".lock") {
+			return nil
+		}
+		rel := relNotePath(config.NotesDir, path)
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if e := sealed[rel]; e != nil && !e.Dir && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+			now[rel] = e
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			failed = err
+			return nil
+		}
+		sum := sha256.Sum256(data)
+		entry := &sealedEntry{Size: int64(len(data)), ModTime: info.ModTime(), SHA256: hex.EncodeToString(sum[:])}
+		if e := sealed[rel]; e == nil || e.SHA256 != entry.SHA256 {
+			if err := writeFileAtomic(filepath.Join(files, keys.sealedName(rel)), keys.sealFile(rel, info.Mode(), info.ModTime(), data)); err != nil {
+				failed = err
+				if e != nil {
+					now[rel] = e
+				}
+				return nil
+			}
+		}
+		now[rel] = entry
+		return nil
+	})
+	for rel, e := range sealed {
+		if now[rel] != nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(files, keys.sealedName(rel))); err != nil && !os.IsNotExist(err) {
+			failed, now[rel] = err, e
+		}
+	}
+	if failed != nil {
+		return now, fmt.Errorf("not everything could be sealed: %w", failed)
+	}
+	return now, nil
+}
+
+// rotateVaultKey seals the working copy into a new container under a new
+// master key and passphrase, then swaps it in for the old one.
+func rotateVaultKey(config *CONFIG) error {
+	if err := sealVault(config); err != nil {
+		return err
+	}
+	fmt.Println("Choose the vault's new passphrase.")
+	pass, err := vaultPassphrase(config, true)
+	if err != nil {
+		return err
+	}
+	unlock, err := acquireLockWait(filepath.Join(config.VaultContainer, "vault.lock"), syncLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	header, master, err := newVaultKey(pass)
+	if err != nil {
+		return err
+	}
+	keys, err := deriveVaultKeys(master)
+	if err != nil {
+		return err
+	}
+	files := filepath.Join(config.VaultContainer, "files")
+	os.RemoveAll(files + ".new")
+	if err := os.MkdirAll(files+".new", 0700); err != nil {
+		return err
+	}
+	sealed, err := sealChanges(config, files+".new", map[string]*sealedEntry{}, keys)
+	if err != nil {
+		os.RemoveAll(files + ".new")
+		return fmt.Errorf("the vault keeps its old key: %w", err)
+	}
+	data, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return err
+	}
+	headerPath := filepath.Join(config.VaultContainer, "vault.json")
+	if err := writeFileAtomic(headerPath+".new", data); err != nil {
+		return err
+	}
+	// Should this stop part way, files.old and vault.json.new hold the rest
+	if err := os.Rename(files, files+".old"); err != nil {
+		return err
+	}
+	if err := os.Rename(files+".new", files); err != nil {
+		return err
+	}
+	if err := os.Rename(headerPath+".new", headerPath); err != nil {
+		return err
+	}
+	os.RemoveAll(files + ".old")
+	if err := saveVaultSession(config, &vaultSession{Key: base64.StdEncoding.EncodeToString(master), Sealed: sealed}); err != nil {
+		return err
+	}
+	fmt.Printf("The vault has a new key; %d file(s) sealed again.\n", len(sealed))
+	return nil
+}
+
+// vaultSealInterval is how often long-running commands, the daemon and
+// `syt serve`, seal an encrypted vault's working copy.
+const vaultSealInterval = time.Minute
+
+// sealPeriodically seals the working copy every vaultSealInterval.
+func sealPeriodically(config *CONFIG) {
+	for ; ; time.Sleep(vaultSealInterval) {
+		if vaultUnlocked(config) {
+			if err := sealVault(config); err != nil {
+				log.Printf("Could not seal the vault: %v", err)
+			}
+		}
+	}
+}
+
+func lockVault(config *CONFIG) error {
+	if !vaultUnlocked(config) {
+		fmt.Println("The vault is locked.")
+		return nil
+	}
+	if err := sealVault(config); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(config.NotesDir); err != nil {
+		return err
+	}
+	fmt.Println("Sealed and locked the vault.")
+	return nil
+}
+
+func vaultStatus(config *CONFIG) error {
+	entries, err := os.ReadDir(filepath.Join(config.VaultContainer, "files"))
+	if err != nil {
+		return codeErrorf(ErrConfigInvalid, "no vault in %s; run syt vault init", config.VaultContainer)
+	}
+	if !vaultUnlocked(config) {
+		fmt.Printf("Locked: %d sealed file(s) in %s.\n", len(entries), config.VaultContainer)
+		return nil
+	}
+	fmt.Printf("Unlocked at %s: %d sealed file(s) in %s.\n", config.NotesDir, len(entries), config.VaultContainer)
+	return nil
+}
+
+// copyTree copies the regular files under src into dst.
+func copyTree(src, dst string) (int, error) {
+	n := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if _, err := copyVerified(path, filepath.Join(dst, relNotePath(src, path)), info.ModTime()); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testVaultKeys(t *testing.T) *vaultKeys {
+	t.Helper()
+	master := make([]byte, 32)
+	rand.Read(master)
+	keys, err := deriveVaultKeys(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestVaultSealFile(t *testing.T) {
+	keys := testVaultKeys(t)
+	mtime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	sealed := keys.sealFile("journal/2024-05-01.md", 0640, mtime, []byte("secret plans"))
+	if bytes.Contains(sealed, []byte("secret")) || bytes.Contains(sealed, []byte("journal")) {
+		t.Fatal("sealed file holds plain text")
+	}
+
+	rel, mode, gotTime, data, err := keys.openFile(keys.sealedName("journal/2024-05-01.md"), sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel != "journal/2024-05-01.md" || mode != 0640 || !gotTime.Equal(mtime) || string(data) != "secret plans" {
+		t.Errorf("opened %q %v %v %q", rel, mode, gotTime, data)
+	}
+
+	dir := keys.sealFile("journal", fs.ModeDir|0700, mtime, nil)
+	if _, mode, _, _, err := keys.openFile(keys.sealedName("journal"), dir); err != nil || !mode.IsDir() {
+		t.Errorf("directory opened as %v, %v", mode, err)
+	}
+}
+
+func TestVaultOpenFileRejects(t *testing.T) {
+	keys := testVaultKeys(t)
+	name := keys.sealedName("a.md")
+	sealed := keys.sealFile("a.md", 0600, time.Now(), []byte("text"))
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name   string
+		keys   *vaultKeys
+		file   string
+		sealed []byte
+	}{
+		{"swapped for another file", keys, keys.sealedName("b.md"), sealed},
+		{"tampered with", keys, name, tampered},
+		{"truncated", keys, name, sealed[:8]},
+		{"from another vault", testVaultKeys(t), name, sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, _, err := tt.keys.openFile(tt.file, tt.sealed); err == nil {
+				t.Error("opened")
+			}
+		})
+	}
+}
+
+func TestVaultLockUnlock(t *testing.T) {
+	dir := t.TempDir()
+	mount := filepath.Join(dir, "mnt")
+	t.Setenv("VAULT_MOUNT", mount)
+	config := &CONFIG{NotesDir: mount, VaultContainer: filepath.Join(dir, "box"), VaultPassCommand: "echo pw"}
+	if err := initVaultContainer(config, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(mount, "journal", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mount, "journal", "today.md"), []byte("secret plans\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockVault(config); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(mount) {
+		t.Fatal("the working copy is still there after locking")
+	}
+	filepath.WalkDir(config.VaultContainer, func(path string, d fs.DirEntry, err error) error {
+		if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("secret")) || bytes.Contains([]byte(path), []byte("today")) {
+			t.Errorf("%s gives the note away", path)
+		}
+		return nil
+	})
+
+	config.VaultPassCommand = "echo wrong"
+	if err := unlockVault(config); err == nil || errorCode(err) != ErrAborted {
+		t.Fatalf("unlocked with the wrong passphrase: %v", err)
+	}
+	if fileExists(mount) {
+		t.Error("a failed unlock left a working copy")
+	}
+
+	config.VaultPassCommand = "echo pw"
+	if err := unlockVault(config); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(mount, "journal", "today.md")); err != nil || string(data) != "secret plans\n" {
+		t.Errorf("unlocked note holds %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(mount, "journal", "empty")); err != nil || !info.IsDir() {
+		t.Errorf("empty directory didn't come back: %v", err)
+	}
+}
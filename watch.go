@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// noteStamp is what the watcher compares to tell a note changed.
+type noteStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchNotes syncs notes edited outside syt, in another editor or by a
+// script, to the enabled backends. It compares the daemon's index after every
+// refresh, and syncs a note once it has gone debounce without changing, so a
+// burst of saves makes one commit. Notes a running syt has open are left to
+// it. Deleted notes aren't synced.
+func watchNotes(config *CONFIG, idx *noteIndex, debounce time.Duration) {
+	seen := noteStamps(idx)
+	dirty := map[string]time.Time{}
+	for range time.Tick(indexRefresh) {
+		now := currentTime()
+		current := noteStamps(idx)
+		for path, stamp := range current {
+			if seen[path] != stamp {
+				dirty[path] = now
+			}
+		}
+		seen = current
+
+		for path, changed := range dirty {
+			if _, ok := current[path]; !ok {
+				delete(dirty, path)
+				continue
+			}
+			if now.Sub(changed) < debounce || editedElsewhere(config, path) {
+				continue
+			}
+			delete(dirty, path)
+			syncWatched(config, path)
+		}
+	}
+}
+
+func noteStamps(idx *noteIndex) map[string]noteStamp {
+	stamps := map[string]noteStamp{}
+	for _, note := range idx.view().notes {
+		stamps[note.Path] = noteStamp{note.ModTime, note.Size}
+	}
+	return stamps
+}
+
+// editedElsewhere reports whether another syt process has path open for
+// editing and will sync it itself.
+func editedElsewhere(config *CONFIG, path string) bool {
+	state, err := loadState(config)
+	if err != nil {
+		return false
+	}
+	p := state.Pending[visitKey(config, path)]
+	if p == nil || p.PID == os.Getpid() {
+		return false
+	}
+	alive, known := processAlive(p.PID)
+	return known && alive
+}
+
+// syncWatched syncs one changed note. It holds runMu because syncing
+// prints, and client commands capture stdout while they run.
+func syncWatched(config *CONFIG, path string) {
+	runMu.Lock()
+	defer runMu.Unlock()
+	startRun()
+	note, err := readNote(path)
+	if err != nil {
+		log.Printf("daemon: reading %s: %v", path, err)
+		return
+	}
+	var t NoteType
+	if note.Meta["type"] != "" {
+		t, _ = lookupType(note.Meta["type"])
+	}
+	if err := syncTracked(config, syncBackends(config), t, path); err != nil {
+		log.Printf("daemon: syncing %s: %v", path, err)
+		return
+	}
+	log.Printf("daemon: synced %s", relNotePath(config.NotesDir, path))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const weatherCacheTTL = time.Hour
+
+// weatherCache maps a "lat,lon" location to the last stamp fetched for it.
+type weatherCache map[string]weatherEntry
+
+type weatherEntry struct {
+	Stamp   string    `json:"stamp"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// weatherStamp returns a short description of the current weather at loc,
+// e.g. "14.2°C, partly cloudy". Results are cached for an hour; when the
+// provider can't be reached a stale cached stamp is used so offline note
+// creation still gets one.
+func weatherStamp(config *CONFIG, loc string) (string, error) {
+	cachePath := filepath.Join(stateDir(config), "weather.json")
+	cache := weatherCache{}
+	if data, err := os.ReadFile(cachePath); err == nil {
+		_ = json.Unmarshal(data, &cache)
+	}
+
+	cached, ok := cache[loc]
+	if ok && time.Since(cached.Fetched) < weatherCacheTTL {
+		return cached.Stamp, nil
+	}
+
+	stamp, err := fetchWeather(config.WeatherURL, loc)
+	if err != nil {
+		if ok {
+			return cached.Stamp, nil
+		}
+		return "", err
+	}
+
+	cache[loc] = weatherEntry{Stamp: stamp, Fetched: time.Now()}
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		if err := os.MkdirAll(stateDir(config), 0755); err == nil {
+			_ = os.WriteFile(cachePath, data, 0644)
+		}
+	}
+	return stamp, nil
+}
+
+// fetchWeather queries an Open-Meteo compatible forecast endpoint.
+func fetchWeather(baseURL, loc string) (string, error) {
+	l, err := parseLocation(loc)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("latitude", fmt.Sprint(l.Lat))
+	q.Set("longitude", fmt.Sprint(l.Lon))
+	q.Set("current", "temperature_2m,weather_code")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(baseURL + "?" + q.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("weather provider returned %s", resp.Status)
+	}
+
+	var body struct {
+		Current struct {
+			Temperature float64 `json:"temperature_2m"`
+			WeatherCode int     `json:"weather_code"`
+		} `json:"current"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding weather response: %w", err)
+	}
+	return fmt.Sprintf("%.1f°C, %s", body.Current.Temperature, weatherDescription(body.Current.WeatherCode)), nil
+}
+
+// weatherDescription translates a WMO weather interpretation code.
+func weatherDescription(code int) string {
+	switch {
+	case code == 0:
+		return "clear sky"
+	case code <= 2:
+		return "partly cloudy"
+	case code == 3:
+		return "overcast"
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 57:
+		return "drizzle"
+	case code >= 61 && code <= 67:
+		return "rain"
+	case code >= 71 && code <= 77:
+		return "snow"
+	case code >= 80 && code <= 82:
+		return "rain showers"
+	case code == 85 || code == 86:
+		return "snow showers"
+	case code >= 95:
+		return "thunderstorm"
+	}
+	return "unknown"
+}